@@ -0,0 +1,63 @@
+package bzkaf
+
+import (
+	"fmt"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// FTPDeliveryRecord is published by ftp-engine for every file written to a third-party FTP destination
+type FTPDeliveryRecord struct {
+	NodeID          int64
+	EventID         int64
+	EventType       string
+	ConsumerGroupID string
+	ProcessorType   string
+	FTPHost         string
+	FTPUsername     string
+	FTPPath         string
+	RemotePath      string
+	Filename        string
+	SHA256Checksum  string
+	Timestamp       time.Time
+	SizeBytes       int
+	Attempts        int
+	// Latency is the time from the source message being received to the file being delivered
+	Latency time.Duration
+}
+
+// UnmarshalEnvelope decodes raw message bytes into an Envelope
+func UnmarshalEnvelope(data []byte) (*Envelope, error) {
+	var e Envelope
+	if err := jsoniter.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// FTPDeliveryRecord decodes the envelope message as an FTPDeliveryRecord,
+// an error is returned if the envelope is not of the FTPDelivery message type
+func (e *Envelope) FTPDeliveryRecord() (*FTPDeliveryRecord, error) {
+	if e.MessageType != FTPDelivery {
+		return nil, fmt.Errorf("bzkaf: envelope message type %q is not %q", e.MessageType, FTPDelivery)
+	}
+	var r FTPDeliveryRecord
+	if err := e.DecodeMessage(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// DecodeFTPDelivery decodes raw message bytes from the delivery topic into the envelope and its FTPDeliveryRecord
+func DecodeFTPDelivery(data []byte) (*Envelope, *FTPDeliveryRecord, error) {
+	e, err := UnmarshalEnvelope(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := e.FTPDeliveryRecord()
+	if err != nil {
+		return e, nil, err
+	}
+	return e, r, nil
+}
@@ -10,7 +10,9 @@ import (
 
 const (
 	ContentModelsEventMsgType MessageType = "content_models_event"
-	FTPDelivery               MessageType = "ftp_delivery"
+	// ContentModelsCompressedEventMsgType is a content_models_event with the LZ4MsgpackEncoding
+	ContentModelsCompressedEventMsgType MessageType = "content_models_event_lz4"
+	FTPDelivery                         MessageType = "ftp_delivery"
 )
 
 // MessageType ...
@@ -26,7 +28,13 @@ type Envelope struct {
 	Trace       opentracing.TextMapCarrier `json:"trace,omitempty"`
 	ID          string                     `json:"id"`
 	MessageType MessageType                `json:"message_type,omitempty"`
-	Message     json.RawMessage            `json:"message"`
+	// Version of the MessageType schema, unset is DefaultVersion
+	Version int `json:"version,omitempty"`
+	// Encoding of Message, unset is JSONEncoding
+	Encoding Encoding `json:"encoding,omitempty"`
+	// Signature is set by a Signer, unsigned envelopes omit it
+	Signature *Signature      `json:"signature,omitempty"`
+	Message   json.RawMessage `json:"message"`
 }
 
 // json.RawMessage is used because it allows us to delay unmarshaling
@@ -0,0 +1,264 @@
+package bzkaf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// DefaultVersion is assumed for envelopes produced before versioning was added
+const DefaultVersion = 1
+
+// Encoding indicates how the envelope Message payload is encoded
+type Encoding string
+
+const (
+	// JSONEncoding Message is the JSON payload, this is the default when Encoding is unset
+	JSONEncoding Encoding = "json"
+	// MsgpackEncoding Message is a base64 JSON string of the MessagePack payload
+	MsgpackEncoding Encoding = "msgpack"
+	// LZ4MsgpackEncoding Message is a base64 JSON string of the lz4 compressed MessagePack payload,
+	// as produced by models.Content.Compress
+	LZ4MsgpackEncoding Encoding = "lz4+msgpack"
+)
+
+// String ...
+func (e Encoding) String() string {
+	if e == "" {
+		return string(JSONEncoding)
+	}
+	return string(e)
+}
+
+// MsgMarshaler is implemented by types with msgp generated code
+type MsgMarshaler interface {
+	MarshalMsg(b []byte) ([]byte, error)
+}
+
+// MsgUnmarshaler is implemented by types with msgp generated code
+type MsgUnmarshaler interface {
+	UnmarshalMsg(bts []byte) ([]byte, error)
+}
+
+// Compressor is implemented by types that provide lz4 compressed MessagePack, ex. models.Content
+type Compressor interface {
+	Compress() ([]byte, error)
+}
+
+// Decompressor is implemented by types that decode lz4 compressed MessagePack, ex. models.Content
+type Decompressor interface {
+	Decompress(data []byte) error
+}
+
+// ErrUnsupportedEncoding is returned when the payload type does not support the envelope encoding
+var ErrUnsupportedEncoding = errors.New("bzkaf: payload type does not support encoding")
+
+// UnknownSchemaError is returned when no type is registered for an envelope message type and version
+type UnknownSchemaError struct {
+	MessageType MessageType
+	Version     int
+	// Versions registered for MessageType, empty if the message type is unknown
+	Versions []int
+}
+
+func (e *UnknownSchemaError) Error() string {
+	if len(e.Versions) == 0 {
+		return fmt.Sprintf("bzkaf: unknown message type %q", e.MessageType)
+	}
+	return fmt.Sprintf("bzkaf: unknown version %d of message type %q, registered versions %v", e.Version, e.MessageType, e.Versions)
+}
+
+type schemaKey struct {
+	messageType MessageType
+	version     int
+}
+
+// Registry maps MessageType and version to Go payload types
+type Registry struct {
+	sync.RWMutex
+	types map[schemaKey]reflect.Type
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{types: map[schemaKey]reflect.Type{}}
+}
+
+// DefaultRegistry is used by the package level Register, Encode and Decode
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	DefaultRegistry.Register(FTPDelivery, 1, FTPDeliveryRecord{})
+}
+
+// Register maps msgType and version to the type of v, v may be a value or pointer. Registering an
+// existing msgType and version replaces it.
+func (r *Registry) Register(msgType MessageType, version int, v interface{}) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	r.Lock()
+	r.types[schemaKey{msgType, version}] = t
+	r.Unlock()
+}
+
+func (r *Registry) lookup(msgType MessageType, version int) (reflect.Type, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	if t, ok := r.types[schemaKey{msgType, version}]; ok {
+		return t, nil
+	}
+
+	err := &UnknownSchemaError{MessageType: msgType, Version: version}
+	for k := range r.types {
+		if k.messageType == msgType {
+			err.Versions = append(err.Versions, k.version)
+		}
+	}
+	sort.Ints(err.Versions)
+	return nil, err
+}
+
+// Encode returns a new envelope with v encoded as the Message, v must be of the type registered for msgType and version.
+// Binary encodings use pointer receiver methods, so v should be a pointer.
+func (r *Registry) Encode(msgType MessageType, version int, enc Encoding, v interface{}) (*Envelope, error) {
+	t, err := r.lookup(msgType, version)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil, fmt.Errorf("bzkaf: nil %s payload", msgType)
+	}
+	if vt := reflect.Indirect(rv).Type(); vt != t {
+		return nil, fmt.Errorf("bzkaf: %s version %d is registered as %s, got %s", msgType, version, t, vt)
+	}
+
+	msg, err := encodePayload(enc, v)
+	if err != nil {
+		return nil, err
+	}
+
+	e := NewEnvelope(msgType, msg)
+	e.Version = version
+	if enc != JSONEncoding {
+		e.Encoding = enc
+	}
+	return e, nil
+}
+
+// Decode returns a pointer to a new value of the type registered for the envelope's message type and version
+func (r *Registry) Decode(e *Envelope) (interface{}, error) {
+	t, err := r.lookup(e.MessageType, e.SchemaVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	v := reflect.New(t).Interface()
+	if err := e.DecodeMessage(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Register adds a type to the DefaultRegistry
+func Register(msgType MessageType, version int, v interface{}) {
+	DefaultRegistry.Register(msgType, version, v)
+}
+
+// Encode encodes v using the DefaultRegistry
+func Encode(msgType MessageType, version int, enc Encoding, v interface{}) (*Envelope, error) {
+	return DefaultRegistry.Encode(msgType, version, enc, v)
+}
+
+// Decode decodes the envelope message using the DefaultRegistry
+func Decode(e *Envelope) (interface{}, error) {
+	return DefaultRegistry.Decode(e)
+}
+
+// SchemaVersion returns the envelope version, DefaultVersion for unversioned envelopes
+func (e *Envelope) SchemaVersion() int {
+	if e.Version == 0 {
+		return DefaultVersion
+	}
+	return e.Version
+}
+
+// DecodeMessage decodes the Message payload into v according to the envelope Encoding, without a registry lookup
+func (e *Envelope) DecodeMessage(v interface{}) error {
+	switch e.Encoding {
+	case "", JSONEncoding:
+		return jsoniter.Unmarshal(e.Message, v)
+	case MsgpackEncoding:
+		u, ok := v.(MsgUnmarshaler)
+		if !ok {
+			return ErrUnsupportedEncoding
+		}
+		payload, err := e.payload()
+		if err != nil {
+			return err
+		}
+		_, err = u.UnmarshalMsg(payload)
+		return err
+	case LZ4MsgpackEncoding:
+		d, ok := v.(Decompressor)
+		if !ok {
+			return ErrUnsupportedEncoding
+		}
+		payload, err := e.payload()
+		if err != nil {
+			return err
+		}
+		return d.Decompress(payload)
+	default:
+		return fmt.Errorf("bzkaf: unknown encoding %q", e.Encoding)
+	}
+}
+
+// payload returns the raw bytes of a binary encoded Message
+func (e *Envelope) payload() ([]byte, error) {
+	var b []byte
+	if err := jsoniter.Unmarshal(e.Message, &b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func encodePayload(enc Encoding, v interface{}) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	switch enc {
+	case "", JSONEncoding:
+		return jsoniter.Marshal(v)
+	case MsgpackEncoding:
+		m, ok := v.(MsgMarshaler)
+		if !ok {
+			return nil, ErrUnsupportedEncoding
+		}
+		b, err = m.MarshalMsg(nil)
+	case LZ4MsgpackEncoding:
+		c, ok := v.(Compressor)
+		if !ok {
+			return nil, ErrUnsupportedEncoding
+		}
+		b, err = c.Compress()
+	default:
+		return nil, fmt.Errorf("bzkaf: unknown encoding %q", enc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Binary payloads are carried as base64 JSON strings
+	return jsoniter.Marshal(b)
+}
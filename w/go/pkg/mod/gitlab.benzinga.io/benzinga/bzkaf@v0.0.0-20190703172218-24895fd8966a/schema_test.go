@@ -0,0 +1,118 @@
+package bzkaf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMsgType MessageType = "test_payload"
+
+type testPayloadV1 struct {
+	Name string
+}
+
+type testPayloadV2 struct {
+	Name  string
+	Count int
+}
+
+// binary codecs are faked with a prefix so tests do not depend on msgp/lz4
+func (p *testPayloadV2) MarshalMsg(b []byte) ([]byte, error) {
+	return append(b, []byte("msgp:"+p.Name)...), nil
+}
+
+func (p *testPayloadV2) UnmarshalMsg(bts []byte) ([]byte, error) {
+	p.Name = string(bytes.TrimPrefix(bts, []byte("msgp:")))
+	return nil, nil
+}
+
+func (p *testPayloadV2) Compress() ([]byte, error) {
+	return []byte("lz4:" + p.Name), nil
+}
+
+func (p *testPayloadV2) Decompress(data []byte) error {
+	p.Name = string(bytes.TrimPrefix(data, []byte("lz4:")))
+	return nil
+}
+
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(testMsgType, 1, testPayloadV1{})
+	r.Register(testMsgType, 2, &testPayloadV2{})
+	return r
+}
+
+func TestRegistryUnversionedEnvelope(t *testing.T) {
+	r := newTestRegistry()
+
+	// Envelope produced before version and encoding fields existed
+	e, err := UnmarshalEnvelope([]byte(`{"id":"abc","message_type":"test_payload","message":{"Name":"legacy"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultVersion, e.SchemaVersion())
+
+	v, err := r.Decode(e)
+	require.NoError(t, err)
+	require.IsType(t, &testPayloadV1{}, v)
+	assert.Equal(t, "legacy", v.(*testPayloadV1).Name)
+}
+
+func TestRegistryEncodings(t *testing.T) {
+	r := newTestRegistry()
+
+	for _, enc := range []Encoding{JSONEncoding, MsgpackEncoding, LZ4MsgpackEncoding} {
+		t.Run(enc.String(), func(t *testing.T) {
+			e, err := r.Encode(testMsgType, 2, enc, &testPayloadV2{Name: "encoded"})
+			require.NoError(t, err)
+			assert.Equal(t, 2, e.Version)
+
+			data, err := e.Marshal()
+			require.NoError(t, err)
+
+			received, err := UnmarshalEnvelope(data)
+			require.NoError(t, err)
+			assert.Equal(t, enc.String(), received.Encoding.String())
+
+			v, err := r.Decode(received)
+			require.NoError(t, err)
+			require.IsType(t, &testPayloadV2{}, v)
+			assert.Equal(t, "encoded", v.(*testPayloadV2).Name)
+		})
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	r := newTestRegistry()
+
+	_, err := r.Decode(&Envelope{MessageType: "unknown_type", Message: []byte(`{}`)})
+	require.IsType(t, &UnknownSchemaError{}, err)
+	assert.Empty(t, err.(*UnknownSchemaError).Versions)
+	assert.Contains(t, err.Error(), "unknown message type")
+
+	_, err = r.Decode(&Envelope{MessageType: testMsgType, Version: 3, Message: []byte(`{}`)})
+	require.IsType(t, &UnknownSchemaError{}, err)
+	assert.Equal(t, []int{1, 2}, err.(*UnknownSchemaError).Versions)
+	assert.Contains(t, err.Error(), "unknown version 3")
+
+	_, err = r.Encode(testMsgType, 1, MsgpackEncoding, &testPayloadV1{})
+	assert.Equal(t, ErrUnsupportedEncoding, err)
+
+	_, err = r.Encode(testMsgType, 1, JSONEncoding, &testPayloadV2{})
+	assert.Error(t, err, "type does not match registered version")
+
+	_, err = r.Encode(testMsgType, 1, JSONEncoding, nil)
+	assert.Error(t, err, "nil payload")
+	_, err = r.Encode(testMsgType, 1, JSONEncoding, (*testPayloadV1)(nil))
+	assert.Error(t, err, "typed nil payload")
+}
+
+func TestDefaultRegistryFTPDelivery(t *testing.T) {
+	e, err := Encode(FTPDelivery, 1, JSONEncoding, &FTPDeliveryRecord{NodeID: 12345})
+	require.NoError(t, err)
+
+	v, err := Decode(e)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12345), v.(*FTPDeliveryRecord).NodeID)
+}
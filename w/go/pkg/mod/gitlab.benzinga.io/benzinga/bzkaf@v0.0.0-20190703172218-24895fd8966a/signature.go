@@ -0,0 +1,223 @@
+package bzkaf
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// SignatureAlgorithm ...
+type SignatureAlgorithm string
+
+const (
+	// HMACSHA256 keyed with a shared secret
+	HMACSHA256 SignatureAlgorithm = "hmac-sha256"
+	// Ed25519 signed with a private key, verified with the public key
+	Ed25519 SignatureAlgorithm = "ed25519"
+)
+
+// Signature over the envelope payload, see SigningInput
+type Signature struct {
+	Algorithm SignatureAlgorithm `json:"alg"`
+	// KeyID identifies the key used, allowing keys to be rotated
+	KeyID string `json:"kid"`
+	Value []byte `json:"sig"`
+}
+
+var (
+	// ErrUnsigned is returned by Verify for envelopes without a signature
+	ErrUnsigned = errors.New("bzkaf: envelope is not signed")
+	// ErrUnknownKey is returned by Verify when the signature key ID and algorithm are not in the keyring
+	ErrUnknownKey = errors.New("bzkaf: unknown signature key")
+	// ErrInvalidSignature is returned by Verify when the signature does not match the envelope
+	ErrInvalidSignature = errors.New("bzkaf: invalid envelope signature")
+)
+
+const signingInputPrefix = "bzkaf-envelope-v1"
+
+// SigningInput returns the bytes signed for the envelope: the ID, message type, version, encoding and
+// compacted message, newline separated. Trace and Signature are not signed.
+func (e *Envelope) SigningInput() []byte {
+	var b bytes.Buffer
+	b.WriteString(signingInputPrefix)
+	b.WriteByte('\n')
+	b.WriteString(e.ID)
+	b.WriteByte('\n')
+	b.WriteString(e.MessageType.String())
+	b.WriteByte('\n')
+	b.WriteString(strconv.Itoa(e.SchemaVersion()))
+	b.WriteByte('\n')
+	b.WriteString(e.Encoding.String())
+	b.WriteByte('\n')
+	// Message is compacted as re-marshaling the envelope may strip insignificant whitespace
+	if err := json.Compact(&b, e.Message); err != nil {
+		b.Write(e.Message)
+	}
+	return b.Bytes()
+}
+
+// Signer signs envelopes
+type Signer interface {
+	Sign(e *Envelope) error
+}
+
+// MinHMACKeySize is the minimum HMAC-SHA256 secret size in bytes, shorter secrets are rejected when signing and
+// verifying so a missing or weak secret cannot be used to forge signatures
+const MinHMACKeySize = 32
+
+// HMACSigner signs envelopes with HMAC-SHA256
+type HMACSigner struct {
+	KeyID string
+	Key   []byte
+}
+
+// Sign sets the envelope Signature
+func (s *HMACSigner) Sign(e *Envelope) error {
+	if len(s.Key) < MinHMACKeySize {
+		return fmt.Errorf("bzkaf: HMAC key %q is %d bytes, at least %d are required", s.KeyID, len(s.Key), MinHMACKeySize)
+	}
+	e.Signature = &Signature{Algorithm: HMACSHA256, KeyID: s.KeyID, Value: hmacSum(s.Key, e.SigningInput())}
+	return nil
+}
+
+// Ed25519Signer signs envelopes with an Ed25519 private key
+type Ed25519Signer struct {
+	KeyID      string
+	PrivateKey ed25519.PrivateKey
+}
+
+// Sign sets the envelope Signature
+func (s *Ed25519Signer) Sign(e *Envelope) error {
+	if len(s.PrivateKey) != ed25519.PrivateKeySize {
+		return errors.New("bzkaf: invalid Ed25519 private key")
+	}
+	e.Signature = &Signature{Algorithm: Ed25519, KeyID: s.KeyID, Value: ed25519.Sign(s.PrivateKey, e.SigningInput())}
+	return nil
+}
+
+func hmacSum(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data) // hash.Hash Write never returns an error
+	return mac.Sum(nil)
+}
+
+type keyringKey struct {
+	alg SignatureAlgorithm
+	id  string
+}
+
+// Keyring holds the keys envelopes are verified with. Several keys may be held at once to allow rotation.
+type Keyring struct {
+	sync.RWMutex
+	keys map[keyringKey][]byte
+}
+
+// NewKeyring returns an empty Keyring
+func NewKeyring() *Keyring {
+	return &Keyring{keys: map[keyringKey][]byte{}}
+}
+
+// AddHMACKey adds a shared HMAC-SHA256 secret of at least MinHMACKeySize bytes
+func (k *Keyring) AddHMACKey(keyID string, key []byte) error {
+	if len(key) < MinHMACKeySize {
+		return fmt.Errorf("bzkaf: HMAC key %q is %d bytes, at least %d are required", keyID, len(key), MinHMACKeySize)
+	}
+	k.add(HMACSHA256, keyID, key)
+	return nil
+}
+
+// AddEd25519Key adds an Ed25519 public key
+func (k *Keyring) AddEd25519Key(keyID string, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("bzkaf: invalid Ed25519 public key size %d for key %q", len(key), keyID)
+	}
+	k.add(Ed25519, keyID, key)
+	return nil
+}
+
+func (k *Keyring) add(alg SignatureAlgorithm, keyID string, key []byte) {
+	k.Lock()
+	k.keys[keyringKey{alg, keyID}] = key
+	k.Unlock()
+}
+
+// Len returns the number of keys held
+func (k *Keyring) Len() int {
+	k.RLock()
+	defer k.RUnlock()
+	return len(k.keys)
+}
+
+// Verify checks the envelope signature, returning ErrUnsigned, ErrUnknownKey or ErrInvalidSignature on failure
+func (k *Keyring) Verify(e *Envelope) error {
+	if e.Signature == nil || len(e.Signature.Value) == 0 {
+		return ErrUnsigned
+	}
+
+	k.RLock()
+	key, ok := k.keys[keyringKey{e.Signature.Algorithm, e.Signature.KeyID}]
+	k.RUnlock()
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	switch e.Signature.Algorithm {
+	case HMACSHA256:
+		if !hmac.Equal(hmacSum(key, e.SigningInput()), e.Signature.Value) {
+			return ErrInvalidSignature
+		}
+	case Ed25519:
+		if !ed25519.Verify(ed25519.PublicKey(key), e.SigningInput(), e.Signature.Value) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnknownKey
+	}
+
+	return nil
+}
+
+// ParseKeyring parses a comma separated list of `<key id>:<algorithm>:<base64 key>` entries, where the key is
+// the HMAC secret or the Ed25519 public key. ex. `2019-07:hmac-sha256:<base64 32 byte secret>,ops:ed25519:<base64 public key>`
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := NewKeyring()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, errors.New("bzkaf: invalid key entry, expected <key id>:<algorithm>:<base64 key>")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("bzkaf: key %q: %s", parts[0], err)
+		}
+
+		switch SignatureAlgorithm(strings.ToLower(parts[1])) {
+		case HMACSHA256:
+			if err := k.AddHMACKey(parts[0], key); err != nil {
+				return nil, err
+			}
+		case Ed25519:
+			if err := k.AddEd25519Key(parts[0], key); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("bzkaf: key %q: unsupported algorithm %q", parts[0], parts[1])
+		}
+	}
+	return k, nil
+}
@@ -0,0 +1,150 @@
+package bzkaf
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+)
+
+type signatureVectors struct {
+	Keyring     string `json:"keyring"`
+	Ed25519Seed []byte `json:"ed25519_seed"`
+	Vectors     []struct {
+		Name         string          `json:"name"`
+		SigningInput string          `json:"signing_input"`
+		Error        string          `json:"error"`
+		Envelope     json.RawMessage `json:"envelope"`
+	} `json:"vectors"`
+}
+
+var vectorErrors = map[string]error{
+	"":            nil,
+	"invalid":     ErrInvalidSignature,
+	"unknown_key": ErrUnknownKey,
+	"unsigned":    ErrUnsigned,
+}
+
+func loadSignatureVectors(t *testing.T) *signatureVectors {
+	data, err := ioutil.ReadFile("testdata/signature_vectors.json")
+	require.NoError(t, err)
+
+	var v signatureVectors
+	require.NoError(t, json.Unmarshal(data, &v))
+	return &v
+}
+
+func TestSignatureVectors(t *testing.T) {
+	v := loadSignatureVectors(t)
+
+	keyring, err := ParseKeyring(v.Keyring)
+	require.NoError(t, err)
+	assert.Equal(t, 2, keyring.Len())
+
+	for _, vector := range v.Vectors {
+		t.Run(vector.Name, func(t *testing.T) {
+			e, err := UnmarshalEnvelope(vector.Envelope)
+			require.NoError(t, err)
+
+			if vector.SigningInput != "" {
+				assert.Equal(t, vector.SigningInput, string(e.SigningInput()))
+			}
+
+			expected, ok := vectorErrors[vector.Error]
+			require.True(t, ok, "unknown vector error %q", vector.Error)
+			assert.Equal(t, expected, keyring.Verify(e))
+		})
+	}
+}
+
+func TestSignersMatchVectors(t *testing.T) {
+	v := loadSignatureVectors(t)
+
+	key, err := base64.StdEncoding.DecodeString("YnprYWYtdGVzdC12ZWN0b3Itc2VjcmV0LTMyYnl0ZXM=")
+	require.NoError(t, err)
+
+	signers := map[string]Signer{
+		"hmac-sha256": &HMACSigner{KeyID: "2019-07", Key: key},
+		"ed25519":     &Ed25519Signer{KeyID: "ops-1", PrivateKey: ed25519.NewKeyFromSeed(v.Ed25519Seed)},
+	}
+
+	for _, vector := range v.Vectors {
+		signer, ok := signers[vector.Name]
+		if !ok {
+			continue
+		}
+		t.Run(vector.Name, func(t *testing.T) {
+			expected, err := UnmarshalEnvelope(vector.Envelope)
+			require.NoError(t, err)
+
+			e := &Envelope{ID: expected.ID, MessageType: expected.MessageType, Version: expected.Version, Message: expected.Message}
+			require.NoError(t, signer.Sign(e))
+			assert.Equal(t, expected.Signature, e.Signature)
+		})
+	}
+}
+
+func TestSignedEnvelopeRoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	keyring := NewKeyring()
+	require.NoError(t, keyring.AddEd25519Key("new", pub))
+	require.NoError(t, keyring.AddHMACKey("old", []byte("bzkaf-test-round-trip-secret-32b")))
+
+	e, err := Encode(FTPDelivery, 1, JSONEncoding, &FTPDeliveryRecord{NodeID: 12345})
+	require.NoError(t, err)
+	require.NoError(t, (&Ed25519Signer{KeyID: "new", PrivateKey: priv}).Sign(e))
+
+	data, err := e.Marshal()
+	require.NoError(t, err)
+
+	received, err := UnmarshalEnvelope(data)
+	require.NoError(t, err)
+	assert.NoError(t, keyring.Verify(received))
+
+	// Trace is not signed, it may be added after signing
+	received.Trace = map[string]string{"uber-trace-id": "1:2:0:1"}
+	assert.NoError(t, keyring.Verify(received))
+
+	received.MessageType = ContentModelsEventMsgType
+	assert.Equal(t, ErrInvalidSignature, keyring.Verify(received))
+}
+
+func TestParseKeyringErrors(t *testing.T) {
+	for _, spec := range []string{
+		"missing-algorithm",
+		"k:hmac-sha256:not base64!",
+		"k:rsa:c2VjcmV0",
+		"k:ed25519:c2VjcmV0",
+		"k:hmac-sha256:",
+		"k:hmac-sha256:c2VjcmV0",
+	} {
+		_, err := ParseKeyring(spec)
+		assert.Error(t, err, spec)
+	}
+
+	k, err := ParseKeyring("")
+	require.NoError(t, err)
+	assert.Zero(t, k.Len())
+}
+
+func TestShortHMACKeys(t *testing.T) {
+	e := &Envelope{ID: "abc", MessageType: FTPDelivery, Message: []byte(`{"NodeID":12345}`)}
+
+	assert.Error(t, NewKeyring().AddHMACKey("empty", nil))
+	assert.Error(t, NewKeyring().AddHMACKey("short", make([]byte, MinHMACKeySize-1)))
+	assert.Error(t, (&HMACSigner{KeyID: "empty"}).Sign(e))
+	assert.Error(t, (&HMACSigner{KeyID: "short", Key: make([]byte, MinHMACKeySize-1)}).Sign(e))
+	assert.Nil(t, e.Signature)
+}
+
+func TestSigningInputIgnoresWhitespace(t *testing.T) {
+	e := &Envelope{ID: "abc", MessageType: FTPDelivery, Message: []byte("{\n  \"NodeID\": 12345\n}")}
+	compact := &Envelope{ID: "abc", MessageType: FTPDelivery, Message: []byte(`{"NodeID":12345}`)}
+	assert.Equal(t, compact.SigningInput(), e.SigningInput())
+}
@@ -0,0 +1,43 @@
+package bzkaf
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// Inject writes the span context into the envelope Trace carrier
+func (e *Envelope) Inject(tracer opentracing.Tracer, sc opentracing.SpanContext) error {
+	if e.Trace == nil {
+		e.Trace = opentracing.TextMapCarrier{}
+	}
+	return tracer.Inject(sc, opentracing.TextMap, e.Trace)
+}
+
+// InjectFromContext writes the context of the span in ctx into the envelope Trace carrier,
+// it is a no-op if ctx has no span
+func (e *Envelope) InjectFromContext(ctx context.Context) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return e.Inject(span.Tracer(), span.Context())
+}
+
+// Extract returns the span context carried by the envelope,
+// opentracing.ErrSpanContextNotFound is returned if the envelope has no trace
+func (e *Envelope) Extract(tracer opentracing.Tracer) (opentracing.SpanContext, error) {
+	if len(e.Trace) == 0 {
+		return nil, opentracing.ErrSpanContextNotFound
+	}
+	return tracer.Extract(opentracing.TextMap, e.Trace)
+}
+
+// StartSpanFromContext starts a span with the global tracer which follows from the trace carried by the
+// envelope, if any, so processing continues the upstream trace instead of starting a new root span
+func (e *Envelope) StartSpanFromContext(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
+	if sc, err := e.Extract(opentracing.GlobalTracer()); err == nil {
+		opts = append(opts, opentracing.FollowsFrom(sc))
+	}
+	return opentracing.StartSpanFromContext(ctx, operationName, opts...)
+}
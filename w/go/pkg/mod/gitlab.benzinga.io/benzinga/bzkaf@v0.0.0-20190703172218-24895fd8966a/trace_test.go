@@ -0,0 +1,63 @@
+package bzkaf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeTracePropagation(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	upstream := tracer.StartSpan("content-engine")
+	ctx := opentracing.ContextWithSpan(context.Background(), upstream)
+
+	e := NewEnvelope(ContentModelsEventMsgType, []byte(`{}`))
+	require.NoError(t, e.InjectFromContext(ctx))
+	assert.NotEmpty(t, e.Trace)
+
+	data, err := e.Marshal()
+	require.NoError(t, err)
+
+	received, err := UnmarshalEnvelope(data)
+	require.NoError(t, err)
+
+	sc, err := received.Extract(tracer)
+	require.NoError(t, err)
+	assert.Equal(t, upstream.Context().(mocktracer.MockSpanContext).TraceID, sc.(mocktracer.MockSpanContext).TraceID)
+
+	span, _ := received.StartSpanFromContext(context.Background(), "worker")
+	span.Finish()
+	upstream.Finish()
+
+	worker := span.(*mocktracer.MockSpan)
+	assert.Equal(t, upstream.(*mocktracer.MockSpan).SpanContext.TraceID, worker.SpanContext.TraceID, "worker span continues upstream trace")
+	assert.Equal(t, upstream.(*mocktracer.MockSpan).SpanContext.SpanID, worker.ParentID)
+}
+
+func TestEnvelopeWithoutTrace(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	e := NewEnvelope(ContentModelsEventMsgType, []byte(`{}`))
+	require.NoError(t, e.InjectFromContext(context.Background()), "no span in context is a no-op")
+	assert.Empty(t, e.Trace)
+
+	// Envelopes produced before tracing was added have no trace field
+	received, err := UnmarshalEnvelope([]byte(`{"id":"abc","message_type":"content_models_event","message":{}}`))
+	require.NoError(t, err)
+
+	_, err = received.Extract(tracer)
+	assert.Equal(t, opentracing.ErrSpanContextNotFound, err)
+
+	span, _ := received.StartSpanFromContext(context.Background(), "worker")
+	span.Finish()
+	assert.Zero(t, span.(*mocktracer.MockSpan).ParentID, "new root span")
+}
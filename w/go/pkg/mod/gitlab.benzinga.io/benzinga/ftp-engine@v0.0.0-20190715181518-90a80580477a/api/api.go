@@ -1,26 +1,60 @@
 package api
 
 import (
+	"net/http"
+
 	"gitlab.benzinga.io/benzinga/ftp-engine/sender"
 	"go.uber.org/zap"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gitlab.benzinga.io/benzinga/content-models/models"
 	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/history"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
 )
 
 type H struct {
 	logger *zap.Logger
 	config *config.Config
 	sender sender.Sender
+	opts   Options
+}
+
+// Options are the dependencies of the worker routes, routes are not loaded without their dependency
+type Options struct {
+	// Resolver lists the unresolved tickers
+	Resolver *rstore.Resolver
+	// History lists the sent and failed deliveries
+	History *history.Store
+	// Processor converts previewed events, it is never sent
+	Processor process.Processor
+	// Archive finds the content of previewed and resent node IDs, optional
+	Archive NodeFinder
+	// Pipeline is paused, resumed and resends events
+	Pipeline *worker.Pipeline
+	// Source reports the readiness of the worker source, optional
+	Source worker.Checker
+	// Push receives the envelopes POSTed to /events by the http source, optional
+	Push http.Handler
 }
 
-func LoadRoutes(cfg *config.Config, logger *zap.Logger, s sender.Sender) *gin.Engine {
+// NodeFinder finds archive content by node ID, see archive.MongoQueryer
+type NodeFinder interface {
+	FindNode(nodeID int64) (*models.Content, error)
+}
+
+// LoadRoutes ... Routes require a principal with their role, see config.AuthConfig. Without credentials configured
+// only the probes and unresolved tickers are loaded, unauthenticated.
+func LoadRoutes(cfg *config.Config, logger *zap.Logger, s sender.Sender, opts Options) *gin.Engine {
 
 	h := H{
 		logger: logger,
 		config: cfg,
 		sender: s,
+		opts:   opts,
 	}
 
 	// Use Gin Release Mode in Production Environment
@@ -34,14 +68,67 @@ func LoadRoutes(cfg *config.Config, logger *zap.Logger, s sender.Sender) *gin.En
 	// Middlewares
 	g.Use(gin.Recovery())
 
-	// Prometheus Endpoint
-	g.GET("/metrics", func(c *gin.Context) {
-		prom := promhttp.Handler()
-		prom.ServeHTTP(c.Writer, c.Request)
-	}).Use()
+	if !cfg.Auth.Enabled() {
+		logger.Info("API Authentication Disabled, API_TOKENS, ADMIN_API_TOKEN and API_CLIENT_ROLES are not set")
+		h.loadProbes(g)
+		if opts.Resolver != nil {
+			g.GET("/unresolved", h.getUnresolved)
+		}
+		if opts.Push != nil {
+			g.POST("/events", gin.WrapH(opts.Push))
+		}
+		return g
+	}
+
+	g.Use(h.authenticate)
+
+	// Probe Routes
+	if cfg.Auth.PublicProbes {
+		h.loadProbes(g)
+	} else {
+		h.loadProbes(g.Group("/", h.requireRole(config.ReadOnlyRole)))
+	}
+
+	// Read Only Routes
+	read := g.Group("/", h.requireRole(config.ReadOnlyRole))
+	if opts.Resolver != nil {
+		read.GET("/unresolved", h.getUnresolved)
+	}
+	if opts.History != nil {
+		read.GET("/deliveries", h.getDeliveries)
+		read.GET("/deliveries/:event_id", h.getEventDeliveries)
+	}
+	if opts.Processor != nil {
+		read.POST("/preview", h.postPreview)
+	}
+
+	// Ingest Routes, pushed envelopes are logged by the pipeline rather than audited
+	if opts.Push != nil {
+		g.POST("/events", h.requireRole(config.IngestRole), gin.WrapH(opts.Push))
+	}
+
+	// Operator Routes
+	if opts.Pipeline != nil {
+		operate := g.Group("/", h.audit, h.requireRole(config.OperatorRole))
+		operate.POST("/pause", h.postPause)
+		operate.POST("/resume", h.postResume)
+	}
 
-	// API Routes
-	g.GET("/healthz", h.getStatus)
+	// Admin Routes
+	if opts.Pipeline != nil {
+		admin := g.Group("/", h.audit, h.requireRole(config.AdminRole))
+		admin.POST("/resend", h.postResend)
+	}
 
 	return g
 }
+
+// loadProbes loads the Prometheus endpoint and the liveness and readiness probes
+func (h *H) loadProbes(r gin.IRoutes) {
+	r.GET("/metrics", func(c *gin.Context) {
+		prom := promhttp.Handler()
+		prom.ServeHTTP(c.Writer, c.Request)
+	})
+	r.GET("/healthz", h.getStatus)
+	r.GET("/readyz", h.getReady)
+}
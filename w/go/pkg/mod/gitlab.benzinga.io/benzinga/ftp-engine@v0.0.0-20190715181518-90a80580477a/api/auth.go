@@ -0,0 +1,146 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+)
+
+// principalKey is the gin context key of the authenticated principal
+const principalKey = "principal"
+
+// principal is the authenticated API client
+type principal struct {
+	// Name is the client certificate common name, or the token fingerprint, tokens are never logged
+	Name string
+	Role config.Role
+	// Method is "token" or "mtls"
+	Method string
+}
+
+// TLSConfig returns the API server TLS config, which verifies client certificates signed by cfg.Auth.ClientCAPath
+// when they are given, nil if the API is not served over TLS. Requests without a certificate can still use tokens.
+func TLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.Auth.TLSCertPath == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.Auth.TLSCertPath, cfg.Auth.TLSKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if cfg.Auth.ClientCAPath != "" {
+		caCertBytes, err := ioutil.ReadFile(cfg.Auth.ClientCAPath)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if ok := pool.AppendCertsFromPEM(caCertBytes); !ok {
+			return nil, errors.New("unable to append client CA bytes")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
+
+// authenticate sets the principal of requests with a valid bearer token or verified client certificate, the token
+// is used if both are given. Requests are rejected by requireRole, not here, so public routes ignore credentials.
+func (h *H) authenticate(c *gin.Context) {
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token := []byte(strings.TrimPrefix(auth, "Bearer "))
+		// Every token is compared so the time does not depend on which token matched
+		var match *principal
+		for t, role := range h.config.Auth.Tokens {
+			if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+				match = &principal{Name: tokenFingerprint(t), Role: role, Method: "token"}
+			}
+		}
+		if match != nil {
+			c.Set(principalKey, match)
+		}
+	} else if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 && len(c.Request.TLS.VerifiedChains[0]) > 0 {
+		name := c.Request.TLS.VerifiedChains[0][0].Subject.CommonName
+		// A verified certificate without a role is authenticated, but allowed no routes
+		c.Set(principalKey, &principal{Name: name, Role: h.config.Auth.CertRoles[name], Method: "mtls"})
+	}
+
+	c.Next()
+}
+
+// requireRole rejects requests without credentials with 401 Unauthorized, and principals without the role with
+// 403 Forbidden
+func (h *H) requireRole(role config.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := getPrincipal(c)
+		if p == nil {
+			h.logger.Warn("API Unauthorized", zap.String("path", c.Request.URL.Path), zap.String("remote_addr", c.ClientIP()))
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		if !p.Role.Allows(role) {
+			h.logger.Warn("API Forbidden", zap.String("path", c.Request.URL.Path), zap.String("remote_addr", c.ClientIP()),
+				zap.String("principal", p.Name), zap.Stringer("role", p.Role), zap.Stringer("required_role", role))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden, requires the " + role.String() + " role"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// audit logs each request once handled, with the principal and response status, for the routes that change the
+// worker
+func (h *H) audit(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	fields := []zap.Field{
+		zap.String("method", c.Request.Method),
+		zap.String("path", c.Request.URL.Path),
+		zap.String("query", c.Request.URL.RawQuery),
+		zap.String("remote_addr", c.ClientIP()),
+		zap.Int("status", c.Writer.Status()),
+		zap.Duration("latency", time.Since(start)),
+	}
+	if p := getPrincipal(c); p != nil {
+		fields = append(fields, zap.String("principal", p.Name), zap.Stringer("role", p.Role), zap.String("auth", p.Method))
+	}
+	h.logger.Named("audit").Info("API Audit", fields...)
+}
+
+// tokenFingerprint identifies a token in logs without revealing it
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// requestedBy identifies the client of a request in logs, the principal and remote address
+func requestedBy(c *gin.Context) string {
+	if p := getPrincipal(c); p != nil {
+		return p.Name + "@" + c.ClientIP()
+	}
+	return c.ClientIP()
+}
+
+func getPrincipal(c *gin.Context) *principal {
+	if v, ok := c.Get(principalKey); ok {
+		return v.(*principal)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+func TestAuth(t *testing.T) {
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		AppEnv:    config.TestingEnv,
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+		Auth: config.AuthConfig{
+			Tokens: map[string]config.Role{"reader": config.ReadOnlyRole, "operator": config.OperatorRole, "admin": config.AdminRole,
+				"pusher": config.IngestRole},
+			CertRoles:    map[string]config.Role{"ops-cli": config.OperatorRole},
+			PublicProbes: true,
+		},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+	s := &workertest.Sender{}
+	pipeline, err := worker.NewPipeline(cfg, zap.NewNop(), inst, s, workertest.Processor{}, nil, nil, "testing")
+	require.NoError(t, err)
+
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&logs), zap.InfoLevel))
+	push := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	opts := Options{Processor: workertest.Processor{}, Pipeline: pipeline, Push: push}
+	router := LoadRoutes(cfg, logger, s, opts)
+
+	do := func(method, url, token, commonName string) int {
+		req := httptest.NewRequest(method, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if commonName != "" {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}}}
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Probes are public
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/healthz", "", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/metrics", "wrong", ""))
+
+	// Roles allow the routes of the roles before them
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/pause", "", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/pause", "wrong", ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/pause", "reader", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/pause", "operator", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/resume", "admin", ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/resend?node_id=1", "operator", ""))
+
+	// Resends require authentication
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/resend?node_id=1", "", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/resend?node_id=1", "wrong", ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/resend?node_id=1", "reader", ""))
+
+	// Ingest tokens only push events, operators can also push
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/events", "", ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/events", "reader", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/events", "pusher", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/events", "admin", ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/pause", "pusher", ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/preview", "pusher", ""))
+
+	// Client certificates have the role of their common name
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/pause", "", "ops-cli"))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/resume", "", "unknown"))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/resend?node_id=1", "", "ops-cli"))
+
+	// Mutating requests are audited with the principal, tokens are not logged
+	audit := logs.String()
+	assert.Contains(t, audit, `"msg":"API Audit","method":"POST","path":"/pause"`)
+	assert.Contains(t, audit, `"principal":"ops-cli","role":"operator","auth":"mtls"`)
+	assert.Contains(t, audit, `"principal":"`+tokenFingerprint("operator")+`"`)
+	assert.NotContains(t, audit, `"principal":"operator"`)
+
+	// Probes can require the read-only role
+	cfg.Auth.PublicProbes = false
+	router = LoadRoutes(cfg, logger, s, opts)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/healthz", "", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/healthz", "reader", ""))
+
+	// Without credentials configured resends are not served
+	router = LoadRoutes(&config.Config{AppName: config.AppName, AppEnv: config.TestingEnv}, logger, s, opts)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/resend?node_id=1", "", ""))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/pause", "", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/events", "", ""))
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/archive"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+)
+
+type pauseResponse struct {
+	Paused bool `json:"paused"`
+	// Changed is false if the worker already was in the requested state
+	Changed bool       `json:"changed"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+type resendResponse struct {
+	Status   worker.Status `json:"status"`
+	Reason   string        `json:"reason,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	EventID  int64         `json:"event_id"`
+	NodeID   int64         `json:"node_id"`
+	Filename string        `json:"filename,omitempty"`
+	Checksum string        `json:"sha256_checksum,omitempty"`
+	Size     int           `json:"size_bytes,omitempty"`
+}
+
+// postPause stops the worker receiving messages, see worker.Pipeline.Pause
+func (h *H) postPause(c *gin.Context) {
+	changed := h.opts.Pipeline.Pause()
+	if changed {
+		h.logger.Warn("Worker Paused", zap.String("requested_by", requestedBy(c)))
+	}
+	h.writePaused(c, changed)
+}
+
+// postResume lets the worker receive messages again
+func (h *H) postResume(c *gin.Context) {
+	changed := h.opts.Pipeline.Resume()
+	if changed {
+		h.logger.Warn("Worker Resumed", zap.String("requested_by", requestedBy(c)))
+	}
+	h.writePaused(c, changed)
+}
+
+func (h *H) writePaused(c *gin.Context, changed bool) {
+	res := pauseResponse{Changed: changed}
+	var since time.Time
+	if res.Paused, since = h.opts.Pipeline.Paused(); res.Paused {
+		res.Since = &since
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// postResend re-renders and delivers the archive content of node_id, or of the node of event_id in the delivery
+// history, through the worker pipeline. The archive has the latest version of the node, which is sent as a created
+// event. The response is 200 OK for sent and rejected events and 502 Bad Gateway if the event failed.
+func (h *H) postResend(c *gin.Context) {
+	if h.opts.Archive == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the content archive is not configured, see ARCHIVE_MONGO_URL"})
+		return
+	}
+
+	var nodeID, eventID int64
+	var err error
+	switch {
+	case c.Query("node_id") != "":
+		if nodeID, err = strconv.ParseInt(c.Query("node_id"), 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "node_id must be an integer"})
+			return
+		}
+	case c.Query("event_id") != "":
+		if eventID, err = strconv.ParseInt(c.Query("event_id"), 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "event_id must be an integer"})
+			return
+		}
+		if h.opts.History == nil {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "the delivery history is not available"})
+			return
+		}
+		deliveries, err := h.opts.History.Get(c.Request.Context(), eventID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(deliveries) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no deliveries of event " + c.Query("event_id")})
+			return
+		}
+		nodeID = deliveries[0].NodeID
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "node_id or event_id is required"})
+		return
+	}
+
+	content, err := h.opts.Archive.FindNode(nodeID)
+	if err == archive.ErrNodeNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := archive.Event(content)
+	// The resend is stored in the delivery history of the requested event
+	if eventID != 0 {
+		event.ID = eventID
+	}
+	result := h.opts.Pipeline.Resend(c.Request.Context(), event, requestedBy(c))
+
+	res := resendResponse{Status: result.Status, Reason: result.Reason, EventID: event.ID, NodeID: event.NodeID}
+	if result.Err != nil {
+		res.Error = result.Err.Error()
+	}
+	if result.Output != nil {
+		res.Filename, res.Checksum, res.Size = result.Output.Filename, result.Output.Checksum, result.Output.Size
+	}
+
+	switch result.Status {
+	case worker.Sent, worker.Rejected:
+		c.JSON(http.StatusOK, res)
+	default:
+		c.JSON(http.StatusBadGateway, res)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/history"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+func TestPauseResend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-engine-api")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	deliveries, err := history.Open(zap.NewNop(), filepath.Join(dir, "history.bolt"), 0)
+	require.NoError(t, err)
+	defer deliveries.Close()
+
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		AppEnv:    config.TestingEnv,
+		Auth:      config.AuthConfig{Tokens: map[string]config.Role{"secret": config.AdminRole}},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+	s := &workertest.Sender{}
+	pipeline, err := worker.NewPipeline(cfg, zap.NewNop(), inst, s, workertest.Processor{}, nil, deliveries, "testing")
+	require.NoError(t, err)
+
+	event := workertest.NewEvent()
+	router := LoadRoutes(cfg, zap.NewNop(), s, Options{History: deliveries, Archive: testNodes{event.NodeID: &event.Content}, Pipeline: pipeline})
+
+	do := func(method, url string, v interface{}) int {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if v != nil {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+		}
+		return rec.Code
+	}
+
+	var pause pauseResponse
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/pause", &pause))
+	assert.True(t, pause.Paused)
+	assert.True(t, pause.Changed)
+	require.NotNil(t, pause.Since)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/pause", &pause))
+	assert.False(t, pause.Changed)
+
+	var status statusResponse
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/healthz", &status))
+	assert.Equal(t, "PAUSED", status.Status)
+	assert.True(t, status.Paused)
+
+	pause = pauseResponse{}
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/resume", &pause))
+	assert.False(t, pause.Paused)
+	assert.True(t, pause.Changed)
+	assert.Nil(t, pause.Since)
+	status = statusResponse{}
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/healthz", &status))
+	assert.Equal(t, "OK", status.Status)
+
+	// Resend by node ID, then by the event ID of the delivery
+	var resend resendResponse
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/resend?node_id="+strconv.FormatInt(event.NodeID, 10), &resend))
+	assert.Equal(t, worker.Sent, resend.Status)
+	assert.Equal(t, event.Content.Title+".xml", resend.Filename)
+	require.Len(t, s.Sent, 1)
+
+	require.NoError(t, deliveries.Add(context.Background(), &history.Delivery{EventID: 42, NodeID: event.NodeID, Status: "failed", Timestamp: time.Now()}))
+	resend = resendResponse{}
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/resend?event_id=42", &resend))
+	assert.Equal(t, int64(42), resend.EventID)
+	assert.Len(t, s.Sent, 2)
+	sent, err := deliveries.Get(context.Background(), 42)
+	require.NoError(t, err)
+	assert.Equal(t, "sent", sent[0].Status)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/resend?event_id=43", nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/resend?node_id=1", nil))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/resend", nil))
+
+	s.Err = errors.New("connection refused")
+	resend = resendResponse{}
+	assert.Equal(t, http.StatusBadGateway, do(http.MethodPost, "/resend?node_id="+strconv.FormatInt(event.NodeID, 10), &resend))
+	assert.Equal(t, worker.Failed, resend.Status)
+	assert.Equal(t, "connection refused", resend.Error)
+}
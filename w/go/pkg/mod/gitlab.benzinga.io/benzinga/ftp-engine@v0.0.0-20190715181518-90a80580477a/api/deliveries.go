@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/history"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+)
+
+// nextCursorHeader has the cursor of the next page of CSV and JSON responses
+const nextCursorHeader = "X-Next-Cursor"
+
+var deliveriesCSVHeader = []string{
+	"event_id", "node_id", "envelope_id", "event_type", "status", "filename", "remote_path", "sha256_checksum",
+	"size_bytes", "attempts", "error", "timestamp", "latency",
+}
+
+// getDeliveries lists the stored deliveries, newest first. node_id, since (RFC3339) and status (sent or failed)
+// filter the deliveries, limit and cursor page them. The response is CSV with format=csv or Accept: text/csv.
+func (h *H) getDeliveries(c *gin.Context) {
+	var q history.Query
+	var err error
+	if s := c.Query("node_id"); s != "" {
+		if q.NodeID, err = strconv.ParseInt(s, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "node_id must be an integer"})
+			return
+		}
+	}
+	if s := c.Query("since"); s != "" {
+		if q.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC3339 time"})
+			return
+		}
+	}
+	switch status := c.Query("status"); status {
+	case "", string(worker.Sent), string(worker.Failed):
+		q.Status = status
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be sent or failed"})
+		return
+	}
+	if s := c.Query("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 1 || q.Limit > history.MaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(history.MaxLimit)})
+			return
+		}
+	}
+	q.Cursor = c.Query("cursor")
+
+	page, err := h.opts.History.List(c.Request.Context(), q)
+	if err == history.ErrInvalidCursor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if page.Next != "" {
+		c.Header(nextCursorHeader, page.Next)
+	}
+	h.writeDeliveries(c, page, page.Deliveries)
+}
+
+// getEventDeliveries lists the deliveries of an event, newest first, 404 Not Found if it was not sent
+func (h *H) getEventDeliveries(c *gin.Context) {
+	eventID, err := strconv.ParseInt(c.Param("event_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "event_id must be an integer"})
+		return
+	}
+
+	deliveries, err := h.opts.History.Get(c.Request.Context(), eventID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(deliveries) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no deliveries of event " + c.Param("event_id")})
+		return
+	}
+
+	h.writeDeliveries(c, history.Page{Deliveries: deliveries}, deliveries)
+}
+
+// writeDeliveries writes the deliveries as CSV if requested, otherwise v as JSON
+func (h *H) writeDeliveries(c *gin.Context, v interface{}, deliveries []history.Delivery) {
+	if c.Query("format") != "csv" && !strings.Contains(c.GetHeader("Accept"), "text/csv") {
+		c.JSON(http.StatusOK, v)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write(deliveriesCSVHeader)
+	for _, d := range deliveries {
+		w.Write([]string{
+			strconv.FormatInt(d.EventID, 10),
+			strconv.FormatInt(d.NodeID, 10),
+			d.EnvelopeID,
+			d.EventType,
+			d.Status,
+			d.Filename,
+			d.RemotePath,
+			d.Checksum,
+			strconv.Itoa(d.SizeBytes),
+			strconv.Itoa(d.Attempts),
+			d.Error,
+			d.Timestamp.Format(time.RFC3339Nano),
+			d.Latency.String(),
+		})
+	}
+	w.Flush()
+}
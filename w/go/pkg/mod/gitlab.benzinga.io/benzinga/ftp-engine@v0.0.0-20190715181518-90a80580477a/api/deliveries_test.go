@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/history"
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+func TestDeliveries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-engine-api")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	deliveries, err := history.Open(zap.NewNop(), filepath.Join(dir, "history.bolt"), 0)
+	require.NoError(t, err)
+	defer deliveries.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	require.NoError(t, deliveries.Add(ctx, &history.Delivery{EventID: 1, NodeID: 12345, Status: "failed", Error: "connection refused", Attempts: 2, Timestamp: now}))
+	require.NoError(t, deliveries.Add(ctx, &history.Delivery{EventID: 1, NodeID: 12345, Status: "sent", Filename: "a.xml", RemotePath: "/a.xml", Checksum: "abc", SizeBytes: 10, Attempts: 1, Timestamp: now.Add(time.Second)}))
+	require.NoError(t, deliveries.Add(ctx, &history.Delivery{EventID: 2, NodeID: 67890, Status: "sent", Filename: "b.xml", Timestamp: now.Add(2 * time.Second)}))
+
+	cfg := &config.Config{AppEnv: config.TestingEnv, Auth: config.AuthConfig{Tokens: map[string]config.Role{"secret": config.AdminRole}}}
+	resolver := rstore.NewResolver(zap.NewNop(), rstore.NewMemory(zap.NewNop()), rstore.ResolverOptions{}, nil)
+	router := LoadRoutes(cfg, zap.NewNop(), &workertest.Sender{}, Options{Resolver: resolver, History: deliveries})
+
+	get := func(url, token string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("/deliveries", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/deliveries", "wrong").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/deliveries?status=lost", "secret").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/deliveries?node_id=story", "secret").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/deliveries?cursor=nope", "secret").Code)
+
+	var page history.Page
+	rec := get("/deliveries?node_id=12345&status=sent", "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Deliveries, 1)
+	assert.Equal(t, "/a.xml", page.Deliveries[0].RemotePath)
+	assert.Equal(t, "abc", page.Deliveries[0].Checksum)
+
+	rec = get("/deliveries?limit=2", "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Deliveries, 2)
+	require.NotEmpty(t, page.Next)
+	assert.Equal(t, page.Next, rec.Header().Get(nextCursorHeader))
+	rec = get("/deliveries?limit=2&cursor="+page.Next, "secret")
+	page = history.Page{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Deliveries, 1)
+	assert.Equal(t, "connection refused", page.Deliveries[0].Error)
+	assert.Empty(t, page.Next)
+
+	rec = get("/deliveries/1", "secret", "Accept", "text/csv")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/csv")
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, deliveriesCSVHeader, rows[0])
+	assert.Equal(t, []string{"1", "12345", "", "", "sent", "a.xml", "/a.xml", "abc", "10", "1", "", now.Add(time.Second).Format(time.RFC3339Nano), "0s"}, rows[1])
+	assert.Equal(t, "connection refused", rows[2][10])
+
+	assert.Equal(t, http.StatusOK, get("/deliveries/2?format=csv", "secret").Code)
+	assert.Equal(t, http.StatusNotFound, get("/deliveries/3", "secret").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/deliveries/story", "secret").Code)
+
+	// Authenticated routes are not loaded without credentials
+	cfg.Auth.Tokens = nil
+	router = LoadRoutes(cfg, zap.NewNop(), &workertest.Sender{}, Options{Resolver: resolver, History: deliveries})
+	assert.Equal(t, http.StatusNotFound, get("/deliveries", "").Code)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/archive"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+)
+
+// maxPreviewSize is the largest event previewed
+const maxPreviewSize = 100 << 20 // 100MB
+
+type previewEvent struct {
+	EventID   int64            `json:"event_id"`
+	NodeID    int64            `json:"node_id"`
+	EventType models.EventType `json:"event_type"`
+}
+
+type previewOutput struct {
+	Filename string `json:"filename"`
+	Checksum string `json:"sha256_checksum"`
+	Size     int    `json:"size_bytes"`
+	Body     string `json:"body"`
+}
+
+type previewResponse struct {
+	Event previewEvent `json:"event"`
+	// Accepted is false if any filter rejects the event, Reason is the first rejection, as the worker reports it
+	Accepted bool                     `json:"accepted"`
+	Reason   process.RejectReason     `json:"reason,omitempty"`
+	Filters  []process.FilterDecision `json:"filters"`
+	// Output is converted even if the event is rejected, nil with Error if the processor failed
+	Output *previewOutput `json:"output"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// postPreview filters and converts the models.Event JSON body, or the archive content of node_id as a created event,
+// as the worker would, without sending it. The response is 422 Unprocessable Entity if the processor failed.
+func (h *H) postPreview(c *gin.Context) {
+	var event *models.Event
+	if s := c.Query("node_id"); s != "" {
+		nodeID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "node_id must be an integer"})
+			return
+		}
+		if h.opts.Archive == nil {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "the content archive is not configured, see ARCHIVE_MONGO_URL"})
+			return
+		}
+		content, err := h.opts.Archive.FindNode(nodeID)
+		if err == archive.ErrNodeNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		event = archive.Event(content)
+	} else {
+		event = &models.Event{}
+		if err := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxPreviewSize)).Decode(event); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "body must be a models.Event: " + err.Error()})
+			return
+		}
+	}
+
+	res := previewResponse{
+		Event:   previewEvent{EventID: event.ID, NodeID: event.NodeID, EventType: event.Event},
+		Filters: process.FilterDecisions(&h.config.Processor, event),
+		Reason:  process.Filter(&h.config.Processor, event),
+	}
+	res.Accepted = res.Reason == ""
+
+	// Convert only, the output is never sent
+	output, err := h.opts.Processor.Convert(event)
+	if err != nil {
+		h.logger.Info("Preview Convert Error", zap.Error(err), zap.Int64("event_id", event.ID), zap.Int64("node_id", event.NodeID))
+		res.Error = err.Error()
+		c.JSON(http.StatusUnprocessableEntity, res)
+		return
+	}
+	res.Output = &previewOutput{
+		Filename: output.Filename,
+		Checksum: output.Checksum,
+		Size:     output.Size,
+		Body:     output.Data.String(),
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/archive"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+type testNodes map[int64]*models.Content
+
+func (n testNodes) FindNode(nodeID int64) (*models.Content, error) {
+	if c, ok := n[nodeID]; ok {
+		return c, nil
+	}
+	return nil, archive.ErrNodeNotFound
+}
+
+type failingProcessor struct{}
+
+func (failingProcessor) Convert(*models.Event) (*process.Output, error) {
+	return nil, errors.New("no tickers")
+}
+
+func TestPreview(t *testing.T) {
+	cfg := &config.Config{
+		AppEnv:    config.TestingEnv,
+		Auth:      config.AuthConfig{Tokens: map[string]config.Role{"secret": config.AdminRole}},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	s := &workertest.Sender{}
+	event := workertest.NewEvent()
+	router := LoadRoutes(cfg, zap.NewNop(), s, Options{Processor: workertest.Processor{}, Archive: testNodes{event.NodeID: &event.Content}})
+
+	post := func(url string, body []byte) (*httptest.ResponseRecorder, *previewResponse) {
+		req := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var res previewResponse
+		if rec.Code == http.StatusOK || rec.Code == http.StatusUnprocessableEntity {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		}
+		return rec, &res
+	}
+
+	body, err := json.Marshal(event)
+	require.NoError(t, err)
+	rec, res := post("/preview", body)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, res.Accepted)
+	assert.Equal(t, event.ID, res.Event.EventID)
+	require.NotNil(t, res.Output)
+	assert.Equal(t, event.Content.Title+".xml", res.Output.Filename)
+	assert.Equal(t, event.Content.Body, res.Output.Body)
+	assert.NotEmpty(t, res.Output.Checksum)
+	assert.Len(t, res.Filters, 3)
+
+	// Rejected events are converted too
+	event.Event = models.Removed
+	body, err = json.Marshal(event)
+	require.NoError(t, err)
+	rec, res = post("/preview", body)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, res.Accepted)
+	assert.Equal(t, process.UnwantedEventType, res.Reason)
+	assert.Equal(t, process.FilterDecision{Filter: "event_type", Reason: process.UnwantedEventType}, res.Filters[2])
+	assert.NotNil(t, res.Output)
+
+	// Archive nodes are previewed as created events
+	rec, res = post("/preview?node_id="+strconv.FormatInt(event.NodeID, 10), nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, res.Accepted)
+	assert.Equal(t, models.Created, res.Event.EventType)
+
+	// Content updated before IGNORE_UPDATED_BEFORE is rejected, as by the worker
+	ignoreBefore := event.Content.UpdatedAt.Add(time.Hour)
+	cutoff := *cfg
+	cutoff.Processor.IgnoreUpdatedBefore = &ignoreBefore
+	router = LoadRoutes(&cutoff, zap.NewNop(), s, Options{Processor: workertest.Processor{}, Archive: testNodes{event.NodeID: &event.Content}})
+	rec, res = post("/preview?node_id="+strconv.FormatInt(event.NodeID, 10), nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, res.Accepted)
+	assert.Equal(t, process.UpdatedBeforeIgnoreValue, res.Reason)
+	assert.Equal(t, process.FilterDecision{Filter: "ignore_updated_before", Reason: process.UpdatedBeforeIgnoreValue}, res.Filters[0])
+
+	rec, _ = post("/preview?node_id=1", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec, _ = post("/preview", []byte("not json"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.Empty(t, s.Sent, "previews are never sent")
+
+	router = LoadRoutes(cfg, zap.NewNop(), s, Options{Processor: failingProcessor{}})
+	rec, res = post("/preview", body)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "no tickers", res.Error)
+	assert.Nil(t, res.Output)
+	rec, _ = post("/preview?node_id=1", nil)
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+)
+
+// checkTimeout is how long each readiness check can take before its dependency is reported down
+const checkTimeout = 5 * time.Second
+
+type readyResponse struct {
+	Status     string                  `json:"status"`
+	Build      string                  `json:"build"`
+	Components map[string]worker.Check `json:"components"`
+}
+
+// getReady checks every dependency of the worker concurrently. The response is 503 UNAVAILABLE if any component is
+// down, otherwise 200 DEGRADED if any component is degraded, or 200 OK.
+func (h *H) getReady(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+	defer cancel()
+
+	checks := map[string]func(ctx context.Context) worker.Check{
+		"ftp": func(ctx context.Context) worker.Check {
+			return errorCheck(h.sender.Status(ctx), worker.CheckDown)
+		},
+	}
+	if h.opts.Resolver != nil {
+		checks["reference"] = func(ctx context.Context) worker.Check {
+			return errorCheck(h.opts.Resolver.Status(ctx), worker.CheckDown)
+		}
+	}
+	if h.opts.History != nil {
+		// Deliveries are sent without the history
+		checks["history"] = func(ctx context.Context) worker.Check {
+			return errorCheck(h.opts.History.Status(ctx), worker.CheckDegraded)
+		}
+	}
+	if h.opts.Pipeline != nil {
+		checks["pipeline"] = func(ctx context.Context) worker.Check {
+			return h.opts.Pipeline.Check(h.config.Ready.MaxSendAge)
+		}
+	}
+	if h.opts.Source != nil {
+		checks["source"] = h.opts.Source.Check
+	}
+
+	res := readyResponse{Status: "OK", Build: h.config.AppBuild, Components: make(map[string]worker.Check, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) worker.Check) {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+			mu.Lock()
+			res.Components[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	for name, check := range res.Components {
+		switch check.Status {
+		case worker.CheckDown:
+			res.Status, code = "UNAVAILABLE", http.StatusServiceUnavailable
+			h.logger.Warn("Worker Not Ready", zap.String("component", name), zap.String("error", check.Error))
+		case worker.CheckDegraded:
+			if code == http.StatusOK {
+				res.Status = "DEGRADED"
+			}
+		}
+	}
+
+	c.JSON(code, res)
+}
+
+// runCheck returns the check, down if it does not return before ctx is done
+func runCheck(ctx context.Context, check func(ctx context.Context) worker.Check) worker.Check {
+	done := make(chan worker.Check, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		return worker.Check{Status: worker.CheckDown, Error: "check timed out: " + ctx.Err().Error()}
+	}
+}
+
+// errorCheck is ok if err is nil, otherwise status
+func errorCheck(err error, status worker.CheckStatus) worker.Check {
+	if err != nil {
+		return worker.Check{Status: status, Error: err.Error()}
+	}
+	return worker.Check{Status: worker.CheckOK}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+func TestReady(t *testing.T) {
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		AppBuild:  "testing",
+		AppEnv:    config.TestingEnv,
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+		Ready:     config.ReadyConfig{MaxSendAge: time.Millisecond},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+	s := &workertest.Sender{}
+	pipeline, err := worker.NewPipeline(cfg, zap.NewNop(), inst, s, workertest.Processor{}, nil, nil, "testing")
+	require.NoError(t, err)
+	router := LoadRoutes(cfg, zap.NewNop(), s, Options{Pipeline: pipeline})
+
+	get := func(url string) (int, readyResponse) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var res readyResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res), rec.Body.String())
+		return rec.Code, res
+	}
+
+	// Nothing sent since the pipeline started
+	time.Sleep(5 * time.Millisecond)
+	code, res := get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "DEGRADED", res.Status)
+	assert.Equal(t, worker.CheckOK, res.Components["ftp"].Status)
+	assert.Equal(t, worker.CheckDegraded, res.Components["pipeline"].Status)
+
+	// The worker is not ready without FTP, but still alive
+	s.StatusErr = errors.New("connection refused")
+	code, res = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "UNAVAILABLE", res.Status)
+	assert.Equal(t, worker.CheckDown, res.Components["ftp"].Status)
+	assert.Equal(t, "connection refused", res.Components["ftp"].Error)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
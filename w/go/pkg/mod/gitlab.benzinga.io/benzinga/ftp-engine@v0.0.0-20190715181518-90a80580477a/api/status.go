@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,13 +10,26 @@ import (
 type statusResponse struct {
 	Status string `json:"status"`
 	Build  string `json:"build"`
+	// Paused is whether the worker pipeline is paused, see postPause
+	Paused      bool       `json:"paused"`
+	PausedSince *time.Time `json:"paused_since,omitempty"`
 }
 
+// getStatus is OK while the process runs, PAUSED if the pipeline is paused. Dependencies are checked by getReady.
 func (h *H) getStatus(c *gin.Context) {
-
-	// Ok
-	c.JSON(http.StatusOK, statusResponse{
+	res := statusResponse{
 		Status: "OK",
 		Build:  h.config.AppBuild,
-	})
+	}
+
+	// Paused workers are alive
+	if h.opts.Pipeline != nil {
+		var since time.Time
+		if res.Paused, since = h.opts.Pipeline.Paused(); res.Paused {
+			res.Status, res.PausedSince = "PAUSED", &since
+		}
+	}
+
+	// Ok
+	c.JSON(http.StatusOK, res)
 }
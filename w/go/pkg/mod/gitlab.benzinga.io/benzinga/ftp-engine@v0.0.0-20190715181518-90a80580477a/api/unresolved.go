@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+)
+
+type unresolvedResponse struct {
+	Tickers []rstore.UnresolvedTicker `json:"tickers"`
+}
+
+// getUnresolved lists the tickers the worker did not resolve, most seen first. since is an RFC3339 time, only
+// tickers seen at or after it are listed.
+func (h *H) getUnresolved(c *gin.Context) {
+	var since time.Time
+	if s := c.Query("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC3339 time"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, unresolvedResponse{Tickers: h.opts.Resolver.Unresolved(since)})
+}
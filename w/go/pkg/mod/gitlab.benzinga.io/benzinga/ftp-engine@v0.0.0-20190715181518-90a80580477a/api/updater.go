@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/refdb"
+)
+
+// UpdaterH handles the ftp-engine-updater API
+type UpdaterH struct {
+	logger  *zap.Logger
+	build   string
+	updater *refdb.Updater
+}
+
+type updaterStatusResponse struct {
+	Status  string              `json:"status"`
+	Build   string              `json:"build"`
+	Error   string              `json:"error,omitempty"`
+	Updater refdb.UpdaterStatus `json:"updater"`
+}
+
+// LoadUpdaterRoutes returns the ftp-engine-updater router, release sets the Gin release mode
+func LoadUpdaterRoutes(logger *zap.Logger, build string, release bool, u *refdb.Updater) *gin.Engine {
+
+	h := UpdaterH{
+		logger:  logger,
+		build:   build,
+		updater: u,
+	}
+
+	if release {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Init Router
+	g := gin.New()
+
+	// Middlewares
+	g.Use(gin.Recovery())
+
+	// Prometheus Endpoint
+	g.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// API Routes
+	g.GET("/healthz", h.getStatus)
+	g.GET("/readyz", h.getReady)
+
+	return g
+}
+
+// getStatus is OK while the updater runs, DEGRADED if the last refresh failed and the last snapshot is served
+func (h *UpdaterH) getStatus(c *gin.Context) {
+	status := h.updater.Status()
+
+	res := updaterStatusResponse{
+		Status:  "OK",
+		Build:   h.build,
+		Updater: status,
+	}
+	if status.Failures > 0 {
+		res.Status = "DEGRADED"
+		res.Error = status.LastError
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// getReady is OK once a snapshot is loaded and the store is available
+func (h *UpdaterH) getReady(c *gin.Context) {
+	res := updaterStatusResponse{
+		Status:  "OK",
+		Build:   h.build,
+		Updater: h.updater.Status(),
+	}
+
+	if err := h.updater.Ready(c.Request.Context()); err != nil {
+		h.logger.Warn("Updater Not Ready", zap.Error(err))
+		res.Status = "UNAVAILABLE"
+		res.Error = err.Error()
+		c.JSON(http.StatusServiceUnavailable, res)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
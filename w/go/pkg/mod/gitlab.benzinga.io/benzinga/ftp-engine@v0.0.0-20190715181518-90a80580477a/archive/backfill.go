@@ -0,0 +1,273 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender"
+)
+
+// Checkpoint records backfill progress, content is queried newest first so the cursor is the created time and
+// node ID of the last content handled
+type Checkpoint struct {
+	// Query fingerprint, a checkpoint is only resumed by the same query
+	Query   string
+	Before  time.Time
+	LastNID int
+	Done    bool
+
+	Read     int
+	Sent     int
+	Rejected int
+	Errors   int
+
+	UpdatedAt time.Time
+}
+
+// BackfillOptions ...
+type BackfillOptions struct {
+	// Query selects archive content, Before is where the backfill starts, LastNID and Skip are managed by the Backfiller
+	Query models.SimpleQuery
+	// CheckpointPath is the file progress is saved to, an existing checkpoint for the same Query is resumed
+	CheckpointPath string
+	// Rate is the maximum number of files sent per second, unlimited if 0
+	Rate float64
+}
+
+// Backfiller sends archive content to the destination as synthetic models.Created events
+type Backfiller struct {
+	log       *zap.Logger
+	cfg       *config.Config
+	queryer   models.SimpleQueryer
+	processor process.Processor
+	sender    sender.Sender
+	opts      BackfillOptions
+	limiter   <-chan time.Time
+}
+
+// NewBackfiller ...
+func NewBackfiller(cfg *config.Config, logger *zap.Logger, q models.SimpleQueryer, s sender.Sender, p process.Processor, opts BackfillOptions) (*Backfiller, error) {
+	if opts.CheckpointPath == "" {
+		return nil, errors.New("backfill checkpoint path is required")
+	}
+	if opts.Rate < 0 {
+		return nil, errors.New("backfill rate must not be negative")
+	}
+	if opts.Query.Limit <= 0 {
+		opts.Query.Limit = DefaultLimit
+	}
+
+	b := Backfiller{
+		log:       logger.Named("backfill"),
+		cfg:       cfg,
+		queryer:   q,
+		processor: p,
+		sender:    s,
+		opts:      opts,
+	}
+
+	return &b, nil
+}
+
+// Run backfills until the query is exhausted or ctx is done, progress is checkpointed after every content item
+func (b *Backfiller) Run(ctx context.Context) (*Checkpoint, error) {
+	cp, err := b.loadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	if cp.Done {
+		b.log.Info("Backfill Already Complete", zap.String("checkpoint", b.opts.CheckpointPath))
+		return cp, nil
+	}
+
+	if b.opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / b.opts.Rate))
+		defer ticker.Stop()
+		b.limiter = ticker.C
+	}
+	if cp.Read > 0 {
+		b.log.Info("Resuming Backfill", zap.Time("before", cp.Before), zap.Int("last_nid", cp.LastNID), zap.Int("sent", cp.Sent))
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return cp, err
+		}
+
+		query := b.opts.Query
+		query.Skip = 0
+		if !cp.Before.IsZero() {
+			query.Before = models.Time{Time: cp.Before}
+			query.LastNID = cp.LastNID
+		}
+
+		contents, err := b.queryer.QuerySimple(query)
+		if err != nil {
+			b.log.Error("Query Archive Error", zap.Error(err))
+			return cp, err
+		}
+		if len(contents) == 0 {
+			cp.Done = true
+			return cp, b.saveCheckpoint(cp)
+		}
+
+		for i := range contents {
+			// Send errors stop the backfill before the cursor moves, so a resumed run retries the content
+			if err := b.backfill(ctx, &contents[i], cp); err != nil {
+				if saveErr := b.saveCheckpoint(cp); saveErr != nil {
+					b.log.Error("Save Checkpoint Error", zap.Error(saveErr))
+				}
+				return cp, err
+			}
+
+			cp.Before = contents[i].CreatedAt.Time
+			cp.LastNID = contents[i].NodeID
+			if err := b.saveCheckpoint(cp); err != nil {
+				return cp, err
+			}
+		}
+	}
+}
+
+// Event wraps archive content as a synthetic models.Created event. Archive content has no pipeline event,
+// so the event ID is the content VersionID.
+func Event(c *models.Content) *models.Event {
+	return &models.Event{
+		ID:      int64(c.VersionID),
+		NodeID:  int64(c.NodeID),
+		Time:    c.UpdatedAt,
+		Content: *c,
+		Event:   models.Created,
+	}
+}
+
+// backfill filters, converts and sends a single content item. Processor errors are counted and the content
+// skipped, send errors are returned.
+func (b *Backfiller) backfill(ctx context.Context, c *models.Content, cp *Checkpoint) error {
+	event := Event(c)
+
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "Backfill Content")
+	defer span.Finish()
+	span.LogFields(otlog.Int64("node_id", event.NodeID), otlog.Int64("event_id", event.ID))
+
+	contentLog := b.log.With(zap.Int64("node_id", event.NodeID), zap.Int("version_id", c.VersionID), zap.Time("created_at", c.CreatedAt.Time))
+
+	if reason := process.Filter(&b.cfg.Processor, event); reason != "" {
+		cp.Read++
+		cp.Rejected++
+		contentLog.Debug("Ignoring Content", zap.Stringer("reason", reason))
+		return nil
+	}
+
+	output, err := b.processor.Convert(event)
+	if err != nil {
+		cp.Read++
+		cp.Errors++
+		span.LogFields(otlog.Error(err))
+		contentLog.Error("Processor Error", zap.Error(err))
+		return nil
+	}
+
+	if b.limiter != nil {
+		select {
+		case <-b.limiter:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := b.sender.Send(subCtx, output); err != nil {
+		// Not counted as read, it is retried when the backfill is resumed
+		span.LogFields(otlog.Error(err))
+		contentLog.Error("Send Error", zap.Error(err))
+		return err
+	}
+
+	cp.Read++
+	cp.Sent++
+	contentLog.Info("Content Backfilled", zap.String("filename", output.Filename), zap.Int("size", output.Size))
+	return nil
+}
+
+// queryFingerprint identifies the query options, excluding the paging fields managed by the Backfiller
+func queryFingerprint(q models.SimpleQuery) (string, error) {
+	q.LastNID, q.Skip = 0, 0
+	data, err := jsoniter.Marshal(q)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (b *Backfiller) loadCheckpoint() (*Checkpoint, error) {
+	fingerprint, err := queryFingerprint(b.opts.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(b.opts.CheckpointPath)
+	if os.IsNotExist(err) {
+		cp := Checkpoint{Query: fingerprint}
+		// An explicit Before is the starting cursor of a new backfill
+		if !b.opts.Query.Before.IsZero() {
+			cp.Before = b.opts.Query.Before.Time
+		}
+		return &cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cp Checkpoint
+	if err := jsoniter.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %s", b.opts.CheckpointPath, err)
+	}
+	if cp.Query != fingerprint {
+		return nil, fmt.Errorf("checkpoint %s is for a different query, remove it to start a new backfill", b.opts.CheckpointPath)
+	}
+	return &cp, nil
+}
+
+// saveCheckpoint writes to a temporary file then renames, so an interrupted write does not lose the checkpoint
+func (b *Backfiller) saveCheckpoint(cp *Checkpoint) error {
+	cp.UpdatedAt = time.Now()
+	data, err := jsoniter.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(b.opts.CheckpointPath), filepath.Base(b.opts.CheckpointPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), b.opts.CheckpointPath); err != nil {
+		b.log.Error("Save Checkpoint Error", zap.Error(err), zap.String("checkpoint", b.opts.CheckpointPath))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+)
+
+// memoryQueryer pages content with the same ordering and cursor as MongoQueryer
+type memoryQueryer struct {
+	contents []models.Content
+}
+
+func (q *memoryQueryer) QuerySimple(sq models.SimpleQuery) ([]models.Content, error) {
+	sort.Slice(q.contents, func(i, j int) bool {
+		a, b := q.contents[i], q.contents[j]
+		if !a.CreatedAt.Equal(b.CreatedAt.Time) {
+			return a.CreatedAt.After(b.CreatedAt.Time)
+		}
+		return a.NodeID > b.NodeID
+	})
+
+	var result []models.Content
+	for _, c := range q.contents {
+		if !sq.EarliestDate.IsZero() && c.CreatedAt.Before(sq.EarliestDate.Time) {
+			continue
+		}
+		if !sq.Before.IsZero() {
+			tie := sq.LastNID > 0 && c.CreatedAt.Equal(sq.Before.Time) && c.NodeID < sq.LastNID
+			if !c.CreatedAt.Before(sq.Before.Time) && !tie {
+				continue
+			}
+		}
+		result = append(result, c)
+		if len(result) == sq.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+type testProcessor struct{}
+
+func (testProcessor) Convert(e *models.Event) (*process.Output, error) {
+	o := &process.Output{Filename: strconv.FormatInt(e.NodeID, 10) + ".xml", Data: bytes.NewBufferString(e.Content.Body)}
+	return o.CalculateChecksumSize(), nil
+}
+
+type testSender struct {
+	sent   []string
+	failAt int
+}
+
+func (s *testSender) Send(ctx context.Context, data *process.Output) error {
+	if s.failAt > 0 && len(s.sent) == s.failAt {
+		return errors.New("connection reset")
+	}
+	s.sent = append(s.sent, data.Filename)
+	return nil
+}
+
+func (s *testSender) Status(ctx context.Context) error { return nil }
+
+func (s *testSender) Close() error { return nil }
+
+func TestBackfillResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-engine-backfill")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Nodes 1-3 share a created time to exercise the node ID cursor
+	created := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	q := &memoryQueryer{}
+	for i := 1; i <= 7; i++ {
+		c := models.Content{NodeID: i, VersionID: 100 + i, Type: "story", CreatedAt: models.Time{Time: created}}
+		if i > 3 {
+			c.CreatedAt = models.Time{Time: created.Add(time.Duration(i) * time.Hour)}
+		}
+		if i == 5 {
+			c.Type = "podcast"
+		}
+		q.contents = append(q.contents, c)
+	}
+
+	cfg := &config.Config{Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}}}
+	opts := BackfillOptions{
+		Query:          models.SimpleQuery{Limit: 2, ContentType: []string{"story", "podcast"}},
+		CheckpointPath: filepath.Join(dir, "checkpoint.json"),
+	}
+
+	// Interrupted by a send error after three files
+	s := &testSender{failAt: 3}
+	b, err := NewBackfiller(cfg, zap.NewNop(), q, s, testProcessor{}, opts)
+	require.NoError(t, err)
+	cp, err := b.Run(context.Background())
+	assert.Error(t, err)
+	assert.False(t, cp.Done)
+	assert.Equal(t, []string{"7.xml", "6.xml", "4.xml"}, s.sent, "newest first, podcast rejected")
+
+	// Resumed from the checkpoint, the failed file is retried
+	s.failAt = 0
+	b, err = NewBackfiller(cfg, zap.NewNop(), q, s, testProcessor{}, opts)
+	require.NoError(t, err)
+	cp, err = b.Run(context.Background())
+	require.NoError(t, err)
+	assert.True(t, cp.Done)
+	assert.Equal(t, []string{"7.xml", "6.xml", "4.xml", "3.xml", "2.xml", "1.xml"}, s.sent)
+	assert.Equal(t, 7, cp.Read)
+	assert.Equal(t, 6, cp.Sent)
+	assert.Equal(t, 1, cp.Rejected)
+
+	// A different query does not resume the checkpoint
+	opts.Query.Symbols = []string{"F"}
+	b, err = NewBackfiller(cfg, zap.NewNop(), q, s, testProcessor{}, opts)
+	require.NoError(t, err)
+	_, err = b.Run(context.Background())
+	assert.Error(t, err)
+}
+
+func TestEvent(t *testing.T) {
+	c := &models.Content{NodeID: 12345, VersionID: 67890, UpdatedAt: models.Time{Time: time.Now()}}
+	e := Event(c)
+	assert.Equal(t, models.Created, e.Event)
+	assert.Equal(t, int64(12345), e.NodeID)
+	assert.Equal(t, int64(67890), e.ID)
+	assert.Equal(t, c.UpdatedAt, e.Time)
+}
@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+)
+
+var _ = models.SimpleQueryer(&MongoQueryer{}) // check interface
+
+// ErrUnsupportedQuery is returned for SimpleQuery fields the content archive cannot be queried by
+var ErrUnsupportedQuery = errors.New("archive: Keywords, Sectors and PartnerID queries are not supported")
+
+// ErrNodeNotFound is returned by FindNode for node IDs that are not in the archive
+var ErrNodeNotFound = errors.New("archive: node not found")
+
+// DefaultLimit is used for queries without a Limit
+const DefaultLimit = 100
+
+// MongoQueryer queries the content archive collection of Drupal nodes
+type MongoQueryer struct {
+	log        *zap.Logger
+	session    *mgo.Session
+	collection string
+}
+
+// NewMongoQueryer dials the Mongo URL, the database is taken from the URL
+func NewMongoQueryer(logger *zap.Logger, url, collection string) (*MongoQueryer, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	// Secondaries are fine for archive reads
+	session.SetMode(mgo.SecondaryPreferred, true)
+
+	return &MongoQueryer{log: logger.Named("archive:mongo"), session: session, collection: collection}, nil
+}
+
+// QuerySimple returns content newest first by created time, then node ID. Before is exclusive, unless LastNID is
+// set, in which case content created at Before with a node ID less than LastNID is also returned; this allows
+// paging with the created time and node ID of the last result. EarliestDate is the inclusive lower bound.
+func (q *MongoQueryer) QuerySimple(sq models.SimpleQuery) ([]models.Content, error) {
+	query, err := nodeQuery(sq)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := sq.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	session := q.session.Copy()
+	defer session.Close()
+
+	find := session.DB("").C(q.collection).Find(query).Sort("-created", "-nid").Skip(sq.Skip).Limit(limit)
+	if sq.ExcludeBody {
+		find = find.Select(bson.M{"body": 0})
+	}
+
+	var nodes []models.Node
+	if err := find.All(&nodes); err != nil {
+		q.log.Error("Query Archive Error", zap.Error(err))
+		return nil, err
+	}
+
+	contents := make([]models.Content, 0, len(nodes))
+	for i := range nodes {
+		contents = append(contents, nodes[i].AsContent())
+	}
+	return contents, nil
+}
+
+// FindNode returns the content of the node, ErrNodeNotFound if it is not in the archive
+func (q *MongoQueryer) FindNode(nodeID int64) (*models.Content, error) {
+	session := q.session.Copy()
+	defer session.Close()
+
+	var node models.Node
+	if err := session.DB("").C(q.collection).Find(bson.M{"nid": nodeID}).One(&node); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrNodeNotFound
+		}
+		q.log.Error("Find Archive Node Error", zap.Error(err), zap.Int64("node_id", nodeID))
+		return nil, err
+	}
+
+	content := node.AsContent()
+	return &content, nil
+}
+
+// Close ...
+func (q *MongoQueryer) Close() {
+	q.session.Close()
+}
+
+// nodeQuery returns the Mongo query for the SimpleQuery
+func nodeQuery(sq models.SimpleQuery) (bson.M, error) {
+	if len(sq.Keywords) > 0 || len(sq.Sectors) > 0 || sq.PartnerID != "" {
+		return nil, ErrUnsupportedQuery
+	}
+
+	query := bson.M{}
+	var and []bson.M
+
+	if !sq.EarliestDate.IsZero() {
+		and = append(and, bson.M{"created": bson.M{"$gte": sq.EarliestDate.Float()}})
+	}
+	if !sq.Before.IsZero() {
+		before := sq.Before.Float()
+		if sq.LastNID > 0 {
+			and = append(and, bson.M{"$or": []bson.M{
+				{"created": bson.M{"$lt": before}},
+				{"created": before, "nid": bson.M{"$lt": sq.LastNID}},
+			}})
+		} else {
+			and = append(and, bson.M{"created": bson.M{"$lt": before}})
+		}
+	}
+	if len(sq.Channels) > 0 {
+		query["taxonomy"] = bson.M{"$elemMatch": bson.M{"vid": models.VocabChannel, "tid": bson.M{"$in": sq.Channels}}}
+	}
+	if len(sq.Symbols) > 0 {
+		// taxonomy is matched twice when filtering by channel and symbol
+		and = append(and, bson.M{"taxonomy": bson.M{"$elemMatch": bson.M{"vid": models.VocabTicker, "name": bson.M{"$in": sq.Symbols}}}})
+	}
+	if len(sq.ContentType) > 0 {
+		query["type"] = bson.M{"$in": sq.ContentType}
+	}
+	if len(sq.Sentiments) > 0 {
+		query["field_rate_bull_bear.0.value"] = bson.M{"$in": sq.Sentiments}
+	}
+	if sq.Published != nil {
+		if *sq.Published {
+			query["status"] = 1
+		} else {
+			query["status"] = bson.M{"$ne": 1}
+		}
+	}
+	if sq.IsBzPost != nil {
+		query["is_bz_post"] = boolInt(*sq.IsBzPost)
+	}
+	if sq.IsBzProPost != nil {
+		query["is_bzpro_post"] = boolInt(*sq.IsBzProPost)
+	}
+
+	if len(and) > 0 {
+		query["$and"] = and
+	}
+	return query, nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,45 @@
+package archive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+)
+
+func TestNodeQuery(t *testing.T) {
+	published := true
+	before := time.Unix(1560000000, 0)
+
+	query, err := nodeQuery(models.SimpleQuery{
+		EarliestDate: models.Time{Time: time.Unix(1550000000, 0)},
+		Before:       models.Time{Time: before},
+		LastNID:      12345,
+		Channels:     []int{16888},
+		Symbols:      []string{"F"},
+		ContentType:  []string{"story"},
+		Published:    &published,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, bson.M{
+		"$and": []bson.M{
+			{"created": bson.M{"$gte": float64(1550000000)}},
+			{"$or": []bson.M{
+				{"created": bson.M{"$lt": float64(1560000000)}},
+				{"created": float64(1560000000), "nid": bson.M{"$lt": 12345}},
+			}},
+			{"taxonomy": bson.M{"$elemMatch": bson.M{"vid": models.VocabTicker, "name": bson.M{"$in": []string{"F"}}}}},
+		},
+		"taxonomy": bson.M{"$elemMatch": bson.M{"vid": models.VocabChannel, "tid": bson.M{"$in": []int{16888}}}},
+		"type":     bson.M{"$in": []string{"story"}},
+		"status":   1,
+	}, query)
+
+	_, err = nodeQuery(models.SimpleQuery{Keywords: []string{"lng"}})
+	assert.Equal(t, ErrUnsupportedQuery, err)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/archive"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process/ravenpack"
+	"gitlab.benzinga.io/benzinga/ftp-engine/refdb"
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender/ftp"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender/local"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/kafka"
+)
+
+var build string // 0:8 GIT SHA injected at build time in Dockerfile
+
+const (
+	kafkaSource   = "kafka"
+	archiveSource = "archive"
+)
+
+// ftp-engine-replay re-sends events from the Kafka topic to the destination configured by the environment,
+// without changing the offsets of the destination's consumer group, or backfills the destination from the
+// content archive
+func main() {
+
+	var (
+		source      = flag.String("source", kafkaSource, "kafka or archive")
+		from        = flag.String("from", "", "replay messages or content from this time, RFC3339")
+		to          = flag.String("to", "", "replay messages or content until this time, RFC3339")
+		startOffset = flag.Int64("start-offset", -1, "kafka: replay messages from this offset (inclusive)")
+		endOffset   = flag.Int64("end-offset", -1, "kafka: replay messages until this offset (inclusive)")
+		partitions  = flag.String("partitions", "", "kafka: comma separated partitions to replay, default all")
+		nodeIDs     = flag.String("node-ids", "", "kafka: comma separated node IDs to replay, default all")
+		mongoURL    = flag.String("mongo-url", os.Getenv("ARCHIVE_MONGO_URL"), "archive: content archive Mongo URL including database, default $ARCHIVE_MONGO_URL")
+		collection  = flag.String("mongo-collection", "node", "archive: content archive collection")
+		channels    = flag.String("channels", "", "archive: comma separated channel IDs")
+		symbols     = flag.String("symbols", "", "archive: comma separated ticker symbols")
+		types       = flag.String("content-types", "", "archive: comma separated content types")
+		checkpoint  = flag.String("checkpoint", "", "archive: progress checkpoint file, an existing checkpoint for the same query is resumed")
+		batchSize   = flag.Int("batch-size", archive.DefaultLimit, "archive: content queried per batch")
+		rate        = flag.Float64("rate", 10, "maximum files sent per second, 0 is unlimited")
+		dryRun      = flag.String("dry-run", "", "write files to this local directory instead of the FTP destination")
+	)
+	flag.Parse()
+
+	buildString := func() string {
+		if build != "" {
+			return build
+		}
+		return "testing-unset"
+	}()
+
+	opts := kafka.ReplayOptions{
+		StartOffset: *startOffset,
+		EndOffset:   *endOffset,
+		Rate:        *rate,
+	}
+
+	var err error
+	if opts.From, err = parseTime(*from); err != nil {
+		log.Fatalln("Invalid -from", err)
+	}
+	if opts.To, err = parseTime(*to); err != nil {
+		log.Fatalln("Invalid -to", err)
+	}
+	if opts.Partitions, err = parseInts(*partitions); err != nil {
+		log.Fatalln("Invalid -partitions", err)
+	}
+	if opts.NodeIDs, err = parseInt64s(*nodeIDs); err != nil {
+		log.Fatalln("Invalid -node-ids", err)
+	}
+
+	var backfillOpts archive.BackfillOptions
+	switch *source {
+	case kafkaSource:
+		if opts.From.IsZero() && opts.To.IsZero() && opts.StartOffset < 0 && opts.EndOffset < 0 && len(opts.NodeIDs) == 0 {
+			log.Fatalln("One of -from, -to, -start-offset, -end-offset or -node-ids is required")
+		}
+	case archiveSource:
+		if *mongoURL == "" || *checkpoint == "" {
+			log.Fatalln("-mongo-url and -checkpoint are required for the archive source")
+		}
+		if opts.From.IsZero() || opts.To.IsZero() {
+			log.Fatalln("-from and -to are required for the archive source")
+		}
+		if len(opts.NodeIDs) > 0 || opts.StartOffset >= 0 || opts.EndOffset >= 0 || len(opts.Partitions) > 0 {
+			log.Fatalln("-node-ids, -start-offset, -end-offset and -partitions are not supported for the archive source")
+		}
+		channelIDs, err := parseInts(*channels)
+		if err != nil {
+			log.Fatalln("Invalid -channels", err)
+		}
+		backfillOpts = archive.BackfillOptions{
+			Query: models.SimpleQuery{
+				EarliestDate: models.Time{Time: opts.From},
+				Before:       models.Time{Time: opts.To},
+				Limit:        *batchSize,
+				Channels:     channelIDs,
+				Symbols:      splitList(*symbols),
+				ContentType:  splitList(*types),
+			},
+			CheckpointPath: *checkpoint,
+			Rate:           *rate,
+		}
+	default:
+		log.Fatalln("Invalid -source", *source)
+	}
+
+	cfg, err := config.LoadConfig(buildString)
+	if err != nil {
+		log.Fatalln("Load Config Error", err)
+	}
+	cfg.AppName = config.AppName + "-replay"
+
+	// Load Logger
+	logger, err := cfg.LoadLogger()
+	if err != nil {
+		log.Fatalln("Load Logger Error", err)
+	}
+
+	logger = logger.With(zap.String("name", cfg.Kafka.GroupID), zap.String("build", buildString), zap.String("environment", cfg.AppEnv.String()))
+	logger.Info("Initializing Replay",
+		zap.String("source", *source),
+		zap.Strings("brokers", cfg.Kafka.Brokers),
+		zap.String("topic", cfg.Kafka.Topic),
+		zap.Time("from", opts.From),
+		zap.Time("to", opts.To),
+		zap.Int64("start_offset", opts.StartOffset),
+		zap.Int64("end_offset", opts.EndOffset),
+		zap.Ints("partitions", opts.Partitions),
+		zap.Int64s("node_ids", opts.NodeIDs),
+		zap.Float64("rate", opts.Rate),
+		zap.String("dry_run", *dryRun))
+
+	// Load Tracing
+	tracer, closer, err := cfg.LoadTracer()
+	if err != nil {
+		logger.Fatal("Load Tracing Failed", zap.Error(err))
+	}
+	opentracing.SetGlobalTracer(tracer)
+
+	// Load Sender, dry runs write to a local directory
+	var s sender.Sender
+	if *dryRun != "" {
+		s, err = local.NewLocalSender(*dryRun, logger)
+	} else {
+		s, err = ftp.NewFTPSender(cfg, logger)
+	}
+	if err != nil {
+		logger.Fatal("Load Sender Error", zap.Error(err))
+	}
+
+	// Exit non-zero if any event was not replayed, registered first so it runs after cleanup
+	var failed bool
+	defer func() {
+		if failed {
+			os.Exit(1)
+		}
+	}()
+
+	defer func() {
+		closer.Close()
+		if closerErr := s.Close(); closerErr != nil {
+			logger.Error("Sender Close Error", zap.Error(closerErr))
+		}
+		if syncErr := logger.Sync(); syncErr != nil {
+			log.Println("Log Sync Error", syncErr)
+		}
+	}()
+
+	// Stop on signal, files already sent are not rolled back
+	ctx, cancel := context.WithCancel(context.Background())
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-quit
+		logger.Warn("Shutdown Signal Received")
+		cancel()
+	}()
+
+	// Load Reference Store
+	store, err := refdb.OpenStore(ctx, cfg, logger, nil)
+	if err != nil {
+		logger.Fatal("Load Reference Store Error", zap.Error(err), zap.Stringer("store", cfg.Reference.Store))
+	}
+	defer store.Close()
+
+	// Load Processor
+	var processor process.Processor
+	switch cfg.Processor.Type {
+	case config.RavenpackProcessor:
+		processor = ravenpack.NewRavenpackProcessor(cfg, rstore.NewResolver(logger, store, rstore.ResolverOptions{ExchangeFallbacks: cfg.Reference.ExchangeFallbacks}, nil), logger)
+	default:
+		logger.Fatal("Unsupported Processor Type", zap.Stringer("type", cfg.Processor.Type))
+	}
+
+	start := time.Now()
+	switch *source {
+	case kafkaSource:
+		failed = !replay(ctx, logger, cfg, s, processor, opts)
+	case archiveSource:
+		failed = !backfill(ctx, logger, cfg, s, processor, *mongoURL, *collection, backfillOpts)
+	}
+	logger.Info("Replay Finished", zap.Duration("duration", time.Since(start)), zap.Bool("failed", failed))
+}
+
+// replay re-sends events from Kafka, returning false if any event was not replayed
+func replay(ctx context.Context, logger *zap.Logger, cfg *config.Config, s sender.Sender, p process.Processor, opts kafka.ReplayOptions) bool {
+	replayer, err := kafka.NewReplayer(cfg, logger, s, p, opts)
+	if err != nil {
+		logger.Error("Load Replayer Error", zap.Error(err))
+		return false
+	}
+
+	stats, err := replayer.Run(ctx)
+	if stats != nil {
+		logger.Info("Kafka Replay Stats",
+			zap.Int("read", stats.Read),
+			zap.Int("sent", stats.Sent),
+			zap.Int("skipped", stats.Skipped),
+			zap.Int("rejected", stats.Rejected),
+			zap.Int("errors", stats.Errors))
+	}
+	if err != nil {
+		logger.Error("Replay Error", zap.Error(err))
+		return false
+	}
+	return stats.Errors == 0
+}
+
+// backfill sends archive content, returning false if the backfill did not complete or any content was not sent
+func backfill(ctx context.Context, logger *zap.Logger, cfg *config.Config, s sender.Sender, p process.Processor, mongoURL, collection string, opts archive.BackfillOptions) bool {
+	queryer, err := archive.NewMongoQueryer(logger, mongoURL, collection)
+	if err != nil {
+		logger.Error("Load Archive Error", zap.Error(err))
+		return false
+	}
+	defer queryer.Close()
+
+	backfiller, err := archive.NewBackfiller(cfg, logger, queryer, s, p, opts)
+	if err != nil {
+		logger.Error("Load Backfiller Error", zap.Error(err))
+		return false
+	}
+
+	cp, err := backfiller.Run(ctx)
+	if cp != nil {
+		logger.Info("Archive Backfill Stats",
+			zap.Int("read", cp.Read),
+			zap.Int("sent", cp.Sent),
+			zap.Int("rejected", cp.Rejected),
+			zap.Int("errors", cp.Errors),
+			zap.Bool("done", cp.Done),
+			zap.Time("before", cp.Before),
+			zap.Int("last_nid", cp.LastNID))
+	}
+	if err != nil {
+		logger.Error("Backfill Error", zap.Error(err), zap.String("checkpoint", opts.CheckpointPath))
+		return false
+	}
+	return cp.Done && cp.Errors == 0
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func parseInt64s(s string) ([]int64, error) {
+	var ids []int64
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", v)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseInts(s string) ([]int, error) {
+	ids, err := parseInt64s(s)
+	if err != nil {
+		return nil, err
+	}
+	ints := make([]int, 0, len(ids))
+	for _, id := range ids {
+		ints = append(ints, int(id))
+	}
+	return ints, nil
+}
@@ -12,19 +12,17 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/eapache/go-resiliency/retrier"
-	jsoniter "github.com/json-iterator/go"
 	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/ext"
-	tlog "github.com/opentracing/opentracing-go/log"
 	"github.com/spf13/viper"
 	jaegerconfig "github.com/uber/jaeger-client-go/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/go-playground/validator.v9"
 
+	"gitlab.benzinga.io/benzinga/ftp-engine/api"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/refdb"
 	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
-	"gitlab.benzinga.io/benzinga/reference-service/reference"
 )
 
 const AppName = "ftp-engine-updater"
@@ -50,12 +48,32 @@ func (e AppEnv) String() string {
 type Config struct {
 	AppName string `validate:"required"`
 	// AppBuild Git SHA[0:8] of current release. The value is injected into build pipeline.
-	AppBuild       string        `validate:"required"`
-	AppEnv         AppEnv        `validate:"required"`
-	Debug          bool          `validate:"required"`
+	AppBuild       string `validate:"required"`
+	AppEnv         AppEnv `validate:"required"`
+	Debug          bool   `validate:"required"`
+	ListenHost     string
+	ListenPort     string        `validate:"required"`
 	UpdateInterval time.Duration `validate:"required"`
 	RefDBEndpoint  string        `validate:"required"`
-	RedisURL       string        `validate:"required"`
+	// RefDBTimeout is the timeout of HTTP refDB downloads, refdb.DefaultTimeout if 0
+	RefDBTimeout time.Duration
+	// RefDBDelta writes only the instruments changed since the last refresh to the current snapshot
+	RefDBDelta bool
+	// RefDBMaxErrorRate is the rate of invalid instruments that aborts a refresh, refdb.DefaultMaxErrorRate if 0
+	RefDBMaxErrorRate float64 `validate:"gte=0,lte=1"`
+	// AliasesEndpoint is where the alias table is loaded from, optional
+	AliasesEndpoint string
+	RedisURL        string `validate:"required"`
+	// LeaderTTL is how long the leader lock is held without renewal, replicas take over after the leader stops
+	LeaderTTL time.Duration `validate:"required"`
+}
+
+// DefaultLeaderTTL is the default LeaderTTL
+const DefaultLeaderTTL = 30 * time.Second
+
+// ListenAPI returns the API listen address
+func (c *Config) ListenAPI() string {
+	return c.ListenHost + ":" + c.ListenPort
 }
 
 func (c *Config) LoadLogger() (*zap.Logger, error) {
@@ -124,13 +142,23 @@ func LoadConfig(appBuild string) (*Config, error) {
 	}
 
 	c := Config{
-		AppName:        AppName,
-		AppBuild:       appBuild,
-		AppEnv:         runEnv,
-		Debug:          v.GetBool("DEBUG"),
-		RedisURL:       v.GetString("REDIS_URL"),
-		UpdateInterval: v.GetDuration("REFDB_UPDATE_INTERVAL"),
-		RefDBEndpoint:  v.GetString("REFDB_ENDPOINT"),
+		AppName:           AppName,
+		AppBuild:          appBuild,
+		AppEnv:            runEnv,
+		Debug:             v.GetBool("DEBUG"),
+		ListenHost:        v.GetString("LISTEN_HOST"),
+		ListenPort:        v.GetString("LISTEN_PORT"),
+		RedisURL:          v.GetString("REDIS_URL"),
+		UpdateInterval:    v.GetDuration("REFDB_UPDATE_INTERVAL"),
+		RefDBEndpoint:     v.GetString("REFDB_ENDPOINT"),
+		RefDBTimeout:      v.GetDuration("REFDB_TIMEOUT"),
+		RefDBDelta:        v.GetBool("REFDB_DELTA"),
+		RefDBMaxErrorRate: v.GetFloat64("REFDB_MAX_ERROR_RATE"),
+		AliasesEndpoint:   v.GetString("REFDB_ALIASES_ENDPOINT"),
+		LeaderTTL:         v.GetDuration("UPDATER_LEADER_TTL"),
+	}
+	if c.LeaderTTL == 0 {
+		c.LeaderTTL = DefaultLeaderTTL
 	}
 
 	// Validate Config
@@ -175,16 +203,64 @@ func main() {
 	// Set Global Tracer
 	opentracing.SetGlobalTracer(tracer)
 
+	// Load Instrumentation
+	inst, err := instr.NewUpdaterCollector(cfg.AppName)
+	if err != nil {
+		logger.Fatal("Load Instrumentation Error", zap.Error(err))
+	}
+
 	// Cancel Context
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Do Initial Load
-	if err := refreshTickers(ctx, logger, cfg); err != nil {
-		logger.Fatal("Unable to do Inital Ticker Loading", zap.Error(err))
+	// Load Reference Store, loaded for the workers
+	store, err := rstore.NewClient(logger, cfg.RedisURL)
+	if err != nil {
+		logger.Fatal("Load Reference Store Error", zap.Error(err))
 	}
+	defer store.Close()
 
-	// Start Refresh Worker
-	go refreshWorker(ctx, logger, cfg)
+	// Only the replica holding the lock refreshes refDB
+	lock, err := store.NewLock("updater", cfg.LeaderTTL)
+	if err != nil {
+		logger.Fatal("Load Leader Lock Error", zap.Error(err))
+	}
+
+	// Load refDB Source
+	source, err := refdb.NewSource(logger.Named("refdb"), cfg.RefDBEndpoint, cfg.RefDBTimeout)
+	if err != nil {
+		logger.Fatal("Load refDB Source Error", zap.Error(err))
+	}
+	opts := refdb.RefresherOptions{
+		Delta:        cfg.RefDBDelta,
+		MaxErrorRate: cfg.RefDBMaxErrorRate,
+	}
+	if cfg.AliasesEndpoint != "" {
+		if opts.Aliases, err = refdb.NewSource(logger.Named("refdb"), cfg.AliasesEndpoint, cfg.RefDBTimeout); err != nil {
+			logger.Fatal("Load Aliases Source Error", zap.Error(err))
+		}
+	}
+	refresher := refdb.NewRefresher(logger.Named("refdb"), source, store, opts)
+
+	// Start Refresh Worker, failed refreshes keep the last snapshot
+	updater := refdb.NewUpdater(logger.Named("refdb"), refresher, cfg.UpdateInterval, lock, cfg.LeaderTTL, inst)
+	updaterDone := make(chan struct{})
+	go func() {
+		updater.Run(ctx)
+		close(updaterDone)
+	}()
+
+	logger.Info("Starting HTTP Server", zap.String("listen", cfg.ListenAPI()))
+	// Start API Server
+	srv := &http.Server{
+		Addr:    cfg.ListenAPI(),
+		Handler: api.LoadUpdaterRoutes(logger, cfg.AppBuild, cfg.AppEnv == ProductionEnv, updater),
+	}
+	go func() {
+		// serve connections
+		if srvErr := srv.ListenAndServe(); srvErr != nil && srvErr != http.ErrServerClosed {
+			logger.Fatal("Server Error", zap.Error(srvErr))
+		}
+	}()
 
 	// kill (no param) default send syscanll.SIGTERM
 	// kill -2 is syscall.SIGINT
@@ -194,105 +270,22 @@ func main() {
 
 	<-quit
 
-	closer.Close()
-	if syncErr := logger.Sync(); syncErr != nil {
-		log.Println("Log Sync Error", syncErr)
-	}
-
 	logger.Warn("Shutdown Signal Received")
 
-	cancel()
-
-	close(quit)
-}
-
-func refreshWorker(ctx context.Context, logger *zap.Logger, cfg *Config) {
-
-	ticker := time.NewTicker(cfg.UpdateInterval)
-
-	logger.Info("Starting Refresh Worker", zap.Duration("refresh_interval", cfg.UpdateInterval))
-
-	for {
-		select {
-		case <-ticker.C:
-			logger.Debug("Starting Update")
-
-			r := retrier.New(retrier.ExponentialBackoff(3, 1*time.Minute), nil)
-
-			err := r.RunCtx(ctx, func(subCtx context.Context) error {
-				if refreshErr := refreshTickers(subCtx, logger, cfg); refreshErr != nil {
-					logger.Error("Refresh Worker Error", zap.Error(refreshErr))
-					return refreshErr
-				}
-				return nil
-			})
-			if err != nil {
-				logger.Fatal("Update Failed After Retries", zap.Error(err))
-			}
-			logger.Debug("Refresh Successful")
-
-		case <-ctx.Done():
-			logger.Info("Stopping Refresh Worker")
-			return
-		}
-	}
-}
-
-func refreshTickers(ctx context.Context, logger *zap.Logger, cfg *Config) error {
-	span, subCtx := opentracing.StartSpanFromContext(ctx, "updater.refreshTickers")
-	defer span.Finish()
-
-	ext.HTTPUrl.Set(span, cfg.RefDBEndpoint)
-	ext.HTTPMethod.Set(span, http.MethodGet)
-
-	start := time.Now()
-
-	resp, err := http.Get(cfg.RefDBEndpoint)
-	if err != nil {
-		span.LogFields(tlog.Error(err))
-		logger.Error("Get refDB instruments error", zap.String("endpoint", cfg.RefDBEndpoint))
-		return err
+	subCtx, shutdownCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(subCtx); err != nil {
+		logger.Error("Server Shutdown Error", zap.Error(err))
 	}
 
-	logger.Debug("refDb Downloaded", zap.Duration("elapsed", time.Since(start)))
-	ext.HTTPStatusCode.Set(span, uint16(resp.StatusCode))
-
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			logger.Error("Response Body Close Error", zap.Error(closeErr))
-		}
-	}()
-
-	var data reference.FinancialData
-
-	if unmarshalErr := jsoniter.NewDecoder(resp.Body).Decode(&data); unmarshalErr != nil {
-		span.LogFields(tlog.Error(err))
-		logger.Error("Decode Instruments JSON Error", zap.Error(unmarshalErr))
-		return unmarshalErr
-	}
-	logger.Debug("Instruments JSON Decoded")
-
-	rClient, err := rstore.NewClient(logger, cfg.RedisURL)
-	if err != nil {
-		span.LogFields(tlog.Error(err))
-		logger.Error("rstore new client error", zap.Error(err))
-		return err
-	}
+	// Stop refreshing and release the leader lock
+	cancel()
+	<-updaterDone
 
-	for i := 0; i < len(data.Instruments); i++ {
-		if err := rClient.PutSymbolCurrency(subCtx, &data.Instruments[i]); err != nil {
-			span.LogFields(tlog.Error(err))
-			logger.Error("refresh PutSymbolCurrency error", zap.Error(err))
-			return err
-		}
-		if err := rClient.PutSymbolExchange(subCtx, &data.Instruments[i]); err != nil {
-			span.LogFields(tlog.Error(err))
-			logger.Error("refresh PutSymbolExchange error", zap.Error(err))
-			return err
-		}
+	closer.Close()
+	if syncErr := logger.Sync(); syncErr != nil {
+		log.Println("Log Sync Error", syncErr)
 	}
 
-	logger.Info("Updated Tickers", zap.Int("count", len(data.Instruments)), zap.Duration("total_duration", time.Since(start)))
-
-	return nil
+	close(quit)
 }
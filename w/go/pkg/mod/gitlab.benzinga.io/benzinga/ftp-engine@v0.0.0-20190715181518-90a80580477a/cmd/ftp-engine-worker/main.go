@@ -13,13 +13,19 @@ import (
 	"go.uber.org/zap"
 
 	"gitlab.benzinga.io/benzinga/ftp-engine/api"
+	"gitlab.benzinga.io/benzinga/ftp-engine/archive"
 	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/history"
 	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
 	"gitlab.benzinga.io/benzinga/ftp-engine/process"
 	"gitlab.benzinga.io/benzinga/ftp-engine/process/ravenpack"
+	"gitlab.benzinga.io/benzinga/ftp-engine/refdb"
 	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
 	"gitlab.benzinga.io/benzinga/ftp-engine/sender/ftp"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/dir"
 	"gitlab.benzinga.io/benzinga/ftp-engine/worker/kafka"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/push"
 )
 
 var build string // 0:8 GIT SHA injected at build time in Dockerfile
@@ -74,20 +80,6 @@ func main() {
 		logger.Fatal("Load FTP Sender Error", zap.Error(err))
 	}
 
-	router := api.LoadRoutes(cfg, logger, sender)
-	logger.Info("Starting HTTP Server", zap.String("listen", cfg.ListenAPI()))
-	// Start API Server
-	srv := &http.Server{
-		Addr:    cfg.ListenAPI(),
-		Handler: router,
-	}
-	go func() {
-		// serve connections
-		if srvErr := srv.ListenAndServe(); srvErr != nil && srvErr != http.ErrServerClosed {
-			logger.Fatal("Server Error", zap.Error(srvErr))
-		}
-	}()
-
 	defer func() {
 		closer.Close()
 		if closerErr := sender.Close(); closerErr != nil {
@@ -101,37 +93,121 @@ func main() {
 	// Cancel Context
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Load Redis
-	logger.Info("Loading Redis")
-	rClient, err := rstore.NewClient(logger, cfg.RedisURL)
+	// Load Reference Store
+	logger.Info("Loading Reference Store", zap.Stringer("store", cfg.Reference.Store))
+	store, err := refdb.OpenStore(ctx, cfg, logger, inst)
 	if err != nil {
-		logger.Fatal("Load Redis Error", zap.Error(err))
+		logger.Fatal("Load Reference Store Error", zap.Error(err), zap.Stringer("store", cfg.Reference.Store))
 	}
+	defer store.Close()
+	resolver := rstore.NewResolver(logger, store, rstore.ResolverOptions{ExchangeFallbacks: cfg.Reference.ExchangeFallbacks}, inst)
 
 	// Load Processor
 	var processor process.Processor
 	switch cfg.Processor.Type {
 	case config.RavenpackProcessor:
-		processor = ravenpack.NewRavenpackProcessor(cfg, rClient, logger)
+		processor = ravenpack.NewRavenpackProcessor(cfg, resolver, logger)
 	default:
 		logger.Fatal("Unsupported Processor Type", zap.Stringer("type", cfg.Processor.Type))
 	}
 
+	// Load Delivery History, it is per worker so it must survive restarts
+	if cfg.Delivery.HistoryPath == "" {
+		logger.Fatal("DELIVERY_HISTORY_PATH Required", zap.Stringer("environment", cfg.AppEnv))
+	}
+	deliveries, err := history.Open(logger, cfg.Delivery.HistoryPath, cfg.Delivery.HistoryRetention)
+	if err != nil {
+		logger.Fatal("Load Delivery History Error", zap.Error(err), zap.String("path", cfg.Delivery.HistoryPath))
+	}
+	defer deliveries.Close()
+	go deliveries.Run(ctx)
+
+	// Load Content Archive, optional, for previews and resends
+	var nodes api.NodeFinder
+	if cfg.Archive.MongoURL != "" {
+		queryer, err := archive.NewMongoQueryer(logger, cfg.Archive.MongoURL, cfg.Archive.Collection)
+		if err != nil {
+			logger.Fatal("Load Archive Error", zap.Error(err))
+		}
+		defer queryer.Close()
+		nodes = queryer
+	}
+
 	// Init Worker
-	logger.Info("Initializing Kafka Worker",
-		zap.Strings("brokers", cfg.Kafka.Brokers),
-		zap.String("topic", cfg.Kafka.Topic),
-		zap.String("group_id", cfg.Kafka.GroupID))
+	var w worker.Worker
+	var pushed http.Handler
+	switch cfg.Source.Type {
+	case config.KafkaSource:
+		logger.Info("Initializing Kafka Worker",
+			zap.Strings("brokers", cfg.Kafka.Brokers),
+			zap.String("topic", cfg.Kafka.Topic),
+			zap.String("group_id", cfg.Kafka.GroupID))
+		w, err = kafka.NewKafkaWorker(cfg, logger, inst, sender, processor, deliveries)
+	case config.DirSource:
+		logger.Info("Initializing Dir Worker", zap.String("path", cfg.Source.Path), zap.Duration("poll_interval", cfg.Source.PollInterval))
+		w, err = dir.NewDirWorker(cfg, logger, inst, sender, processor, deliveries)
+	case config.HTTPSource:
+		logger.Info("Initializing Push Worker", zap.String("listen", cfg.ListenAPI()))
+		var pw *push.Worker
+		if pw, err = push.NewPushWorker(cfg, logger, inst, sender, processor, deliveries); err == nil {
+			pushed = pw
+			w = pw
+		}
+	default:
+		logger.Fatal("Unsupported Source Type", zap.Stringer("type", cfg.Source.Type))
+	}
+	if err != nil {
+		logger.Fatal("Load Worker Error", zap.Error(err), zap.Stringer("source", cfg.Source.Type))
+	}
 
-	kw, err := kafka.NewKafkaWorker(cfg, logger, inst, sender, processor)
+	// Publish Audit Records, optional
+	if cfg.Kafka.AuditTopic != "" {
+		auditor, err := kafka.NewAuditWriter(cfg, logger)
+		if err != nil {
+			logger.Fatal("Load Audit Writer Error", zap.Error(err), zap.String("topic", cfg.Kafka.AuditTopic))
+		}
+		defer auditor.Close()
+		w.Pipeline().EnableAudit(auditor)
+	}
+
+	opts := api.Options{Resolver: resolver, History: deliveries, Processor: processor, Archive: nodes, Pipeline: w.Pipeline(), Push: pushed}
+	if checker, ok := w.(worker.Checker); ok {
+		opts.Source = checker
+	}
+	router := api.LoadRoutes(cfg, logger, sender, opts)
+
+	tlsConfig, err := api.TLSConfig(cfg)
 	if err != nil {
-		logger.Fatal("Load Kafka Worker Error", zap.Error(err))
+		logger.Fatal("Load API TLS Error", zap.Error(err))
+	}
+
+	logger.Info("Starting HTTP Server", zap.String("listen", cfg.ListenAPI()), zap.Bool("tls", tlsConfig != nil))
+	// Start API Server
+	srv := &http.Server{
+		Addr:      cfg.ListenAPI(),
+		Handler:   router,
+		TLSConfig: tlsConfig,
 	}
+	go func() {
+		// serve connections, the certificate is in the TLS config
+		serve := srv.ListenAndServe
+		if tlsConfig != nil {
+			serve = func() error { return srv.ListenAndServeTLS("", "") }
+		}
+		if srvErr := serve(); srvErr != nil && srvErr != http.ErrServerClosed {
+			logger.Fatal("Server Error", zap.Error(srvErr))
+		}
+	}()
 
 	// Start Worker
 	logger.Info("Starting Worker")
 
-	go kw.Work(ctx)
+	// Work returns early for sources that are read once, ex. the dir source without a poll interval
+	workDone := make(chan struct{})
+	go func() {
+		w.Work(ctx)
+		close(workDone)
+	}()
 
 	logger.Info("Worker Started")
 
@@ -141,7 +217,11 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
-	<-quit
+	select {
+	case <-quit:
+	case <-workDone:
+		logger.Info("Worker Done")
+	}
 
 	subCtx, shutdownCancel := context.WithTimeout(ctx, 5*time.Second)
 	defer shutdownCancel()
@@ -149,7 +229,7 @@ func main() {
 		logger.Error("Server Shutdown Error", zap.Error(err))
 	}
 
-	logger.Warn("Shutdown Signal Received")
+	logger.Warn("Shutting Down")
 
 	cancel()
 
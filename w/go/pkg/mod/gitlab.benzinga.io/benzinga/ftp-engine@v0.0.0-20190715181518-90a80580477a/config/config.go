@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -15,21 +17,29 @@ import (
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/go-playground/validator.v9"
 
+	"gitlab.benzinga.io/benzinga/bzkaf"
 	"gitlab.benzinga.io/benzinga/content-models/models"
 )
 
 type Config struct {
 	AppName string `validate:"required"`
 	// AppBuild Git SHA[0:8] of current release. The value is injected into build pipeline.
-	AppBuild   string          `validate:"required"`
-	AppEnv     AppEnv          `validate:"required"`
-	ListenHost string          `validate:"required"`
-	ListenPort string          `validate:"required"`
-	Debug      bool            `validate:"required"`
-	RedisURL   string          `validate:"required"`
-	Processor  ProcessorConfig `validate:"required"`
-	Kafka      KafkaConfig     `validate:"required"`
-	FTP        FTPConfig       `validate:"required"`
+	AppBuild   string `validate:"required"`
+	AppEnv     AppEnv `validate:"required"`
+	ListenHost string `validate:"required"`
+	ListenPort string `validate:"required"`
+	Debug      bool   `validate:"required"`
+	// RedisURL is required for the redis reference store
+	RedisURL  string
+	Reference ReferenceConfig `validate:"required"`
+	Processor ProcessorConfig `validate:"required"`
+	Source    SourceConfig    `validate:"required"`
+	Kafka     KafkaConfig     `validate:"required"`
+	FTP       FTPConfig       `validate:"required"`
+	Delivery  DeliveryConfig  `validate:"required"`
+	Auth      AuthConfig
+	Archive   ArchiveConfig
+	Ready     ReadyConfig
 }
 
 type ProcessorConfig struct {
@@ -48,6 +58,101 @@ type FTPConfig struct {
 	SendRetires       int `validate:"required"`
 }
 
+// DeliveryConfig configures publishing of FTP delivery records
+type DeliveryConfig struct {
+	// Topic delivery records are published to
+	Topic string `validate:"required"`
+	// BufferPath is the directory records are written to when they cannot be published, defaults to os.TempDir
+	BufferPath string `validate:"required"`
+	// RetryInterval is how often buffered records are re-published
+	RetryInterval time.Duration `validate:"required"`
+	// HistoryPath is the bbolt file sent and failed deliveries are stored in for the admin API. The history is
+	// per worker and must be on a persistent volume, it defaults to os.TempDir only in the testing environment.
+	HistoryPath string
+	// HistoryRetention is how long deliveries are stored
+	HistoryRetention time.Duration `validate:"required"`
+}
+
+// AuthConfig configures authentication of the worker API. Without tokens or client certificate roles the API is
+// unauthenticated and only serves the probes and unresolved tickers.
+type AuthConfig struct {
+	// Tokens are the roles of static bearer tokens, by token
+	Tokens map[string]Role
+	// CertRoles are the roles of mTLS client certificates, by subject common name
+	CertRoles map[string]Role
+	// TLSCertPath and TLSKeyPath serve the API over TLS
+	TLSCertPath string
+	TLSKeyPath  string
+	// ClientCAPath verifies client certificates, required for CertRoles
+	ClientCAPath string
+	// PublicProbes serves /metrics, /healthz and /readyz without authentication
+	PublicProbes bool
+}
+
+// Enabled reports if any credentials are configured
+func (a AuthConfig) Enabled() bool {
+	return len(a.Tokens) > 0 || len(a.CertRoles) > 0
+}
+
+// ReadyConfig configures when /readyz reports the worker degraded, zero values are never degraded
+type ReadyConfig struct {
+	// MaxLag is the Kafka consumer group lag of the assigned partitions, in messages, above which the source is degraded
+	MaxLag int64
+	// MaxSendAge is the time without a successful send after which the pipeline is degraded, for sources that
+	// always have content
+	MaxSendAge time.Duration
+}
+
+// ArchiveConfig configures the content archive the admin API previews nodes from
+type ArchiveConfig struct {
+	// MongoURL of the content archive including the database, nodes are not previewed if empty
+	MongoURL string
+	// Collection of archive nodes, DefaultArchiveCollection if empty
+	Collection string
+}
+
+// SourceConfig configures where the worker receives events from
+type SourceConfig struct {
+	Type SourceType `validate:"required"`
+	// Path is the directory or file of envelopes read by the dir source
+	Path string
+	// PollInterval is how often the dir source checks Path for new files, Path is read once if 0
+	PollInterval time.Duration
+}
+
+// ReferenceConfig configures the reference store tickers are looked up in
+type ReferenceConfig struct {
+	Store StoreType `validate:"required"`
+	// Path is the bbolt store file
+	Path string
+	// RefDBEndpoint is where the memory and bbolt stores are loaded from, the redis store is loaded by
+	// ftp-engine-updater
+	RefDBEndpoint string
+	// UpdateInterval is how often the memory and bbolt stores are reloaded from RefDBEndpoint
+	UpdateInterval time.Duration
+	// Timeout of HTTP refDB downloads, refdb.DefaultTimeout if 0
+	Timeout time.Duration
+	// Delta writes only the instruments changed since the last refresh, to stores that support it
+	Delta bool
+	// MaxErrorRate is the rate of invalid refDB instruments that aborts a refresh, refdb.DefaultMaxErrorRate if 0,
+	// 1 never aborts
+	MaxErrorRate float64
+	// AliasesEndpoint is where the memory and bbolt stores load the alias table from, optional, the redis store
+	// alias table is loaded by ftp-engine-updater
+	AliasesEndpoint string
+	// ExchangeFallbacks are the exchanges tickers not found on their exchange are looked up on, in order
+	ExchangeFallbacks []string
+
+	// DisableCache disables the in-process cache of redis store lookups
+	DisableCache bool
+	// CacheSize is the maximum number of cached lookups, rstore.DefaultCacheSize if 0
+	CacheSize int
+	// CacheTTL is how long instruments are cached, rstore.DefaultCacheTTL if 0
+	CacheTTL time.Duration
+	// CacheNegativeTTL is how long symbols not found are cached, rstore.DefaultCacheNegativeTTL if 0
+	CacheNegativeTTL time.Duration
+}
+
 type KafkaConfig struct {
 	Brokers []string `validate:"required"`
 	Topic   string   `validate:"required"`
@@ -58,10 +163,28 @@ type KafkaConfig struct {
 	TLSKeyPath  string
 	TLSCertPath string
 	TLSCAPath   string
+	// SignatureKeys verify envelope signatures, see bzkaf.ParseKeyring for the format. When set, envelopes with
+	// an invalid signature are rejected.
+	SignatureKeys string
+	// RequireSignature rejects unsigned envelopes, requires SignatureKeys
+	RequireSignature bool
+	// AuditTopic is the topic the audit record of every message is published to, records are only logged if empty
+	AuditTopic string
 }
 
 const AppName = "ftp-engine"
 
+const (
+	// DefaultDeliveryTopic ...
+	DefaultDeliveryTopic = "third-party-deliveries"
+	// DefaultDeliveryRetryInterval ...
+	DefaultDeliveryRetryInterval = time.Minute
+	// DefaultDeliveryHistoryRetention ...
+	DefaultDeliveryHistoryRetention = 30 * 24 * time.Hour
+	// DefaultArchiveCollection ...
+	DefaultArchiveCollection = "node"
+)
+
 // AppEnv
 type AppEnv string
 
@@ -80,6 +203,97 @@ func (e AppEnv) String() string {
 	return string(e)
 }
 
+// SourceType is where the worker receives events from
+type SourceType string
+
+const (
+	// KafkaSource consumes KafkaConfig Topic, the default
+	KafkaSource SourceType = "kafka"
+	// DirSource reads envelopes from .json and .jsonl files in SourceConfig Path
+	DirSource SourceType = "dir"
+	// HTTPSource accepts envelopes POSTed to the API /events endpoint
+	HTTPSource SourceType = "http"
+)
+
+// String ...
+func (s SourceType) String() string {
+	return string(s)
+}
+
+// StoreType is the reference store tickers are looked up in
+type StoreType string
+
+const (
+	// RedisStore is shared by workers and loaded by ftp-engine-updater, the default
+	RedisStore StoreType = "redis"
+	// MemoryStore is loaded from refDB by each worker
+	MemoryStore StoreType = "memory"
+	// BoltStore is a bbolt file loaded from refDB by each worker, kept across restarts
+	BoltStore StoreType = "bbolt"
+)
+
+// String ...
+func (s StoreType) String() string {
+	return string(s)
+}
+
+// Role of an API client, each role can use the routes of the roles before it. IngestRole is not in this order.
+type Role string
+
+const (
+	// ReadOnlyRole lists deliveries and unresolved tickers and previews events
+	ReadOnlyRole Role = "read-only"
+	// OperatorRole pauses and resumes the worker and pushes events
+	OperatorRole Role = "operator"
+	// AdminRole resends events
+	AdminRole Role = "admin"
+	// IngestRole only pushes events to the http source
+	IngestRole Role = "ingest"
+)
+
+// roles in order, each allows the roles before it
+var roles = []Role{ReadOnlyRole, OperatorRole, AdminRole}
+
+// String ...
+func (r Role) String() string {
+	return string(r)
+}
+
+// Allows reports if r can use the routes of role, the ingest routes are also allowed to operators
+func (r Role) Allows(role Role) bool {
+	if role == IngestRole {
+		if r == IngestRole {
+			return true
+		}
+		role = OperatorRole
+	}
+	return r.level() >= role.level() && r.level() > 0
+}
+
+func (r Role) level() int {
+	for i, role := range roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// parseRoles parses the comma separated <role>:<value> list of s into roles by value. Values can be secrets, so
+// errors only include the entry position.
+func parseRoles(s string) (map[string]Role, error) {
+	values := make(map[string]Role)
+	for i, entry := range splitList(s) {
+		parts := strings.SplitN(entry, ":", 2)
+		role := Role(strings.ToLower(parts[0]))
+		if len(parts) != 2 || parts[1] == "" || (role.level() == 0 && role != IngestRole) {
+			return nil, fmt.Errorf("invalid entry %d, expected <read-only|operator|admin|ingest>:<value>", i+1)
+		}
+		values[parts[1]] = role
+	}
+	return values, nil
+}
+
 // ProcessorType indicates formater/Processor to use for output
 type ProcessorType string
 
@@ -104,6 +318,7 @@ func LoadConfig(appBuild string) (*Config, error) {
 	v.AddConfigPath("../config")
 	v.AddConfigPath("../../config")
 	v.SetConfigName("config")
+	v.SetDefault("API_PUBLIC_PROBES", true)
 	if err := v.ReadInConfig(); err != nil {
 		fmt.Printf("Config file not found, using ENV vars. Note: This is expected behavior. Msg: %s", err)
 	}
@@ -151,6 +366,32 @@ func LoadConfig(appBuild string) (*Config, error) {
 		}
 	}
 
+	// Determine Reference Store
+	var storeType StoreType
+	switch store := strings.ToLower(v.GetString("REFERENCE_STORE")); store {
+	case "", RedisStore.String():
+		storeType = RedisStore
+	case MemoryStore.String():
+		storeType = MemoryStore
+	case BoltStore.String():
+		storeType = BoltStore
+	default:
+		return nil, fmt.Errorf("invalid reference store '%s'", store)
+	}
+
+	// Determine Source
+	var sourceType SourceType
+	switch source := strings.ToLower(v.GetString("SOURCE")); source {
+	case "", KafkaSource.String():
+		sourceType = KafkaSource
+	case DirSource.String():
+		sourceType = DirSource
+	case HTTPSource.String():
+		sourceType = HTTPSource
+	default:
+		return nil, fmt.Errorf("invalid source '%s'", source)
+	}
+
 	c := Config{
 		AppName:    AppName,
 		AppBuild:   appBuild,
@@ -159,6 +400,23 @@ func LoadConfig(appBuild string) (*Config, error) {
 		ListenPort: v.GetString("LISTEN_PORT"),
 		ListenHost: v.GetString("LISTEN_HOST"),
 		RedisURL:   v.GetString("REDIS_URL"),
+		Reference: ReferenceConfig{
+			Store:          storeType,
+			Path:           v.GetString("REFERENCE_STORE_PATH"),
+			RefDBEndpoint:  v.GetString("REFDB_ENDPOINT"),
+			UpdateInterval: v.GetDuration("REFDB_UPDATE_INTERVAL"),
+			Timeout:        v.GetDuration("REFDB_TIMEOUT"),
+			Delta:          v.GetBool("REFDB_DELTA"),
+			MaxErrorRate:   v.GetFloat64("REFDB_MAX_ERROR_RATE"),
+
+			AliasesEndpoint:   v.GetString("REFDB_ALIASES_ENDPOINT"),
+			ExchangeFallbacks: splitList(v.GetString("REFERENCE_EXCHANGE_FALLBACKS")),
+
+			DisableCache:     v.GetBool("REFERENCE_CACHE_DISABLE"),
+			CacheSize:        v.GetInt("REFERENCE_CACHE_SIZE"),
+			CacheTTL:         v.GetDuration("REFERENCE_CACHE_TTL"),
+			CacheNegativeTTL: v.GetDuration("REFERENCE_CACHE_NEGATIVE_TTL"),
+		},
 		Processor: ProcessorConfig{
 			Type:           processorType,
 			AcceptedEvents: processorEvents,
@@ -172,6 +430,11 @@ func LoadConfig(appBuild string) (*Config, error) {
 			KeepAliveInterval: v.GetDuration("FTP_KEEPALIVE_INTERVAL"),
 			SendRetires:       v.GetInt("FTP_SEND_RETRIES"),
 		},
+		Source: SourceConfig{
+			Type:         sourceType,
+			Path:         v.GetString("SOURCE_PATH"),
+			PollInterval: v.GetDuration("SOURCE_POLL_INTERVAL"),
+		},
 		Kafka: KafkaConfig{
 			Brokers:     strings.Split(v.GetString("KAFKA_BROKERS"), ","),
 			Topic:       v.GetString("KAFKA_TOPIC"),
@@ -181,7 +444,112 @@ func LoadConfig(appBuild string) (*Config, error) {
 			TLSCAPath:   v.GetString("KAFKA_TLS_CA"),
 			TLSCertPath: v.GetString("KAFKA_TLS_CERT"),
 			TLSKeyPath:  v.GetString("KAFKA_TLS_KEY"),
+
+			SignatureKeys:    v.GetString("KAFKA_SIGNATURE_KEYS"),
+			RequireSignature: v.GetBool("KAFKA_REQUIRE_SIGNATURE"),
+			AuditTopic:       v.GetString("KAFKA_AUDIT_TOPIC"),
+		},
+		Delivery: DeliveryConfig{
+			Topic:            v.GetString("KAFKA_DELIVERY_TOPIC"),
+			BufferPath:       v.GetString("DELIVERY_BUFFER_PATH"),
+			RetryInterval:    v.GetDuration("DELIVERY_RETRY_INTERVAL"),
+			HistoryPath:      v.GetString("DELIVERY_HISTORY_PATH"),
+			HistoryRetention: v.GetDuration("DELIVERY_HISTORY_RETENTION"),
 		},
+		Auth: AuthConfig{
+			TLSCertPath:  v.GetString("API_TLS_CERT"),
+			TLSKeyPath:   v.GetString("API_TLS_KEY"),
+			ClientCAPath: v.GetString("API_TLS_CLIENT_CA"),
+			PublicProbes: v.GetBool("API_PUBLIC_PROBES"),
+		},
+		Ready: ReadyConfig{
+			MaxLag:     v.GetInt64("READY_MAX_LAG"),
+			MaxSendAge: v.GetDuration("READY_MAX_SEND_AGE"),
+		},
+		Archive: ArchiveConfig{
+			MongoURL:   v.GetString("ARCHIVE_MONGO_URL"),
+			Collection: v.GetString("ARCHIVE_MONGO_COLLECTION"),
+		},
+	}
+
+	// Set Delivery Defaults
+	if c.Delivery.Topic == "" {
+		c.Delivery.Topic = DefaultDeliveryTopic
+	}
+	if c.Delivery.BufferPath == "" {
+		c.Delivery.BufferPath = filepath.Join(os.TempDir(), AppName+"-deliveries")
+	}
+	if c.Delivery.RetryInterval == 0 {
+		c.Delivery.RetryInterval = DefaultDeliveryRetryInterval
+	}
+	if c.Delivery.HistoryPath == "" && c.AppEnv == TestingEnv {
+		c.Delivery.HistoryPath = filepath.Join(os.TempDir(), AppName+"-"+c.Kafka.GroupID+"-history.bolt")
+	}
+	if c.Delivery.HistoryRetention <= 0 {
+		c.Delivery.HistoryRetention = DefaultDeliveryHistoryRetention
+	}
+	if c.Ready.MaxLag < 0 || c.Ready.MaxSendAge < 0 {
+		return nil, errors.New("READY_MAX_LAG and READY_MAX_SEND_AGE can not be negative")
+	}
+	if c.Archive.Collection == "" {
+		c.Archive.Collection = DefaultArchiveCollection
+	}
+
+	switch c.Reference.Store {
+	case RedisStore:
+		if c.RedisURL == "" {
+			return nil, errors.New("REDIS_URL is required for the redis reference store")
+		}
+	case BoltStore:
+		if c.Reference.Path == "" {
+			return nil, errors.New("REFERENCE_STORE_PATH is required for the bbolt reference store")
+		}
+		fallthrough
+	case MemoryStore:
+		if c.Reference.RefDBEndpoint == "" || c.Reference.UpdateInterval <= 0 {
+			return nil, fmt.Errorf("REFDB_ENDPOINT and REFDB_UPDATE_INTERVAL are required for the %s reference store", c.Reference.Store)
+		}
+	}
+
+	if c.Reference.MaxErrorRate < 0 || c.Reference.MaxErrorRate > 1 {
+		return nil, errors.New("REFDB_MAX_ERROR_RATE must be between 0 and 1")
+	}
+	if c.Reference.CacheSize < 0 || c.Reference.CacheTTL < 0 || c.Reference.CacheNegativeTTL < 0 {
+		return nil, errors.New("REFERENCE_CACHE_SIZE, REFERENCE_CACHE_TTL and REFERENCE_CACHE_NEGATIVE_TTL can not be negative")
+	}
+
+	if c.Source.Type == DirSource && c.Source.Path == "" {
+		return nil, errors.New("SOURCE_PATH is required for the dir source")
+	}
+
+	// Load API Roles, the ADMIN_API_TOKEN token is an admin token
+	var err error
+	if c.Auth.Tokens, err = parseRoles(v.GetString("API_TOKENS")); err != nil {
+		return nil, fmt.Errorf("API_TOKENS: %s", err)
+	}
+	if token := v.GetString("ADMIN_API_TOKEN"); token != "" {
+		c.Auth.Tokens[token] = AdminRole
+	}
+	if c.Auth.CertRoles, err = parseRoles(v.GetString("API_CLIENT_ROLES")); err != nil {
+		return nil, fmt.Errorf("API_CLIENT_ROLES: %s", err)
+	}
+	if (c.Auth.TLSCertPath == "") != (c.Auth.TLSKeyPath == "") {
+		return nil, errors.New("API_TLS_CERT and API_TLS_KEY must be set together")
+	}
+	if c.Auth.ClientCAPath != "" && c.Auth.TLSCertPath == "" {
+		return nil, errors.New("API_TLS_CLIENT_CA requires API_TLS_CERT and API_TLS_KEY")
+	}
+	if len(c.Auth.CertRoles) > 0 && c.Auth.ClientCAPath == "" {
+		return nil, errors.New("API_CLIENT_ROLES requires API_TLS_CLIENT_CA")
+	}
+
+	if c.Kafka.RequireSignature && c.Kafka.SignatureKeys == "" {
+		return nil, errors.New("KAFKA_REQUIRE_SIGNATURE set without KAFKA_SIGNATURE_KEYS")
+	}
+	if c.Kafka.SignatureKeys != "" {
+		if _, err := bzkaf.ParseKeyring(c.Kafka.SignatureKeys); err != nil {
+			return nil, fmt.Errorf("KAFKA_SIGNATURE_KEYS: %s", err)
+		}
 	}
 
 	// Set Ignore Updated Before, this setting tells worker to ignore content with an `UpdatedAt` before this time
@@ -202,6 +570,17 @@ func LoadConfig(appBuild string) (*Config, error) {
 	return &c, nil
 }
 
+// splitList returns the comma separated values of s without spaces around them, nil if s is empty
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func (c *Config) ListenAPI() string {
 	return c.ListenHost + ":" + c.ListenPort
 }
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"encoding/base64"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,6 +19,125 @@ func TestLoadConfig(t *testing.T) {
 
 }
 
+func TestLoadConfigRequireSignature(t *testing.T) {
+	require.NoError(t, os.Setenv("KAFKA_REQUIRE_SIGNATURE", "true"))
+	defer os.Unsetenv("KAFKA_REQUIRE_SIGNATURE")
+
+	_, err := LoadConfig(testBuild)
+	assert.Error(t, err, "signature keys are required")
+
+	require.NoError(t, os.Setenv("KAFKA_SIGNATURE_KEYS", "2019-07:hmac-sha256:c2VjcmV0"))
+	defer os.Unsetenv("KAFKA_SIGNATURE_KEYS")
+
+	_, err = LoadConfig(testBuild)
+	assert.Error(t, err, "HMAC keys shorter than 32 bytes are rejected")
+
+	require.NoError(t, os.Setenv("KAFKA_SIGNATURE_KEYS", "2019-07:hmac-sha256:"+base64.StdEncoding.EncodeToString([]byte("ftp-engine-test-signature-secret"))))
+
+	cfg, err := LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.True(t, cfg.Kafka.RequireSignature)
+}
+
+func TestLoadConfigSource(t *testing.T) {
+	cfg, err := LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.Equal(t, KafkaSource, cfg.Source.Type, "kafka is the default source")
+
+	require.NoError(t, os.Setenv("SOURCE", "dir"))
+	defer os.Unsetenv("SOURCE")
+
+	_, err = LoadConfig(testBuild)
+	assert.Error(t, err, "dir source path is required")
+
+	require.NoError(t, os.Setenv("SOURCE_PATH", "/tmp/events"))
+	defer os.Unsetenv("SOURCE_PATH")
+
+	cfg, err = LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.Equal(t, DirSource, cfg.Source.Type)
+	assert.Equal(t, "/tmp/events", cfg.Source.Path)
+
+	require.NoError(t, os.Setenv("SOURCE", "carrier-pigeon"))
+	_, err = LoadConfig(testBuild)
+	assert.Error(t, err)
+}
+
+func TestLoadConfigReferenceStore(t *testing.T) {
+	cfg, err := LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.Equal(t, RedisStore, cfg.Reference.Store, "redis is the default reference store")
+
+	require.NoError(t, os.Setenv("REFERENCE_STORE", "bbolt"))
+	defer os.Unsetenv("REFERENCE_STORE")
+
+	_, err = LoadConfig(testBuild)
+	assert.Error(t, err, "bbolt store path is required")
+
+	require.NoError(t, os.Setenv("REFERENCE_STORE_PATH", "/tmp/refdb.bolt"))
+	defer os.Unsetenv("REFERENCE_STORE_PATH")
+
+	cfg, err = LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.Equal(t, BoltStore, cfg.Reference.Store)
+	assert.Equal(t, "/tmp/refdb.bolt", cfg.Reference.Path)
+	assert.NotEmpty(t, cfg.Reference.RefDBEndpoint)
+
+	require.NoError(t, os.Setenv("REFDB_UPDATE_INTERVAL", "0s"))
+	defer os.Unsetenv("REFDB_UPDATE_INTERVAL")
+	require.NoError(t, os.Setenv("REFERENCE_STORE", "memory"))
+	_, err = LoadConfig(testBuild)
+	assert.Error(t, err, "refDB update interval is required")
+
+	require.NoError(t, os.Setenv("REFERENCE_STORE", "sqlite"))
+	_, err = LoadConfig(testBuild)
+	assert.Error(t, err)
+}
+
+func TestLoadConfigReferenceCache(t *testing.T) {
+	cfg, err := LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.False(t, cfg.Reference.DisableCache)
+	assert.Equal(t, 10000, cfg.Reference.CacheSize)
+	assert.Equal(t, time.Minute, cfg.Reference.CacheNegativeTTL)
+
+	require.NoError(t, os.Setenv("REFERENCE_CACHE_TTL", "-1m"))
+	defer os.Unsetenv("REFERENCE_CACHE_TTL")
+	_, err = LoadConfig(testBuild)
+	assert.Error(t, err)
+}
+
+func TestLoadConfigMaxErrorRate(t *testing.T) {
+	cfg, err := LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, cfg.Reference.MaxErrorRate)
+
+	require.NoError(t, os.Setenv("REFDB_MAX_ERROR_RATE", "1.5"))
+	defer os.Unsetenv("REFDB_MAX_ERROR_RATE")
+	_, err = LoadConfig(testBuild)
+	assert.Error(t, err)
+}
+
+func TestLoadConfigHistoryPath(t *testing.T) {
+	cfg, err := LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.NotEmpty(t, cfg.Delivery.HistoryPath, "temporary file for tests")
+
+	require.NoError(t, os.Setenv("ENVIRONMENT", "production"))
+	defer os.Unsetenv("ENVIRONMENT")
+	cfg, err = LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Delivery.HistoryPath, "the worker requires a persistent path")
+}
+
+func TestLoadConfigExchangeFallbacks(t *testing.T) {
+	require.NoError(t, os.Setenv("REFERENCE_EXCHANGE_FALLBACKS", "NYSE, NASDAQ,,OTC"))
+	defer os.Unsetenv("REFERENCE_EXCHANGE_FALLBACKS")
+	cfg, err := LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"NYSE", "NASDAQ", "OTC"}, cfg.Reference.ExchangeFallbacks)
+}
+
 func TestListenAPI(t *testing.T) {
 	cfg, err := LoadConfig(testBuild)
 	require.NoError(t, err)
@@ -47,3 +169,43 @@ func TestLoadTracer(t *testing.T) {
 
 	assert.NoError(t, closer.Close())
 }
+
+func TestLoadConfigAuth(t *testing.T) {
+	cfg, err := LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.False(t, cfg.Auth.Enabled())
+	assert.True(t, cfg.Auth.PublicProbes, "probes are public by default")
+
+	require.NoError(t, os.Setenv("API_TOKENS", "read-only:abc, Operator:d:e, ingest:f"))
+	defer os.Unsetenv("API_TOKENS")
+	require.NoError(t, os.Setenv("ADMIN_API_TOKEN", "secret"))
+	defer os.Unsetenv("ADMIN_API_TOKEN")
+
+	cfg, err = LoadConfig(testBuild)
+	require.NoError(t, err)
+	assert.True(t, cfg.Auth.Enabled())
+	assert.Equal(t, map[string]Role{"abc": ReadOnlyRole, "d:e": OperatorRole, "f": IngestRole, "secret": AdminRole}, cfg.Auth.Tokens)
+
+	require.NoError(t, os.Setenv("API_CLIENT_ROLES", "admin:ops-cli"))
+	defer os.Unsetenv("API_CLIENT_ROLES")
+	_, err = LoadConfig(testBuild)
+	assert.Error(t, err, "client roles require a client CA")
+
+	require.NoError(t, os.Setenv("API_CLIENT_ROLES", "superuser:ops-cli"))
+	_, err = LoadConfig(testBuild)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "ops-cli", "values are not in errors")
+}
+
+func TestRoleAllows(t *testing.T) {
+	assert.True(t, AdminRole.Allows(OperatorRole))
+	assert.True(t, OperatorRole.Allows(OperatorRole))
+	assert.False(t, OperatorRole.Allows(AdminRole))
+	assert.True(t, ReadOnlyRole.Allows(ReadOnlyRole))
+	assert.False(t, Role("").Allows(ReadOnlyRole))
+	assert.False(t, Role("superuser").Allows(Role("superuser")))
+	assert.True(t, IngestRole.Allows(IngestRole))
+	assert.True(t, OperatorRole.Allows(IngestRole))
+	assert.False(t, ReadOnlyRole.Allows(IngestRole))
+	assert.False(t, IngestRole.Allows(ReadOnlyRole))
+}
@@ -0,0 +1,362 @@
+// Package history stores the outcome of each event the worker sent or failed to send, so deliveries can be looked
+// up by event and node ID without searching the logs
+package history
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tlog "github.com/opentracing/opentracing-go/log"
+	"github.com/vmihailenco/msgpack"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultLimit is the number of deliveries listed if the query has no limit
+	DefaultLimit = 100
+	// MaxLimit is the most deliveries listed at once
+	MaxLimit = 1000
+
+	// pruneInterval is how often deliveries older than the retention are removed
+	pruneInterval = time.Hour
+)
+
+var (
+	// deliveriesBucket has the deliveries by time, keyed by the time and a sequence number
+	deliveriesBucket = []byte("deliveries")
+	// eventsBucket indexes the deliveries keys by event ID
+	eventsBucket = []byte("events")
+	// nodesBucket indexes the deliveries keys by node ID
+	nodesBucket = []byte("nodes")
+)
+
+// keySize is the size of a deliveries key, 8 bytes of time and 8 bytes of sequence
+const keySize = 16
+
+// ErrInvalidCursor is returned for a Query Cursor that was not returned by List
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Delivery is the outcome of sending an event, Status is "sent" or "failed", see worker.Status
+type Delivery struct {
+	EventID    int64  `json:"event_id"`
+	NodeID     int64  `json:"node_id"`
+	EnvelopeID string `json:"envelope_id"`
+	EventType  string `json:"event_type"`
+	Status     string `json:"status"`
+	// Filename and RemotePath are empty if the event failed to convert
+	Filename   string `json:"filename"`
+	RemotePath string `json:"remote_path"`
+	Checksum   string `json:"sha256_checksum"`
+	SizeBytes  int    `json:"size_bytes"`
+	Attempts   int    `json:"attempts"`
+	// Error is the convert or send error of failed deliveries
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// Latency is the time from the source message being received to the file being delivered or failing
+	Latency time.Duration `json:"latency"`
+}
+
+// Query filters the deliveries listed, zero values do not filter
+type Query struct {
+	NodeID int64
+	Since  time.Time
+	Status string
+	// Cursor is the Page Next of the previous page
+	Cursor string
+	// Limit is DefaultLimit if 0, at most MaxLimit
+	Limit int
+}
+
+// Page of deliveries, newest first
+type Page struct {
+	Deliveries []Delivery `json:"deliveries"`
+	// Next is the Query Cursor of the next page, empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+// Store is a bbolt file of deliveries, deliveries older than the retention are removed
+type Store struct {
+	db        *bolt.DB
+	logger    *zap.Logger
+	retention time.Duration
+}
+
+// Open opens or creates the bbolt file at path. The file is locked, so only one process can open it. Deliveries are
+// kept forever if retention is 0.
+func Open(l *zap.Logger, path string, retention time.Duration) (*Store, error) {
+	db, err := bolt.Open(path, 0640, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{deliveriesBucket, eventsBucket, nodesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db, logger: l.Named("history"), retention: retention}, nil
+}
+
+// Add stores the delivery and indexes it by event and node ID
+func (s *Store) Add(ctx context.Context, d *Delivery) error {
+	span, _ := opentracing.StartSpanFromContext(ctx, "history.Add")
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.Int64("event_id", d.EventID), tlog.String("status", d.Status))
+
+	value, err := msgpack.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		deliveries := tx.Bucket(deliveriesBucket)
+		seq, err := deliveries.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, keySize)
+		binary.BigEndian.PutUint64(key, uint64(d.Timestamp.UnixNano()))
+		binary.BigEndian.PutUint64(key[8:], seq)
+
+		if err := deliveries.Put(key, value); err != nil {
+			return err
+		}
+		if err := tx.Bucket(eventsBucket).Put(indexKey(d.EventID, key), nil); err != nil {
+			return err
+		}
+		return tx.Bucket(nodesBucket).Put(indexKey(d.NodeID, key), nil)
+	}); err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		s.logger.Error("Bolt Add Delivery Error", zap.Error(err), zap.Int64("event_id", d.EventID))
+		return err
+	}
+
+	return nil
+}
+
+// Get returns the deliveries of the event, newest first, none if the event was not sent
+func (s *Store) Get(ctx context.Context, eventID int64) ([]Delivery, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "history.Get")
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.Int64("event_id", eventID))
+
+	var deliveries []Delivery
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return scan(tx, eventsBucket, idPrefix(eventID), nil, func(key []byte, d *Delivery) bool {
+			deliveries = append(deliveries, *d)
+			return true
+		})
+	}); err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		s.logger.Error("Bolt Get Deliveries Error", zap.Error(err), zap.Int64("event_id", eventID))
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// List returns a page of the deliveries matching the query, newest first
+func (s *Store) List(ctx context.Context, q Query) (*Page, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "history.List")
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.Int64("node_id", q.NodeID), tlog.String("status", q.Status), tlog.String("cursor", q.Cursor))
+
+	var before []byte
+	if q.Cursor != "" {
+		var err error
+		if before, err = hex.DecodeString(q.Cursor); err != nil || len(before) != keySize {
+			return nil, ErrInvalidCursor
+		}
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	page := Page{Deliveries: []Delivery{}}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		fn := func(key []byte, d *Delivery) bool {
+			if d.Timestamp.Before(q.Since) {
+				return false
+			}
+			if q.Status != "" && d.Status != q.Status {
+				return true
+			}
+			if len(page.Deliveries) == limit {
+				// There is at least one more delivery, the next page starts before the last one listed
+				page.Next = hex.EncodeToString(before)
+				return false
+			}
+			page.Deliveries = append(page.Deliveries, *d)
+			before = key
+			return true
+		}
+
+		if q.NodeID != 0 {
+			return scan(tx, nodesBucket, idPrefix(q.NodeID), before, fn)
+		}
+		return scan(tx, nil, nil, before, fn)
+	})
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		s.logger.Error("Bolt List Deliveries Error", zap.Error(err))
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// Prune removes the deliveries before t and returns how many were removed
+func (s *Store) Prune(ctx context.Context, t time.Time) (int, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "history.Prune")
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+
+	end := make([]byte, 8)
+	binary.BigEndian.PutUint64(end, uint64(t.UnixNano()))
+
+	var removed int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		deliveries := tx.Bucket(deliveriesBucket)
+		// Keys are collected before deleting, as deleting moves the cursor
+		var keys [][]byte
+		c := deliveries.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) < 0; k, _ = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+		}
+
+		for _, k := range keys {
+			var d Delivery
+			if err := msgpack.Unmarshal(deliveries.Get(k), &d); err != nil {
+				return err
+			}
+			if err := tx.Bucket(eventsBucket).Delete(indexKey(d.EventID, k)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(nodesBucket).Delete(indexKey(d.NodeID, k)); err != nil {
+				return err
+			}
+			if err := deliveries.Delete(k); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	span.LogFields(tlog.Int("removed", removed))
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		s.logger.Error("Bolt Prune Deliveries Error", zap.Error(err))
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// Run removes the deliveries older than the retention every hour until ctx is done
+func (s *Store) Run(ctx context.Context) {
+	if s.retention == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if removed, err := s.Prune(ctx, time.Now().Add(-s.retention)); err == nil && removed > 0 {
+			s.logger.Info("Deliveries Pruned", zap.Int("removed", removed), zap.Duration("retention", s.retention))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Status checks the file can be read
+func (s *Store) Status(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(deliveriesBucket) == nil {
+			return errors.New("bbolt deliveries bucket missing")
+		}
+		return nil
+	})
+}
+
+// Close ...
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// scan calls fn with the deliveries before the before key, newest first, until fn returns false. Deliveries are
+// read from the index bucket entries starting with prefix, or the deliveries bucket if index is nil.
+func scan(tx *bolt.Tx, index, prefix, before []byte, fn func(key []byte, d *Delivery) bool) error {
+	deliveries := tx.Bucket(deliveriesBucket)
+	bucket := deliveries
+	if index != nil {
+		bucket = tx.Bucket(index)
+	}
+
+	end := before
+	if end == nil {
+		end = bytes.Repeat([]byte{0xff}, keySize)
+	}
+	c := bucket.Cursor()
+	k, v := c.Seek(append(append([]byte{}, prefix...), end...))
+	if k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+		key := k[len(prefix):]
+		if index != nil {
+			v = deliveries.Get(key)
+		}
+		var d Delivery
+		if err := msgpack.Unmarshal(v, &d); err != nil {
+			return err
+		}
+		if !fn(key, &d) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func idPrefix(id int64) []byte {
+	prefix := make([]byte, 8)
+	binary.BigEndian.PutUint64(prefix, uint64(id))
+	return prefix
+}
+
+func indexKey(id int64, key []byte) []byte {
+	return append(idPrefix(id), key...)
+}
@@ -0,0 +1,119 @@
+package history
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func testStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "ftp-engine-history")
+	require.NoError(t, err)
+
+	s, err := Open(zap.NewNop(), filepath.Join(dir, "history.bolt"), time.Hour)
+	require.NoError(t, err)
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, done := testStore(t)
+	defer done()
+	ctx := context.Background()
+
+	start := time.Now().Add(-time.Hour).UTC()
+	for i, d := range []Delivery{
+		{EventID: 1, NodeID: 100, Status: "sent", Filename: "a.xml"},
+		{EventID: 2, NodeID: 200, Status: "failed", Error: "connection refused"},
+		{EventID: 2, NodeID: 200, Status: "sent", Filename: "b.xml"},
+		{EventID: 3, NodeID: 100, Status: "sent", Filename: "c.xml"},
+		{EventID: 4, NodeID: 300, Status: "sent", Filename: "d.xml"},
+	} {
+		d.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, s.Add(ctx, &d))
+	}
+	require.NoError(t, s.Status(ctx))
+
+	deliveries, err := s.Get(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, "sent", deliveries[0].Status, "newest first")
+	assert.Equal(t, "connection refused", deliveries[1].Error)
+
+	deliveries, err = s.Get(ctx, 5)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	events := func(p *Page) []int64 {
+		var ids []int64
+		for _, d := range p.Deliveries {
+			ids = append(ids, d.EventID)
+		}
+		return ids
+	}
+
+	for name, tt := range map[string]struct {
+		q      Query
+		events []int64
+	}{
+		"all":    {Query{}, []int64{4, 3, 2, 2, 1}},
+		"node":   {Query{NodeID: 100}, []int64{3, 1}},
+		"status": {Query{Status: "failed"}, []int64{2}},
+		"since":  {Query{Since: start.Add(2 * time.Minute)}, []int64{4, 3, 2}},
+		"none":   {Query{NodeID: 400}, nil},
+	} {
+		page, err := s.List(ctx, tt.q)
+		require.NoError(t, err, name)
+		assert.Equal(t, tt.events, events(page), name)
+		assert.Empty(t, page.Next, name)
+	}
+
+	// Pages
+	var listed []int64
+	q := Query{Limit: 2, Status: "sent"}
+	for i := 0; ; i++ {
+		require.True(t, i < 3, "too many pages")
+		page, err := s.List(ctx, q)
+		require.NoError(t, err)
+		listed = append(listed, events(page)...)
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	assert.Equal(t, []int64{4, 3, 2, 1}, listed)
+
+	page, err := s.List(ctx, Query{NodeID: 100, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3}, events(page))
+	page, err = s.List(ctx, Query{NodeID: 100, Limit: 1, Cursor: page.Next})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, events(page))
+	assert.Empty(t, page.Next)
+
+	_, err = s.List(ctx, Query{Cursor: "nope"})
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	// Prune
+	removed, err := s.Prune(ctx, start.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	page, err = s.List(ctx, Query{})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 3, 2}, events(page))
+	deliveries, err = s.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+	page, err = s.List(ctx, Query{NodeID: 200})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, events(page))
+}
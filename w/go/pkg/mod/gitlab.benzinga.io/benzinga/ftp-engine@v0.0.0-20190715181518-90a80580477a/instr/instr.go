@@ -14,16 +14,40 @@ type Collector struct {
 	ContentReceiveErrors *prometheus.CounterVec
 	// ContentRejected ...
 	ContentRejected *prometheus.CounterVec
+	// ContentInvalid counts messages that could not be decoded, by reason
+	ContentInvalid *prometheus.CounterVec
 	// ContentAccepted ...
 	ContentAccepted *prometheus.CounterVec
 
 	// ContentProcessingLatency ...
-	ContentProcessingLatency *prometheus.SummaryVec
+	ContentProcessingLatency *prometheus.HistogramVec
+	// ContentEventAge is the age of sent events, by the event time and the content update time
+	ContentEventAge *prometheus.HistogramVec
+
+	// ConsumerLag is the Kafka consumer group lag of each partition assigned to the worker
+	ConsumerLag *prometheus.GaugeVec
 
 	// ContentSent ...
 	ContentSent *prometheus.CounterVec
 	// ContentSendErrors ...
 	ContentSendErrors *prometheus.CounterVec
+	// SendDuration is the upload time of sent files, including retries
+	SendDuration *prometheus.HistogramVec
+	// SendBytes is the size of sent files
+	SendBytes *prometheus.HistogramVec
+	// SendLastSuccess is the unix time of the last file sent to each destination
+	SendLastSuccess *prometheus.GaugeVec
+
+	// ReferenceCacheHits ...
+	ReferenceCacheHits *prometheus.CounterVec
+	// ReferenceCacheMisses ...
+	ReferenceCacheMisses *prometheus.CounterVec
+	// ReferenceResolutions ...
+	ReferenceResolutions *prometheus.CounterVec
+	// ReferenceUnresolved ...
+	ReferenceUnresolved *prometheus.CounterVec
+	// ReferenceFallbacks ...
+	ReferenceFallbacks *prometheus.CounterVec
 }
 
 // NewCollector returns initialized prometheus collector
@@ -63,6 +87,17 @@ func NewCollector(appName string) (*Collector, error) {
 	)
 	collectors = append(collectors, contentRejected)
 
+	contentInvalid := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "receive",
+			Name:      "content_invalid",
+			Help:      "content objects that could not be decoded, not acknowledged",
+		},
+		[]string{"kafka_group_id", "kafka_topic", "reason"},
+	)
+	collectors = append(collectors, contentInvalid)
+
 	contentAccepted := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: strings.Replace(appName, "-", "_", -1),
@@ -96,17 +131,131 @@ func NewCollector(appName string) (*Collector, error) {
 	)
 	collectors = append(collectors, contentSent)
 
-	contentProcessLatency := prometheus.NewSummaryVec(
-		prometheus.SummaryOpts{
+	contentProcessLatency := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
 			Namespace: strings.Replace(appName, "-", "_", -1),
 			Subsystem: "content",
-			Name:      "content_processing_latency",
+			Name:      "content_processing_latency_seconds",
 			Help:      "content objects processing latency, receive to send complete",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
 		},
 		[]string{"kafka_group_id", "kafka_topic"},
 	)
 	collectors = append(collectors, contentProcessLatency)
 
+	contentEventAge := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "content",
+			Name:      "event_age_seconds",
+			Help:      "age of sent events at delivery, since the event time or the content update time",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+		},
+		[]string{"kafka_group_id", "kafka_topic", "since"},
+	)
+	collectors = append(collectors, contentEventAge)
+
+	consumerLag := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "receive",
+			Name:      "consumer_group_lag",
+			Help:      "consumer group lag of each partition assigned to the worker, the high watermark less the committed offset",
+		},
+		[]string{"kafka_group_id", "kafka_topic", "partition"},
+	)
+	collectors = append(collectors, consumerLag)
+
+	sendDuration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "send",
+			Name:      "duration_seconds",
+			Help:      "upload time of sent files, including retries",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+		},
+		[]string{"kafka_group_id", "kafka_topic", "destination"},
+	)
+	collectors = append(collectors, sendDuration)
+
+	sendBytes := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "send",
+			Name:      "bytes",
+			Help:      "size of sent files",
+			Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+		},
+		[]string{"kafka_group_id", "kafka_topic", "destination"},
+	)
+	collectors = append(collectors, sendBytes)
+
+	sendLastSuccess := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "send",
+			Name:      "last_success_timestamp_seconds",
+			Help:      "unix time of the last file sent to the destination",
+		},
+		[]string{"kafka_group_id", "destination"},
+	)
+	collectors = append(collectors, sendLastSuccess)
+
+	referenceCacheHits := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "reference",
+			Name:      "cache_hits",
+			Help:      "reference store lookups answered by the local cache, including keys cached as not found",
+		},
+		[]string{"lookup"},
+	)
+	collectors = append(collectors, referenceCacheHits)
+
+	referenceCacheMisses := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "reference",
+			Name:      "cache_misses",
+			Help:      "reference store lookups not in the local cache",
+		},
+		[]string{"lookup"},
+	)
+	collectors = append(collectors, referenceCacheMisses)
+
+	referenceResolutions := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "reference",
+			Name:      "tickers_resolved",
+			Help:      "content tickers resolved, by the method that found them",
+		},
+		[]string{"method"},
+	)
+	collectors = append(collectors, referenceResolutions)
+
+	referenceUnresolved := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "reference",
+			Name:      "tickers_unresolved",
+			Help:      "content tickers not found in the reference store, see /unresolved",
+		},
+		[]string{"exchange"},
+	)
+	collectors = append(collectors, referenceUnresolved)
+
+	referenceFallbacks := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: strings.Replace(appName, "-", "_", -1),
+			Subsystem: "reference",
+			Name:      "tickers_exchange_fallback",
+			Help:      "content tickers resolved on a fallback exchange, by content exchange and the exchange found on",
+		},
+		[]string{"exchange", "fallback_exchange"},
+	)
+	collectors = append(collectors, referenceFallbacks)
+
 	for _, c := range collectors {
 		err := prometheus.Register(c)
 		if err != nil {
@@ -125,10 +274,21 @@ func NewCollector(appName string) (*Collector, error) {
 	return &Collector{
 		ContentAccepted:          contentAccepted,
 		ContentRejected:          contentRejected,
+		ContentInvalid:           contentInvalid,
 		ContentAcknowledged:      contentAcknowledged,
 		ContentReceiveErrors:     contentRecvError,
 		ContentProcessingLatency: contentProcessLatency,
+		ContentEventAge:          contentEventAge,
+		ConsumerLag:              consumerLag,
 		ContentSendErrors:        contentSendErrors,
 		ContentSent:              contentSent,
+		SendDuration:             sendDuration,
+		SendBytes:                sendBytes,
+		SendLastSuccess:          sendLastSuccess,
+		ReferenceCacheHits:       referenceCacheHits,
+		ReferenceCacheMisses:     referenceCacheMisses,
+		ReferenceResolutions:     referenceResolutions,
+		ReferenceUnresolved:      referenceUnresolved,
+		ReferenceFallbacks:       referenceFallbacks,
 	}, nil
 }
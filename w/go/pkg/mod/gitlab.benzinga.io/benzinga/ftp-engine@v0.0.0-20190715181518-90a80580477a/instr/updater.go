@@ -0,0 +1,87 @@
+package instr
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UpdaterCollector contains the prometheus metrics of ftp-engine-updater
+type UpdaterCollector struct {
+	// RefreshLastSuccess is the unix time of the last successful refresh
+	RefreshLastSuccess prometheus.Gauge
+	// RefreshInstruments is the number of instruments loaded by the last successful refresh
+	RefreshInstruments prometheus.Gauge
+	// RefreshDuration ...
+	RefreshDuration prometheus.Histogram
+	// RefreshFailures ...
+	RefreshFailures prometheus.Counter
+	// RefreshInvalidInstruments is the number of instruments with each problem in the last decoded refDB
+	RefreshInvalidInstruments *prometheus.GaugeVec
+	// RefreshErrorRate is the rate of invalid instruments in the last decoded refDB
+	RefreshErrorRate prometheus.Gauge
+	// Leader is 1 while the updater holds the leader lock
+	Leader prometheus.Gauge
+}
+
+// NewUpdaterCollector returns initialized prometheus collector
+func NewUpdaterCollector(appName string) (*UpdaterCollector, error) {
+	namespace := strings.Replace(appName, "-", "_", -1)
+
+	c := &UpdaterCollector{
+		RefreshLastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "refresh",
+			Name:      "last_success_timestamp_seconds",
+			Help:      "unix time of the last successful refDB refresh",
+		}),
+		RefreshInstruments: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "refresh",
+			Name:      "instruments",
+			Help:      "instruments loaded by the last successful refDB refresh",
+		}),
+		RefreshDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "refresh",
+			Name:      "duration_seconds",
+			Help:      "refDB refresh duration, download to snapshot loaded, including failed refreshes",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}),
+		RefreshFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "refresh",
+			Name:      "failures",
+			Help:      "refDB refreshes failed after retries",
+		}),
+		RefreshInvalidInstruments: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "refresh",
+			Name:      "invalid_instruments",
+			Help:      "instruments with each problem in the last decoded refDB, including aborted refreshes",
+		}, []string{"problem"}),
+		RefreshErrorRate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "refresh",
+			Name:      "error_rate",
+			Help:      "rate of invalid instruments in the last decoded refDB, refreshes above REFDB_MAX_ERROR_RATE are aborted",
+		}),
+		Leader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "refresh",
+			Name:      "leader",
+			Help:      "1 if this replica holds the leader lock and refreshes refDB",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{c.RefreshLastSuccess, c.RefreshInstruments, c.RefreshDuration, c.RefreshFailures, c.RefreshInvalidInstruments, c.RefreshErrorRate, c.Leader} {
+		if err := prometheus.Register(collector); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				continue
+			}
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
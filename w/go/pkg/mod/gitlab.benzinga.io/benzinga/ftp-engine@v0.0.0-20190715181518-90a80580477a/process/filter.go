@@ -0,0 +1,73 @@
+package process
+
+import (
+	"strings"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+)
+
+// RejectReason is why Filter rejected an event, it is used as the ContentRejected metric reason
+type RejectReason string
+
+const (
+	// UpdatedBeforeIgnoreValue content was last updated before ProcessorConfig IgnoreUpdatedBefore
+	UpdatedBeforeIgnoreValue RejectReason = "updated_before_ignore_value"
+	// UnwantedContentType content type is not in ContentTypeMappings
+	UnwantedContentType RejectReason = "unwanted_content_type"
+	// UnwantedEventType event type is not in ProcessorConfig AcceptedEvents
+	UnwantedEventType RejectReason = "unwanted_event_type"
+)
+
+// String ...
+func (r RejectReason) String() string {
+	return string(r)
+}
+
+// FilterDecision is the decision of a single filter, Reason is empty if the filter accepts the event
+type FilterDecision struct {
+	Filter   string       `json:"filter"`
+	Accepted bool         `json:"accepted"`
+	Reason   RejectReason `json:"reason,omitempty"`
+}
+
+// Filter returns the reason a destination configured with cfg rejects the event, empty if the event is accepted
+func Filter(cfg *config.ProcessorConfig, event *models.Event) RejectReason {
+	for _, d := range FilterDecisions(cfg, event) {
+		if !d.Accepted {
+			return d.Reason
+		}
+	}
+	return ""
+}
+
+// FilterDecisions returns the decision of every filter, in the order Filter applies them
+func FilterDecisions(cfg *config.ProcessorConfig, event *models.Event) []FilterDecision {
+	decide := func(filter string, accepted bool, reason RejectReason) FilterDecision {
+		if accepted {
+			reason = ""
+		}
+		return FilterDecision{Filter: filter, Accepted: accepted, Reason: reason}
+	}
+
+	// Check Event Updated Not Before Ignore Value
+	updated := cfg.IgnoreUpdatedBefore == nil || !event.Content.UpdatedAt.Before(*cfg.IgnoreUpdatedBefore)
+
+	// Check Event Content Type
+	_, contentType := ContentTypeMappings[strings.ToLower(event.Content.Type)]
+
+	// Check Event is of Accepted Event Type
+	var eventType bool
+	for _, accepted := range cfg.AcceptedEvents {
+		if event.Event == accepted {
+			eventType = true
+			break
+		}
+	}
+
+	return []FilterDecision{
+		decide("ignore_updated_before", updated, UpdatedBeforeIgnoreValue),
+		decide("content_type", contentType, UnwantedContentType),
+		decide("event_type", eventType, UnwantedEventType),
+	}
+}
@@ -64,6 +64,7 @@ type Output struct {
 	Checksum string // SHA256 Hex Output
 	Data     *bytes.Buffer
 	Size     int
+	Attempts int // Send attempts made by the Sender
 }
 
 type Processor interface {
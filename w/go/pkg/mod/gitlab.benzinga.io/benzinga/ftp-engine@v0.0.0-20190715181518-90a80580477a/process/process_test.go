@@ -2,8 +2,12 @@ package process
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
 )
 
 func TestGetContentType(t *testing.T) {
@@ -11,3 +15,50 @@ func TestGetContentType(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, Story, contentType)
 }
+
+func TestFilter(t *testing.T) {
+	ignoreBefore := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created, models.Updated}}
+
+	event := &models.Event{Event: models.Created, Content: models.Content{Type: "Story", UpdatedAt: models.Time{Time: ignoreBefore.Add(time.Hour)}}}
+	assert.Equal(t, RejectReason(""), Filter(cfg, event))
+
+	event.Event = models.Removed
+	assert.Equal(t, UnwantedEventType, Filter(cfg, event))
+
+	event.Content.Type = "podcast"
+	assert.Equal(t, UnwantedContentType, Filter(cfg, event))
+
+	// Content updated before the cutoff is rejected, content updated after it is accepted
+	cfg.IgnoreUpdatedBefore = &ignoreBefore
+	event.Event, event.Content.Type = models.Created, "Story"
+	assert.Equal(t, RejectReason(""), Filter(cfg, event))
+	event.Content.UpdatedAt = models.Time{Time: ignoreBefore.Add(-time.Hour)}
+	assert.Equal(t, UpdatedBeforeIgnoreValue, Filter(cfg, event))
+	event.Content.UpdatedAt = models.Time{Time: ignoreBefore}
+	assert.Equal(t, RejectReason(""), Filter(cfg, event), "the cutoff is inclusive")
+}
+
+func TestFilterDecisions(t *testing.T) {
+	ignoreBefore := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}, IgnoreUpdatedBefore: &ignoreBefore}
+
+	event := &models.Event{Event: models.Removed, Content: models.Content{Type: "story", UpdatedAt: models.Time{Time: ignoreBefore.Add(time.Hour)}}}
+	assert.Equal(t, []FilterDecision{
+		{Filter: "ignore_updated_before", Accepted: true},
+		{Filter: "content_type", Accepted: true},
+		{Filter: "event_type", Reason: UnwantedEventType},
+	}, FilterDecisions(cfg, event))
+
+	event.Content.Type = "podcast"
+	decisions := FilterDecisions(cfg, event)
+	assert.False(t, decisions[1].Accepted)
+	assert.Equal(t, UnwantedContentType, decisions[1].Reason)
+	assert.Equal(t, UnwantedContentType, Filter(cfg, event), "the first rejection is the reason")
+
+	// Content updated before the cutoff is rejected
+	event.Content.UpdatedAt = models.Time{Time: ignoreBefore.Add(-time.Hour)}
+	decisions = FilterDecisions(cfg, event)
+	assert.Equal(t, FilterDecision{Filter: "ignore_updated_before", Reason: UpdatedBeforeIgnoreValue}, decisions[0])
+	assert.Equal(t, UpdatedBeforeIgnoreValue, Filter(cfg, event))
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -24,11 +25,11 @@ const (
 
 type Processor struct {
 	cfg     *config.Config
-	rClient *rstore.Client
+	rClient *rstore.Resolver
 	log     *zap.Logger
 }
 
-func NewRavenpackProcessor(cfg *config.Config, r *rstore.Client, log *zap.Logger) *Processor {
+func NewRavenpackProcessor(cfg *config.Config, r *rstore.Resolver, log *zap.Logger) *Processor {
 	return &Processor{cfg, r, log}
 }
 
@@ -150,25 +151,20 @@ func (p *Processor) Convert(e *models.Event) (*process.Output, error) {
 
 func (p *Processor) getTickers(e *models.Event) (tickers []ItemTicker) {
 
-	for i := 0; i < len(e.Content.Tickers); i++ {
+	// Resolve symbols as of the content creation, so historical content gets the instrument that held the symbol then
+	asOf := e.Content.CreatedAt.Time
+	if asOf.IsZero() {
+		asOf = time.Now()
+	}
 
-		symbolSplit := strings.Split(e.Content.Tickers[i].Name, ":")
+	for i := 0; i < len(e.Content.Tickers); i++ {
 
 		ctx := context.TODO()
 
-		var tickerData *reference.Instrument
-		if len(symbolSplit) > 1 {
-			res, err := p.rClient.GetSymbolExchange(ctx, symbolSplit[1], symbolSplit[0])
-			if err != nil {
-				p.log.Error("Get Ticker by Symbol-Exchange Error", zap.Error(err))
-			}
-			tickerData = res
-		} else {
-			res, err := p.rClient.GetSymbolCurrency(ctx, symbolSplit[0], "USD") // default to USD for tickers without an exchange
-			if err != nil {
-				p.log.Error("Get Ticker by Symbol-Currency Error", zap.Error(err))
-			}
-			tickerData = res
+		// Tickers refDB does not have are resolved by alias, share class notation and exchange fallbacks
+		tickerData, err := p.rClient.Resolve(ctx, e.Content.Tickers[i].Name, asOf)
+		if err != nil {
+			p.log.Error("Resolve Ticker Error", zap.Error(err), zap.String("ticker", e.Content.Tickers[i].Name))
 		}
 
 		t := ItemTicker{
@@ -176,8 +172,19 @@ func (p *Processor) getTickers(e *models.Event) (tickers []ItemTicker) {
 			Sentiment: "0",
 		}
 
+		// Tickers refDB does not have a symbol for, ex. renamed, are looked up by partner taxonomy identifiers
+		if tickerData == nil {
+			_, symbol := rstore.ParseTicker(e.Content.Tickers[i].Name)
+			tickerData = p.getTaxonomyInstrument(ctx, e, symbol)
+		}
+		if tickerData == nil && err == nil {
+			p.rClient.ReportUnresolved(e.Content.Tickers[i].Name, e.Content.NodeID)
+		}
+
 		if tickerData != nil {
 			t.ISIN = tickerData.ISIN
+			t.CUSIP = tickerData.CUSIP
+			t.CIK = tickerData.CIK
 			t.Exchange = tickerData.Exchange
 		}
 
@@ -193,6 +200,38 @@ func (p *Processor) getTickers(e *models.Event) (tickers []ItemTicker) {
 	return tickers
 }
 
+// taxonomyIdentifierTypes are the partner taxonomy identifiers instruments are looked up by, in order. CIK is not
+// used as it identifies the issuer, so share classes would resolve to an arbitrary class.
+var taxonomyIdentifierTypes = []rstore.IdentifierType{rstore.ISIN, rstore.CUSIP}
+
+// getTaxonomyInstrument looks up the instrument of symbol by the identifiers of its partner taxonomy, nil if the
+// content has no taxonomy for symbol or no identifier is in refDB
+func (p *Processor) getTaxonomyInstrument(ctx context.Context, e *models.Event, symbol string) *reference.Instrument {
+	if e.Content.Meta.PartnerTaxonomy == nil {
+		return nil
+	}
+
+	for _, taxonomy := range e.Content.Meta.PartnerTaxonomy.Taxonomies {
+		if !strings.EqualFold(taxonomy.Symbol, symbol) {
+			continue
+		}
+
+		ids := map[rstore.IdentifierType]string{rstore.ISIN: taxonomy.ISIN, rstore.CUSIP: taxonomy.CUSIP}
+		for _, idType := range taxonomyIdentifierTypes {
+			if ids[idType] == "" {
+				continue
+			}
+			res, err := p.rClient.GetIdentifier(ctx, idType, ids[idType])
+			if err != nil {
+				p.log.Error("Get Ticker by Identifier Error", zap.Error(err), zap.Stringer("identifier_type", idType), zap.String("identifier", ids[idType]))
+				continue
+			}
+			return res
+		}
+	}
+	return nil
+}
+
 func getCategories(e *models.Event) (categories []ItemCategory) {
 
 	for i := 0; i < len(e.Content.Channels); i++ {
@@ -0,0 +1,161 @@
+package ravenpack
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func newTestProcessor(t *testing.T) *Processor {
+	data, err := ioutil.ReadFile(filepath.Join("..", "..", "rstore", "testdata", "refdb.json"))
+	require.NoError(t, err)
+
+	var refDB reference.FinancialData
+	require.NoError(t, json.Unmarshal(data, &refDB))
+
+	store := rstore.NewMemory(zap.NewNop())
+	require.NoError(t, store.Load(context.Background(), refDB.Instruments))
+
+	return NewRavenpackProcessor(&config.Config{}, rstore.NewResolver(zap.NewNop(), store, rstore.ResolverOptions{}, nil), zap.NewNop())
+}
+
+func TestGetTickers(t *testing.T) {
+	p := newTestProcessor(t)
+
+	tests := []struct {
+		name       string
+		ticker     string
+		taxonomies []models.PartnerTaxonomy
+		want       ItemTicker
+	}{
+		{
+			name:   "symbol defaults to USD",
+			ticker: "F",
+			want:   ItemTicker{ISIN: "US3453708600", CUSIP: "345370860", CIK: "37996", Exchange: "NYSE"},
+		},
+		{
+			name:   "exchange symbol",
+			ticker: "BMV:AAPL",
+			want:   ItemTicker{ISIN: "US0378331005", CUSIP: "037833100", CIK: "320193", Exchange: "BMV"},
+		},
+		{
+			name:   "instrument without isin",
+			ticker: "TSX:A",
+			want:   ItemTicker{CUSIP: "04226J108", CIK: "1463915", Exchange: "TSX"},
+		},
+		{
+			name:       "unknown symbol by taxonomy isin",
+			ticker:     "FMC",
+			taxonomies: []models.PartnerTaxonomy{{Symbol: "FMC", ISIN: "US3453708600", CIK: "320193"}},
+			want:       ItemTicker{ISIN: "US3453708600", CUSIP: "345370860", CIK: "37996", Exchange: "NYSE"},
+		},
+		{
+			name:       "unknown symbol by taxonomy cusip",
+			ticker:     "BRKB",
+			taxonomies: []models.PartnerTaxonomy{{Symbol: "brkb", ISIN: "US0000000000", CUSIP: "084670702"}},
+			want:       ItemTicker{ISIN: "US0846707026", CUSIP: "084670702", CIK: "1067983", Exchange: "NYSE"},
+		},
+		{
+			name:       "taxonomy cik is not used, it is shared by share classes",
+			ticker:     "BRKX",
+			taxonomies: []models.PartnerTaxonomy{{Symbol: "BRKX", CIK: "1067983"}},
+			want:       ItemTicker{},
+		},
+		{
+			name:       "taxonomy of another symbol",
+			ticker:     "NOPE",
+			taxonomies: []models.PartnerTaxonomy{{Symbol: "F", ISIN: "US3453708600"}},
+			want:       ItemTicker{},
+		},
+		{
+			name:   "unknown symbol",
+			ticker: "NOPE",
+			want:   ItemTicker{},
+		},
+		{
+			name:   "share class notation",
+			ticker: "NYSE:BRK/B",
+			want:   ItemTicker{ISIN: "US0846707026", CUSIP: "084670702", CIK: "1067983", Exchange: "NYSE"},
+		},
+		{
+			name:   "lowercase share class",
+			ticker: "brk-b",
+			want:   ItemTicker{ISIN: "US0846707026", CUSIP: "084670702", CIK: "1067983", Exchange: "NYSE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := workertest.NewEvent()
+			e.Content.Tickers = []models.Category{{Name: tt.ticker, Primary: true}}
+			if tt.taxonomies != nil {
+				e.Content.Meta.PartnerTaxonomy = &models.PartnerTaxonomyMeta{Taxonomies: tt.taxonomies}
+			}
+
+			tickers := p.getTickers(e)
+			require.Len(t, tickers, 1)
+
+			tt.want.Text, tt.want.Primary, tt.want.Sentiment = tt.ticker, "1", "0"
+			assert.Equal(t, tt.want, tickers[0])
+		})
+	}
+}
+
+func TestConvertTickerIdentifiers(t *testing.T) {
+	p := newTestProcessor(t)
+
+	output, err := p.Convert(workertest.NewEvent())
+	require.NoError(t, err)
+	assert.Contains(t, output.Data.String(), `<bz:ticker primary="1" isin="US3453708600" cusip="345370860" cik="37996" exchange="NYSE" sentiment="0">F</bz:ticker>`)
+	assert.Contains(t, output.Data.String(), `<bz:ticker primary="0" isin="" exchange="" sentiment="0">GLOG</bz:ticker>`)
+}
+
+func TestGetTickersAsOf(t *testing.T) {
+	ctx := context.Background()
+	store := rstore.NewMemory(zap.NewNop())
+	p := NewRavenpackProcessor(&config.Config{}, rstore.NewResolver(zap.NewNop(), store, rstore.ResolverOptions{}, nil), zap.NewNop())
+
+	require.NoError(t, store.Load(ctx, []reference.Instrument{{Symbol: "FB", CurrencyID: "USD", Exchange: "NASDAQ", ISIN: "US30303M1027"}}))
+	beforeChange := time.Now()
+	time.Sleep(time.Millisecond)
+
+	// The symbol is reassigned
+	require.NoError(t, store.Load(ctx, []reference.Instrument{{Symbol: "FB", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US0000000000"}}))
+
+	e := workertest.NewEvent()
+	e.Content.Tickers = []models.Category{{Name: "FB"}}
+
+	e.Content.CreatedAt.Time = beforeChange
+	assert.Equal(t, "US30303M1027", p.getTickers(e)[0].ISIN, "historical content")
+
+	e.Content.CreatedAt.Time = time.Now()
+	assert.Equal(t, "US0000000000", p.getTickers(e)[0].ISIN, "current content")
+}
+
+func TestGetTickersUnresolved(t *testing.T) {
+	p := newTestProcessor(t)
+
+	e := workertest.NewEvent()
+	e.Content.Tickers = []models.Category{{Name: "F"}, {Name: "nyse:nope"}, {Name: "FMC"}}
+	e.Content.Meta.PartnerTaxonomy = &models.PartnerTaxonomyMeta{Taxonomies: []models.PartnerTaxonomy{{Symbol: "FMC", ISIN: "US3453708600"}}}
+	p.getTickers(e)
+
+	// Tickers found by taxonomy are resolved
+	unresolved := p.rClient.Unresolved(time.Time{})
+	require.Len(t, unresolved, 1)
+	assert.Equal(t, "NYSE:NOPE", unresolved[0].Name)
+	assert.Equal(t, e.Content.NodeID, unresolved[0].NodeID)
+}
@@ -53,6 +53,8 @@ type ItemTicker struct {
 	Text      string `xml:",chardata"`
 	Primary   string `xml:"primary,attr"`
 	ISIN      string `xml:"isin,attr"`
+	CUSIP     string `xml:"cusip,attr,omitempty"`
+	CIK       string `xml:"cik,attr,omitempty"`
 	Exchange  string `xml:"exchange,attr"`
 	Sentiment string `xml:"sentiment,attr"`
 }
@@ -0,0 +1,60 @@
+package refdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/opentracing/opentracing-go"
+	tlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+)
+
+// decodeAliases decodes the alias table JSON, an object of ticker names to the ticker they are an alias of, ex.
+// {"BRK/B": "NYSE:BRK.B", "GOOG": "NASDAQ:GOOGL"}
+func decodeAliases(r io.Reader) (map[string]string, error) {
+	aliases := make(map[string]string)
+	if err := jsoniter.NewDecoder(r).Decode(&aliases); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+// refreshAliases loads the alias table into the store if it changed since the last refresh, the lock must be
+// held
+func (r *Refresher) refreshAliases(ctx context.Context) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "refdb.RefreshAliases")
+	defer span.Finish()
+
+	aliaser, ok := r.store.(rstore.Aliaser)
+	if !ok {
+		return fmt.Errorf("reference store %T does not support aliases", r.store)
+	}
+
+	body, validator, err := r.aliases.Open(subCtx, r.aliasValidator)
+	if err == ErrNotModified {
+		span.LogFields(tlog.Bool("unchanged", true))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	aliases, err := decodeAliases(body)
+	if err != nil {
+		r.logger.Error("Decode Aliases JSON Error", zap.Error(err), zap.Stringer("source", r.aliases))
+		return err
+	}
+	if err := aliaser.LoadAliases(subCtx, aliases); err != nil {
+		return err
+	}
+	r.aliasValidator, r.aliasCount = validator, len(aliases)
+	span.LogFields(tlog.Int("count", len(aliases)))
+	r.logger.Info("Updated Aliases", zap.Int("count", len(aliases)))
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package refdb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+// aliasSource returns the alias table JSON, it is not modified while the etag is the same
+type aliasSource struct {
+	etag string
+	json string
+}
+
+func (s *aliasSource) Open(ctx context.Context, since Validator) (io.ReadCloser, Validator, error) {
+	if since.ETag == s.etag {
+		return nil, since, ErrNotModified
+	}
+	return ioutil.NopCloser(bytes.NewReader([]byte(s.json))), Validator{ETag: s.etag}, nil
+}
+
+func (s *aliasSource) String() string {
+	return "aliases"
+}
+
+func TestRefresherAliases(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	store := rstore.NewMemory(logger)
+	source := &testSource{etag: "1", data: &reference.FinancialData{Instruments: []reference.Instrument{
+		{Symbol: "GOOGL", CurrencyID: "USD", Exchange: "NASDAQ", ISIN: "US02079K3059"},
+	}}}
+	aliases := &aliasSource{etag: "1", json: `{"GOOG": "NASDAQ:GOOGL", "BRK/B": "NYSE:BRK.B"}`}
+	r := NewRefresher(logger, source, store, RefresherOptions{Aliases: aliases})
+
+	result, err := r.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Aliases)
+	target, err := store.GetAlias(ctx, "goog")
+	require.NoError(t, err)
+	assert.Equal(t, "NASDAQ:GOOGL", target)
+
+	// Aliases are refreshed when the instruments are unchanged
+	aliases.etag, aliases.json = "2", `{"GOOG": "NASDAQ:GOOGL"}`
+	result, err = r.Refresh(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Unchanged)
+	assert.Equal(t, 1, result.Aliases)
+	target, err = store.GetAlias(ctx, "BRK/B")
+	require.NoError(t, err)
+	assert.Empty(t, target)
+
+	// Invalid tables keep the previous aliases
+	aliases.etag, aliases.json = "3", `["GOOG"]`
+	_, err = r.Refresh(ctx)
+	assert.Error(t, err)
+	target, err = store.GetAlias(ctx, "GOOG")
+	require.NoError(t, err)
+	assert.Equal(t, "NASDAQ:GOOGL", target)
+}
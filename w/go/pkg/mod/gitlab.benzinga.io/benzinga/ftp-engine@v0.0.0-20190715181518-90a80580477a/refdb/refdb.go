@@ -0,0 +1,416 @@
+// Package refdb loads refDB instruments into a reference store
+package refdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/opentracing/opentracing-go"
+	tlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+// Load writes the instruments to the store, stores implementing rstore.Loader replace every instrument at once
+func Load(ctx context.Context, logger *zap.Logger, store rstore.Store, instruments []reference.Instrument) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "refdb.Load")
+	defer span.Finish()
+	span.LogFields(tlog.Int("count", len(instruments)))
+
+	if loader, ok := store.(rstore.Loader); ok {
+		if err := loader.Load(subCtx, instruments); err != nil {
+			span.LogFields(tlog.Error(err))
+			logger.Error("refresh Load error", zap.Error(err))
+			return err
+		}
+		return nil
+	}
+
+	for i := 0; i < len(instruments); i++ {
+		if err := store.PutSymbolCurrency(subCtx, &instruments[i]); err != nil {
+			span.LogFields(tlog.Error(err))
+			logger.Error("refresh PutSymbolCurrency error", zap.Error(err))
+			return err
+		}
+		if err := store.PutSymbolExchange(subCtx, &instruments[i]); err != nil {
+			span.LogFields(tlog.Error(err))
+			logger.Error("refresh PutSymbolExchange error", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+// streamBatchSize is the number of instruments written to rstore.SnapshotWriter at once
+const streamBatchSize = 1000
+
+// Result is the outcome of Refresher.Refresh
+type Result struct {
+	// Instruments is the number of refDB instruments
+	Instruments int
+	// Unchanged is true if refDB was not modified, the store was not written
+	Unchanged bool
+	// Delta is the number of keys changed if only the changes were written, see rstore.DeltaLoader
+	Delta int
+	// Validation is the validation of the refDB instruments, nil if refDB was not decoded
+	Validation *Validation
+	// Aliases is the number of aliases in the alias table, if refreshed
+	Aliases int
+}
+
+// RefresherOptions configures a Refresher
+type RefresherOptions struct {
+	// Delta writes only the changed instruments to stores implementing rstore.DeltaLoader
+	Delta bool
+	// MaxErrorRate is the rate of invalid instruments that aborts a refresh, DefaultMaxErrorRate if 0, 1 never
+	// aborts
+	MaxErrorRate float64
+	// Aliases is the Source of the alias table loaded into stores implementing rstore.Aliaser, optional
+	Aliases Source
+}
+
+// Refresher loads refDB from a Source into a store. Unchanged downloads are skipped without writing the store,
+// and in delta mode only the changed instruments are written to stores implementing rstore.DeltaLoader.
+// Otherwise stores implementing rstore.StreamLoader are written as refDB is decoded. Neither keeps refDB in
+// memory. Refreshes with too many invalid instruments do not replace the store instruments.
+type Refresher struct {
+	logger       *zap.Logger
+	source       Source
+	store        rstore.Store
+	delta        bool
+	maxErrorRate float64
+
+	mu        sync.Mutex
+	validator Validator
+	// previous is the last load in delta mode
+	previous rstore.Fingerprints
+	count    int
+
+	aliases        Source
+	aliasValidator Validator
+	aliasCount     int
+}
+
+// NewRefresher returns a Refresher of store
+func NewRefresher(logger *zap.Logger, source Source, store rstore.Store, opts RefresherOptions) *Refresher {
+	if opts.MaxErrorRate == 0 {
+		opts.MaxErrorRate = DefaultMaxErrorRate
+	}
+	return &Refresher{
+		logger:       logger,
+		source:       source,
+		store:        store,
+		delta:        opts.Delta,
+		maxErrorRate: opts.MaxErrorRate,
+		aliases:      opts.Aliases,
+	}
+}
+
+// Refresh decodes the refDB instruments and loads them into the store, unless refDB is unchanged since the last
+// successful Refresh. A *ValidationError is returned with the Result if too many instruments are invalid. The
+// alias table is refreshed the same way after the instruments.
+func (r *Refresher) Refresh(ctx context.Context) (Result, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "refdb.Refresh")
+	defer span.Finish()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, err := r.refreshInstruments(subCtx)
+	if err != nil || r.aliases == nil {
+		return result, err
+	}
+	if err := r.refreshAliases(subCtx); err != nil {
+		span.LogFields(tlog.Error(err))
+		return result, err
+	}
+	result.Aliases = r.aliasCount
+	return result, nil
+}
+
+// refreshInstruments loads the refDB instruments if they changed, the lock must be held
+func (r *Refresher) refreshInstruments(ctx context.Context) (Result, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "refdb.RefreshInstruments")
+	defer span.Finish()
+
+	start := time.Now()
+
+	body, validator, err := r.source.Open(subCtx, r.validator)
+	if err == ErrNotModified {
+		span.LogFields(tlog.Bool("unchanged", true))
+		r.logger.Debug("refDB Unchanged", zap.Stringer("source", r.source))
+		return Result{Instruments: r.count, Unchanged: true}, nil
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() {
+		if closeErr := body.Close(); closeErr != nil {
+			r.logger.Error("refDB Close Error", zap.Error(closeErr))
+		}
+	}()
+
+	v := NewValidation()
+	result := Result{Validation: v}
+	var delta *rstore.DeltaBuilder
+	deltaLoader, ok := r.store.(rstore.DeltaLoader)
+	if ok && r.delta {
+		delta = rstore.NewDeltaBuilder(r.previous)
+	}
+	loadDelta := delta != nil && r.previous != nil
+	loader, stream := r.store.(rstore.StreamLoader)
+	switch {
+	case loadDelta:
+		err = r.loadDelta(subCtx, body, deltaLoader, delta, v, &result)
+	case stream:
+		err = r.stream(subCtx, body, loader, delta, v)
+	default:
+		err = r.decodeAndLoad(subCtx, body, v)
+	}
+	result.Instruments = v.Instruments
+	span.LogFields(tlog.Int("count", v.Instruments), tlog.Int("invalid", v.Invalid))
+	if err == rstore.ErrSnapshotConflict && loadDelta {
+		// refDB was read, it is downloaded again to load every instrument
+		r.logger.Info("Snapshot Changed, Loading Every Instrument")
+		r.validator, r.previous = Validator{}, nil
+		return r.refreshInstruments(ctx)
+	}
+	if err != nil {
+		// The store may be partially written, the next Refresh loads every instrument
+		r.validator, r.previous = Validator{}, nil
+		span.LogFields(tlog.Error(err))
+		if _, ok := err.(*ValidationError); ok {
+			r.logger.Error("refDB Validation Failed", zap.Error(err), zap.Int("count", v.Instruments), zap.Int("invalid", v.Invalid), zap.Any("problems", v.Problems))
+			return result, err
+		}
+		return Result{Validation: v}, err
+	}
+	r.validator = validator
+	r.count = v.Instruments
+	if delta != nil {
+		r.previous = delta.Fingerprints()
+	}
+
+	r.logger.Info("Updated Tickers", zap.Int("count", result.Instruments), zap.Int("invalid", v.Invalid), zap.Int("delta", result.Delta), zap.Duration("total_duration", time.Since(start)))
+
+	return result, nil
+}
+
+// validate returns a *ValidationError if the error rate of v exceeds the maximum
+func (r *Refresher) validate(v *Validation) error {
+	if rate := v.ErrorRate(); rate > r.maxErrorRate {
+		return &ValidationError{Rate: rate, Max: r.maxErrorRate}
+	}
+	return nil
+}
+
+// decodeAndLoad decodes every instrument, then loads them if they are valid, for stores that cannot be written
+// as refDB is decoded. The lock must be held.
+func (r *Refresher) decodeAndLoad(ctx context.Context, body io.Reader, v *Validation) error {
+	instruments, err := decodeAll(body, v)
+	if err != nil {
+		r.logger.Error("Decode Instruments JSON Error", zap.Error(err))
+		return err
+	}
+	if err := r.validate(v); err != nil {
+		return err
+	}
+	return Load(ctx, r.logger, r.store, instruments)
+}
+
+// loadDelta decodes the changes since the previous load, then writes them if the instruments are valid. The lock
+// must be held.
+func (r *Refresher) loadDelta(ctx context.Context, body io.Reader, loader rstore.DeltaLoader, delta *rstore.DeltaBuilder, v *Validation, result *Result) error {
+	if err := Decode(body, func(inst *reference.Instrument) error {
+		v.Check(inst)
+		return delta.Add(inst)
+	}); err != nil {
+		r.logger.Error("Decode Instruments JSON Error", zap.Error(err))
+		return err
+	}
+	if err := r.validate(v); err != nil {
+		return err
+	}
+
+	d := delta.Delta()
+	if err := loader.LoadDelta(ctx, d); err != nil {
+		return err
+	}
+	result.Delta = d.Len()
+	return nil
+}
+
+// errWriteFailed stops Decode when the snapshot writer failed, the write error is returned instead
+var errWriteFailed = errors.New("snapshot write failed")
+
+// stream writes batches of instruments to a snapshot while they are decoded, the snapshot is committed if the
+// instruments are valid. The instruments are added to delta if it is not nil.
+func (r *Refresher) stream(ctx context.Context, body io.Reader, loader rstore.StreamLoader, delta *rstore.DeltaBuilder, v *Validation) error {
+	w, err := loader.BeginLoad(ctx)
+	if err != nil {
+		return err
+	}
+
+	batches := make(chan []reference.Instrument, 1)
+	failed := make(chan struct{})
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		for batch := range batches {
+			if err != nil {
+				continue
+			}
+			if err = w.Write(ctx, batch); err != nil {
+				close(failed)
+			}
+		}
+		written <- err
+	}()
+
+	batch := make([]reference.Instrument, 0, streamBatchSize)
+	send := func() error {
+		select {
+		case batches <- batch:
+		case <-failed:
+			return errWriteFailed
+		}
+		batch = make([]reference.Instrument, 0, streamBatchSize)
+		return nil
+	}
+	err = Decode(body, func(inst *reference.Instrument) error {
+		v.Check(inst)
+		if delta != nil {
+			if err := delta.Add(inst); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, *inst)
+		if len(batch) < streamBatchSize {
+			return nil
+		}
+		return send()
+	})
+	if err == nil && len(batch) > 0 {
+		err = send()
+	}
+	close(batches)
+
+	writeErr := <-written
+	switch {
+	case writeErr != nil:
+		err = writeErr
+	case err != nil:
+		r.logger.Error("Decode Instruments JSON Error", zap.Error(err))
+	default:
+		err = r.validate(v)
+	}
+	if err != nil {
+		if abortErr := w.Abort(ctx); abortErr != nil {
+			r.logger.Error("Abort Snapshot Error", zap.Error(abortErr))
+		}
+		return err
+	}
+
+	return w.Commit(ctx)
+}
+
+// Run refreshes the store every interval until ctx is done. Failed refreshes are retried, then the store keeps
+// the previous instruments until the next interval.
+func Run(ctx context.Context, logger *zap.Logger, refresher *Refresher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger.Info("Starting Refresh Worker", zap.Duration("refresh_interval", interval))
+
+	for {
+		select {
+		case <-ticker.C:
+			logger.Debug("Starting Update")
+
+			r := retrier.New(retrier.ExponentialBackoff(3, 1*time.Minute), nil)
+			err := r.RunCtx(ctx, func(subCtx context.Context) error {
+				_, refreshErr := refresher.Refresh(subCtx)
+				return refreshErr
+			})
+			if err != nil {
+				logger.Error("Update Failed After Retries", zap.Error(err))
+				continue
+			}
+			logger.Debug("Refresh Successful")
+
+		case <-ctx.Done():
+			logger.Info("Stopping Refresh Worker")
+			return
+		}
+	}
+}
+
+// OpenStore opens the configured reference store. The memory and bbolt stores are loaded from refDB and
+// refreshed until ctx is done, a bbolt store with instruments is used as is if refDB is unavailable at start.
+// Redis store lookups are cached unless disabled, inst is optional.
+func OpenStore(ctx context.Context, cfg *config.Config, logger *zap.Logger, inst *instr.Collector) (rstore.Store, error) {
+	var store rstore.Store
+	var err error
+	switch cfg.Reference.Store {
+	case config.RedisStore:
+		// Loaded by ftp-engine-updater
+		client, err := rstore.NewClient(logger, cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		if !cfg.Reference.DisableCache {
+			client.EnableCache(rstore.CacheOptions{
+				Size:        cfg.Reference.CacheSize,
+				TTL:         cfg.Reference.CacheTTL,
+				NegativeTTL: cfg.Reference.CacheNegativeTTL,
+			}, inst)
+		}
+		return client, nil
+	case config.MemoryStore:
+		store = rstore.NewMemory(logger)
+	case config.BoltStore:
+		if store, err = rstore.NewBolt(logger, cfg.Reference.Path); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported reference store '%s'", cfg.Reference.Store)
+	}
+
+	logger = logger.Named("refdb")
+	source, err := NewSource(logger, cfg.Reference.RefDBEndpoint, cfg.Reference.Timeout)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	opts := RefresherOptions{
+		Delta:        cfg.Reference.Delta,
+		MaxErrorRate: cfg.Reference.MaxErrorRate,
+	}
+	if cfg.Reference.AliasesEndpoint != "" {
+		if opts.Aliases, err = NewSource(logger, cfg.Reference.AliasesEndpoint, cfg.Reference.Timeout); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	refresher := NewRefresher(logger, source, store, opts)
+	if _, err := refresher.Refresh(ctx); err != nil {
+		if cfg.Reference.Store != config.BoltStore {
+			store.Close()
+			return nil, err
+		}
+		logger.Warn("Initial refDB Load Failed, Using Stored Instruments", zap.Error(err), zap.String("path", cfg.Reference.Path))
+	}
+
+	go Run(ctx, logger, refresher, cfg.Reference.UpdateInterval)
+
+	return store, nil
+}
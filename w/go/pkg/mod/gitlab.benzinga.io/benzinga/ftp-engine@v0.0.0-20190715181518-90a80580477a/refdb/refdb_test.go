@@ -0,0 +1,108 @@
+package refdb
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+)
+
+var refDBJSON = []byte(`{
+	"instruments": [
+		{"symbol": "F", "currencyId": "USD", "exchange": "NYSE", "isin": "US3453708600"},
+		{"symbol": "AAPL", "currencyId": "USD", "exchange": "NASDAQ", "isin": "US0378331005"}
+	]
+}`)
+
+// newRefDBServer serves refDBJSON while available is true
+func newRefDBServer(available *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(available) == 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(refDBJSON)
+	}))
+}
+
+func TestRefresh(t *testing.T) {
+	available := int32(1)
+	srv := newRefDBServer(&available)
+	defer srv.Close()
+
+	ctx := context.Background()
+	logger := zap.NewNop()
+	store := rstore.NewMemory(logger)
+
+	r := NewRefresher(logger, NewHTTPSource(logger, srv.URL, 0), store, RefresherOptions{})
+	_, err := r.Refresh(ctx)
+	require.NoError(t, err)
+
+	inst, err := store.GetSymbolExchange(ctx, "AAPL", "NASDAQ")
+	require.NoError(t, err)
+	assert.Equal(t, "US0378331005", inst.ISIN)
+	inst, err = store.GetSymbolCurrency(ctx, "F", "USD")
+	require.NoError(t, err)
+	assert.Equal(t, "US3453708600", inst.ISIN)
+
+	// Failed refreshes keep the previous instruments
+	atomic.StoreInt32(&available, 0)
+	_, err = r.Refresh(ctx)
+	assert.Error(t, err)
+	_, err = store.GetSymbolCurrency(ctx, "F", "USD")
+	assert.NoError(t, err)
+}
+
+func TestOpenStore(t *testing.T) {
+	available := int32(1)
+	srv := newRefDBServer(&available)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "ftp-engine-refdb")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &config.Config{Reference: config.ReferenceConfig{
+		Store:          config.BoltStore,
+		Path:           filepath.Join(dir, "refdb.bolt"),
+		RefDBEndpoint:  srv.URL,
+		UpdateInterval: time.Hour,
+	}}
+	logger := zap.NewNop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store, err := OpenStore(ctx, cfg, logger, nil)
+	require.NoError(t, err)
+	_, err = store.GetSymbolExchange(ctx, "F", "NYSE")
+	assert.NoError(t, err)
+	cancel()
+	require.NoError(t, store.Close())
+
+	// The bbolt store is used as is when refDB is unavailable
+	atomic.StoreInt32(&available, 0)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	store, err = OpenStore(ctx, cfg, logger, nil)
+	require.NoError(t, err)
+	_, err = store.GetSymbolExchange(ctx, "F", "NYSE")
+	assert.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// The memory store requires refDB
+	cfg.Reference.Store = config.MemoryStore
+	_, err = OpenStore(ctx, cfg, logger, nil)
+	assert.Error(t, err)
+}
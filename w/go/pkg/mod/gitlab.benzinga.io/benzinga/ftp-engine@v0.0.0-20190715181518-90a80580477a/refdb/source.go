@@ -0,0 +1,249 @@
+package refdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+)
+
+// DefaultTimeout is the default timeout of HTTP refDB downloads
+const DefaultTimeout = 2 * time.Minute
+
+// ErrNotModified is returned by Source.Open when refDB is unchanged since the Validator
+var ErrNotModified = errors.New("refDB not modified")
+
+// Validator identifies a refDB download, like the HTTP ETag and Last-Modified headers
+type Validator struct {
+	ETag         string
+	LastModified string
+}
+
+// Source downloads the refDB JSON, gzip compressed JSON is decompressed
+type Source interface {
+	// Open returns the refDB JSON and its Validator, or ErrNotModified if refDB is unchanged since the Validator
+	// of an earlier Open. The zero Validator always opens. The JSON is read with Decode.
+	Open(ctx context.Context, since Validator) (io.ReadCloser, Validator, error)
+	fmt.Stringer
+}
+
+// NewSource returns the Source of endpoint, a http or https URL, or a file path or file URL. HTTP downloads time
+// out after timeout, DefaultTimeout if 0.
+func NewSource(logger *zap.Logger, endpoint string, timeout time.Duration) (Source, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return NewHTTPSource(logger, endpoint, timeout), nil
+	case "file":
+		return NewFileSource(logger, u.Path), nil
+	case "":
+		return NewFileSource(logger, endpoint), nil
+	default:
+		return nil, fmt.Errorf("unsupported refDB endpoint scheme '%s'", u.Scheme)
+	}
+}
+
+// HTTPSource downloads refDB with conditional requests, servers that do not support them are checked with the
+// ETag and Last-Modified headers of the response before the body is decoded
+type HTTPSource struct {
+	logger   *zap.Logger
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPSource returns the Source of the endpoint URL, downloads time out after timeout, DefaultTimeout if 0
+func NewHTTPSource(logger *zap.Logger, endpoint string, timeout time.Duration) *HTTPSource {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &HTTPSource{
+		logger:   logger,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *HTTPSource) String() string {
+	return s.endpoint
+}
+
+// Open requests refDB, the response body is read until the timeout
+func (s *HTTPSource) Open(ctx context.Context, since Validator) (io.ReadCloser, Validator, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "refdb.HTTPSource.Open")
+	defer span.Finish()
+
+	ext.HTTPUrl.Set(span, s.endpoint)
+	ext.HTTPMethod.Set(span, http.MethodGet)
+
+	logger := s.logger.With(zap.String("endpoint", s.endpoint))
+
+	req, err := http.NewRequest(http.MethodGet, s.endpoint, nil)
+	if err != nil {
+		return nil, Validator{}, err
+	}
+	if since.ETag != "" {
+		req.Header.Set("If-None-Match", since.ETag)
+	}
+	if since.LastModified != "" {
+		req.Header.Set("If-Modified-Since", since.LastModified)
+	}
+
+	resp, err := s.client.Do(req.WithContext(subCtx))
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		logger.Error("Get refDB instruments error", zap.Error(err))
+		return nil, Validator{}, err
+	}
+
+	closeBody := func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Error("Response Body Close Error", zap.Error(closeErr))
+		}
+	}
+
+	ext.HTTPStatusCode.Set(span, uint16(resp.StatusCode))
+
+	validator := Validator{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		closeBody()
+		return nil, since, ErrNotModified
+	case resp.StatusCode != http.StatusOK:
+		closeBody()
+		err := fmt.Errorf("refDB status %d", resp.StatusCode)
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		logger.Error("Get refDB instruments error", zap.Int("status", resp.StatusCode))
+		return nil, Validator{}, err
+	case validator != Validator{} && validator == since:
+		closeBody()
+		return nil, since, ErrNotModified
+	}
+
+	body, err := decompress(resp.Body)
+	if err != nil {
+		closeBody()
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		logger.Error("Decompress refDB Error", zap.Error(err))
+		return nil, Validator{}, err
+	}
+	logger.Debug("refDB Opened", zap.String("etag", validator.ETag), zap.Int64("content_length", resp.ContentLength))
+
+	return body, validator, nil
+}
+
+// FileSource reads refDB from a file, ex. a local copy used when the refDB endpoint is unavailable. Files are
+// compared by size and modification time.
+type FileSource struct {
+	logger *zap.Logger
+	path   string
+}
+
+// NewFileSource returns the Source of the file at path
+func NewFileSource(logger *zap.Logger, path string) *FileSource {
+	return &FileSource{
+		logger: logger,
+		path:   path,
+	}
+}
+
+func (s *FileSource) String() string {
+	return s.path
+}
+
+// Open opens the file if it changed since the Validator
+func (s *FileSource) Open(ctx context.Context, since Validator) (io.ReadCloser, Validator, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "refdb.FileSource.Open")
+	defer span.Finish()
+	span.LogFields(tlog.String("path", s.path))
+
+	logger := s.logger.With(zap.String("path", s.path))
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		logger.Error("Open refDB File Error", zap.Error(err))
+		return nil, Validator{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		logger.Error("Stat refDB File Error", zap.Error(err))
+		return nil, Validator{}, err
+	}
+	validator := Validator{
+		ETag:         strconv.FormatInt(info.Size(), 10) + "-" + strconv.FormatInt(info.ModTime().UnixNano(), 10),
+		LastModified: info.ModTime().UTC().Format(http.TimeFormat),
+	}
+	if validator == since {
+		f.Close()
+		return nil, since, ErrNotModified
+	}
+
+	rc, err := decompress(f)
+	if err != nil {
+		f.Close()
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		logger.Error("Decompress refDB Error", zap.Error(err))
+		return nil, Validator{}, err
+	}
+	logger.Debug("refDB Opened", zap.Int64("size", info.Size()))
+
+	return rc, validator, nil
+}
+
+// readCloser closes the decompressed reader and the underlying reader
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if closeErr := c.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// decompress returns the gzip decompressed rc if it starts with the gzip header, or rc
+func decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	if header, err := br.Peek(2); err != nil || header[0] != 0x1f || header[1] != 0x8b {
+		return &readCloser{Reader: br, closers: []io.Closer{rc}}, nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return &readCloser{Reader: gz, closers: []io.Closer{gz, rc}}, nil
+}
@@ -0,0 +1,252 @@
+package refdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// fetch opens and decodes source
+func fetch(ctx context.Context, source Source, since Validator) (*reference.FinancialData, Validator, error) {
+	body, validator, err := source.Open(ctx, since)
+	if err != nil {
+		return nil, validator, err
+	}
+	defer body.Close()
+
+	data := &reference.FinancialData{}
+	data.Instruments, err = decodeAll(body, NewValidation())
+	return data, validator, err
+}
+
+func TestNewSource(t *testing.T) {
+	logger := zap.NewNop()
+	for endpoint, expected := range map[string]Source{
+		"https://example.com/refdb.json":  &HTTPSource{},
+		"http://data-api/refdb.json":      &HTTPSource{},
+		"file:///var/lib/refdb.json":      &FileSource{},
+		"/var/lib/refdb.json.gz":          &FileSource{},
+		"testdata/refdb.json":             &FileSource{},
+		"ftp://example.com/refdb.json.gz": nil,
+	} {
+		source, err := NewSource(logger, endpoint, 0)
+		if expected == nil {
+			assert.Error(t, err, endpoint)
+			continue
+		}
+		require.NoError(t, err, endpoint)
+		assert.IsType(t, expected, source, endpoint)
+	}
+
+	source, err := NewSource(logger, "file:///var/lib/refdb.json", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/refdb.json", source.String())
+}
+
+func TestHTTPSource(t *testing.T) {
+	var requests, notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped(t, refDBJSON))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	source := NewHTTPSource(zap.NewNop(), srv.URL, time.Second)
+
+	data, validator, err := fetch(ctx, source, Validator{})
+	require.NoError(t, err)
+	assert.Len(t, data.Instruments, 2)
+	assert.Equal(t, `"v1"`, validator.ETag)
+
+	_, same, err := fetch(ctx, source, validator)
+	assert.Equal(t, ErrNotModified, err)
+	assert.Equal(t, validator, same)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+}
+
+func TestHTTPSourceWithoutConditionalRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A gzip file, ex. refdb.json.gz, with a Last-Modified header
+		w.Header().Set("Last-Modified", "Mon, 15 Jul 2019 18:15:18 GMT")
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(gzipped(t, refDBJSON))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	source := NewHTTPSource(zap.NewNop(), srv.URL, time.Second)
+
+	data, validator, err := fetch(ctx, source, Validator{})
+	require.NoError(t, err)
+	assert.Len(t, data.Instruments, 2)
+
+	_, _, err = fetch(ctx, source, validator)
+	assert.Equal(t, ErrNotModified, err, "same Last-Modified is not decoded")
+}
+
+func TestHTTPSourceTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write(refDBJSON)
+	}))
+	defer srv.Close()
+
+	_, _, err := fetch(context.Background(), NewHTTPSource(zap.NewNop(), srv.URL, 50*time.Millisecond), Validator{})
+	assert.Error(t, err)
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "refdb")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "refdb.json.gz")
+	require.NoError(t, ioutil.WriteFile(path, gzipped(t, refDBJSON), 0644))
+
+	source := NewFileSource(zap.NewNop(), path)
+	data, validator, err := fetch(ctx, source, Validator{})
+	require.NoError(t, err)
+	assert.Len(t, data.Instruments, 2)
+
+	_, _, err = fetch(ctx, source, validator)
+	assert.Equal(t, ErrNotModified, err)
+
+	// Changed files are read again
+	require.NoError(t, ioutil.WriteFile(path, refDBJSON, 0644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	data, _, err = fetch(ctx, source, validator)
+	require.NoError(t, err)
+	assert.Len(t, data.Instruments, 2)
+
+	_, _, err = fetch(ctx, NewFileSource(zap.NewNop(), filepath.Join(dir, "missing.json")), Validator{})
+	assert.Error(t, err)
+}
+
+// testSource returns the instruments as JSON, data is not modified while the etag is the same
+type testSource struct {
+	etag string
+	data *reference.FinancialData
+}
+
+func (s *testSource) Open(ctx context.Context, since Validator) (io.ReadCloser, Validator, error) {
+	if since.ETag == s.etag {
+		return nil, since, ErrNotModified
+	}
+	b, err := jsoniter.Marshal(s.data)
+	if err != nil {
+		return nil, Validator{}, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), Validator{ETag: s.etag}, nil
+}
+
+func (s *testSource) String() string {
+	return "test"
+}
+
+// deltaStore is a memory store recording loads, deltas are applied as a Load of the instruments
+type deltaStore struct {
+	*rstore.Memory
+	loads     int
+	deltas    []int
+	conflicts int
+}
+
+func (s *deltaStore) BeginLoad(ctx context.Context) (rstore.SnapshotWriter, error) {
+	s.loads++
+	return s.Memory.BeginLoad(ctx)
+}
+
+func (s *deltaStore) LoadDelta(ctx context.Context, d *rstore.Delta) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return rstore.ErrSnapshotConflict
+	}
+	s.deltas = append(s.deltas, d.Len())
+	return nil
+}
+
+// withoutValidation returns the Result without Validation, see TestRefresherValidation
+func withoutValidation(r Result) Result {
+	r.Validation = nil
+	return r
+}
+
+func TestRefresherDelta(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	store := &deltaStore{Memory: rstore.NewMemory(logger)}
+	source := &testSource{etag: "1", data: &reference.FinancialData{Instruments: []reference.Instrument{
+		{Symbol: "F", CurrencyID: "USD", Exchange: "NYSE"},
+		{Symbol: "AAPL", CurrencyID: "USD", Exchange: "NASDAQ"},
+	}}}
+	r := NewRefresher(logger, source, store, RefresherOptions{Delta: true, MaxErrorRate: 1})
+
+	// The first refresh loads every instrument
+	result, err := r.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Instruments: 2}, withoutValidation(result))
+	assert.Equal(t, 1, store.loads)
+
+	// Unchanged downloads do not write the store
+	result, err = r.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Instruments: 2, Unchanged: true}, withoutValidation(result))
+	assert.Equal(t, 1, store.loads)
+	assert.Empty(t, store.deltas)
+
+	// Only the keys of changed instruments are written
+	source.etag = "2"
+	source.data = &reference.FinancialData{Instruments: []reference.Instrument{
+		{Symbol: "F", CurrencyID: "USD", Exchange: "NYSE"},
+		{Symbol: "AAPL", CurrencyID: "USD", Exchange: "NASDAQ", ISIN: "US0378331005"},
+	}}
+	result, err = r.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Instruments: 2, Delta: 3}, withoutValidation(result), "symbol exchange, symbol currency and ISIN keys")
+	assert.Equal(t, 1, store.loads)
+
+	// Snapshots loaded by another updater are replaced
+	source.etag = "3"
+	store.conflicts = 1
+	result, err = r.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Instruments: 2}, withoutValidation(result))
+	assert.Equal(t, 2, store.loads)
+}
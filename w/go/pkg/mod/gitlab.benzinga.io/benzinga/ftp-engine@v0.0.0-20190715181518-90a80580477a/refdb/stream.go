@@ -0,0 +1,58 @@
+package refdb
+
+import (
+	"io"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+// decodeBufferSize is the read buffer of Decode
+const decodeBufferSize = 64 * 1024
+
+// Decode reads the refDB JSON in r token by token and calls fn with each instrument in document order, so the
+// document is never in memory at once. fn must copy the instrument to keep it. Decoding stops at the first error
+// of fn, which is returned.
+func Decode(r io.Reader, fn func(inst *reference.Instrument) error) error {
+	iter := jsoniter.Parse(jsoniter.ConfigDefault, r, decodeBufferSize)
+
+	var fnErr error
+	iter.ReadObjectCB(func(iter *jsoniter.Iterator, field string) bool {
+		if !strings.EqualFold(field, "instruments") || iter.WhatIsNext() == jsoniter.NilValue {
+			iter.Skip()
+			return iter.Error == nil
+		}
+		return iter.ReadArrayCB(func(iter *jsoniter.Iterator) bool {
+			var inst reference.Instrument
+			iter.ReadVal(&inst)
+			if iter.Error != nil {
+				return false
+			}
+			if fnErr = fn(&inst); fnErr != nil {
+				return false
+			}
+			return true
+		})
+	})
+
+	if fnErr != nil {
+		return fnErr
+	}
+	if iter.Error != nil && iter.Error != io.EOF {
+		return iter.Error
+	}
+	return nil
+}
+
+// decodeAll returns every instrument of the refDB JSON in r
+func decodeAll(r io.Reader, v *Validation) ([]reference.Instrument, error) {
+	var instruments []reference.Instrument
+	err := Decode(r, func(inst *reference.Instrument) error {
+		v.Check(inst)
+		instruments = append(instruments, *inst)
+		return nil
+	})
+	return instruments, err
+}
@@ -0,0 +1,218 @@
+package refdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func TestDecode(t *testing.T) {
+	doc := `{
+		"version": {"build": "1", "tags": ["a", "b"]},
+		"instruments": [
+			{"symbol": "F", "currencyId": "USD", "exchange": "NYSE", "isin": "US3453708600", "unknown": [1, {"x": null}]},
+			{"symbol": "AAPL", "currencyId": "USD", "exchange": "NASDAQ"}
+		],
+		"count": 2
+	}`
+
+	var symbols []string
+	require.NoError(t, Decode(strings.NewReader(doc), func(inst *reference.Instrument) error {
+		symbols = append(symbols, inst.Symbol)
+		return nil
+	}))
+	assert.Equal(t, []string{"F", "AAPL"}, symbols)
+
+	// gzip is decompressed by Source, Decode reads JSON
+	body, err := decompress(nopCloser{bytes.NewReader(gzipped(t, refDBJSON))})
+	require.NoError(t, err)
+	instruments, err := decodeAll(body, NewValidation())
+	require.NoError(t, err)
+	assert.Len(t, instruments, 2)
+
+	instruments, err = decodeAll(strings.NewReader(`{"instruments": null}`), NewValidation())
+	require.NoError(t, err)
+	assert.Empty(t, instruments)
+
+	_, err = decodeAll(strings.NewReader(`{"instruments": [{"symbol": "F"},`), NewValidation())
+	assert.Error(t, err, "truncated")
+	_, err = decodeAll(strings.NewReader(`[]`), NewValidation())
+	assert.Error(t, err)
+
+	stop := errors.New("stop")
+	count := 0
+	err = Decode(strings.NewReader(doc), func(inst *reference.Instrument) error {
+		count++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, count)
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestValidation(t *testing.T) {
+	v := NewValidation()
+	assert.Zero(t, v.ErrorRate())
+
+	for _, inst := range []reference.Instrument{
+		{Symbol: "F", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US3453708600"},
+		{Symbol: "F", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US3453708600"},
+		{Symbol: "F", CurrencyID: "usd", Exchange: "XETRA"},
+		{Symbol: "AAPL", CurrencyID: "USD", Exchange: "NASDAQ", ISIN: "US0378331005"},
+	} {
+		v.Check(&inst)
+	}
+
+	assert.Equal(t, 4, v.Instruments)
+	assert.Equal(t, 2, v.Invalid)
+	assert.Equal(t, map[string]int{DuplicateSymbolExchange: 1, MissingISIN: 1, BadCurrency: 1}, v.Problems)
+	assert.Equal(t, 0.5, v.ErrorRate())
+
+	// Missing ISINs are warnings
+	inst := reference.Instrument{Symbol: "META", CurrencyID: "USD", Exchange: "NASDAQ"}
+	v.Check(&inst)
+	assert.Equal(t, 2, v.Problems[MissingISIN])
+	assert.Equal(t, 2, v.Invalid)
+}
+
+// streamStore is a memory store loaded by snapshots written in batches
+type streamStore struct {
+	*rstore.Memory
+	batches   []int
+	committed int
+	aborted   int
+	writeErr  error
+}
+
+func (s *streamStore) BeginLoad(ctx context.Context) (rstore.SnapshotWriter, error) {
+	return &streamWriter{store: s}, nil
+}
+
+type streamWriter struct {
+	store       *streamStore
+	instruments []reference.Instrument
+}
+
+func (w *streamWriter) Write(ctx context.Context, instruments []reference.Instrument) error {
+	if w.store.writeErr != nil {
+		return w.store.writeErr
+	}
+	w.store.batches = append(w.store.batches, len(instruments))
+	w.instruments = append(w.instruments, instruments...)
+	return nil
+}
+
+func (w *streamWriter) Commit(ctx context.Context) error {
+	w.store.committed++
+	return w.store.Memory.Load(ctx, w.instruments)
+}
+
+func (w *streamWriter) Abort(ctx context.Context) error {
+	w.store.aborted++
+	return nil
+}
+
+func TestRefresherStream(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	store := &streamStore{Memory: rstore.NewMemory(logger)}
+
+	data := &reference.FinancialData{}
+	for i := 0; i < streamBatchSize+10; i++ {
+		data.Instruments = append(data.Instruments, reference.Instrument{
+			Symbol:     fmt.Sprintf("S%d", i),
+			CurrencyID: "USD",
+			Exchange:   "NYSE",
+			ISIN:       fmt.Sprintf("US%010d", i),
+		})
+	}
+	source := &testSource{etag: "1", data: data}
+	r := NewRefresher(logger, source, store, RefresherOptions{MaxErrorRate: 0.1})
+
+	result, err := r.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, streamBatchSize+10, result.Instruments)
+	assert.Equal(t, []int{streamBatchSize, 10}, store.batches)
+	assert.Equal(t, 1, store.committed)
+	_, err = store.GetSymbolExchange(ctx, "S1000", "NYSE")
+	assert.NoError(t, err)
+
+	// Instruments without ISIN are counted, but do not abort the refresh
+	source.etag = "2"
+	for i := 0; i < 200; i++ {
+		data.Instruments[i].ISIN = ""
+	}
+	result, err = r.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 200, result.Validation.Problems[MissingISIN])
+	assert.Zero(t, result.Validation.Invalid)
+	assert.Equal(t, 2, store.committed)
+
+	// Snapshots with too many invalid instruments are not committed
+	source.etag = "3"
+	for i := 0; i < 200; i++ {
+		data.Instruments[i].CurrencyID = "usd"
+	}
+	data.Instruments[0].Symbol = "BAD"
+	result, err = r.Refresh(ctx)
+	require.Error(t, err)
+	require.IsType(t, &ValidationError{}, err)
+	assert.Equal(t, streamBatchSize+10, result.Instruments)
+	assert.Equal(t, 200, result.Validation.Problems[BadCurrency])
+	assert.Equal(t, 2, store.committed)
+	assert.Equal(t, 1, store.aborted)
+	_, err = store.GetSymbolExchange(ctx, "BAD", "NYSE")
+	assert.Error(t, err, "previous instruments are kept")
+
+	// Write errors abort the snapshot
+	source.etag = "4"
+	store.writeErr = errors.New("write")
+	_, err = r.Refresh(ctx)
+	assert.Equal(t, store.writeErr, err)
+	assert.Equal(t, 2, store.aborted)
+
+	// Failed downloads are decoded again
+	store.writeErr = nil
+	result, err = r.Refresh(ctx)
+	assert.IsType(t, &ValidationError{}, err)
+	assert.False(t, result.Unchanged)
+}
+
+func TestRefresherValidation(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	store := rstore.NewMemory(logger)
+	source := &testSource{etag: "1", data: &reference.FinancialData{Instruments: []reference.Instrument{
+		{Symbol: "F", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US3453708600"},
+		{Symbol: "AAPL", CurrencyID: "$", Exchange: "NASDAQ", ISIN: "US0378331005"},
+	}}}
+
+	result, err := NewRefresher(logger, source, store, RefresherOptions{}).Refresh(ctx)
+	assert.Equal(t, &ValidationError{Rate: 0.5, Max: DefaultMaxErrorRate}, err)
+	assert.Equal(t, map[string]int{BadCurrency: 1}, result.Validation.Problems)
+	_, err = store.GetSymbolExchange(ctx, "F", "NYSE")
+	assert.Error(t, err, "not loaded")
+
+	result, err = NewRefresher(logger, source, store, RefresherOptions{MaxErrorRate: 1}).Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Validation.Invalid)
+	_, err = store.GetSymbolExchange(ctx, "F", "NYSE")
+	assert.NoError(t, err)
+}
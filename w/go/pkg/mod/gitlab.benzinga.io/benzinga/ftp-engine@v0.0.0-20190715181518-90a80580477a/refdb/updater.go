@@ -0,0 +1,266 @@
+package refdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/opentracing/opentracing-go"
+	tlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+)
+
+// ErrNoSnapshot is returned by Updater.Ready until instruments are loaded
+var ErrNoSnapshot = errors.New("no refDB snapshot loaded")
+
+// Locker is the leader lock of updater replicas, see rstore.Lock
+type Locker interface {
+	// Acquire takes or keeps the lock, false if another replica holds it
+	Acquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context) error
+}
+
+// versioner is implemented by stores shared by replicas, see rstore.Client.SnapshotVersion
+type versioner interface {
+	SnapshotVersion(ctx context.Context) (int64, error)
+}
+
+// UpdaterStatus is the refresh state of an Updater
+type UpdaterStatus struct {
+	// Leader is true while the replica holds the leader lock, only the leader refreshes
+	Leader bool `json:"leader"`
+	// LastAttempt is when the last refresh finished
+	LastAttempt time.Time `json:"last_attempt"`
+	// LastSuccess is when the last successful refresh finished
+	LastSuccess time.Time `json:"last_success"`
+	// LastError is the error of the last refresh, empty if it succeeded
+	LastError string `json:"last_error,omitempty"`
+	// Instruments is the number of instruments loaded by the last successful refresh
+	Instruments int `json:"instruments"`
+	// Failures is the number of refreshes failed since the last success
+	Failures int `json:"failures"`
+}
+
+// Updater refreshes a store shared by every worker, ex. Redis, from refDB. Replicas elect a leader with the
+// Locker so only the leader refreshes, and failed refreshes keep the last loaded snapshot.
+type Updater struct {
+	logger    *zap.Logger
+	refresher *Refresher
+	interval  time.Duration
+	lock      Locker
+	lockTTL   time.Duration
+	inst      *instr.UpdaterCollector
+	backoff   []time.Duration
+
+	mu     sync.Mutex
+	status UpdaterStatus
+}
+
+// NewUpdater returns an Updater of the refresher store. lock is held for lockTTL and renewed every third of
+// lockTTL, without a lock the Updater is always the leader. inst is optional.
+func NewUpdater(logger *zap.Logger, refresher *Refresher, interval time.Duration, lock Locker, lockTTL time.Duration, inst *instr.UpdaterCollector) *Updater {
+	return &Updater{
+		logger:    logger,
+		refresher: refresher,
+		interval:  interval,
+		lock:      lock,
+		lockTTL:   lockTTL,
+		inst:      inst,
+		backoff:   retrier.ExponentialBackoff(3, 1*time.Minute),
+	}
+}
+
+// Run elects a leader and refreshes the store every interval while leader, until ctx is done. The leader
+// refreshes as soon as it is elected, and releases the lock before Run returns.
+func (u *Updater) Run(ctx context.Context) {
+	elected := make(chan struct{}, 1)
+	electDone := make(chan struct{})
+	go func() {
+		u.elect(ctx, elected)
+		close(electDone)
+	}()
+
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+
+	u.logger.Info("Starting Refresh Worker", zap.Duration("refresh_interval", u.interval))
+
+	for {
+		select {
+		case <-elected:
+			u.logger.Info("Elected Leader")
+			u.refresh(ctx)
+
+		case <-ticker.C:
+			if !u.Status().Leader {
+				u.logger.Debug("Not Leader, Skipping Update")
+				continue
+			}
+			u.refresh(ctx)
+
+		case <-ctx.Done():
+			u.logger.Info("Stopping Refresh Worker")
+			<-electDone
+			return
+		}
+	}
+}
+
+// elect acquires the lock until ctx is done, elected is signaled when the replica becomes leader
+func (u *Updater) elect(ctx context.Context, elected chan<- struct{}) {
+	if u.lock == nil {
+		u.setLeader(true)
+		elected <- struct{}{}
+		return
+	}
+
+	ticker := time.NewTicker(u.lockTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		leader, err := u.lock.Acquire(ctx)
+		if err != nil {
+			// The lock may expire before it is acquired again, so another replica can be elected
+			u.logger.Error("Acquire Leader Lock Error", zap.Error(err))
+			leader = false
+		}
+		if changed := u.setLeader(leader); changed && leader {
+			select {
+			case elected <- struct{}{}:
+			default:
+			}
+		} else if changed {
+			u.logger.Warn("Lost Leader Lock")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if u.Status().Leader {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := u.lock.Release(releaseCtx); err != nil {
+					u.logger.Error("Release Leader Lock Error", zap.Error(err))
+				}
+				cancel()
+				u.setLeader(false)
+			}
+			return
+		}
+	}
+}
+
+// setLeader returns true if leader changed
+func (u *Updater) setLeader(leader bool) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	changed := u.status.Leader != leader
+	u.status.Leader = leader
+	if u.inst != nil {
+		if leader {
+			u.inst.Leader.Set(1)
+		} else {
+			u.inst.Leader.Set(0)
+		}
+	}
+	return changed
+}
+
+// refresh the store with retries, a failed refresh is logged and the store keeps the last snapshot
+func (u *Updater) refresh(ctx context.Context) {
+	u.logger.Debug("Starting Update")
+
+	r := retrier.New(u.backoff, nil)
+	err := r.RunCtx(ctx, func(subCtx context.Context) error {
+		if refreshErr := u.Refresh(subCtx); refreshErr != nil {
+			u.logger.Error("Refresh Worker Error", zap.Error(refreshErr))
+			return refreshErr
+		}
+		return nil
+	})
+	if err != nil {
+		if u.inst != nil {
+			u.inst.RefreshFailures.Inc()
+		}
+		u.logger.Error("Update Failed After Retries, Keeping Last Snapshot", zap.Error(err), zap.Int("failures", u.Status().Failures))
+		return
+	}
+	u.logger.Debug("Refresh Successful")
+}
+
+// Refresh refreshes the store once, see Refresher, and records the result in Status. An unchanged refDB is a
+// successful refresh.
+func (u *Updater) Refresh(ctx context.Context) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "refdb.Updater.Refresh")
+	defer span.Finish()
+
+	start := time.Now()
+	result, err := u.refresher.Refresh(subCtx)
+	finished := time.Now()
+	if u.inst != nil {
+		u.inst.RefreshDuration.Observe(finished.Sub(start).Seconds())
+		if v := result.Validation; v != nil {
+			for _, problem := range Problems {
+				u.inst.RefreshInvalidInstruments.WithLabelValues(problem).Set(float64(v.Problems[problem]))
+			}
+			u.inst.RefreshErrorRate.Set(v.ErrorRate())
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.status.LastAttempt = finished
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		u.status.LastError = err.Error()
+		u.status.Failures++
+		return err
+	}
+
+	u.status.LastSuccess = finished
+	u.status.LastError = ""
+	u.status.Instruments = result.Instruments
+	u.status.Failures = 0
+	if u.inst != nil {
+		u.inst.RefreshLastSuccess.Set(float64(finished.Unix()))
+		u.inst.RefreshInstruments.Set(float64(result.Instruments))
+	}
+	return nil
+}
+
+// Status returns the refresh state
+func (u *Updater) Status() UpdaterStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.status
+}
+
+// Ready returns nil if the store is available and has a snapshot, loaded by this or another replica. Failed
+// refreshes do not make the Updater unready, workers keep reading the last snapshot.
+func (u *Updater) Ready(ctx context.Context) error {
+	store := u.refresher.store
+	if err := store.Status(ctx); err != nil {
+		return err
+	}
+
+	if v, ok := store.(versioner); ok {
+		version, err := v.SnapshotVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			return ErrNoSnapshot
+		}
+		return nil
+	}
+
+	if u.Status().LastSuccess.IsZero() {
+		return ErrNoSnapshot
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package refdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+)
+
+// testLock is a Locker shared by replicas in process, holder is the name of the replica holding it
+type testLock struct {
+	mu     *sync.Mutex
+	holder *string
+	name   string
+}
+
+func (l testLock) Acquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if *l.holder == "" {
+		*l.holder = l.name
+	}
+	return *l.holder == l.name, nil
+}
+
+func (l testLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if *l.holder == l.name {
+		*l.holder = ""
+	}
+	return nil
+}
+
+// waitFor polls cond until it is true or the timeout is reached
+func waitFor(t *testing.T, timeout time.Duration, msg string, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			require.FailNow(t, "timed out waiting for "+msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUpdaterRefresh(t *testing.T) {
+	available := int32(0)
+	srv := newRefDBServer(&available)
+	defer srv.Close()
+
+	ctx := context.Background()
+	logger := zap.NewNop()
+	store := rstore.NewMemory(logger)
+	u := NewUpdater(logger, NewRefresher(logger, NewHTTPSource(logger, srv.URL, 0), store, RefresherOptions{}), time.Hour, nil, 0, nil)
+
+	assert.Equal(t, ErrNoSnapshot, u.Ready(ctx))
+
+	assert.Error(t, u.Refresh(ctx))
+	assert.Equal(t, 1, u.Status().Failures)
+	assert.NotEmpty(t, u.Status().LastError)
+
+	atomic.StoreInt32(&available, 1)
+	require.NoError(t, u.Refresh(ctx))
+	status := u.Status()
+	assert.Equal(t, 2, status.Instruments)
+	assert.Equal(t, 0, status.Failures)
+	assert.False(t, status.LastSuccess.IsZero())
+	assert.NoError(t, u.Ready(ctx))
+
+	// Failed refreshes keep the last snapshot, the updater stays ready
+	atomic.StoreInt32(&available, 0)
+	assert.Error(t, u.Refresh(ctx))
+	assert.NoError(t, u.Ready(ctx))
+	assert.Equal(t, status.LastSuccess, u.Status().LastSuccess)
+	_, err := store.GetSymbolExchange(ctx, "AAPL", "NASDAQ")
+	assert.NoError(t, err)
+}
+
+func TestUpdaterLeader(t *testing.T) {
+	available := int32(1)
+	srv := newRefDBServer(&available)
+	defer srv.Close()
+
+	logger := zap.NewNop()
+	var mu sync.Mutex
+	var holder string
+
+	newReplica := func(name string) (*Updater, rstore.Store) {
+		store := rstore.NewMemory(logger)
+		u := NewUpdater(logger, NewRefresher(logger, NewHTTPSource(logger, srv.URL, 0), store, RefresherOptions{}), time.Hour, testLock{mu: &mu, holder: &holder, name: name}, 30*time.Millisecond, nil)
+		u.backoff = nil
+		return u, store
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, firstStore := newReplica("first")
+	firstDone := make(chan struct{})
+	go func() {
+		first.Run(ctx)
+		close(firstDone)
+	}()
+
+	// The leader refreshes when elected
+	waitFor(t, time.Second, "leader refresh", func() bool { return first.Status().Instruments == 2 })
+	assert.True(t, first.Status().Leader)
+	_, err := firstStore.GetSymbolExchange(ctx, "F", "NYSE")
+	assert.NoError(t, err)
+
+	secondCtx, secondCancel := context.WithCancel(context.Background())
+	defer secondCancel()
+	second, _ := newReplica("second")
+	go second.Run(secondCtx)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, second.Status().Leader)
+	assert.Equal(t, 0, second.Status().Instruments, "replicas do not refresh")
+
+	// The lock is released when the leader stops, another replica takes over
+	cancel()
+	<-firstDone
+	assert.False(t, first.Status().Leader)
+	waitFor(t, time.Second, "new leader refresh", func() bool { return second.Status().Instruments == 2 })
+	assert.True(t, second.Status().Leader)
+}
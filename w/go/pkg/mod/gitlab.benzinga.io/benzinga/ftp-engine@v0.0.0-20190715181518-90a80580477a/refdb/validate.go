@@ -0,0 +1,106 @@
+package refdb
+
+import (
+	"fmt"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+// Problems found by Validation, an instrument may have several
+const (
+	// DuplicateSymbolExchange is an instrument with the symbol and exchange of an earlier instrument
+	DuplicateSymbolExchange = "duplicate_symbol_exchange"
+	// MissingISIN is an instrument without ISIN, a warning: many refDB instruments have no ISIN
+	MissingISIN = "missing_isin"
+	// BadCurrency is an instrument whose currency is not an ISO 4217 code
+	BadCurrency = "bad_currency"
+)
+
+// Problems are the problems reported by Validation
+var Problems = []string{DuplicateSymbolExchange, MissingISIN, BadCurrency}
+
+// warnings are the Problems that are counted but do not make an instrument invalid
+var warnings = map[string]bool{MissingISIN: true}
+
+// DefaultMaxErrorRate is the default rate of invalid instruments that aborts a refresh
+const DefaultMaxErrorRate = 0.25
+
+// Validation counts the invalid refDB instruments of a refresh as they are decoded
+type Validation struct {
+	// Instruments is the number of instruments checked
+	Instruments int
+	// Invalid is the number of instruments with at least one problem other than a warning
+	Invalid int
+	// Problems is the number of instruments with each problem
+	Problems map[string]int
+
+	seen map[string]struct{}
+}
+
+// NewValidation returns an empty Validation
+func NewValidation() *Validation {
+	return &Validation{
+		Problems: make(map[string]int),
+		seen:     make(map[string]struct{}),
+	}
+}
+
+// Check counts the problems of inst
+func (v *Validation) Check(inst *reference.Instrument) {
+	v.Instruments++
+
+	var problems []string
+	key := inst.Symbol + ":" + inst.Exchange
+	if _, ok := v.seen[key]; ok {
+		problems = append(problems, DuplicateSymbolExchange)
+	} else {
+		v.seen[key] = struct{}{}
+	}
+	if inst.ISIN == "" {
+		problems = append(problems, MissingISIN)
+	}
+	if !isCurrency(inst.CurrencyID) {
+		problems = append(problems, BadCurrency)
+	}
+
+	var invalid bool
+	for _, problem := range problems {
+		v.Problems[problem]++
+		invalid = invalid || !warnings[problem]
+	}
+	if invalid {
+		v.Invalid++
+	}
+}
+
+// ErrorRate returns the rate of invalid instruments, 0 if no instrument was checked
+func (v *Validation) ErrorRate() float64 {
+	if v.Instruments == 0 {
+		return 0
+	}
+	return float64(v.Invalid) / float64(v.Instruments)
+}
+
+// isCurrency returns true for three uppercase letters, ex. USD
+func isCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for i := 0; i < len(currency); i++ {
+		if currency[i] < 'A' || currency[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidationError is returned by Refresher.Refresh when the rate of invalid instruments exceeds the maximum, the
+// store keeps the previous instruments
+type ValidationError struct {
+	Rate float64
+	Max  float64
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("refDB error rate %.3f exceeds %.3f", e.Rate, e.Max)
+}
@@ -0,0 +1,123 @@
+package rstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tlog "github.com/opentracing/opentracing-go/log"
+	otredis "github.com/smacker/opentracing-go-redis"
+	"go.uber.org/zap"
+)
+
+var _ = Aliaser(&Client{}) // check interface
+
+const (
+	// aliasesKey is the hash of the alias table, it is kept across snapshot versions
+	aliasesKey = ftpEnginePrefix + ":aliases"
+	// aliasesLoadingKey is the alias table being loaded, renamed to aliasesKey when complete
+	aliasesLoadingKey = ftpEnginePrefix + ":aliases:loading"
+)
+
+// GetAlias looks up name in the alias table, from the cache if enabled
+func (c *Client) GetAlias(ctx context.Context, name string) (string, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.GetAlias")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+
+	name = NormalizeTicker(name)
+	span.LogFields(tlog.String("name", name))
+	client := otredis.WrapRedisClient(subCtx, c.client)
+
+	var generation int64
+	if c.cache != nil {
+		var err error
+		if _, generation, err = c.currentVersion(client); err != nil {
+			span.LogFields(tlog.Error(err))
+			ext.Error.Set(span, true)
+			c.logger.Error("Redis Get Alias Version Error", zap.Error(err), zap.String("name", name))
+			return "", err
+		}
+		if value, ok := c.cache.get(generation, "alias", aliasesKey+":"+name); ok {
+			span.LogFields(tlog.Bool("cached", true))
+			return value.(string), nil
+		}
+	}
+
+	target, err := client.HGet(aliasesKey, name).Result()
+	if err != nil && err != redis.Nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		c.logger.Error("Redis Get Alias Error", zap.Error(err), zap.String("name", name))
+		return "", err
+	}
+
+	if c.cache != nil {
+		c.cache.add(generation, aliasesKey+":"+name, target)
+	}
+	return target, nil
+}
+
+// LoadAliases writes the alias table with pipelined writes, then replaces the previous table at once and
+// increments the generation so readers clear their cache
+func (c *Client) LoadAliases(ctx context.Context, aliases map[string]string) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.LoadAliases")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+	span.LogFields(tlog.Int("count", len(aliases)))
+
+	client := otredis.WrapRedisClient(subCtx, c.client)
+	fail := func(msg string, err error) error {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		c.logger.Error(msg, zap.Error(err))
+		return err
+	}
+
+	if err := client.Del(aliasesLoadingKey).Err(); err != nil {
+		return fail("Redis Delete Loading Aliases Error", err)
+	}
+
+	fields := make(map[string]interface{}, loadBatchSize)
+	write := func() error {
+		if len(fields) == 0 {
+			return nil
+		}
+		err := client.HMSet(aliasesLoadingKey, fields).Err()
+		fields = make(map[string]interface{}, loadBatchSize)
+		return err
+	}
+	for name, target := range aliases {
+		fields[NormalizeTicker(name)] = target
+		if len(fields) == loadBatchSize {
+			if err := write(); err != nil {
+				return fail("Redis Write Aliases Error", err)
+			}
+		}
+	}
+	if err := write(); err != nil {
+		return fail("Redis Write Aliases Error", err)
+	}
+
+	var generation *redis.IntCmd
+	if _, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		if len(aliases) == 0 {
+			pipe.Del(aliasesKey)
+		} else {
+			pipe.Rename(aliasesLoadingKey, aliasesKey)
+		}
+		generation = pipe.Incr(generationKey)
+		return nil
+	}); err != nil {
+		return fail("Redis Replace Aliases Error", err)
+	}
+
+	// The next lookup reads the new generation
+	c.versionMu.Lock()
+	c.versionExpires = time.Time{}
+	c.versionMu.Unlock()
+	c.logger.Info("Aliases Loaded", zap.Int("count", len(aliases)), zap.Int64("generation", generation.Val()))
+	return nil
+}
@@ -0,0 +1,416 @@
+package rstore
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tlog "github.com/opentracing/opentracing-go/log"
+	"github.com/vmihailenco/msgpack"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+var _ = Store(&Bolt{})        // check interface
+var _ = Loader(&Bolt{})       // check interface
+var _ = StreamLoader(&Bolt{}) // check interface
+var _ = Aliaser(&Bolt{})      // check interface
+
+var (
+	instrumentsBucket = []byte("instruments")
+	// historyBucket has the History of each symbol key, kept when instruments are loaded
+	historyBucket = []byte("history")
+	// aliasesBucket is the alias table, see Aliaser
+	aliasesBucket = []byte("aliases")
+)
+
+// Bolt is a bbolt file Store, instruments survive restarts without Redis or refDB
+type Bolt struct {
+	db     *bolt.DB
+	logger *zap.Logger
+}
+
+// NewBolt opens or creates the bbolt file at path. The file is locked, so only one process can open it.
+func NewBolt(l *zap.Logger, path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0640, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{instrumentsBucket, historyBucket, aliasesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Bolt{db: db, logger: l.Named("bolt")}, nil
+}
+
+func (b *Bolt) get(ctx context.Context, operationName, key string) (*reference.Instrument, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, operationName)
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.String("key", key))
+
+	var instr reference.Instrument
+	err := b.db.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(instrumentsBucket).Get([]byte(key))
+		if val == nil {
+			return ErrKeyNotFound
+		}
+		return msgpack.Unmarshal(val, &instr)
+	})
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		b.logger.Error("Bolt Get Error", zap.Error(err), zap.String("key", key))
+		return nil, err
+	}
+
+	return &instr, nil
+}
+
+// getAt returns the instrument of key at t from the key history, or the current instrument without history
+func (b *Bolt) getAt(ctx context.Context, operationName, key string, t time.Time) (*reference.Instrument, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, operationName)
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.String("key", key), tlog.String("at", t.String()))
+
+	var h History
+	err := b.db.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(historyBucket).Get([]byte(key))
+		if val == nil {
+			return nil
+		}
+		return msgpack.Unmarshal(val, &h)
+	})
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		b.logger.Error("Bolt Get History Error", zap.Error(err), zap.String("key", key))
+		return nil, err
+	}
+	// Without history, or after its last change, the current instrument is used
+	if h == nil || !t.Before(h.Changed()) {
+		return b.get(subCtx, operationName, key)
+	}
+
+	instr, ok := h.At(t)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return instr, nil
+}
+
+func (b *Bolt) put(ctx context.Context, operationName, key string, inst *reference.Instrument) error {
+	span, _ := opentracing.StartSpanFromContext(ctx, operationName)
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.String("key", key))
+
+	val, err := msgpack.Marshal(inst)
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		b.logger.Error("Bolt Put Marshal Error", zap.Error(err))
+		return err
+	}
+
+	if err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(instrumentsBucket).Put([]byte(key), val)
+	}); err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		b.logger.Error("Bolt Put Error", zap.Error(err), zap.String("key", key))
+		return err
+	}
+	return nil
+}
+
+// GetSymbolExchange ...
+func (b *Bolt) GetSymbolExchange(ctx context.Context, symbol, exchange string) (*reference.Instrument, error) {
+	return b.get(ctx, "bolt.GetSymbolExchange", symbolExchangeKey(symbol, exchange))
+}
+
+// GetSymbolCurrency ...
+func (b *Bolt) GetSymbolCurrency(ctx context.Context, symbol, currency string) (*reference.Instrument, error) {
+	return b.get(ctx, "bolt.GetSymbolCurrency", symbolCurrencyKey(symbol, currency))
+}
+
+// GetSymbolExchangeAt ...
+func (b *Bolt) GetSymbolExchangeAt(ctx context.Context, symbol, exchange string, t time.Time) (*reference.Instrument, error) {
+	return b.getAt(ctx, "bolt.GetSymbolExchangeAt", symbolExchangeKey(symbol, exchange), t)
+}
+
+// GetSymbolCurrencyAt ...
+func (b *Bolt) GetSymbolCurrencyAt(ctx context.Context, symbol, currency string, t time.Time) (*reference.Instrument, error) {
+	return b.getAt(ctx, "bolt.GetSymbolCurrencyAt", symbolCurrencyKey(symbol, currency), t)
+}
+
+// GetIdentifier ...
+func (b *Bolt) GetIdentifier(ctx context.Context, idType IdentifierType, id string) (*reference.Instrument, error) {
+	return b.get(ctx, "bolt.GetIdentifier", identifierKey(idType, id))
+}
+
+// PutSymbolExchange ...
+func (b *Bolt) PutSymbolExchange(ctx context.Context, inst *reference.Instrument) error {
+	return b.put(ctx, "bolt.PutSymbolExchange", symbolExchangeKey(inst.Symbol, inst.Exchange), inst)
+}
+
+// PutSymbolCurrency ...
+func (b *Bolt) PutSymbolCurrency(ctx context.Context, inst *reference.Instrument) error {
+	return b.put(ctx, "bolt.PutSymbolCurrency", symbolCurrencyKey(inst.Symbol, inst.CurrencyID), inst)
+}
+
+// Load replaces every instrument in a single transaction, readers see the previous instruments until it commits
+func (b *Bolt) Load(ctx context.Context, instruments []reference.Instrument) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "bolt.Load")
+	defer span.Finish()
+	span.LogFields(tlog.Int("count", len(instruments)))
+
+	w, err := b.BeginLoad(subCtx)
+	if err != nil {
+		return err
+	}
+	if err := w.Write(subCtx, instruments); err != nil {
+		w.Abort(subCtx)
+		return err
+	}
+	return w.Commit(subCtx)
+}
+
+// BeginLoad starts a load written in batches in a single transaction, readers see the previous instruments until
+// it commits. Other writes wait for the load. See Load.
+func (b *Bolt) BeginLoad(ctx context.Context) (SnapshotWriter, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "bolt.BeginLoad")
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+
+	tx, err := b.db.Begin(true)
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		b.logger.Error("Bolt Begin Load Error", zap.Error(err))
+		return nil, err
+	}
+	if err := tx.DeleteBucket(instrumentsBucket); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := tx.CreateBucket(instrumentsBucket); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &boltWriter{b: b, tx: tx}, nil
+}
+
+// boltWriter writes the instruments of a Bolt load in its transaction
+type boltWriter struct {
+	b     *Bolt
+	tx    *bolt.Tx
+	count int
+}
+
+func (w *boltWriter) fail(span opentracing.Span, msg string, err error) error {
+	span.LogFields(tlog.Error(err))
+	ext.Error.Set(span, true)
+	w.b.logger.Error(msg, zap.Error(err))
+	return err
+}
+
+// Write the instruments, later instruments replace earlier instruments of the same symbol and identifiers are
+// indexed to the first instrument
+func (w *boltWriter) Write(ctx context.Context, instruments []reference.Instrument) error {
+	span, _ := opentracing.StartSpanFromContext(ctx, "bolt.SnapshotWrite")
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.Int("count", len(instruments)))
+
+	bucket := w.tx.Bucket(instrumentsBucket)
+	for i := range instruments {
+		val, err := msgpack.Marshal(&instruments[i])
+		if err != nil {
+			return w.fail(span, "Bolt Write Error", err)
+		}
+		for _, key := range symbolKeys(&instruments[i]) {
+			if err := bucket.Put([]byte(key), val); err != nil {
+				return w.fail(span, "Bolt Write Error", err)
+			}
+		}
+		for _, key := range identifierKeys(&instruments[i]) {
+			if bucket.Get([]byte(key)) != nil {
+				continue
+			}
+			if err := bucket.Put([]byte(key), val); err != nil {
+				return w.fail(span, "Bolt Write Error", err)
+			}
+		}
+	}
+	w.count += len(instruments)
+	return nil
+}
+
+// Commit updates the History of every symbol and commits the transaction
+func (w *boltWriter) Commit(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContext(ctx, "bolt.SnapshotCommit")
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.Int("count", w.count))
+
+	if err := updateBoltHistory(w.tx.Bucket(historyBucket), w.tx.Bucket(instrumentsBucket), now()); err != nil {
+		w.tx.Rollback()
+		return w.fail(span, "Bolt Load Error", err)
+	}
+	if err := w.tx.Commit(); err != nil {
+		return w.fail(span, "Bolt Load Error", err)
+	}
+	return nil
+}
+
+// Abort rolls back the transaction, readers keep the previous instruments
+func (w *boltWriter) Abort(ctx context.Context) error {
+	return w.tx.Rollback()
+}
+
+// updateBoltHistory updates the history of every key in the history bucket and every symbol key in the
+// instruments bucket, see updateHistories
+func updateBoltHistory(history, instruments *bolt.Bucket, at time.Time) error {
+	histories := map[string]History{}
+	if err := history.ForEach(func(k, v []byte) error {
+		var h History
+		if err := msgpack.Unmarshal(v, &h); err != nil {
+			return err
+		}
+		histories[string(k)] = h
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Symbols with history, including symbols removed from refDB
+	for key, h := range histories {
+		var inst *reference.Instrument
+		if val := instruments.Get([]byte(key)); val != nil {
+			inst = &reference.Instrument{}
+			if err := msgpack.Unmarshal(val, inst); err != nil {
+				return err
+			}
+		}
+		if err := putBoltHistory(history, key, h, inst, at); err != nil {
+			return err
+		}
+	}
+
+	// New symbols
+	prefix := []byte(symbolKeyPrefix)
+	c := instruments.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if _, ok := histories[string(k)]; ok {
+			continue
+		}
+		var inst reference.Instrument
+		if err := msgpack.Unmarshal(v, &inst); err != nil {
+			return err
+		}
+		if err := putBoltHistory(history, string(k), nil, &inst, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putBoltHistory(bucket *bolt.Bucket, key string, h History, inst *reference.Instrument, at time.Time) error {
+	h, changed := h.update(inst, at)
+	if !changed {
+		return nil
+	}
+	if len(h) == 0 {
+		return bucket.Delete([]byte(key))
+	}
+	val, err := msgpack.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), val)
+}
+
+// GetAlias ...
+func (b *Bolt) GetAlias(ctx context.Context, name string) (string, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "bolt.GetAlias")
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.String("name", name))
+
+	var target string
+	if err := b.db.View(func(tx *bolt.Tx) error {
+		target = string(tx.Bucket(aliasesBucket).Get([]byte(NormalizeTicker(name))))
+		return nil
+	}); err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		b.logger.Error("Bolt Get Alias Error", zap.Error(err), zap.String("name", name))
+		return "", err
+	}
+	return target, nil
+}
+
+// LoadAliases replaces the alias table in a single transaction
+func (b *Bolt) LoadAliases(ctx context.Context, aliases map[string]string) error {
+	span, _ := opentracing.StartSpanFromContext(ctx, "bolt.LoadAliases")
+	defer span.Finish()
+	ext.DBType.Set(span, "bbolt")
+	span.LogFields(tlog.Int("count", len(aliases)))
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(aliasesBucket); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(aliasesBucket)
+		if err != nil {
+			return err
+		}
+		for name, target := range aliases {
+			if err := bucket.Put([]byte(NormalizeTicker(name)), []byte(target)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		b.logger.Error("Bolt Load Aliases Error", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// Status ...
+func (b *Bolt) Status(ctx context.Context) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(instrumentsBucket) == nil {
+			return ErrKeyNotFound
+		}
+		return nil
+	})
+}
+
+// Close ...
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		b.logger.Error("Bolt Close Error", zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package rstore
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func TestBolt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-engine-bolt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "refdb.bolt")
+
+	b, err := NewBolt(zap.NewNop(), path)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, b.Status(ctx))
+
+	var data reference.FinancialData
+	require.NoError(t, json.Unmarshal(instrumentsJSON, &data))
+
+	instr := data.Instruments[0]
+	require.NoError(t, b.PutSymbolCurrency(ctx, &instr))
+	res, err := b.GetSymbolCurrency(ctx, instr.Symbol, instr.CurrencyID)
+	require.NoError(t, err)
+	assert.Equal(t, instr.ISIN, res.ISIN)
+
+	_, err = b.GetSymbolExchange(ctx, instr.Symbol, instr.Exchange)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Load replaces every instrument
+	require.NoError(t, b.Load(ctx, data.Instruments[1:]))
+	_, err = b.GetSymbolCurrency(ctx, instr.Symbol, instr.CurrencyID)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Instruments are kept after reopening
+	require.NoError(t, b.Close())
+	b, err = NewBolt(zap.NewNop(), path)
+	require.NoError(t, err)
+	defer b.Close()
+
+	for _, v := range data.Instruments[1:] {
+		res, err := b.GetSymbolExchange(ctx, v.Symbol, v.Exchange)
+		require.NoError(t, err)
+		assert.Equal(t, v.ISIN, res.ISIN)
+
+		res, err = b.GetSymbolCurrency(ctx, v.Symbol, v.CurrencyID)
+		require.NoError(t, err)
+		assert.Equal(t, v.CurrencyID, res.CurrencyID)
+	}
+
+	// Loads written in batches are seen once committed, aborted loads keep the previous instruments
+	w, err := b.BeginLoad(ctx)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(ctx, data.Instruments[:1]))
+	require.NoError(t, w.Abort(ctx))
+	_, err = b.GetSymbolCurrency(ctx, instr.Symbol, instr.CurrencyID)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	w, err = b.BeginLoad(ctx)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(ctx, data.Instruments[:1]))
+	require.NoError(t, w.Write(ctx, data.Instruments[1:]))
+	_, err = b.GetSymbolCurrency(ctx, instr.Symbol, instr.CurrencyID)
+	assert.Equal(t, ErrKeyNotFound, err, "not committed")
+	require.NoError(t, w.Commit(ctx))
+	_, err = b.GetSymbolCurrency(ctx, instr.Symbol, instr.CurrencyID)
+	assert.NoError(t, err)
+}
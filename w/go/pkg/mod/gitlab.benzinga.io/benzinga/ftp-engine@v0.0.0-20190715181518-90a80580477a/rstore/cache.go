@@ -0,0 +1,157 @@
+package rstore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+)
+
+const (
+	// DefaultCacheSize is the default maximum number of cached keys
+	DefaultCacheSize = 10000
+	// DefaultCacheTTL is the default time instruments are cached
+	DefaultCacheTTL = 10 * time.Minute
+	// DefaultCacheNegativeTTL is the default time keys not found are cached
+	DefaultCacheNegativeTTL = time.Minute
+)
+
+// CacheOptions configures the lookup cache, see Client.EnableCache
+type CacheOptions struct {
+	// Size is the maximum number of cached keys, the least recently used key is evicted first
+	Size int
+	// TTL is how long instruments are cached
+	TTL time.Duration
+	// NegativeTTL is how long keys not found are cached
+	NegativeTTL time.Duration
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// cache is a LRU cache of lookups of one snapshot generation, it is cleared when the generation changes
+type cache struct {
+	sync.Mutex
+
+	opts       CacheOptions
+	inst       *instr.Collector
+	generation int64
+	lru        *list.List
+	entries    map[string]*list.Element
+}
+
+// newCache returns a cache with opts, zero options are replaced by the defaults. inst is optional.
+func newCache(opts CacheOptions, inst *instr.Collector) *cache {
+	if opts.Size <= 0 {
+		opts.Size = DefaultCacheSize
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultCacheTTL
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = DefaultCacheNegativeTTL
+	}
+	return &cache{
+		opts:    opts,
+		inst:    inst,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the value of key cached for generation, a nil value is a key not found. lookup labels the hit and
+// miss metrics.
+func (c *cache) get(generation int64, lookup, key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.setGeneration(generation)
+	elem, found := c.entries[key]
+	if found && now().After(elem.Value.(*cacheEntry).expires) {
+		c.removeElement(elem)
+		found = false
+	}
+	if !found {
+		c.count(lookup, false)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	c.count(lookup, true)
+	return elem.Value.(*cacheEntry).value, true
+}
+
+// add caches value of key for generation, a nil value caches the key as not found. Values are only cached for
+// the generation of the last get.
+func (c *cache) add(generation int64, key string, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.generation != generation {
+		// read before a concurrent get saw another generation
+		return
+	}
+
+	ttl := c.opts.TTL
+	if value == nil {
+		ttl = c.opts.NegativeTTL
+	}
+	entry := &cacheEntry{key: key, value: value, expires: now().Add(ttl)}
+
+	if elem, found := c.entries[key]; found {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.opts.Size {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// remove key from the cache
+func (c *cache) remove(key string) {
+	c.Lock()
+	defer c.Unlock()
+	if elem, found := c.entries[key]; found {
+		c.removeElement(elem)
+	}
+}
+
+// len returns the number of cached keys
+func (c *cache) len() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.lru.Len()
+}
+
+// setGeneration clears the cache when the generation changes, the lock must be held
+func (c *cache) setGeneration(generation int64) {
+	if generation == c.generation {
+		return
+	}
+	c.generation = generation
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// removeElement removes the entry, the lock must be held
+func (c *cache) removeElement(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+func (c *cache) count(lookup string, hit bool) {
+	if c.inst == nil {
+		return
+	}
+	if hit {
+		c.inst.ReferenceCacheHits.WithLabelValues(lookup).Inc()
+	} else {
+		c.inst.ReferenceCacheMisses.WithLabelValues(lookup).Inc()
+	}
+}
@@ -0,0 +1,172 @@
+package rstore
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func testCollector() *instr.Collector {
+	return &instr.Collector{
+		ReferenceCacheHits:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "cache_hits"}, []string{"lookup"}),
+		ReferenceCacheMisses: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "cache_misses"}, []string{"lookup"}),
+		ReferenceResolutions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "tickers_resolved"}, []string{"method"}),
+		ReferenceUnresolved:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "tickers_unresolved"}, []string{"exchange"}),
+		ReferenceFallbacks:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "tickers_exchange_fallback"}, []string{"exchange", "fallback_exchange"}),
+	}
+}
+
+func TestCache(t *testing.T) {
+	defer func() { now = time.Now }()
+	t0 := time.Now()
+	now = func() time.Time { return t0 }
+
+	inst := testCollector()
+	c := newCache(CacheOptions{Size: 2, TTL: time.Minute, NegativeTTL: time.Second}, inst)
+
+	_, ok := c.get(1, "symbol_exchange", "F")
+	assert.False(t, ok)
+
+	f := &reference.Instrument{Symbol: "F", Exchange: "NYSE"}
+	c.add(1, "F", f)
+	c.add(1, "MISSING", nil)
+
+	value, ok := c.get(1, "symbol_exchange", "F")
+	assert.True(t, ok)
+	assert.Equal(t, f, value)
+
+	value, ok = c.get(1, "symbol_exchange", "MISSING")
+	assert.True(t, ok, "keys not found are cached")
+	assert.Nil(t, value)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(inst.ReferenceCacheHits.WithLabelValues("symbol_exchange")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(inst.ReferenceCacheMisses.WithLabelValues("symbol_exchange")))
+
+	// Least recently used key is evicted
+	c.add(1, "AAPL", &reference.Instrument{Symbol: "AAPL"})
+	assert.Equal(t, 2, c.len())
+	_, ok = c.get(1, "symbol_exchange", "F")
+	assert.False(t, ok)
+	_, ok = c.get(1, "symbol_exchange", "MISSING")
+	assert.True(t, ok)
+
+	// Keys not found expire after NegativeTTL, instruments after TTL
+	c.add(1, "F", f)
+	now = func() time.Time { return t0.Add(2 * time.Second) }
+	_, ok = c.get(1, "symbol_exchange", "MISSING")
+	assert.False(t, ok)
+	_, ok = c.get(1, "symbol_exchange", "F")
+	assert.True(t, ok)
+	now = func() time.Time { return t0.Add(2 * time.Minute) }
+	_, ok = c.get(1, "symbol_exchange", "F")
+	assert.False(t, ok)
+
+	// Removed keys are looked up again
+	now = func() time.Time { return t0 }
+	c.add(1, "F", f)
+	c.remove("F")
+	_, ok = c.get(1, "symbol_exchange", "F")
+	assert.False(t, ok)
+
+	// A new version clears the cache, values read for another version are not cached
+	c.add(1, "F", f)
+	_, ok = c.get(2, "symbol_exchange", "F")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.len())
+	c.add(1, "F", f)
+	assert.Equal(t, 0, c.len())
+}
+
+func TestClientCache(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires docker-compose services, see make deps")
+	}
+
+	cfg, err := config.LoadConfig("test")
+	require.NoError(t, err)
+
+	c, err := NewClient(zap.NewNop(), cfg.RedisURL)
+	require.NoError(t, err)
+	defer c.Close()
+	inst := testCollector()
+	c.EnableCache(CacheOptions{}, inst)
+
+	ctx := context.Background()
+
+	var data reference.FinancialData
+	require.NoError(t, json.Unmarshal(instrumentsJSON, &data))
+	require.NoError(t, c.Load(ctx, data.Instruments))
+
+	v := data.Instruments[0]
+	for i := 0; i < 2; i++ {
+		res, err := c.GetSymbolExchange(ctx, v.Symbol, v.Exchange)
+		require.NoError(t, err)
+		assert.Equal(t, v.ISIN, res.ISIN)
+
+		_, err = c.GetSymbolExchange(ctx, "NOT-A-SYMBOL", v.Exchange)
+		assert.Equal(t, redis.Nil, err)
+	}
+	assert.Equal(t, 2.0, testutil.ToFloat64(inst.ReferenceCacheHits.WithLabelValues("symbol_exchange")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(inst.ReferenceCacheMisses.WithLabelValues("symbol_exchange")))
+
+	// Instruments removed by the next snapshot are no longer cached
+	require.NoError(t, c.Load(ctx, data.Instruments[1:]))
+	_, err = c.GetSymbolExchange(ctx, v.Symbol, v.Exchange)
+	assert.Equal(t, redis.Nil, err)
+}
+
+func BenchmarkCache(b *testing.B) {
+	c := newCache(CacheOptions{}, nil)
+	for i := 0; i < DefaultCacheSize; i++ {
+		c.add(0, strconv.Itoa(i), &reference.Instrument{Symbol: strconv.Itoa(i)})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.get(0, "symbol_exchange", strconv.Itoa(i%DefaultCacheSize))
+	}
+}
+
+// BenchmarkGetSymbolExchange compares Redis lookups with and without the cache, ex.
+// go test -run XXX -bench GetSymbolExchange ./rstore/
+func BenchmarkGetSymbolExchange(b *testing.B) {
+	cfg, err := config.LoadConfig("test")
+	require.NoError(b, err)
+
+	c, err := NewClient(zap.NewNop(), cfg.RedisURL)
+	if err != nil {
+		b.Skip("requires docker-compose services, see make deps: ", err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+
+	var data reference.FinancialData
+	require.NoError(b, json.Unmarshal(instrumentsJSON, &data))
+	require.NoError(b, c.Load(ctx, data.Instruments))
+
+	lookup := func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			v := data.Instruments[i%len(data.Instruments)]
+			if _, err := c.GetSymbolExchange(ctx, v.Symbol, v.Exchange); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("Uncached", lookup)
+	c.EnableCache(CacheOptions{}, nil)
+	b.Run("Cached", lookup)
+}
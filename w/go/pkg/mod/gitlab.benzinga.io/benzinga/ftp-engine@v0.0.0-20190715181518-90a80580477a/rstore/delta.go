@@ -0,0 +1,222 @@
+package rstore
+
+import (
+	"context"
+	"crypto/sha1"
+	"sort"
+
+	"github.com/go-redis/redis"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tlog "github.com/opentracing/opentracing-go/log"
+	otredis "github.com/smacker/opentracing-go-redis"
+	"github.com/vmihailenco/msgpack"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+var _ = DeltaLoader(&Client{}) // check interface
+
+// DeltaLoader is implemented by stores that can apply the changes between two loads, faster than Load when few
+// instruments change
+type DeltaLoader interface {
+	// LoadDelta applies d to the snapshot written by the last Load, ErrSnapshotConflict is returned if another
+	// snapshot was loaded since, then Load replaces the snapshot
+	LoadDelta(ctx context.Context, d *Delta) error
+}
+
+// Delta is the change of the store keys between two refDB loads, see DeltaBuilder
+type Delta struct {
+	set     map[string]*reference.Instrument
+	deleted []string
+	// symbols are the changed symbol keys, nil for symbols removed from refDB, see History
+	symbols map[string]*reference.Instrument
+}
+
+// Len returns the number of keys set or deleted
+func (d *Delta) Len() int {
+	return len(d.set) + len(d.deleted)
+}
+
+// Diff returns the keys Load writes for instruments that are not written the same for previous
+func Diff(previous, instruments []reference.Instrument) (*Delta, error) {
+	before := NewDeltaBuilder(nil)
+	for i := range previous {
+		if err := before.Add(&previous[i]); err != nil {
+			return nil, err
+		}
+	}
+	after := NewDeltaBuilder(before.Fingerprints())
+	for i := range instruments {
+		if err := after.Add(&instruments[i]); err != nil {
+			return nil, err
+		}
+	}
+	return after.Delta(), nil
+}
+
+// Fingerprints are the hashes of the instrument Load writes to each key, so a load can be compared to the
+// previous load without keeping its instruments
+type Fingerprints map[string][sha1.Size]byte
+
+// DeltaBuilder builds the Delta of instruments added in batches from the Fingerprints of the previous load. Only
+// the changed instruments are kept.
+type DeltaBuilder struct {
+	previous     Fingerprints
+	fingerprints Fingerprints
+	set          map[string]*reference.Instrument
+}
+
+// NewDeltaBuilder returns a DeltaBuilder from the previous load, without previous load only the Fingerprints of
+// the instruments added are built
+func NewDeltaBuilder(previous Fingerprints) *DeltaBuilder {
+	return &DeltaBuilder{
+		previous:     previous,
+		fingerprints: make(Fingerprints),
+		set:          make(map[string]*reference.Instrument),
+	}
+}
+
+// Add adds the keys Load writes for inst, later instruments replace earlier instruments for symbol keys and
+// identifiers are indexed to the first instrument. inst is copied if it changed.
+func (b *DeltaBuilder) Add(inst *reference.Instrument) error {
+	val, err := msgpack.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	fingerprint := sha1.Sum(val)
+
+	var changed *reference.Instrument
+	add := func(key string) {
+		b.fingerprints[key] = fingerprint
+		if prev, ok := b.previous[key]; b.previous == nil || ok && prev == fingerprint {
+			delete(b.set, key)
+			return
+		}
+		if changed == nil {
+			copied := *inst
+			changed = &copied
+		}
+		b.set[key] = changed
+	}
+	for _, key := range symbolKeys(inst) {
+		add(key)
+	}
+	for _, key := range identifierKeys(inst) {
+		if _, ok := b.fingerprints[key]; !ok {
+			add(key)
+		}
+	}
+	return nil
+}
+
+// Fingerprints returns the Fingerprints of the instruments added, the previous load of the next DeltaBuilder
+func (b *DeltaBuilder) Fingerprints() Fingerprints {
+	return b.fingerprints
+}
+
+// Delta returns the keys of the instruments added that are not written the same by the previous load, and the
+// keys of the previous load that are not written
+func (b *DeltaBuilder) Delta() *Delta {
+	d := &Delta{
+		set:     b.set,
+		symbols: make(map[string]*reference.Instrument),
+	}
+	for key, inst := range b.set {
+		if isSymbolKey(key) {
+			d.symbols[key] = inst
+		}
+	}
+	for key := range b.previous {
+		if _, ok := b.fingerprints[key]; !ok {
+			d.deleted = append(d.deleted, key)
+			if isSymbolKey(key) {
+				d.symbols[key] = nil
+			}
+		}
+	}
+	sort.Strings(d.deleted)
+	return d
+}
+
+// LoadDelta writes and deletes the changed keys and updates the History of changed symbols in the snapshot
+// loaded last by this client, in a transaction that fails with ErrSnapshotConflict if another snapshot is loaded
+// meanwhile. Readers see the changes when their cached generation expires.
+func (c *Client) LoadDelta(ctx context.Context, d *Delta) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.LoadDelta")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+
+	client := otredis.WrapRedisClient(subCtx, c.client)
+	fail := func(msg string, err error) error {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		c.logger.Error(msg, zap.Error(err))
+		return err
+	}
+
+	keys := make([]string, 0, len(d.set))
+	for key := range d.set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	symbols := make([]string, 0, len(d.symbols))
+	for key := range d.symbols {
+		symbols = append(symbols, key)
+	}
+	sort.Strings(symbols)
+
+	// Apply the delta in a transaction, so readers never see it half applied and a snapshot loaded meanwhile is
+	// not changed
+	var version int64
+	var updated int
+	var generation *redis.IntCmd
+	err := client.Watch(func(tx *redis.Tx) error {
+		var err error
+		if version, err = getVersion(tx); err != nil {
+			return err
+		}
+		if version == 0 || version != c.loaded {
+			return ErrSnapshotConflict
+		}
+
+		histories, changed, err := updateHistory(tx, version, symbols, mapInstruments(d.symbols), now())
+		if err != nil {
+			return err
+		}
+		updated = changed
+
+		prefix := versionPrefix(version)
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				val, err := msgpack.Marshal(d.set[key])
+				if err != nil {
+					return err
+				}
+				pipe.Set(prefix+key, val, 0)
+			}
+			for _, key := range d.deleted {
+				pipe.Del(prefix + key)
+			}
+			if err := setHistory(pipe, version, symbols, histories, 0); err != nil {
+				return err
+			}
+			generation = pipe.Incr(generationKey)
+			return nil
+		})
+		return err
+	}, currentVersionKey)
+	span.LogFields(tlog.Int64("version", version), tlog.Int("set", len(d.set)), tlog.Int("deleted", len(d.deleted)))
+	switch {
+	case err == ErrSnapshotConflict || err == redis.TxFailedErr:
+		span.LogFields(tlog.Error(ErrSnapshotConflict))
+		return ErrSnapshotConflict
+	case err != nil:
+		return fail("Redis Write Delta Error", err)
+	}
+	c.setCurrentVersion(version, generation.Val())
+	c.logger.Info("Delta Loaded", zap.Int64("version", version), zap.Int("set", len(d.set)), zap.Int("deleted", len(d.deleted)), zap.Int("histories", updated))
+
+	return nil
+}
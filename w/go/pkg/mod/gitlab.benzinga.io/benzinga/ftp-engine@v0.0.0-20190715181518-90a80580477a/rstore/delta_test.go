@@ -0,0 +1,121 @@
+package rstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func TestDiff(t *testing.T) {
+	previous := []reference.Instrument{
+		{Symbol: "F", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US3453708600"},
+		{Symbol: "AAPL", CurrencyID: "USD", Exchange: "NASDAQ", ISIN: "US0378331005"},
+		{Symbol: "FB", CurrencyID: "USD", Exchange: "NASDAQ"},
+	}
+	instruments := []reference.Instrument{
+		{Symbol: "F", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US3453708600"},
+		{Symbol: "AAPL", CurrencyID: "USD", Exchange: "NASDAQ", ISIN: "US0378331005", CUSIP: "037833100"},
+		{Symbol: "META", CurrencyID: "USD", Exchange: "NASDAQ"},
+	}
+
+	d, err := Diff(previous, instruments)
+	require.NoError(t, err)
+	unchanged, err := Diff(instruments, instruments)
+	require.NoError(t, err)
+	assert.Empty(t, unchanged.Len())
+
+	var set []string
+	for key := range d.set {
+		set = append(set, key)
+	}
+	assert.ElementsMatch(t, []string{
+		symbolExchangeKey("AAPL", "NASDAQ"), symbolCurrencyKey("AAPL", "USD"),
+		identifierKey(ISIN, "US0378331005"), identifierKey(CUSIP, "037833100"),
+		symbolExchangeKey("META", "NASDAQ"), symbolCurrencyKey("META", "USD"),
+	}, set)
+	assert.Equal(t, []string{symbolCurrencyKey("FB", "USD"), symbolExchangeKey("FB", "NASDAQ")}, d.deleted)
+	assert.Equal(t, 8, d.Len())
+
+	// Identifier keys are not symbols, removed symbols end their History
+	assert.Len(t, d.symbols, 6)
+	assert.Nil(t, d.symbols[symbolExchangeKey("FB", "NASDAQ")])
+	assert.Equal(t, "META", d.symbols[symbolExchangeKey("META", "NASDAQ")].Symbol)
+}
+
+func TestLoadDelta(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires docker-compose services, see make deps")
+	}
+
+	cfg, err := config.LoadConfig("test")
+	require.NoError(t, err)
+
+	c, err := NewClient(zap.NewNop(), cfg.RedisURL)
+	require.NoError(t, err)
+	defer c.Close()
+	c.EnableCache(CacheOptions{}, nil)
+
+	ctx := context.Background()
+
+	previous := []reference.Instrument{
+		{Symbol: "DELTA-F", CurrencyID: "USD", Exchange: "NYSE"},
+		{Symbol: "DELTA-FB", CurrencyID: "USD", Exchange: "NASDAQ"},
+	}
+	instruments := []reference.Instrument{
+		{Symbol: "DELTA-F", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US3453708600"},
+		{Symbol: "DELTA-META", CurrencyID: "USD", Exchange: "NASDAQ"},
+	}
+
+	// Deltas apply to the snapshot loaded by the client
+	other, err := NewClient(zap.NewNop(), cfg.RedisURL)
+	require.NoError(t, err)
+	defer other.Close()
+	require.NoError(t, other.Load(ctx, previous))
+	d, err := Diff(previous, instruments)
+	require.NoError(t, err)
+	assert.Equal(t, ErrSnapshotConflict, c.LoadDelta(ctx, d))
+
+	require.NoError(t, c.Load(ctx, previous))
+	version, err := c.SnapshotVersion(ctx)
+	require.NoError(t, err)
+	_, err = c.GetSymbolExchange(ctx, "DELTA-FB", "NASDAQ")
+	require.NoError(t, err)
+
+	loaded := time.Now()
+	require.NoError(t, c.LoadDelta(ctx, d))
+	after, err := c.SnapshotVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, version, after, "deltas change the current snapshot")
+
+	inst, err := c.GetSymbolExchange(ctx, "DELTA-F", "NYSE")
+	require.NoError(t, err)
+	assert.Equal(t, "US3453708600", inst.ISIN)
+	_, err = c.GetSymbolExchange(ctx, "DELTA-META", "NASDAQ")
+	assert.NoError(t, err)
+	_, err = c.GetSymbolExchange(ctx, "DELTA-FB", "NASDAQ")
+	assert.Equal(t, redis.Nil, err, "cached instruments are cleared")
+	_, err = c.GetIdentifier(ctx, ISIN, "US3453708600")
+	assert.NoError(t, err)
+
+	// Histories are updated with the delta
+	_, err = c.GetSymbolExchangeAt(ctx, "DELTA-FB", "NASDAQ", loaded)
+	assert.NoError(t, err, "before the delta")
+	_, err = c.GetSymbolExchangeAt(ctx, "DELTA-FB", "NASDAQ", time.Now())
+	assert.Error(t, err, "removed by the delta")
+
+	// Deltas are not applied to a snapshot loaded by another client
+	require.NoError(t, other.Load(ctx, instruments))
+	d, err = Diff(instruments, previous)
+	require.NoError(t, err)
+	assert.Equal(t, ErrSnapshotConflict, c.LoadDelta(ctx, d))
+	_, err = other.GetSymbolExchange(ctx, "DELTA-META", "NASDAQ")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,160 @@
+package rstore
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+// now is the time history mappings start and end, replaced in tests
+var now = time.Now
+
+// HistoryRetention is how long mappings are kept after they end, older mappings are removed when the history is
+// updated. Times before the retained history resolve to its first instrument.
+const HistoryRetention = 2 * 365 * 24 * time.Hour
+
+// Mapping is the instrument a symbol resolved to from From until To, To is zero while the mapping is current
+type Mapping struct {
+	Instrument reference.Instrument `msgpack:"instrument"`
+	From       time.Time            `msgpack:"from"`
+	To         time.Time            `msgpack:"to"`
+}
+
+// Current ...
+func (m *Mapping) Current() bool {
+	return m.To.IsZero()
+}
+
+// History of the instruments a symbol resolved to, oldest first. Mappings start and end when Load first sees
+// the change, so they are as precise as the refDB update interval.
+type History []Mapping
+
+// At returns the instrument the symbol resolved to at t. Times before the history resolve to the first
+// instrument, as the history starts when the symbol was first loaded. ok is false if the symbol did not resolve
+// at t, ex. it was delisted.
+func (h History) At(t time.Time) (inst *reference.Instrument, ok bool) {
+	if len(h) == 0 {
+		return nil, false
+	}
+	if t.Before(h[0].From) {
+		inst := h[0].Instrument
+		return &inst, true
+	}
+
+	for i := len(h) - 1; i >= 0; i-- {
+		if !t.Before(h[i].From) && (h[i].Current() || t.Before(h[i].To)) {
+			inst := h[i].Instrument
+			return &inst, true
+		}
+	}
+	return nil, false
+}
+
+// Changed returns the time of the last change of the history, the start or end of its last mapping. Instruments
+// after it are the current instruments of the store.
+func (h History) Changed() time.Time {
+	if len(h) == 0 {
+		return time.Time{}
+	}
+	if last := h[len(h)-1]; !last.Current() {
+		return last.To
+	}
+	return h[len(h)-1].From
+}
+
+// update returns the history with the symbol resolving to inst, or to no instrument if inst is nil, from at.
+// The current mapping ends if inst is another instrument, compared by identifiers, otherwise its instrument is
+// updated. Mappings that ended HistoryRetention before at are removed, the history is empty if none are left.
+// changed is false if the history is unchanged. h is not modified.
+func (h History) update(inst *reference.Instrument, at time.Time) (updated History, changed bool) {
+	h, changed = h.prune(at.Add(-HistoryRetention))
+	updated, updateChanged := h.updateCurrent(inst, at)
+	return updated, changed || updateChanged
+}
+
+// prune returns the history without the mappings that ended before t
+func (h History) prune(t time.Time) (History, bool) {
+	var i int
+	for i < len(h) && !h[i].Current() && h[i].To.Before(t) {
+		i++
+	}
+	if i == 0 {
+		return h, false
+	}
+	return h[i:], true
+}
+
+func (h History) updateCurrent(inst *reference.Instrument, at time.Time) (updated History, changed bool) {
+	var current *Mapping
+	if n := len(h); n > 0 && h[n-1].Current() {
+		current = &h[n-1]
+	}
+
+	switch {
+	case inst == nil && current == nil:
+		return h, false
+	case current != nil && inst != nil && sameInstrument(&current.Instrument, inst):
+		if reflect.DeepEqual(current.Instrument, *inst) {
+			return h, false
+		}
+		updated = append(History(nil), h...)
+		updated[len(updated)-1].Instrument = *inst
+		return updated, true
+	}
+
+	updated = append(History(nil), h...)
+	if current != nil {
+		updated[len(updated)-1].To = at
+	}
+	if inst != nil {
+		updated = append(updated, Mapping{Instrument: *inst, From: at})
+	}
+	return updated, true
+}
+
+// sameInstrument is true if the instruments have the same identifiers
+func sameInstrument(a, b *reference.Instrument) bool {
+	for _, idType := range IdentifierTypes {
+		if Identifier(a, idType) != Identifier(b, idType) {
+			return false
+		}
+	}
+	return true
+}
+
+// symbolKeyPrefix starts the symbol keys, symbols have a History and identifiers do not
+const symbolKeyPrefix = "SYMBOL-"
+
+// symbolKeys returns the symbol keys Load writes for inst
+func symbolKeys(inst *reference.Instrument) []string {
+	return []string{symbolCurrencyKey(inst.Symbol, inst.CurrencyID), symbolExchangeKey(inst.Symbol, inst.Exchange)}
+}
+
+func isSymbolKey(key string) bool {
+	return strings.HasPrefix(key, symbolKeyPrefix)
+}
+
+// updateHistories returns the histories with every symbol key of instruments, the keys written by Load,
+// resolving to its instrument from at, and symbols not in instruments resolving to no instrument. Histories left
+// empty by HistoryRetention are removed. histories is not modified.
+func updateHistories(histories map[string]History, instruments map[string]reference.Instrument, at time.Time) map[string]History {
+	updated := make(map[string]History, len(histories))
+	for key, h := range histories {
+		var inst *reference.Instrument
+		if i, ok := instruments[key]; ok {
+			inst = &i
+		}
+		if h, _ = h.update(inst, at); len(h) > 0 {
+			updated[key] = h
+		}
+	}
+	for key, inst := range instruments {
+		if _, ok := histories[key]; !ok && isSymbolKey(key) {
+			inst := inst
+			updated[key], _ = History(nil).update(&inst, at)
+		}
+	}
+	return updated
+}
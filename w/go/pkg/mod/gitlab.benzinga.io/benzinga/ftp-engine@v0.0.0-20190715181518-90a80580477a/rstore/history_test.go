@@ -0,0 +1,217 @@
+package rstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func TestHistoryAt(t *testing.T) {
+	t1 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	t3 := t2.Add(24 * time.Hour)
+
+	h := History{
+		{Instrument: reference.Instrument{ISIN: "OLD"}, From: t1, To: t2},
+		{Instrument: reference.Instrument{ISIN: "NEW"}, From: t2},
+	}
+	delisted := History{{Instrument: reference.Instrument{ISIN: "OLD"}, From: t1, To: t2}}
+
+	tests := []struct {
+		name    string
+		history History
+		at      time.Time
+		isin    string
+		missing bool
+	}{
+		{name: "before history", history: h, at: t1.Add(-time.Hour), isin: "OLD"},
+		{name: "start", history: h, at: t1, isin: "OLD"},
+		{name: "previous", history: h, at: t2.Add(-time.Nanosecond), isin: "OLD"},
+		{name: "change", history: h, at: t2, isin: "NEW"},
+		{name: "current", history: h, at: t3, isin: "NEW"},
+		{name: "before delisting", history: delisted, at: t1.Add(time.Hour), isin: "OLD"},
+		{name: "after delisting", history: delisted, at: t3, missing: true},
+		{name: "no history", history: nil, at: t3, missing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst, ok := tt.history.At(tt.at)
+			if tt.missing {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, tt.isin, inst.ISIN)
+		})
+	}
+}
+
+func TestHistoryUpdate(t *testing.T) {
+	t1 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	ford := &reference.Instrument{Symbol: "F", ISIN: "US3453708600"}
+
+	h, changed := History(nil).update(ford, t1)
+	assert.True(t, changed)
+	assert.Equal(t, History{{Instrument: *ford, From: t1}}, h)
+
+	_, changed = h.update(ford, t2)
+	assert.False(t, changed, "same instrument")
+
+	renamed := &reference.Instrument{Symbol: "F", ISIN: "US3453708600", NameShort: "Ford"}
+	updated, changed := h.update(renamed, t2)
+	assert.True(t, changed)
+	assert.Equal(t, History{{Instrument: *renamed, From: t1}}, updated, "same identifiers update the instrument")
+	assert.Equal(t, "", h[0].Instrument.NameShort, "history is not modified")
+
+	other := &reference.Instrument{Symbol: "F", ISIN: "US0000000000"}
+	updated, changed = h.update(other, t2)
+	assert.True(t, changed)
+	assert.Equal(t, History{{Instrument: *ford, From: t1, To: t2}, {Instrument: *other, From: t2}}, updated)
+	assert.True(t, h[0].Current(), "history is not modified")
+
+	updated, changed = h.update(nil, t2)
+	assert.True(t, changed)
+	assert.Equal(t, History{{Instrument: *ford, From: t1, To: t2}}, updated)
+
+	_, changed = updated.update(nil, t2)
+	assert.False(t, changed, "already delisted")
+
+	t3 := t2.Add(HistoryRetention)
+	updated, changed = History{{Instrument: *ford, From: t1, To: t2}, {Instrument: *other, From: t2}}.update(other, t3.Add(time.Hour))
+	assert.True(t, changed, "mappings ended before the retention are removed")
+	assert.Equal(t, History{{Instrument: *other, From: t2}}, updated)
+
+	updated, changed = History{{Instrument: *ford, From: t1, To: t2}}.update(nil, t3.Add(time.Hour))
+	assert.True(t, changed)
+	assert.Empty(t, updated, "delisted symbol history is removed after the retention")
+
+	_, changed = History{{Instrument: *ford, From: t1, To: t2}}.update(nil, t3)
+	assert.False(t, changed, "mappings are kept for the retention")
+}
+
+func TestHistoryChanged(t *testing.T) {
+	t1 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	inst := reference.Instrument{ISIN: "US3453708600"}
+
+	assert.True(t, History(nil).Changed().IsZero())
+	assert.Equal(t, t1, History{{Instrument: inst, From: t1}}.Changed(), "listed")
+	assert.Equal(t, t2, History{{Instrument: inst, From: t1, To: t2}}.Changed(), "delisted")
+}
+
+func TestLoadHistory(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "ftp-engine-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bolt, err := NewBolt(logger, filepath.Join(dir, "refdb.bolt"))
+	require.NoError(t, err)
+	defer bolt.Close()
+
+	stores := map[string]Store{
+		"memory": NewMemory(logger),
+		"bbolt":  bolt,
+	}
+	if !testing.Short() {
+		cfg, err := config.LoadConfig("test")
+		require.NoError(t, err)
+		c, err := NewClient(logger, cfg.RedisURL)
+		require.NoError(t, err)
+		defer c.Close()
+		stores["redis"] = c
+	}
+
+	// Symbols are unique to the run, Redis histories are kept across runs
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	changed, delisted, listed := "CHG"+suffix, "DEL"+suffix, "NEW"+suffix
+
+	t1 := time.Now().Add(-48 * time.Hour).Truncate(time.Millisecond)
+	t2 := t1.Add(24 * time.Hour)
+	first := []reference.Instrument{
+		{Symbol: changed, CurrencyID: "USD", Exchange: "NYSE", ISIN: "US0000000001"},
+		{Symbol: delisted, CurrencyID: "USD", Exchange: "NYSE", ISIN: "US0000000002"},
+	}
+	second := []reference.Instrument{
+		{Symbol: changed, CurrencyID: "USD", Exchange: "NYSE", ISIN: "US0000000003"},
+		{Symbol: listed, CurrencyID: "USD", Exchange: "NASDAQ", ISIN: "US0000000004"},
+	}
+
+	tests := []struct {
+		name     string
+		symbol   string
+		exchange string
+		at       time.Time
+		isin     string
+		missing  bool
+	}{
+		{name: "before history", symbol: changed, exchange: "NYSE", at: t1.Add(-time.Hour), isin: "US0000000001"},
+		{name: "before change", symbol: changed, exchange: "NYSE", at: t1.Add(time.Hour), isin: "US0000000001"},
+		{name: "after change", symbol: changed, exchange: "NYSE", at: t2.Add(time.Hour), isin: "US0000000003"},
+		{name: "before delisting", symbol: delisted, exchange: "NYSE", at: t1.Add(time.Hour), isin: "US0000000002"},
+		{name: "after delisting", symbol: delisted, exchange: "NYSE", at: t2.Add(time.Hour), missing: true},
+		{name: "before listing", symbol: listed, exchange: "NASDAQ", at: t1, isin: "US0000000004"},
+		{name: "after listing", symbol: listed, exchange: "NASDAQ", at: t2.Add(time.Hour), isin: "US0000000004"},
+	}
+
+	for storeName, store := range stores {
+		now = func() time.Time { return t1 }
+		require.NoError(t, store.(Loader).Load(ctx, first), storeName)
+		now = func() time.Time { return t2 }
+		require.NoError(t, store.(Loader).Load(ctx, second), storeName)
+
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				inst, err := store.GetSymbolExchangeAt(ctx, tt.symbol, tt.exchange, tt.at)
+				if tt.missing {
+					assert.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tt.isin, inst.ISIN)
+
+				inst, err = store.GetSymbolCurrencyAt(ctx, tt.symbol, "USD", tt.at)
+				require.NoError(t, err)
+				assert.Equal(t, tt.isin, inst.ISIN)
+			})
+		}
+	}
+
+	// After the last change of a history the current instrument is used, ex. when the history update of a
+	// change is missing
+	relisted := reference.Instrument{Symbol: delisted, CurrencyID: "USD", Exchange: "NYSE", ISIN: "US0000000005"}
+	for storeName, store := range stores {
+		require.NoError(t, store.PutSymbolExchange(ctx, &relisted), storeName)
+		inst, err := store.GetSymbolExchangeAt(ctx, delisted, "NYSE", t2.Add(time.Hour))
+		require.NoError(t, err, storeName)
+		assert.Equal(t, "US0000000005", inst.ISIN, storeName)
+
+		inst, err = store.GetSymbolExchangeAt(ctx, delisted, "NYSE", t1.Add(time.Hour))
+		require.NoError(t, err, storeName)
+		assert.Equal(t, "US0000000002", inst.ISIN, storeName)
+	}
+
+	// Symbols without history resolve to the current instrument
+	m := NewMemory(logger)
+	require.NoError(t, m.PutSymbolExchange(ctx, &first[0]))
+	inst, err := m.GetSymbolExchangeAt(ctx, changed, "NYSE", t1)
+	require.NoError(t, err)
+	assert.Equal(t, "US0000000001", inst.ISIN)
+}
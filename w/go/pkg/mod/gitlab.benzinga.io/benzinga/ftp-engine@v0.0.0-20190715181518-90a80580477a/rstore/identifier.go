@@ -0,0 +1,60 @@
+package rstore
+
+import (
+	"strings"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+// IdentifierType is an instrument identifier indexed by Load. FIGI is not indexed as reference.Instrument and the
+// refDB feed have no FIGI field.
+type IdentifierType string
+
+const (
+	// ISIN ...
+	ISIN IdentifierType = "isin"
+	// CUSIP ...
+	CUSIP IdentifierType = "cusip"
+	// CIK is the SEC company identifier, shared by every instrument of the company, so it does not identify a
+	// share class
+	CIK IdentifierType = "cik"
+)
+
+// IdentifierTypes in the order instruments are looked up by, most specific first
+var IdentifierTypes = []IdentifierType{ISIN, CUSIP, CIK}
+
+// String ...
+func (t IdentifierType) String() string {
+	return string(t)
+}
+
+// Identifier returns the identifier of the instrument, "" if the instrument does not have one
+func Identifier(inst *reference.Instrument, idType IdentifierType) string {
+	switch idType {
+	case ISIN:
+		return inst.ISIN
+	case CUSIP:
+		return inst.CUSIP
+	case CIK:
+		return inst.CIK
+	default:
+		return ""
+	}
+}
+
+// identifierKey is the instrument key of the identifier. Identifiers are shared by several instruments, ex. the
+// listings of a security on each exchange, so Load indexes the first instrument in refDB order.
+func identifierKey(idType IdentifierType, id string) string {
+	return strings.ToUpper(strings.Join([]string{"id", string(idType), id}, ":"))
+}
+
+// identifierKeys returns the keys of every identifier of the instrument
+func identifierKeys(inst *reference.Instrument) []string {
+	keys := make([]string, 0, len(IdentifierTypes))
+	for _, idType := range IdentifierTypes {
+		if id := Identifier(inst, idType); id != "" {
+			keys = append(keys, identifierKey(idType, id))
+		}
+	}
+	return keys
+}
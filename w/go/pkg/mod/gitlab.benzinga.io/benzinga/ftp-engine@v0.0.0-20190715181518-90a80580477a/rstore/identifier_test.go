@@ -0,0 +1,98 @@
+package rstore
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func loadFixture(t *testing.T) []reference.Instrument {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "refdb.json"))
+	require.NoError(t, err)
+
+	var refDB reference.FinancialData
+	require.NoError(t, json.Unmarshal(data, &refDB))
+	return refDB.Instruments
+}
+
+func TestGetIdentifier(t *testing.T) {
+	instruments := loadFixture(t)
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	dir, err := ioutil.TempDir("", "ftp-engine-identifier")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bolt, err := NewBolt(logger, filepath.Join(dir, "refdb.bolt"))
+	require.NoError(t, err)
+	defer bolt.Close()
+
+	stores := map[string]Store{
+		"memory": NewMemory(logger),
+		"bbolt":  bolt,
+	}
+	if !testing.Short() {
+		cfg, err := config.LoadConfig("test")
+		require.NoError(t, err)
+		c, err := NewClient(logger, cfg.RedisURL)
+		require.NoError(t, err)
+		defer c.Close()
+		stores["redis"] = c
+	}
+
+	tests := []struct {
+		name     string
+		idType   IdentifierType
+		id       string
+		symbol   string
+		exchange string
+		missing  bool
+	}{
+		{name: "isin", idType: ISIN, id: "US3453708600", symbol: "F", exchange: "NYSE"},
+		{name: "cusip", idType: CUSIP, id: "345370860", symbol: "F", exchange: "NYSE"},
+		{name: "cik", idType: CIK, id: "37996", symbol: "F", exchange: "NYSE"},
+		{name: "lowercase", idType: CUSIP, id: "04226j108", symbol: "A", exchange: "TSX"},
+		{name: "isin shared by listings is the first listing", idType: ISIN, id: "US0378331005", symbol: "AAPL", exchange: "NASDAQ"},
+		{name: "cik shared by share classes is the first class", idType: CIK, id: "1067983", symbol: "BRK.A", exchange: "NYSE"},
+		{name: "share class isin", idType: ISIN, id: "US0846707026", symbol: "BRK.B", exchange: "NYSE"},
+		{name: "unknown isin", idType: ISIN, id: "US0000000000", missing: true},
+		{name: "isin is not a cusip", idType: CUSIP, id: "US3453708600", missing: true},
+	}
+
+	for storeName, store := range stores {
+		require.NoError(t, store.(Loader).Load(ctx, instruments), storeName)
+
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				inst, err := store.GetIdentifier(ctx, tt.idType, tt.id)
+				if tt.missing {
+					assert.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tt.symbol, inst.Symbol)
+				assert.Equal(t, tt.exchange, inst.Exchange)
+			})
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	inst := &reference.Instrument{ISIN: "US3453708600", CUSIP: "345370860"}
+
+	assert.Equal(t, "US3453708600", Identifier(inst, ISIN))
+	assert.Equal(t, "345370860", Identifier(inst, CUSIP))
+	assert.Equal(t, "", Identifier(inst, CIK))
+	assert.Equal(t, []string{"ID:ISIN:US3453708600", "ID:CUSIP:345370860"}, identifierKeys(inst))
+}
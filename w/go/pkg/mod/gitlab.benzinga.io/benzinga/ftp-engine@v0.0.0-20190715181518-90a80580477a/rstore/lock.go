@@ -0,0 +1,109 @@
+package rstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tlog "github.com/opentracing/opentracing-go/log"
+	otredis "github.com/smacker/opentracing-go-redis"
+	"go.uber.org/zap"
+)
+
+// lockPrefix is the key prefix of locks
+const lockPrefix = ftpEnginePrefix + ":lock:"
+
+var (
+	// extendLock extends the lock TTL if the lock is still held by the token
+	extendLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// releaseLock deletes the lock if the lock is still held by the token
+	releaseLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Lock is a Redis lock held for a TTL, used for leader election. The holder calls Acquire again before the
+// TTL to keep the lock, a holder that stops refreshing loses the lock once the TTL expires.
+type Lock struct {
+	client *redis.Client
+	logger *zap.Logger
+	key    string
+	token  string
+	ttl    time.Duration
+}
+
+// NewLock returns the lock name held for ttl, each Lock has a unique token so replicas locking the same name
+// exclude each other
+func (c *Client) NewLock(name string, ttl time.Duration) (*Lock, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	return &Lock{
+		client: c.client,
+		logger: c.logger.With(zap.String("lock", name)),
+		key:    lockPrefix + name,
+		token:  hex.EncodeToString(token),
+		ttl:    ttl,
+	}, nil
+}
+
+// Acquire takes the lock, or extends the TTL if the lock is already held. It returns false if another Lock
+// holds it.
+func (l *Lock) Acquire(ctx context.Context) (bool, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.AcquireLock")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+	span.LogFields(tlog.String("key", l.key))
+
+	client := otredis.WrapRedisClient(subCtx, l.client)
+
+	extended, err := extendLock.Run(client, []string{l.key}, l.token, l.ttl.Nanoseconds()/int64(time.Millisecond)).Int64()
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		l.logger.Error("Redis Extend Lock Error", zap.Error(err))
+		return false, err
+	}
+	if extended == 1 {
+		return true, nil
+	}
+
+	acquired, err := client.SetNX(l.key, l.token, l.ttl).Result()
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		l.logger.Error("Redis Acquire Lock Error", zap.Error(err))
+		return false, err
+	}
+	span.LogFields(tlog.Bool("acquired", acquired))
+	return acquired, nil
+}
+
+// Release unlocks the lock if it is held, so another Lock can take it without waiting for the TTL
+func (l *Lock) Release(ctx context.Context) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.ReleaseLock")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+	span.LogFields(tlog.String("key", l.key))
+
+	client := otredis.WrapRedisClient(subCtx, l.client)
+	if err := releaseLock.Run(client, []string{l.key}, l.token).Err(); err != nil && err != redis.Nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		l.logger.Error("Redis Release Lock Error", zap.Error(err))
+		return err
+	}
+	return nil
+}
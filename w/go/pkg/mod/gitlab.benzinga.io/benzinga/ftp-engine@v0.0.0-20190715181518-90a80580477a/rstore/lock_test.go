@@ -0,0 +1,68 @@
+package rstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+)
+
+func TestLock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires docker-compose services, see make deps")
+	}
+
+	cfg, err := config.LoadConfig("test")
+	require.NoError(t, err)
+
+	c, err := NewClient(zap.NewNop(), cfg.RedisURL)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	name := "test-" + time.Now().Format(time.RFC3339Nano)
+
+	first, err := c.NewLock(name, 200*time.Millisecond)
+	require.NoError(t, err)
+	second, err := c.NewLock(name, 200*time.Millisecond)
+	require.NoError(t, err)
+
+	acquired, err := first.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = second.Acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	// The holder keeps the lock by acquiring it again before the TTL
+	time.Sleep(150 * time.Millisecond)
+	acquired, err = first.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	time.Sleep(150 * time.Millisecond)
+	acquired, err = second.Acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	// Only the holder releases the lock
+	require.NoError(t, second.Release(ctx))
+	acquired, err = second.Acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+	require.NoError(t, first.Release(ctx))
+	acquired, err = second.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// The lock expires if the holder stops
+	time.Sleep(300 * time.Millisecond)
+	acquired, err = first.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	require.NoError(t, first.Release(ctx))
+}
@@ -0,0 +1,193 @@
+package rstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+var _ = Store(&Memory{})        // check interface
+var _ = Loader(&Memory{})       // check interface
+var _ = StreamLoader(&Memory{}) // check interface
+var _ = Aliaser(&Memory{})      // check interface
+
+// Memory is an in-process Store, instruments and history are lost on restart
+type Memory struct {
+	sync.RWMutex
+	logger      *zap.Logger
+	instruments map[string]reference.Instrument
+	history     map[string]History
+	aliases     map[string]string
+}
+
+// NewMemory ...
+func NewMemory(l *zap.Logger) *Memory {
+	return &Memory{
+		logger:      l.Named("memory"),
+		instruments: map[string]reference.Instrument{},
+		history:     map[string]History{},
+	}
+}
+
+func (m *Memory) get(key string) (*reference.Instrument, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	instr, ok := m.instruments[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return &instr, nil
+}
+
+// getAt returns the instrument of key at t from the key history, or the current instrument without history
+func (m *Memory) getAt(key string, t time.Time) (*reference.Instrument, error) {
+	m.RLock()
+	h, ok := m.history[key]
+	m.RUnlock()
+	// Without history, or after its last change, the current instrument is used
+	if !ok || !t.Before(h.Changed()) {
+		return m.get(key)
+	}
+
+	instr, ok := h.At(t)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return instr, nil
+}
+
+func (m *Memory) put(key string, inst *reference.Instrument) {
+	m.Lock()
+	defer m.Unlock()
+	m.instruments[key] = *inst
+}
+
+// GetSymbolExchange ...
+func (m *Memory) GetSymbolExchange(ctx context.Context, symbol, exchange string) (*reference.Instrument, error) {
+	return m.get(symbolExchangeKey(symbol, exchange))
+}
+
+// GetSymbolCurrency ...
+func (m *Memory) GetSymbolCurrency(ctx context.Context, symbol, currency string) (*reference.Instrument, error) {
+	return m.get(symbolCurrencyKey(symbol, currency))
+}
+
+// GetSymbolExchangeAt ...
+func (m *Memory) GetSymbolExchangeAt(ctx context.Context, symbol, exchange string, t time.Time) (*reference.Instrument, error) {
+	return m.getAt(symbolExchangeKey(symbol, exchange), t)
+}
+
+// GetSymbolCurrencyAt ...
+func (m *Memory) GetSymbolCurrencyAt(ctx context.Context, symbol, currency string, t time.Time) (*reference.Instrument, error) {
+	return m.getAt(symbolCurrencyKey(symbol, currency), t)
+}
+
+// GetIdentifier ...
+func (m *Memory) GetIdentifier(ctx context.Context, idType IdentifierType, id string) (*reference.Instrument, error) {
+	return m.get(identifierKey(idType, id))
+}
+
+// PutSymbolExchange ...
+func (m *Memory) PutSymbolExchange(ctx context.Context, inst *reference.Instrument) error {
+	m.put(symbolExchangeKey(inst.Symbol, inst.Exchange), inst)
+	return nil
+}
+
+// PutSymbolCurrency ...
+func (m *Memory) PutSymbolCurrency(ctx context.Context, inst *reference.Instrument) error {
+	m.put(symbolCurrencyKey(inst.Symbol, inst.CurrencyID), inst)
+	return nil
+}
+
+// Load replaces every instrument, readers see the previous instruments until the load is complete
+func (m *Memory) Load(ctx context.Context, instruments []reference.Instrument) error {
+	w, err := m.BeginLoad(ctx)
+	if err != nil {
+		return err
+	}
+	if err := w.Write(ctx, instruments); err != nil {
+		return err
+	}
+	return w.Commit(ctx)
+}
+
+// BeginLoad starts a load written in batches, see Load
+func (m *Memory) BeginLoad(ctx context.Context) (SnapshotWriter, error) {
+	return &memoryWriter{m: m, loaded: map[string]reference.Instrument{}}, nil
+}
+
+// memoryWriter builds the instruments of a Memory load, they replace the Memory instruments on Commit
+type memoryWriter struct {
+	m      *Memory
+	loaded map[string]reference.Instrument
+	count  int
+}
+
+// Write indexes the instruments, later instruments replace earlier instruments of the same symbol and
+// identifiers are indexed to the first instrument
+func (w *memoryWriter) Write(ctx context.Context, instruments []reference.Instrument) error {
+	for i := range instruments {
+		for _, key := range symbolKeys(&instruments[i]) {
+			w.loaded[key] = instruments[i]
+		}
+		for _, key := range identifierKeys(&instruments[i]) {
+			if _, ok := w.loaded[key]; !ok {
+				w.loaded[key] = instruments[i]
+			}
+		}
+	}
+	w.count += len(instruments)
+	return nil
+}
+
+// Commit replaces the instruments and updates the History of every symbol
+func (w *memoryWriter) Commit(ctx context.Context) error {
+	w.m.Lock()
+	w.m.instruments = w.loaded
+	w.m.history = updateHistories(w.m.history, w.loaded, now())
+	w.m.Unlock()
+
+	w.m.logger.Debug("Instruments Loaded", zap.Int("count", w.count))
+	return nil
+}
+
+// Abort discards the instruments written
+func (w *memoryWriter) Abort(ctx context.Context) error {
+	w.loaded = nil
+	return nil
+}
+
+// GetAlias ...
+func (m *Memory) GetAlias(ctx context.Context, name string) (string, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return m.aliases[NormalizeTicker(name)], nil
+}
+
+// LoadAliases ...
+func (m *Memory) LoadAliases(ctx context.Context, aliases map[string]string) error {
+	loaded := make(map[string]string, len(aliases))
+	for name, target := range aliases {
+		loaded[NormalizeTicker(name)] = target
+	}
+
+	m.Lock()
+	m.aliases = loaded
+	m.Unlock()
+	return nil
+}
+
+// Status ...
+func (m *Memory) Status(ctx context.Context) error {
+	return nil
+}
+
+// Close ...
+func (m *Memory) Close() error {
+	return nil
+}
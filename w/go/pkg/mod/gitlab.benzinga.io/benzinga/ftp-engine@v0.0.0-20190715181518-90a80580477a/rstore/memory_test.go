@@ -0,0 +1,49 @@
+package rstore
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	ctx := context.Background()
+
+	require.NoError(t, m.Status(ctx))
+
+	var data reference.FinancialData
+	require.NoError(t, json.Unmarshal(instrumentsJSON, &data))
+
+	for _, v := range data.Instruments {
+		instr := v
+		assert.NoError(t, m.PutSymbolCurrency(ctx, &instr))
+		assert.NoError(t, m.PutSymbolExchange(ctx, &instr))
+
+		res, err := m.GetSymbolCurrency(ctx, instr.Symbol, instr.CurrencyID)
+		require.NoError(t, err)
+		assert.Equal(t, instr.ISIN, res.ISIN)
+		assert.Equal(t, instr.CurrencyID, res.CurrencyID)
+
+		res, err = m.GetSymbolExchange(ctx, instr.Symbol, instr.Exchange)
+		require.NoError(t, err)
+		assert.Equal(t, instr.ISIN, res.ISIN)
+		assert.Equal(t, instr.Exchange, res.Exchange)
+	}
+
+	_, err := m.GetSymbolExchange(ctx, "NOPE", "XNAS")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Keys are case insensitive, as in Redis
+	instr := data.Instruments[0]
+	_, err = m.GetSymbolCurrency(ctx, instr.Symbol, "cad")
+	assert.NoError(t, err)
+
+	require.NoError(t, m.Close())
+}
@@ -0,0 +1,320 @@
+package rstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/opentracing/opentracing-go"
+	tlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+// DefaultUnresolvedSize is the default number of unresolved tickers listed by Resolver.Unresolved
+const DefaultUnresolvedSize = 1000
+
+// defaultCurrency is the currency of tickers without an exchange
+const defaultCurrency = "USD"
+
+// Methods a Resolver resolved a ticker with, in the order they are tried
+const (
+	// ResolvedExact is a ticker found as is
+	ResolvedExact = "exact"
+	// ResolvedAlias is a ticker found by the alias table, see Aliaser
+	ResolvedAlias = "alias"
+	// ResolvedNormalized is a ticker found with another share class notation or without OTC suffix
+	ResolvedNormalized = "normalized"
+	// ResolvedFallback is a ticker found on a fallback exchange
+	ResolvedFallback = "exchange_fallback"
+)
+
+var (
+	// otcSuffixes are removed from symbols, ex. NSRGY.PK is NSRGY
+	otcSuffixes = []string{".PK", ".OB", ".OTC", "-OTC"}
+	// shareClassSeparators separate the share class of symbols, ex. BRK.B, BRK/B, BRK-B and BRK B
+	shareClassSeparators = []string{".", "/", "-", " "}
+)
+
+// Aliaser is implemented by stores with an alias table, ticker names refDB does not have mapped to refDB
+// tickers. Names are EXCHANGE:SYMBOL or SYMBOL, see ParseTicker.
+type Aliaser interface {
+	// GetAlias returns the ticker name is an alias of, "" if name is not an alias
+	GetAlias(ctx context.Context, name string) (string, error)
+	// LoadAliases replaces every alias
+	LoadAliases(ctx context.Context, aliases map[string]string) error
+}
+
+// ParseTicker splits a content ticker name, EXCHANGE:SYMBOL or SYMBOL
+func ParseTicker(name string) (exchange, symbol string) {
+	split := strings.SplitN(name, ":", 2)
+	if len(split) > 1 {
+		return split[0], split[1]
+	}
+	return "", split[0]
+}
+
+// NormalizeSymbol returns symbol upper case, without OTC suffix and with '.' separating the share class, ex.
+// brk/b and BRK-B are BRK.B
+func NormalizeSymbol(symbol string) string {
+	s := strings.ToUpper(strings.TrimSpace(symbol))
+	for _, suffix := range otcSuffixes {
+		if len(s) > len(suffix) && strings.HasSuffix(s, suffix) {
+			s = strings.TrimSuffix(s, suffix)
+			break
+		}
+	}
+	for _, sep := range shareClassSeparators[1:] {
+		s = strings.Replace(s, sep, shareClassSeparators[0], -1)
+	}
+	return s
+}
+
+// NormalizeTicker returns the ticker name with its exchange upper case and its symbol normalized, see
+// NormalizeSymbol
+func NormalizeTicker(name string) string {
+	exchange, symbol := ParseTicker(name)
+	if exchange == "" {
+		return NormalizeSymbol(symbol)
+	}
+	return strings.ToUpper(strings.TrimSpace(exchange)) + ":" + NormalizeSymbol(symbol)
+}
+
+// symbolVariants returns the normalized symbol in every share class notation
+func symbolVariants(symbol string) []string {
+	normalized := NormalizeSymbol(symbol)
+	if !strings.Contains(normalized, shareClassSeparators[0]) {
+		return []string{normalized}
+	}
+
+	variants := make([]string, 0, len(shareClassSeparators))
+	for _, sep := range shareClassSeparators {
+		variants = append(variants, strings.Replace(normalized, shareClassSeparators[0], sep, -1))
+	}
+	return variants
+}
+
+// isNotFound returns true for the errors stores return for unknown keys
+func isNotFound(err error) bool {
+	return err == ErrKeyNotFound || err == redis.Nil
+}
+
+// ResolverOptions configures a Resolver
+type ResolverOptions struct {
+	// ExchangeFallbacks are tried in order for tickers not found on their exchange, none by default. The same
+	// symbol on another exchange may be another instrument, so every fallback match is logged and counted.
+	ExchangeFallbacks []string
+	// UnresolvedSize is the number of unresolved tickers listed, DefaultUnresolvedSize if 0
+	UnresolvedSize int
+}
+
+// Resolver looks up content tickers in a Store. Tickers not found as is are looked up in the alias table of
+// stores implementing Aliaser, then with other share class notations, then on the fallback exchanges. Tickers
+// that are not resolved are counted and listed so refDB can be fixed.
+type Resolver struct {
+	Store
+	logger    *zap.Logger
+	fallbacks []string
+	inst      *instr.Collector
+
+	mu             sync.Mutex
+	unresolved     map[string]*UnresolvedTicker
+	unresolvedSize int
+}
+
+// UnresolvedTicker is a ticker name the Resolver did not find
+type UnresolvedTicker struct {
+	Name      string    `json:"name"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// NodeID is the content the ticker was last seen in
+	NodeID int `json:"last_node_id,omitempty"`
+}
+
+// NewResolver returns a Resolver of store, with resolution metrics when inst is not nil
+func NewResolver(logger *zap.Logger, store Store, opts ResolverOptions, inst *instr.Collector) *Resolver {
+	if opts.UnresolvedSize == 0 {
+		opts.UnresolvedSize = DefaultUnresolvedSize
+	}
+	fallbacks := make([]string, 0, len(opts.ExchangeFallbacks))
+	for _, exchange := range opts.ExchangeFallbacks {
+		if exchange = strings.ToUpper(strings.TrimSpace(exchange)); exchange != "" {
+			fallbacks = append(fallbacks, exchange)
+		}
+	}
+
+	return &Resolver{
+		Store:          store,
+		logger:         logger.Named("resolver"),
+		fallbacks:      fallbacks,
+		inst:           inst,
+		unresolved:     make(map[string]*UnresolvedTicker),
+		unresolvedSize: opts.UnresolvedSize,
+	}
+}
+
+// Resolve looks up the instrument of the ticker name at t, see GetSymbolExchangeAt. Tickers without exchange
+// are looked up in USD. nil is returned if the ticker is not resolved, errors are store errors other than
+// not found.
+func (r *Resolver) Resolve(ctx context.Context, name string, t time.Time) (*reference.Instrument, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "rstore.Resolve")
+	defer span.Finish()
+	span.LogFields(tlog.String("ticker", name))
+
+	inst, method, err := r.resolve(subCtx, name, t)
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		return nil, err
+	}
+	if inst == nil {
+		span.LogFields(tlog.Bool("resolved", false))
+		return nil, nil
+	}
+
+	span.LogFields(tlog.String("method", method))
+	switch method {
+	case ResolvedExact:
+	case ResolvedFallback:
+		exchange, _ := ParseTicker(NormalizeTicker(name))
+		r.logger.Warn("Ticker Resolved On Fallback Exchange", zap.String("ticker", name), zap.String("symbol", inst.Symbol), zap.String("exchange", inst.Exchange), zap.String("isin", inst.ISIN))
+		if r.inst != nil {
+			r.inst.ReferenceFallbacks.WithLabelValues(exchange, inst.Exchange).Inc()
+		}
+	default:
+		r.logger.Debug("Ticker Resolved", zap.String("ticker", name), zap.String("method", method), zap.String("symbol", inst.Symbol), zap.String("exchange", inst.Exchange))
+	}
+	if r.inst != nil {
+		r.inst.ReferenceResolutions.WithLabelValues(method).Inc()
+	}
+	return inst, nil
+}
+
+func (r *Resolver) resolve(ctx context.Context, name string, t time.Time) (*reference.Instrument, string, error) {
+	exchange, symbol := ParseTicker(name)
+	exchange = strings.ToUpper(strings.TrimSpace(exchange))
+
+	if inst, err := r.lookup(ctx, exchange, symbol, t); inst != nil || err != nil {
+		return inst, ResolvedExact, err
+	}
+
+	if aliaser, ok := r.Store.(Aliaser); ok {
+		names := []string{NormalizeTicker(name)}
+		if exchange != "" {
+			names = append(names, NormalizeSymbol(symbol))
+		}
+		for _, alias := range names {
+			target, err := aliaser.GetAlias(ctx, alias)
+			if err != nil {
+				return nil, "", err
+			}
+			if target == "" {
+				continue
+			}
+			targetExchange, targetSymbol := ParseTicker(target)
+			if targetExchange == "" {
+				targetExchange = exchange
+			}
+			if inst, err := r.lookup(ctx, targetExchange, targetSymbol, t); inst != nil || err != nil {
+				return inst, ResolvedAlias, err
+			}
+		}
+	}
+
+	variants := symbolVariants(symbol)
+	tried := strings.ToUpper(strings.TrimSpace(symbol))
+	for _, variant := range variants {
+		if variant == tried {
+			continue
+		}
+		if inst, err := r.lookup(ctx, exchange, variant, t); inst != nil || err != nil {
+			return inst, ResolvedNormalized, err
+		}
+	}
+
+	for _, fallback := range r.fallbacks {
+		if fallback == exchange {
+			continue
+		}
+		for _, variant := range variants {
+			if inst, err := r.lookup(ctx, fallback, variant, t); inst != nil || err != nil {
+				return inst, ResolvedFallback, err
+			}
+		}
+	}
+
+	return nil, "", nil
+}
+
+// lookup returns the instrument of symbol on exchange, or in USD without exchange, nil if not found
+func (r *Resolver) lookup(ctx context.Context, exchange, symbol string, t time.Time) (*reference.Instrument, error) {
+	var inst *reference.Instrument
+	var err error
+	if exchange != "" {
+		inst, err = r.GetSymbolExchangeAt(ctx, symbol, exchange, t)
+	} else {
+		inst, err = r.GetSymbolCurrencyAt(ctx, symbol, defaultCurrency, t)
+	}
+	if isNotFound(err) {
+		return nil, nil
+	}
+	return inst, err
+}
+
+// ReportUnresolved counts and lists the ticker name of content nodeID as unresolved. The least recently seen
+// ticker is removed when the list is full.
+func (r *Resolver) ReportUnresolved(name string, nodeID int) {
+	name = NormalizeTicker(name)
+	exchange, _ := ParseTicker(name)
+	if r.inst != nil {
+		r.inst.ReferenceUnresolved.WithLabelValues(exchange).Inc()
+	}
+	r.logger.Info("Ticker Unresolved", zap.String("ticker", name), zap.Int("node_id", nodeID))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at := time.Now()
+	if u, ok := r.unresolved[name]; ok {
+		u.Count++
+		u.LastSeen = at
+		u.NodeID = nodeID
+		return
+	}
+
+	if len(r.unresolved) >= r.unresolvedSize {
+		var oldest *UnresolvedTicker
+		for _, u := range r.unresolved {
+			if oldest == nil || u.LastSeen.Before(oldest.LastSeen) {
+				oldest = u
+			}
+		}
+		delete(r.unresolved, oldest.Name)
+	}
+	r.unresolved[name] = &UnresolvedTicker{Name: name, Count: 1, FirstSeen: at, LastSeen: at, NodeID: nodeID}
+}
+
+// Unresolved returns the unresolved tickers last seen at or after since, most seen first
+func (r *Resolver) Unresolved(since time.Time) []UnresolvedTicker {
+	r.mu.Lock()
+	tickers := make([]UnresolvedTicker, 0, len(r.unresolved))
+	for _, u := range r.unresolved {
+		if !u.LastSeen.Before(since) {
+			tickers = append(tickers, *u)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Slice(tickers, func(i, j int) bool {
+		if tickers[i].Count != tickers[j].Count {
+			return tickers[i].Count > tickers[j].Count
+		}
+		return tickers[i].Name < tickers[j].Name
+	})
+	return tickers
+}
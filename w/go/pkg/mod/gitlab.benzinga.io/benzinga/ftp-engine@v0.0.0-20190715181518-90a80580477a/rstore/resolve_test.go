@@ -0,0 +1,183 @@
+package rstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func TestNormalizeSymbol(t *testing.T) {
+	for symbol, expected := range map[string]string{
+		"AAPL":     "AAPL",
+		" aapl ":   "AAPL",
+		"BRK.B":    "BRK.B",
+		"BRK/B":    "BRK.B",
+		"brk-b":    "BRK.B",
+		"BRK B":    "BRK.B",
+		"NSRGY.PK": "NSRGY",
+		"ABCD.OB":  "ABCD",
+		".PK":      ".PK",
+	} {
+		assert.Equal(t, expected, NormalizeSymbol(symbol), symbol)
+	}
+
+	assert.Equal(t, "NYSE:BRK.B", NormalizeTicker("nyse:BRK/B"))
+	assert.Equal(t, []string{"BRK.B", "BRK/B", "BRK-B", "BRK B"}, symbolVariants("brk/b"))
+	assert.Equal(t, []string{"F"}, symbolVariants("F"))
+
+	exchange, symbol := ParseTicker("NYSE:F")
+	assert.Equal(t, "NYSE", exchange)
+	assert.Equal(t, "F", symbol)
+	exchange, symbol = ParseTicker("F")
+	assert.Empty(t, exchange)
+	assert.Equal(t, "F", symbol)
+}
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory(zap.NewNop())
+	require.NoError(t, store.Load(ctx, []reference.Instrument{
+		{Symbol: "F", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US3453708600"},
+		{Symbol: "BRK.B", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US0846707026"},
+		{Symbol: "GOOGL", CurrencyID: "USD", Exchange: "NASDAQ", ISIN: "US02079K3059"},
+		{Symbol: "NSRGY", CurrencyID: "USD", Exchange: "OTC", ISIN: "US6410694060"},
+		{Symbol: "SHOP", CurrencyID: "CAD", Exchange: "TSX", ISIN: "CA82509L1076"},
+	}))
+	require.NoError(t, store.LoadAliases(ctx, map[string]string{
+		"GOOG":        "NASDAQ:GOOGL",
+		"nyse:ford":   "F",
+		"NASDAQ:MISS": "NASDAQ:NOPE",
+	}))
+
+	inst := testCollector()
+	r := NewResolver(zap.NewNop(), store, ResolverOptions{ExchangeFallbacks: []string{" otc", ""}}, inst)
+
+	for name, expected := range map[string]struct {
+		isin   string
+		method string
+	}{
+		"F":             {"US3453708600", ResolvedExact},
+		"NYSE:f":        {"US3453708600", ResolvedExact},
+		"GOOG":          {"US02079K3059", ResolvedAlias},
+		"NYSE:FORD":     {"US3453708600", ResolvedAlias},
+		"BRK/B":         {"US0846707026", ResolvedNormalized},
+		"NYSE:brk-b":    {"US0846707026", ResolvedNormalized},
+		"NASDAQ:F":      {},
+		"NYSE:NSRGY.PK": {"US6410694060", ResolvedFallback},
+		"TSX:SHOP":      {"CA82509L1076", ResolvedExact},
+		"SHOP":          {},
+		"NASDAQ:MISS":   {},
+	} {
+		var resolved float64
+		if expected.method != "" {
+			resolved = testutil.ToFloat64(inst.ReferenceResolutions.WithLabelValues(expected.method))
+		}
+		res, err := r.Resolve(ctx, name, time.Now())
+		require.NoError(t, err, name)
+		if expected.isin == "" {
+			assert.Nil(t, res, name)
+			continue
+		}
+		require.NotNil(t, res, name)
+		assert.Equal(t, expected.isin, res.ISIN, name)
+		assert.Equal(t, resolved+1, testutil.ToFloat64(inst.ReferenceResolutions.WithLabelValues(expected.method)), name)
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(inst.ReferenceFallbacks.WithLabelValues("NYSE", "OTC")))
+
+	// Exchange fallbacks are opt-in
+	res, err := NewResolver(zap.NewNop(), store, ResolverOptions{}, nil).Resolve(ctx, "NYSE:NSRGY.PK", time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, res)
+
+	// Resolver is the Store
+	_, err = r.GetIdentifier(ctx, ISIN, "US3453708600")
+	assert.NoError(t, err)
+}
+
+func TestResolverUnresolved(t *testing.T) {
+	inst := testCollector()
+	r := NewResolver(zap.NewNop(), NewMemory(zap.NewNop()), ResolverOptions{UnresolvedSize: 2}, inst)
+
+	r.ReportUnresolved("nyse:nope", 1)
+	r.ReportUnresolved("NYSE:NOPE", 2)
+	r.ReportUnresolved("GLOG", 3)
+	unresolved := r.Unresolved(time.Time{})
+	require.Len(t, unresolved, 2)
+	assert.Equal(t, "NYSE:NOPE", unresolved[0].Name)
+	assert.Equal(t, 2, unresolved[0].Count)
+	assert.Equal(t, 2, unresolved[0].NodeID)
+	assert.Equal(t, "GLOG", unresolved[1].Name)
+	assert.Equal(t, 2.0, testutil.ToFloat64(inst.ReferenceUnresolved.WithLabelValues("NYSE")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(inst.ReferenceUnresolved.WithLabelValues("")))
+
+	// The least recently seen ticker is removed when the list is full
+	since := time.Now()
+	time.Sleep(time.Millisecond)
+	r.ReportUnresolved("GLOG", 4)
+	r.ReportUnresolved("TSX:NOPE", 5)
+	unresolved = r.Unresolved(time.Time{})
+	require.Len(t, unresolved, 2)
+	assert.Equal(t, "GLOG", unresolved[0].Name)
+	assert.Equal(t, "TSX:NOPE", unresolved[1].Name)
+	assert.Len(t, r.Unresolved(since), 2)
+	assert.Empty(t, r.Unresolved(time.Now().Add(time.Minute)))
+}
+
+func TestAliases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-engine-aliases")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := NewBolt(zap.NewNop(), filepath.Join(dir, "refdb.bolt"))
+	require.NoError(t, err)
+	defer b.Close()
+
+	stores := map[string]Aliaser{"memory": NewMemory(zap.NewNop()), "bolt": b}
+	if !testing.Short() {
+		cfg, err := config.LoadConfig("test")
+		require.NoError(t, err)
+		c, err := NewClient(zap.NewNop(), cfg.RedisURL)
+		require.NoError(t, err)
+		defer c.Close()
+		c.EnableCache(CacheOptions{}, nil)
+		stores["redis"] = c
+	}
+
+	ctx := context.Background()
+	for name, store := range stores {
+		target, err := store.GetAlias(ctx, "ALIAS-GOOG")
+		require.NoError(t, err, name)
+		assert.Empty(t, target, name)
+
+		require.NoError(t, store.LoadAliases(ctx, map[string]string{"alias-goog": "NASDAQ:GOOGL", "NYSE:ALIAS-BRK/B": "BRK.B"}), name)
+		target, err = store.GetAlias(ctx, "ALIAS-GOOG")
+		require.NoError(t, err, name)
+		assert.Equal(t, "NASDAQ:GOOGL", target, name)
+		target, err = store.GetAlias(ctx, "nyse:alias-brk-b")
+		require.NoError(t, err, name)
+		assert.Equal(t, "BRK.B", target, name)
+
+		// Loads replace every alias
+		require.NoError(t, store.LoadAliases(ctx, map[string]string{"ALIAS-FB": "NASDAQ:META"}), name)
+		target, err = store.GetAlias(ctx, "ALIAS-GOOG")
+		require.NoError(t, err, name)
+		assert.Empty(t, target, name)
+
+		require.NoError(t, store.LoadAliases(ctx, nil), name)
+		target, err = store.GetAlias(ctx, "ALIAS-FB")
+		require.NoError(t, err, name)
+		assert.Empty(t, target, name)
+	}
+}
@@ -3,6 +3,7 @@ package rstore
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -11,11 +12,54 @@ import (
 	tlog "github.com/opentracing/opentracing-go/log"
 	otredis "github.com/smacker/opentracing-go-redis"
 	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
 )
 
+// Store looks up reference instruments by symbol, Client is the Redis Store
+type Store interface {
+	GetSymbolExchange(ctx context.Context, symbol, exchange string) (*reference.Instrument, error)
+	GetSymbolCurrency(ctx context.Context, symbol, currency string) (*reference.Instrument, error)
+	// GetSymbolExchangeAt looks up the instrument symbol resolved to on exchange at t, see History. Symbols
+	// without history, ex. written by PutSymbolExchange, and times after the last change of the history resolve
+	// to the current instrument.
+	GetSymbolExchangeAt(ctx context.Context, symbol, exchange string, t time.Time) (*reference.Instrument, error)
+	// GetSymbolCurrencyAt looks up the instrument symbol resolved to in currency at t, see GetSymbolExchangeAt
+	GetSymbolCurrencyAt(ctx context.Context, symbol, currency string, t time.Time) (*reference.Instrument, error)
+	// GetIdentifier looks up the instrument by identifier, identifiers are indexed by Load
+	GetIdentifier(ctx context.Context, idType IdentifierType, id string) (*reference.Instrument, error)
+	PutSymbolExchange(ctx context.Context, inst *reference.Instrument) error
+	PutSymbolCurrency(ctx context.Context, inst *reference.Instrument) error
+	Status(ctx context.Context) error
+	Close() error
+}
+
+// Loader is implemented by stores that can replace every instrument at once, faster than PutSymbolExchange
+// and PutSymbolCurrency for each instrument. Load also indexes the instrument identifiers, and records the
+// History of each symbol.
+type Loader interface {
+	Load(ctx context.Context, instruments []reference.Instrument) error
+}
+
+var _ = Store(&Client{}) // check interface
+
+// Client is the Redis Store, instruments are read from the snapshot version loaded last by Load
 type Client struct {
 	client *redis.Client
 	logger *zap.Logger
+
+	// versionMu guards the cached snapshot version and generation, see VersionCacheTTL
+	versionMu      sync.Mutex
+	version        int64
+	generation     int64
+	versionExpires time.Time
+
+	// loaded is the snapshot version written by the last Load, LoadDelta only changes that version
+	loaded int64
+
+	// cache of lookups, nil unless EnableCache is called
+	cache *cache
 }
 
 const ftpEnginePrefix = "ftp-engine"
@@ -39,6 +83,12 @@ func NewClient(l *zap.Logger, redisURL string) (*Client, error) {
 	}, nil
 }
 
+// EnableCache caches lookups in process, with hit and miss metrics when inst is not nil. The cache is cleared
+// when readers see a new snapshot generation, see VersionCacheTTL.
+func (c *Client) EnableCache(opts CacheOptions, inst *instr.Collector) {
+	c.cache = newCache(opts, inst)
+}
+
 func (c *Client) Status(ctx context.Context) error {
 	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.Status")
 	defer span.Finish()
@@ -10,6 +10,10 @@ import (
 )
 
 func TestStatus(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires docker-compose services, see make deps")
+	}
+
 	// Load Config
 	cfg, err := config.LoadConfig("test")
 	require.NoError(t, err)
@@ -0,0 +1,404 @@
+package rstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tlog "github.com/opentracing/opentracing-go/log"
+	otredis "github.com/smacker/opentracing-go-redis"
+	"github.com/vmihailenco/msgpack"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+var _ = Loader(&Client{}) // check interface
+
+const (
+	// currentVersionKey is the snapshot version readers use
+	currentVersionKey = ftpEnginePrefix + ":current"
+	// versionCounterKey is incremented for each snapshot loaded
+	versionCounterKey = ftpEnginePrefix + ":version"
+	// generationKey is incremented for each change readers see, snapshots loaded, deltas applied and history
+	// updates, readers clear their cache when it changes
+	generationKey = ftpEnginePrefix + ":generation"
+	// historyPrefix is the key prefix of symbol histories in a snapshot version, each snapshot copies the
+	// histories of the previous snapshot before readers are pointed to it
+	historyPrefix = "HISTORY:"
+	// legacyHistoryPrefix is the key prefix of histories written outside snapshot versions, they are read until a
+	// snapshot copies them and then expire
+	legacyHistoryPrefix = ftpEnginePrefix + ":history:"
+
+	// VersionCacheTTL is how long readers use the current version before checking it again
+	VersionCacheTTL = 5 * time.Second
+	// PreviousVersionTTL is how long the previous snapshot is kept after a new snapshot is loaded, so readers
+	// with the previous version cached still find instruments
+	PreviousVersionTTL = 10 * time.Minute
+	// LoadingVersionTTL expires the keys of a snapshot that was not completed, ex. the updater stopped during a load
+	LoadingVersionTTL = time.Hour
+
+	// loadBatchSize is the number of commands sent per pipeline
+	loadBatchSize = 1000
+)
+
+// ErrSnapshotConflict is returned by Load when another snapshot was loaded during the load
+var ErrSnapshotConflict = errors.New("snapshot version changed during load")
+
+// versionPrefix is the key prefix of a snapshot version. Version 0 is the unversioned keys written before
+// snapshots, they are read until the first snapshot is loaded.
+func versionPrefix(version int64) string {
+	if version == 0 {
+		return strings.ToUpper(ftpEnginePrefix) + ":"
+	}
+	return ftpEnginePrefix + ":v" + strconv.FormatInt(version, 10) + ":"
+}
+
+// currentVersion returns the snapshot version readers use and its generation, cached for VersionCacheTTL
+func (c *Client) currentVersion(client *redis.Client) (version, generation int64, err error) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+
+	if time.Now().Before(c.versionExpires) {
+		return c.version, c.generation, nil
+	}
+
+	vals, err := client.MGet(currentVersionKey, generationKey).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, v := range []*int64{&version, &generation} {
+		if vals[i] == nil {
+			continue
+		}
+		if *v, err = strconv.ParseInt(vals[i].(string), 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	c.version, c.generation, c.versionExpires = version, generation, time.Now().Add(VersionCacheTTL)
+	return version, generation, nil
+}
+
+func (c *Client) setCurrentVersion(version, generation int64) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	c.version, c.generation, c.versionExpires = version, generation, time.Now().Add(VersionCacheTTL)
+}
+
+type getter interface {
+	Get(key string) *redis.StringCmd
+}
+
+// getVersion reads currentVersionKey, 0 if no snapshot has been loaded
+func getVersion(client getter) (int64, error) {
+	version, err := client.Get(currentVersionKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return version, err
+}
+
+// SnapshotVersion returns the snapshot version readers use, 0 if no snapshot has been loaded
+func (c *Client) SnapshotVersion(ctx context.Context) (int64, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.SnapshotVersion")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+
+	version, err := getVersion(otredis.WrapRedisClient(subCtx, c.client))
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		c.logger.Error("Redis Get Snapshot Version Error", zap.Error(err))
+		return 0, err
+	}
+	return version, nil
+}
+
+// historyKey is the key of the symbol key history in the snapshot version
+func historyKey(version int64, key string) string {
+	return versionPrefix(version) + historyPrefix + key
+}
+
+// versionKey returns key in the current snapshot version
+func (c *Client) versionKey(client *redis.Client, key string) (string, error) {
+	version, _, err := c.currentVersion(client)
+	if err != nil {
+		return "", err
+	}
+	return versionPrefix(version) + key, nil
+}
+
+// Load writes the instruments to a new snapshot version with pipelined writes, then points readers to it and
+// expires the previous version. Readers see the previous snapshot until the new snapshot is complete, and
+// instruments removed from refDB are removed with the previous version. See BeginLoad to write the instruments
+// in batches.
+func (c *Client) Load(ctx context.Context, instruments []reference.Instrument) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.Load")
+	defer span.Finish()
+	span.LogFields(tlog.Int("count", len(instruments)))
+
+	w, err := c.BeginLoad(subCtx)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(instruments); start += loadBatchSize {
+		end := start + loadBatchSize
+		if end > len(instruments) {
+			end = len(instruments)
+		}
+		if err := w.Write(subCtx, instruments[start:end]); err != nil {
+			w.Abort(subCtx)
+			return err
+		}
+	}
+
+	return w.Commit(subCtx)
+}
+
+// expireVersion expires every key of the snapshot version after PreviousVersionTTL
+func (c *Client) expireVersion(client *redis.Client, version int64) (int, error) {
+	return expireKeys(client, versionPrefix(version)+"*")
+}
+
+// expireKeys expires the keys matching pattern after PreviousVersionTTL
+func expireKeys(client *redis.Client, pattern string) (int, error) {
+	var expired int
+	err := scanKeys(client, pattern, func(keys []string) error {
+		expired += len(keys)
+		return pipelineKeys(client, keys, func(pipe redis.Pipeliner, key string) { pipe.Expire(key, PreviousVersionTTL) })
+	})
+	return expired, err
+}
+
+// scanKeys calls fn with batches of the keys matching pattern, a key may be in several batches
+func scanKeys(client *redis.Client, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(cursor, pattern, loadBatchSize).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// trimKeys returns keys without prefix
+func trimKeys(keys []string, prefix string) []string {
+	trimmed := make([]string, len(keys))
+	for i, key := range keys {
+		trimmed[i] = strings.TrimPrefix(key, prefix)
+	}
+	return trimmed
+}
+
+// copyHistory writes the history of every symbol of the snapshot version, updated from the histories of the
+// previous version, see updateHistories. Symbols only in the previous histories resolve to no instrument from at.
+// Histories expire after LoadingVersionTTL like the snapshot keys. It returns the number of histories changed.
+func (c *Client) copyHistory(client *redis.Client, previous, version int64, at time.Time) (int, error) {
+	var updated int
+	instruments := versionInstruments(client, version)
+
+	// Symbols of the snapshot
+	prefix := versionPrefix(version)
+	if err := scanKeys(client, prefix+symbolKeyPrefix+"*", func(keys []string) error {
+		n, err := c.writeHistory(client, previous, version, trimKeys(keys, prefix), instruments, at, LoadingVersionTTL)
+		updated += n
+		return err
+	}); err != nil {
+		return updated, err
+	}
+
+	// Symbols no longer in refDB
+	for _, prefix := range []string{versionPrefix(previous) + historyPrefix, legacyHistoryPrefix} {
+		if err := scanKeys(client, prefix+"*", func(keys []string) error {
+			keys = trimKeys(keys, prefix)
+			batchInstruments, err := instruments(keys)
+			if err != nil {
+				return err
+			}
+			removed := keys[:0]
+			for i, key := range keys {
+				if batchInstruments[i] == nil {
+					removed = append(removed, key)
+				}
+			}
+			n, err := c.writeHistory(client, previous, version, removed, mapInstruments(nil), at, LoadingVersionTTL)
+			updated += n
+			return err
+		}); err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+// instrumentsFunc returns the instrument of each key, nil for keys removed from refDB
+type instrumentsFunc func(keys []string) ([]*reference.Instrument, error)
+
+// mapInstruments returns the instruments of keys in symbols
+func mapInstruments(symbols map[string]*reference.Instrument) instrumentsFunc {
+	return func(keys []string) ([]*reference.Instrument, error) {
+		instruments := make([]*reference.Instrument, len(keys))
+		for i, key := range keys {
+			instruments[i] = symbols[key]
+		}
+		return instruments, nil
+	}
+}
+
+// versionInstruments returns the instruments of keys in the snapshot version
+func versionInstruments(client *redis.Client, version int64) instrumentsFunc {
+	return func(keys []string) ([]*reference.Instrument, error) {
+		versionKeys := make([]string, len(keys))
+		for i, key := range keys {
+			versionKeys[i] = versionPrefix(version) + key
+		}
+		vals, err := client.MGet(versionKeys...).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		instruments := make([]*reference.Instrument, len(keys))
+		for i, val := range vals {
+			if val == nil {
+				continue
+			}
+			var inst reference.Instrument
+			if err := msgpack.Unmarshal([]byte(val.(string)), &inst); err != nil {
+				return nil, err
+			}
+			instruments[i] = &inst
+		}
+		return instruments, nil
+	}
+}
+
+// writeHistory writes the histories of keys in version, the histories of previous updated with their instrument,
+// keys without instrument are removed from refDB. Histories left empty by HistoryRetention are deleted. It returns
+// the number of histories changed.
+func (c *Client) writeHistory(client *redis.Client, previous, version int64, keys []string, instruments instrumentsFunc, at time.Time, ttl time.Duration) (int, error) {
+	var updated int
+	for start := 0; start < len(keys); start += loadBatchSize {
+		end := start + loadBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+
+		histories, changed, err := updateHistory(client, previous, batch, instruments, at)
+		if err != nil {
+			return updated, err
+		}
+		if _, err := client.Pipelined(func(pipe redis.Pipeliner) error {
+			return setHistory(pipe, version, batch, histories, ttl)
+		}); err != nil {
+			return updated, err
+		}
+		updated += changed
+	}
+	return updated, nil
+}
+
+// updateHistory returns the histories of keys in version updated with their instrument, and the number of
+// histories changed
+func updateHistory(client mgetter, version int64, keys []string, instruments instrumentsFunc, at time.Time) ([]History, int, error) {
+	keyInstruments, err := instruments(keys)
+	if err != nil {
+		return nil, 0, err
+	}
+	histories, err := readHistories(client, version, keys)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var updated int
+	for i := range keys {
+		var changed bool
+		if histories[i], changed = histories[i].update(keyInstruments[i], at); changed {
+			updated++
+		}
+	}
+	return histories, updated, nil
+}
+
+// setHistory queues the writes of the histories of keys in version, empty histories are deleted
+func setHistory(pipe redis.Pipeliner, version int64, keys []string, histories []History, ttl time.Duration) error {
+	for i, key := range keys {
+		if len(histories[i]) == 0 {
+			pipe.Del(historyKey(version, key))
+			continue
+		}
+		val, err := msgpack.Marshal(histories[i])
+		if err != nil {
+			return err
+		}
+		pipe.Set(historyKey(version, key), val, ttl)
+	}
+	return nil
+}
+
+type mgetter interface {
+	MGet(keys ...string) *redis.SliceCmd
+}
+
+// readHistories returns the histories of keys in the snapshot version, or the legacy histories of keys without
+// history in the version. Histories are nil for keys without history.
+func readHistories(client mgetter, version int64, keys []string) ([]History, error) {
+	historyKeys := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		historyKeys = append(historyKeys, historyKey(version, key), legacyHistoryPrefix+key)
+	}
+	vals, err := client.MGet(historyKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	histories := make([]History, len(keys))
+	for i := range keys {
+		val := vals[2*i]
+		if val == nil {
+			val = vals[2*i+1]
+		}
+		if val == nil {
+			continue
+		}
+		if err := msgpack.Unmarshal([]byte(val.(string)), &histories[i]); err != nil {
+			return nil, err
+		}
+	}
+	return histories, nil
+}
+
+// pipelineKeys calls cmd for every key in pipelines of loadBatchSize commands
+func pipelineKeys(client *redis.Client, keys []string, cmd func(pipe redis.Pipeliner, key string)) error {
+	for start := 0; start < len(keys); start += loadBatchSize {
+		end := start + loadBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		if _, err := client.Pipelined(func(pipe redis.Pipeliner) error {
+			for _, key := range keys[start:end] {
+				cmd(pipe, key)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
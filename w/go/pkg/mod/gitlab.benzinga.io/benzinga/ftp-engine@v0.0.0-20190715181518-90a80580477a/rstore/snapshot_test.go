@@ -0,0 +1,79 @@
+package rstore
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func TestVersionPrefix(t *testing.T) {
+	// Version 0 is the unversioned keys written before snapshots
+	assert.Equal(t, "FTP-ENGINE:SYMBOL-EXCHANGE:F:NYSE", versionPrefix(0)+symbolExchangeKey("f", "nyse"))
+	assert.Equal(t, "ftp-engine:v12:SYMBOL-CURRENCY:F:USD", versionPrefix(12)+symbolCurrencyKey("F", "usd"))
+}
+
+func TestSnapshot(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires docker-compose services, see make deps")
+	}
+
+	cfg, err := config.LoadConfig("test")
+	require.NoError(t, err)
+
+	logger, err := cfg.LoadLogger()
+	require.NoError(t, err)
+
+	c, err := NewClient(logger, cfg.RedisURL)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	var data reference.FinancialData
+	require.NoError(t, json.Unmarshal(instrumentsJSON, &data))
+
+	require.NoError(t, c.Load(ctx, data.Instruments))
+	first, err := getVersion(c.client)
+	require.NoError(t, err)
+
+	for _, v := range data.Instruments {
+		res, err := c.GetSymbolExchange(ctx, v.Symbol, v.Exchange)
+		require.NoError(t, err)
+		assert.Equal(t, v.ISIN, res.ISIN)
+
+		ttl, err := c.client.TTL(versionPrefix(first) + symbolExchangeKey(v.Symbol, v.Exchange)).Result()
+		require.NoError(t, err)
+		assert.True(t, ttl < 0, "complete snapshot keys do not expire")
+	}
+
+	// Instruments removed from refDB are not in the next snapshot, the previous snapshot expires
+	removed := data.Instruments[0]
+	require.NoError(t, c.Load(ctx, data.Instruments[1:]))
+	second, err := getVersion(c.client)
+	require.NoError(t, err)
+	assert.True(t, second > first)
+
+	_, err = c.GetSymbolCurrency(ctx, removed.Symbol, removed.CurrencyID)
+	assert.Equal(t, redis.Nil, err)
+	res, err := c.GetSymbolCurrency(ctx, data.Instruments[1].Symbol, data.Instruments[1].CurrencyID)
+	require.NoError(t, err)
+	assert.Equal(t, data.Instruments[1].ISIN, res.ISIN)
+
+	ttl, err := c.client.TTL(versionPrefix(first) + symbolCurrencyKey(removed.Symbol, removed.CurrencyID)).Result()
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= PreviousVersionTTL, "previous snapshot keys expire")
+
+	// Readers with another client resolve the current version
+	reader, err := NewClient(logger, cfg.RedisURL)
+	require.NoError(t, err)
+	defer reader.Close()
+	_, err = reader.GetSymbolExchange(ctx, data.Instruments[1].Symbol, data.Instruments[1].Exchange)
+	assert.NoError(t, err)
+}
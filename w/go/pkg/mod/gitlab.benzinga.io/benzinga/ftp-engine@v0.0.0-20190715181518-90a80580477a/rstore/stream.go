@@ -0,0 +1,214 @@
+package rstore
+
+import (
+	"context"
+
+	"github.com/go-redis/redis"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tlog "github.com/opentracing/opentracing-go/log"
+	otredis "github.com/smacker/opentracing-go-redis"
+	"github.com/vmihailenco/msgpack"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+var _ = StreamLoader(&Client{}) // check interface
+
+// StreamLoader is implemented by stores that can load a snapshot in batches, so the instruments do not have to
+// be in memory at once
+type StreamLoader interface {
+	// BeginLoad starts a snapshot, readers see the previous instruments until it is committed
+	BeginLoad(ctx context.Context) (SnapshotWriter, error)
+}
+
+// SnapshotWriter writes the instruments of a snapshot in batches, like Loader.Load the snapshot replaces every
+// instrument
+type SnapshotWriter interface {
+	Write(ctx context.Context, instruments []reference.Instrument) error
+	// Commit points readers to the snapshot
+	Commit(ctx context.Context) error
+	// Abort deletes the snapshot, readers keep the previous instruments
+	Abort(ctx context.Context) error
+}
+
+// snapshotWriter writes a Redis snapshot version, keys are found by their version prefix so none are kept in
+// memory
+type snapshotWriter struct {
+	c        *Client
+	logger   *zap.Logger
+	previous int64
+	version  int64
+	count    int
+}
+
+// BeginLoad starts a new snapshot version, keys written expire after LoadingVersionTTL unless the snapshot is
+// committed. See Load.
+func (c *Client) BeginLoad(ctx context.Context) (SnapshotWriter, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.BeginLoad")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+
+	client := otredis.WrapRedisClient(subCtx, c.client)
+
+	previous, err := getVersion(client)
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		c.logger.Error("Redis Get Snapshot Version Error", zap.Error(err))
+		return nil, err
+	}
+	version, err := client.Incr(versionCounterKey).Result()
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		c.logger.Error("Redis New Snapshot Version Error", zap.Error(err))
+		return nil, err
+	}
+	span.LogFields(tlog.Int64("version", version), tlog.Int64("previous_version", previous))
+
+	return &snapshotWriter{
+		c:        c,
+		logger:   c.logger.With(zap.Int64("version", version), zap.Int64("previous_version", previous)),
+		previous: previous,
+		version:  version,
+	}, nil
+}
+
+func (w *snapshotWriter) fail(span opentracing.Span, msg string, err error) error {
+	span.LogFields(tlog.Error(err))
+	ext.Error.Set(span, true)
+	w.logger.Error(msg, zap.Error(err))
+	return err
+}
+
+// Write the instruments with a pipeline, later instruments replace earlier instruments of the same symbol and
+// identifiers are indexed to the first instrument
+func (w *snapshotWriter) Write(ctx context.Context, instruments []reference.Instrument) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.SnapshotWrite")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+	span.LogFields(tlog.Int64("version", w.version), tlog.Int("count", len(instruments)))
+
+	client := otredis.WrapRedisClient(subCtx, w.c.client)
+	prefix := versionPrefix(w.version)
+
+	if _, err := client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i := range instruments {
+			val, err := msgpack.Marshal(&instruments[i])
+			if err != nil {
+				return err
+			}
+			for _, key := range symbolKeys(&instruments[i]) {
+				pipe.Set(prefix+key, val, LoadingVersionTTL)
+			}
+			for _, key := range identifierKeys(&instruments[i]) {
+				pipe.SetNX(prefix+key, val, LoadingVersionTTL)
+			}
+		}
+		return nil
+	}); err != nil {
+		return w.fail(span, "Redis Write Snapshot Error", err)
+	}
+
+	w.count += len(instruments)
+	return nil
+}
+
+// Commit writes the History of every symbol to the snapshot, persists it and points readers to it, unless
+// another snapshot was loaded since BeginLoad. Then the previous version expires.
+func (w *snapshotWriter) Commit(ctx context.Context) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.SnapshotCommit")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+	span.LogFields(tlog.Int64("version", w.version), tlog.Int("count", w.count))
+
+	client := otredis.WrapRedisClient(subCtx, w.c.client)
+
+	// Record symbol changes, readers see the histories with the snapshot
+	updated, err := w.c.copyHistory(client, w.previous, w.version, now())
+	if err != nil {
+		w.deleteKeys(client)
+		return w.fail(span, "Redis Update History Error", err)
+	}
+	w.logger.Debug("History Updated", zap.Int("symbols", updated))
+
+	// Keep the complete snapshot
+	if err := scanKeys(client, versionPrefix(w.version)+"*", func(keys []string) error {
+		return pipelineKeys(client, keys, func(pipe redis.Pipeliner, key string) { pipe.Persist(key) })
+	}); err != nil {
+		w.deleteKeys(client)
+		return w.fail(span, "Redis Persist Snapshot Error", err)
+	}
+
+	// Point readers to the snapshot, unless another snapshot was loaded meanwhile
+	var generation *redis.IntCmd
+	err = client.Watch(func(tx *redis.Tx) error {
+		current, err := getVersion(tx)
+		if err != nil {
+			return err
+		}
+		if current != w.previous {
+			return ErrSnapshotConflict
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(currentVersionKey, w.version, 0)
+			generation = pipe.Incr(generationKey)
+			return nil
+		})
+		return err
+	}, currentVersionKey)
+	if err != nil {
+		w.deleteKeys(client)
+		return w.fail(span, "Redis Flip Snapshot Error", err)
+	}
+	w.c.setCurrentVersion(w.version, generation.Val())
+	w.c.loaded = w.version
+	w.logger.Info("Snapshot Loaded", zap.Int("count", w.count))
+
+	// Expire the previous snapshot, it is no longer used once cached versions expire
+	expired, err := w.c.expireVersion(client, w.previous)
+	if err != nil {
+		// The snapshot is loaded, previous keys are expired by the next load
+		w.logger.Error("Redis Expire Previous Snapshot Error", zap.Error(err))
+		return nil
+	}
+	w.logger.Debug("Previous Snapshot Expired", zap.Int("keys", expired))
+
+	// Histories written before versioned histories were copied to the snapshot
+	if expired, err := expireKeys(client, legacyHistoryPrefix+"*"); err != nil {
+		w.logger.Error("Redis Expire Legacy History Error", zap.Error(err))
+	} else if expired > 0 {
+		w.logger.Debug("Legacy History Expired", zap.Int("keys", expired))
+	}
+
+	return nil
+}
+
+// Abort deletes the keys written
+func (w *snapshotWriter) Abort(ctx context.Context) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.SnapshotAbort")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
+	span.LogFields(tlog.Int64("version", w.version), tlog.Int("count", w.count))
+
+	w.logger.Warn("Snapshot Aborted", zap.Int("count", w.count))
+	if err := w.deleteKeys(otredis.WrapRedisClient(subCtx, w.c.client)); err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		return err
+	}
+	return nil
+}
+
+// deleteKeys deletes the keys of the version, keys not deleted expire after LoadingVersionTTL
+func (w *snapshotWriter) deleteKeys(client *redis.Client) error {
+	if err := scanKeys(client, versionPrefix(w.version)+"*", func(keys []string) error {
+		return pipelineKeys(client, keys, func(pipe redis.Pipeliner, key string) { pipe.Del(key) })
+	}); err != nil {
+		w.logger.Error("Redis Delete Snapshot Error", zap.Error(err))
+		return err
+	}
+	return nil
+}
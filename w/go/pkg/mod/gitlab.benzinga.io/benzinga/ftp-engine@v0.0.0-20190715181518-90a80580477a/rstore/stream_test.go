@@ -0,0 +1,59 @@
+package rstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+func TestBeginLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires docker-compose services, see make deps")
+	}
+
+	cfg, err := config.LoadConfig("test")
+	require.NoError(t, err)
+
+	c, err := NewClient(zap.NewNop(), cfg.RedisURL)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Load(ctx, []reference.Instrument{{Symbol: "STREAM-F", CurrencyID: "USD", Exchange: "NYSE"}}))
+
+	// Aborted snapshots are not seen by readers
+	w, err := c.BeginLoad(ctx)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(ctx, []reference.Instrument{{Symbol: "STREAM-AAPL", CurrencyID: "USD", Exchange: "NASDAQ"}}))
+	require.NoError(t, w.Abort(ctx))
+	_, err = c.GetSymbolExchange(ctx, "STREAM-AAPL", "NASDAQ")
+	assert.Equal(t, redis.Nil, err)
+
+	w, err = c.BeginLoad(ctx)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(ctx, []reference.Instrument{{Symbol: "STREAM-AAPL", CurrencyID: "USD", Exchange: "NASDAQ", ISIN: "US0378331005"}}))
+	require.NoError(t, w.Write(ctx, []reference.Instrument{{Symbol: "STREAM-META", CurrencyID: "USD", Exchange: "NASDAQ"}}))
+	_, err = c.GetSymbolExchange(ctx, "STREAM-META", "NASDAQ")
+	assert.Equal(t, redis.Nil, err, "not committed")
+	require.NoError(t, w.Commit(ctx))
+
+	_, err = c.GetSymbolExchange(ctx, "STREAM-META", "NASDAQ")
+	assert.NoError(t, err)
+	_, err = c.GetIdentifier(ctx, ISIN, "US0378331005")
+	assert.NoError(t, err)
+	_, err = c.GetSymbolExchange(ctx, "STREAM-F", "NYSE")
+	assert.Equal(t, redis.Nil, err, "snapshots replace every instrument")
+
+	// Snapshots loaded meanwhile are not replaced
+	w, err = c.BeginLoad(ctx)
+	require.NoError(t, err)
+	require.NoError(t, c.Load(ctx, []reference.Instrument{{Symbol: "STREAM-F", CurrencyID: "USD", Exchange: "NYSE"}}))
+	assert.Equal(t, ErrSnapshotConflict, w.Commit(ctx))
+}
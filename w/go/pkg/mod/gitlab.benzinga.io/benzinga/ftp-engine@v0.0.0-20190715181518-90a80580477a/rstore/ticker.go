@@ -3,7 +3,9 @@ package rstore
 import (
 	"context"
 	"strings"
+	"time"
 
+	"github.com/go-redis/redis"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	tlog "github.com/opentracing/opentracing-go/log"
@@ -14,30 +16,70 @@ import (
 	"gitlab.benzinga.io/benzinga/reference-service/reference"
 )
 
+// symbolExchangeKey is the instrument key of symbol on exchange, Redis keys are prefixed with the snapshot version
 func symbolExchangeKey(symbol, exchange string) string {
-	return strings.ToUpper(strings.Join([]string{ftpEnginePrefix, "symbol-exchange", symbol, exchange}, ":"))
+	return strings.ToUpper(strings.Join([]string{"symbol-exchange", symbol, exchange}, ":"))
 }
 
+// symbolCurrencyKey is the instrument key of symbol in currency, Redis keys are prefixed with the snapshot version
 func symbolCurrencyKey(symbol, currency string) string {
-	return strings.ToUpper(strings.Join([]string{ftpEnginePrefix, "symbol-currency", symbol, currency}, ":"))
+	return strings.ToUpper(strings.Join([]string{"symbol-currency", symbol, currency}, ":"))
 }
 
+// GetSymbolExchange ...
 func (c *Client) GetSymbolExchange(ctx context.Context, symbol, exchange string) (*reference.Instrument, error) {
 	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.GetSymbolExchange")
 	defer span.Finish()
+
+	logger := c.logger.With(zap.String("symbol", symbol), zap.String("exchange", exchange))
+	return c.getInstrument(subCtx, span, logger, "GetSymbolExchange", "symbol_exchange", symbolExchangeKey(symbol, exchange))
+}
+
+// GetSymbolCurrency ...
+func (c *Client) GetSymbolCurrency(ctx context.Context, symbol, currency string) (*reference.Instrument, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.GetSymbolCurrency")
+	defer span.Finish()
+
+	logger := c.logger.With(zap.String("symbol", symbol), zap.String("currency", currency))
+	return c.getInstrument(subCtx, span, logger, "GetSymbolCurrency", "symbol_currency", symbolCurrencyKey(symbol, currency))
+}
+
+// getInstrument gets key of the current snapshot, from the cache if enabled. Keys not found are cached, the
+// redis.Nil error is returned for them.
+func (c *Client) getInstrument(ctx context.Context, span opentracing.Span, logger *zap.Logger, name, lookup, key string) (*reference.Instrument, error) {
 	ext.DBType.Set(span, "redis")
 
-	key := symbolExchangeKey(symbol, exchange)
-	span.LogFields(tlog.String("key", key))
+	client := otredis.WrapRedisClient(ctx, c.client)
+	version, generation, err := c.currentVersion(client)
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		logger.Error("Redis "+name+" Version Error", zap.Error(err))
+		return nil, err
+	}
+	redisKey := versionPrefix(version) + key
+	span.LogFields(tlog.String("key", redisKey))
+	logger = logger.With(zap.String("key", redisKey))
 
-	logger := c.logger.With(zap.String("symbol", symbol), zap.String("exchange", exchange), zap.String("key", key))
+	if c.cache != nil {
+		if value, ok := c.cache.get(generation, lookup, key); ok {
+			span.LogFields(tlog.Bool("cached", true))
+			if value == nil {
+				return nil, redis.Nil
+			}
+			instr := *value.(*reference.Instrument)
+			return &instr, nil
+		}
+	}
 
-	client := otredis.WrapRedisClient(subCtx, c.client)
-	res, err := client.Get(key).Bytes()
+	res, err := client.Get(redisKey).Bytes()
+	if err == redis.Nil && c.cache != nil {
+		c.cache.add(generation, key, nil)
+	}
 	if err != nil {
 		span.LogFields(tlog.Error(err))
 		ext.Error.Set(span, true)
-		logger.Error("Redis GetSymbolExchange Error", zap.Error(err))
+		logger.Error("Redis "+name+" Error", zap.Error(err))
 		return nil, err
 	}
 
@@ -45,49 +87,133 @@ func (c *Client) GetSymbolExchange(ctx context.Context, symbol, exchange string)
 	if err := msgpack.Unmarshal(res, &instr); err != nil {
 		span.LogFields(tlog.Error(err))
 		ext.Error.Set(span, true)
-		logger.Error("GetSymbolExchange Unmarshal Error", zap.Error(err))
+		logger.Error(name+" Unmarshal Error", zap.Error(err))
 		return nil, err
 	}
 
+	if c.cache != nil {
+		cached := instr
+		c.cache.add(generation, key, &cached)
+	}
 	return &instr, nil
 }
 
-func (c *Client) GetSymbolCurrency(ctx context.Context, symbol, currency string) (*reference.Instrument, error) {
-	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.GetSymbolCurrency")
+// GetSymbolExchangeAt ...
+func (c *Client) GetSymbolExchangeAt(ctx context.Context, symbol, exchange string, t time.Time) (*reference.Instrument, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.GetSymbolExchangeAt")
 	defer span.Finish()
-	ext.DBType.Set(span, "redis")
 
-	key := symbolCurrencyKey(symbol, currency)
-	span.LogFields(tlog.String("key", key))
+	h, err := c.getHistory(subCtx, symbolExchangeKey(symbol, exchange))
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		return nil, err
+	}
+	// Without history, or after its last change, the current instrument is used
+	if h == nil || !t.Before(h.Changed()) {
+		return c.GetSymbolExchange(subCtx, symbol, exchange)
+	}
+
+	instr, ok := h.At(t)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return instr, nil
+}
+
+// GetSymbolCurrencyAt ...
+func (c *Client) GetSymbolCurrencyAt(ctx context.Context, symbol, currency string, t time.Time) (*reference.Instrument, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.GetSymbolCurrencyAt")
+	defer span.Finish()
+
+	h, err := c.getHistory(subCtx, symbolCurrencyKey(symbol, currency))
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		return nil, err
+	}
+	// Without history, or after its last change, the current instrument is used
+	if h == nil || !t.Before(h.Changed()) {
+		return c.GetSymbolCurrency(subCtx, symbol, currency)
+	}
+
+	instr, ok := h.At(t)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return instr, nil
+}
 
-	logger := c.logger.With(zap.String("symbol", symbol), zap.String("currency", currency), zap.String("key", key))
+// getHistory returns the history of key in the current snapshot, nil if the key has no history. Histories
+// change with the snapshot generation, so they are cached by generation.
+func (c *Client) getHistory(ctx context.Context, key string) (History, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.getHistory")
+	defer span.Finish()
+	ext.DBType.Set(span, "redis")
 
 	client := otredis.WrapRedisClient(subCtx, c.client)
-	res, err := client.Get(key).Bytes()
+
+	version, generation, err := c.currentVersion(client)
 	if err != nil {
 		span.LogFields(tlog.Error(err))
 		ext.Error.Set(span, true)
-		logger.Error("Redis GetSymbolCurrency Error", zap.Error(err))
+		c.logger.Error("Redis Get History Version Error", zap.Error(err), zap.String("key", key))
 		return nil, err
 	}
+	span.LogFields(tlog.String("key", historyKey(version, key)))
 
-	var instr reference.Instrument
-	if err := msgpack.Unmarshal(res, &instr); err != nil {
+	if c.cache != nil {
+		if value, ok := c.cache.get(generation, "history", historyKey(version, key)); ok {
+			span.LogFields(tlog.Bool("cached", true))
+			if value == nil {
+				return nil, nil
+			}
+			return value.(History), nil
+		}
+	}
+
+	histories, err := readHistories(client, version, []string{key})
+	if err != nil {
 		span.LogFields(tlog.Error(err))
 		ext.Error.Set(span, true)
-		logger.Error("GetSymbolCurrency Unmarshal Error", zap.Error(err))
+		c.logger.Error("Redis Get History Error", zap.Error(err), zap.String("key", key))
 		return nil, err
 	}
+	h := histories[0]
 
-	return &instr, nil
+	if c.cache != nil {
+		if h == nil {
+			c.cache.add(generation, historyKey(version, key), nil)
+		} else {
+			c.cache.add(generation, historyKey(version, key), h)
+		}
+	}
+	return h, nil
 }
 
+// GetIdentifier looks up the instrument by identifier in the current snapshot
+func (c *Client) GetIdentifier(ctx context.Context, idType IdentifierType, id string) (*reference.Instrument, error) {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.GetIdentifier")
+	defer span.Finish()
+
+	logger := c.logger.With(zap.Stringer("identifier_type", idType), zap.String("identifier", id))
+	return c.getInstrument(subCtx, span, logger, "GetIdentifier", "identifier", identifierKey(idType, id))
+}
+
+// PutSymbolCurrency writes the instrument to the current snapshot, Load replaces the snapshot
 func (c *Client) PutSymbolCurrency(ctx context.Context, inst *reference.Instrument) error {
 	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.PutSymbolCurrency")
 	defer span.Finish()
 	ext.DBType.Set(span, "redis")
 
-	key := symbolCurrencyKey(inst.Symbol, inst.CurrencyID)
+	client := otredis.WrapRedisClient(subCtx, c.client)
+	key, err := c.versionKey(client, symbolCurrencyKey(inst.Symbol, inst.CurrencyID))
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		c.logger.Error("Redis PutSymbolCurrency Version Error", zap.Error(err))
+		return err
+	}
 	span.LogFields(tlog.String("key", key))
 
 	val, err := msgpack.Marshal(&inst)
@@ -98,22 +224,32 @@ func (c *Client) PutSymbolCurrency(ctx context.Context, inst *reference.Instrume
 		return err
 	}
 
-	client := otredis.WrapRedisClient(subCtx, c.client)
 	if err := client.Set(key, val, 0).Err(); err != nil {
 		span.LogFields(tlog.Error(err))
 		ext.Error.Set(span, true)
 		c.logger.Error("Redis PutSymbolCurrency Set Error", zap.Error(err))
 		return err
 	}
+	if c.cache != nil {
+		c.cache.remove(symbolCurrencyKey(inst.Symbol, inst.CurrencyID))
+	}
 	return nil
 }
 
+// PutSymbolExchange writes the instrument to the current snapshot, Load replaces the snapshot
 func (c *Client) PutSymbolExchange(ctx context.Context, inst *reference.Instrument) error {
 	span, subCtx := opentracing.StartSpanFromContext(ctx, "redis.PutSymbolExchange")
 	defer span.Finish()
 	ext.DBType.Set(span, "redis")
 
-	key := symbolExchangeKey(inst.Symbol, inst.Exchange)
+	client := otredis.WrapRedisClient(subCtx, c.client)
+	key, err := c.versionKey(client, symbolExchangeKey(inst.Symbol, inst.Exchange))
+	if err != nil {
+		span.LogFields(tlog.Error(err))
+		ext.Error.Set(span, true)
+		c.logger.Error("Redis PutSymbolExchange Version Error", zap.Error(err))
+		return err
+	}
 	span.LogFields(tlog.String("key", key))
 
 	val, err := msgpack.Marshal(&inst)
@@ -124,12 +260,14 @@ func (c *Client) PutSymbolExchange(ctx context.Context, inst *reference.Instrume
 		return err
 	}
 
-	client := otredis.WrapRedisClient(subCtx, c.client)
 	if err := client.Set(key, val, 0).Err(); err != nil {
 		span.LogFields(tlog.Error(err))
 		ext.Error.Set(span, true)
 		c.logger.Error("Redis PutSymbolExchange Set Error", zap.Error(err))
 		return err
 	}
+	if c.cache != nil {
+		c.cache.remove(symbolExchangeKey(inst.Symbol, inst.Exchange))
+	}
 	return nil
 }
@@ -3,9 +3,9 @@ package ftp
 import (
 	"bytes"
 	"context"
+	"net"
 	"path"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/eapache/go-resiliency/retrier"
@@ -21,14 +21,15 @@ import (
 )
 
 type Sender struct {
-	sync.Mutex
-	cfg   *config.Config
-	log   *zap.Logger
-	conn  *ftp.ServerConn
-	retry *retrier.Retrier
+	cfg     *config.Config
+	log     *zap.Logger
+	conn    *ftp.ServerConn
+	netConn net.Conn // control connection of conn, used to bound status checks
+	retry   *retrier.Retrier
+	busy    chan struct{}
 }
 
-// re: sync.Mutex, some FTP servers do not allow sending commands via control channel with transfer in progress on same connection
+// re: busy, some FTP servers do not allow sending commands via control channel with transfer in progress on same connection
 // so we will delay status checks until transfers complete
 
 var _ = sender.Sender(&Sender{}) // check interface
@@ -38,8 +39,9 @@ const testFilename = ".bztest"
 func NewFTPSender(cfg *config.Config, logger *zap.Logger) (*Sender, error) {
 
 	s := Sender{
-		log: logger.Named("ftp"),
-		cfg: cfg,
+		log:  logger.Named("ftp"),
+		cfg:  cfg,
+		busy: make(chan struct{}, 1),
 	}
 
 	// Configure Retrier
@@ -47,19 +49,11 @@ func NewFTPSender(cfg *config.Config, logger *zap.Logger) (*Sender, error) {
 		s.retry = retrier.New(retrier.ExponentialBackoff(cfg.FTP.SendRetires, 500*time.Millisecond), nil)
 	}
 
-	// Start New Connection
+	// Start New Connection & Login
 	if err := s.connect(); err != nil {
 		return nil, err
 	}
 
-	// Login
-	if err := s.login(); err != nil {
-		if quitErr := s.conn.Quit(); quitErr != nil {
-			logger.Error("Quit Connection Error", zap.Error(err))
-		}
-		return nil, err
-	}
-
 	// Check Path Writeable
 	if err := s.checkPath(); err != nil {
 		if quitErr := s.conn.Quit(); quitErr != nil {
@@ -87,11 +81,12 @@ func (s *Sender) Send(ctx context.Context, data *process.Output) error {
 	defer span.Finish()
 
 	// Use Retrier if configured
-	s.Lock()
-	defer s.Unlock()
+	s.lock()
+	defer s.unlock()
 	if s.retry != nil {
 
 		err := s.retry.RunCtx(subCtx, func(ctx context.Context) error {
+			data.Attempts++
 			if storErr := s.conn.Stor(data.Filename, data.Data); storErr != nil {
 				s.log.Error("FTP Write Error, will retry.", zap.String("filename", data.Filename))
 				span.LogFields(otlog.Error(storErr))
@@ -112,20 +107,24 @@ func (s *Sender) Send(ctx context.Context, data *process.Output) error {
 			return err
 		}
 
-	} else if err := s.conn.Stor(data.Filename, data.Data); err != nil {
-		s.log.Error("FTP Write Error", zap.String("filename", data.Filename))
-		span.LogFields(otlog.Error(err))
+	} else {
+		data.Attempts++
+		if err := s.conn.Stor(data.Filename, data.Data); err != nil {
+			s.log.Error("FTP Write Error", zap.String("filename", data.Filename))
+			span.LogFields(otlog.Error(err))
 
-		if strings.Contains(err.Error(), "broken pipe") {
-			if reconnectErr := s.reconnect(); reconnectErr != nil {
-				s.log.Fatal("FTP reconnect error", zap.Error(reconnectErr))
+			if strings.Contains(err.Error(), "broken pipe") {
+				if reconnectErr := s.reconnect(); reconnectErr != nil {
+					s.log.Fatal("FTP reconnect error", zap.Error(reconnectErr))
+				}
 			}
-		}
 
-		return err
+			return err
+		}
 	}
 
-	s.log.Info("FTP Write Success", zap.String("host", s.cfg.FTP.Host), zap.String("filename", data.Filename))
+	span.LogFields(otlog.Int("attempts", data.Attempts))
+	s.log.Info("FTP Write Success", zap.String("host", s.cfg.FTP.Host), zap.String("filename", data.Filename), zap.Int("attempts", data.Attempts))
 	return nil
 }
 
@@ -155,13 +154,13 @@ func (s *Sender) startKeepAlive() {
 	for {
 		select {
 		case <-ticker.C:
-			s.Lock()
+			s.lock()
 			if err := s.conn.NoOp(); err != nil {
 				s.log.Error("keepalive NoOp Error", zap.Error(err))
 			} else {
 				s.log.Debug("keepalive NoOp Success")
 			}
-			s.Unlock()
+			s.unlock()
 		}
 	}
 
@@ -175,18 +174,45 @@ func (s *Sender) login() error {
 	return nil
 }
 
-func (s *Sender) Status() error {
-
-	s.Lock()
-	defer s.Unlock()
+// Status sends a NOOP once any transfer in progress completes, it fails once ctx is done. The connection is
+// reconnected after an error, a late reply would otherwise be read as the reply to the next command
+func (s *Sender) Status(ctx context.Context) error {
+	select {
+	case s.busy <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer s.unlock()
 
-	if err := s.conn.NoOp(); err != nil {
+	if err := s.noOp(ctx); err != nil {
 		s.log.Error("FTP NoOp Error", zap.Error(err))
+		if reconnectErr := s.reconnect(); reconnectErr != nil {
+			s.log.Error("Status - Reconnect - Error", zap.Error(reconnectErr))
+		}
 		return err
 	}
 	return nil
 }
 
+// noOp sends a NOOP, the reply must be received before the ctx deadline
+func (s *Sender) noOp(ctx context.Context) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := s.netConn.SetDeadline(deadline); err != nil {
+			return err
+		}
+		defer s.netConn.SetDeadline(time.Time{})
+	}
+	return s.conn.NoOp()
+}
+
+func (s *Sender) lock() {
+	s.busy <- struct{}{}
+}
+
+func (s *Sender) unlock() {
+	<-s.busy
+}
+
 func (s *Sender) Close() error {
 	if err := s.conn.Logout(); err != nil {
 		s.log.Error("Logout Error", zap.Error(err))
@@ -202,24 +228,39 @@ func (s *Sender) reconnect() error {
 		s.log.Error("Reconnect - Connect - Error", zap.Error(err))
 		return err
 	}
-	if err := s.login(); err != nil {
-		s.log.Error("Reconnect - Login - Error", zap.Error(err))
-		return err
-	}
 	return nil
 }
 
+// connect dials the server and logs in, the greeting and login must complete within the connect timeout
 func (s *Sender) connect() error {
 	s.log.Info("Connecting FTP Client", zap.String("addr", s.cfg.FTP.Host))
 
-	ftpConn, err := ftp.DialTimeout(s.cfg.FTP.Host, 5*time.Second) // TODO(darwin): use timeout from config
+	netConn, err := net.DialTimeout("tcp", s.cfg.FTP.Host, s.cfg.FTP.ConnTimeout)
+	if err != nil {
+		return err
+	}
+	if err := netConn.SetDeadline(time.Now().Add(s.cfg.FTP.ConnTimeout)); err != nil {
+		netConn.Close()
+		return err
+	}
+
+	ftpConn, err := ftp.Dial(s.cfg.FTP.Host, ftp.DialWithNetConn(netConn), ftp.DialWithTimeout(s.cfg.FTP.ConnTimeout))
 	if err != nil {
+		netConn.Close()
 		return err
 	}
 
 	s.conn = ftpConn
+	s.netConn = netConn
 
-	return nil
+	if err := s.login(); err != nil {
+		if quitErr := s.conn.Quit(); quitErr != nil {
+			s.log.Error("Quit Connection Error", zap.Error(quitErr))
+		}
+		return err
+	}
+
+	return netConn.SetDeadline(time.Time{})
 }
 
 func (s *Sender) disconnect() error {
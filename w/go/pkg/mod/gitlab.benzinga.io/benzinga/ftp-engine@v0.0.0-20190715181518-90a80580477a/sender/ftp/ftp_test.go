@@ -1,11 +1,17 @@
 package ftp
 
 import (
+	"bufio"
+	"context"
+	"net"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 
 	filedriver "github.com/goftp/file-driver"
 	"github.com/goftp/server"
@@ -51,8 +57,81 @@ func TestFTP(t *testing.T) {
 	defer s.Close()
 
 	// Test Status
-	assert.NoError(t, s.Status())
+	assert.NoError(t, s.Status(context.Background()))
 
 	// Test checkPath
 	assert.NoError(t, s.checkPath(), "checkPath tests FTP directory writeable")
 }
+
+// startHungServer starts a server never replying to NOOP, each accepted connection is sent on the returned channel
+func startHungServer(t *testing.T) (net.Listener, <-chan net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				_, _ = conn.Write([]byte("220 Ready\r\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch {
+					case strings.HasPrefix(line, "NOOP"):
+					case strings.HasPrefix(line, "USER"):
+						_, _ = conn.Write([]byte("331 Password Required\r\n"))
+					case strings.HasPrefix(line, "PASS"):
+						_, _ = conn.Write([]byte("230 Logged In\r\n"))
+					case strings.HasPrefix(line, "FEAT"):
+						_, _ = conn.Write([]byte("502 Not Implemented\r\n"))
+					default:
+						_, _ = conn.Write([]byte("200 OK\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+
+	return l, conns
+}
+
+func TestFTPStatusTimeout(t *testing.T) {
+	cfg, err := config.LoadConfig("testing")
+	require.NoError(t, err)
+
+	l, conns := startHungServer(t)
+	defer l.Close()
+	cfg.FTP.Host = l.Addr().String()
+	cfg.FTP.ConnTimeout = time.Second
+
+	s := &Sender{cfg: cfg, log: zap.NewNop(), busy: make(chan struct{}, 1)}
+	require.NoError(t, s.connect())
+	<-conns
+
+	// The NOOP is not replied, Status returns at the deadline and reconnects
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, s.Status(ctx))
+	assert.True(t, time.Since(start) < time.Second, "status returns at the ctx deadline")
+	select {
+	case <-conns:
+	case <-time.After(time.Second):
+		assert.Fail(t, "status reconnects after a timeout")
+	}
+
+	// A transfer in progress, Status does not wait past ctx
+	s.lock()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Status(ctx))
+	s.unlock()
+}
@@ -0,0 +1,75 @@
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender"
+)
+
+// Sender writes output to a local directory instead of a destination, used for dry runs
+type Sender struct {
+	log  *zap.Logger
+	path string
+}
+
+var _ = sender.Sender(&Sender{}) // check interface
+
+// NewLocalSender returns a Sender writing to path, the directory is created if it does not exist
+func NewLocalSender(path string, logger *zap.Logger) (*Sender, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	s := Sender{
+		log:  logger.Named("local"),
+		path: path,
+	}
+
+	if err := s.Status(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *Sender) Send(ctx context.Context, data *process.Output) error {
+	span, _ := opentracing.StartSpanFromContext(ctx, "Local Send")
+	span.LogFields(otlog.String("file.name", data.Filename), otlog.String("path", s.path))
+	defer span.Finish()
+
+	data.Attempts++
+	filename := filepath.Join(s.path, filepath.Base(data.Filename))
+	if err := ioutil.WriteFile(filename, data.Data.Bytes(), 0644); err != nil {
+		s.log.Error("Local Write Error", zap.Error(err), zap.String("filename", filename))
+		span.LogFields(otlog.Error(err))
+		return err
+	}
+
+	s.log.Info("Local Write Success", zap.String("filename", filename), zap.Int("size", data.Data.Len()))
+	return nil
+}
+
+// Status checks the path is a writeable directory
+func (s *Sender) Status(ctx context.Context) error {
+	f, err := ioutil.TempFile(s.path, ".bztest")
+	if err != nil {
+		s.log.Error("Create Test File Error", zap.Error(err), zap.String("path", s.path))
+		return err
+	}
+	if err := f.Close(); err != nil {
+		s.log.Error("Close Test File Error", zap.Error(err))
+	}
+	return os.Remove(f.Name())
+}
+
+func (s *Sender) Close() error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+)
+
+func TestLocalSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-engine-local")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewLocalSender(filepath.Join(dir, "out"), zap.NewNop())
+	require.NoError(t, err)
+	assert.NoError(t, s.Status(context.Background()))
+
+	o := &process.Output{Filename: "12345.xml", Data: bytes.NewBufferString("<xml/>")}
+	require.NoError(t, s.Send(context.Background(), o))
+	assert.Equal(t, 1, o.Attempts)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "out", "12345.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "<xml/>", string(data))
+
+	assert.NoError(t, s.Close())
+}
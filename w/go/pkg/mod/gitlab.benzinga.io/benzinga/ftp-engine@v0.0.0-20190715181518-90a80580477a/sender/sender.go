@@ -9,6 +9,7 @@ import (
 // Sender describes a data sender
 type Sender interface {
 	Send(ctx context.Context, data *process.Output) error
-	Status() error
+	// Status checks the destination is reachable, it fails once ctx is done
+	Status(ctx context.Context) error
 	Close() error
 }
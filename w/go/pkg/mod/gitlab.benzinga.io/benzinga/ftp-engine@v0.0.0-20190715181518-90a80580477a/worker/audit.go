@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Stage of handling a message
+type Stage string
+
+const (
+	// EnvelopeStage unmarshals the envelope and checks its message type
+	EnvelopeStage Stage = "envelope"
+	// SignatureStage verifies the envelope signature
+	SignatureStage Stage = "signature"
+	// DecodeStage decodes the event of the envelope
+	DecodeStage Stage = "decode"
+	// FilterStage applies the processor filters
+	FilterStage Stage = "filter"
+	// ConvertStage converts the event to the output file
+	ConvertStage Stage = "convert"
+	// SendStage sends the output file to the destination
+	SendStage Stage = "send"
+	// RecordStage publishes the delivery record
+	RecordStage Stage = "record"
+	// AckStage acknowledges the message to the source
+	AckStage Stage = "ack"
+)
+
+// Outcome of a stage
+type Outcome string
+
+const (
+	// OK stages passed the message to the next stage
+	OK Outcome = "ok"
+	// Reject stages stopped the message, see StageResult Reason
+	Reject Outcome = "rejected"
+	// Error stages failed, see StageResult Error
+	Error Outcome = "error"
+)
+
+// Rejection and invalid message reasons of the pipeline, signature and filter reasons are returned by
+// VerifyEnvelope and process.Filter
+const (
+	// InvalidEnvelopeReason is the reason of messages that are not a JSON envelope
+	InvalidEnvelopeReason = "invalid_envelope"
+	// InvalidMessageTypeReason is the reason of envelopes that are not events
+	InvalidMessageTypeReason = "invalid_evenlope_message_type"
+	// InvalidEventReason is the reason of envelopes with an event that could not be decoded
+	InvalidEventReason = "invalid_event"
+)
+
+// StageResult is the outcome of a stage
+type StageResult struct {
+	Stage    Stage         `json:"stage"`
+	Outcome  Outcome       `json:"outcome"`
+	Reason   string        `json:"reason,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// MarshalLogObject ...
+func (s StageResult) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("stage", string(s.Stage))
+	enc.AddString("outcome", string(s.Outcome))
+	if s.Reason != "" {
+		enc.AddString("reason", s.Reason)
+	}
+	if s.Error != "" {
+		enc.AddString("error", s.Error)
+	}
+	enc.AddDuration("duration", s.Duration)
+	return nil
+}
+
+type stageResults []StageResult
+
+// MarshalLogArray ...
+func (s stageResults) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, stage := range s {
+		if err := enc.AppendObject(stage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuditRecord is the outcome of each stage of handling a message, so why a story was or was not sent can be
+// reconstructed. Fields of stages the message did not reach are empty.
+type AuditRecord struct {
+	EnvelopeID  string `json:"envelope_id,omitempty"`
+	EventID     int64  `json:"event_id,omitempty"`
+	NodeID      int64  `json:"node_id,omitempty"`
+	EventType   string `json:"event_type,omitempty"`
+	GroupID     string `json:"kafka_group_id"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Status      Status `json:"status"`
+	// Reason is the reason of rejected and invalid messages
+	Reason   string        `json:"reason,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Filename string        `json:"filename,omitempty"`
+	Stages   []StageResult `json:"stages"`
+	Received time.Time     `json:"received"`
+	// Duration is the time from the message being received to being handled
+	Duration time.Duration `json:"duration"`
+}
+
+// MarshalLogObject ...
+func (r *AuditRecord) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("envelope_id", r.EnvelopeID)
+	enc.AddInt64("event_id", r.EventID)
+	enc.AddInt64("node_id", r.NodeID)
+	enc.AddString("event_type", r.EventType)
+	enc.AddString("kafka_group_id", r.GroupID)
+	enc.AddString("source", r.Source)
+	enc.AddString("destination", r.Destination)
+	enc.AddString("status", string(r.Status))
+	enc.AddString("reason", r.Reason)
+	enc.AddString("error", r.Error)
+	enc.AddString("filename", r.Filename)
+	enc.AddTime("received", r.Received)
+	enc.AddDuration("duration", r.Duration)
+	return enc.AddArray("stages", stageResults(r.Stages))
+}
+
+// Auditor publishes audit records, see kafka.AuditWriter
+type Auditor interface {
+	Audit(ctx context.Context, r *AuditRecord) error
+}
+
+// stage adds the result of the stage started at start
+func (r *AuditRecord) stage(stage Stage, start time.Time, outcome Outcome, reason string, err error) {
+	result := StageResult{Stage: stage, Outcome: outcome, Reason: reason, Duration: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	r.Stages = append(r.Stages, result)
+}
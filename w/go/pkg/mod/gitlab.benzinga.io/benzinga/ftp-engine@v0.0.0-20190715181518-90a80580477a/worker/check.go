@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"context"
+)
+
+// CheckStatus is the readiness of a dependency
+type CheckStatus string
+
+const (
+	// CheckOK dependencies are available
+	CheckOK CheckStatus = "ok"
+	// CheckDegraded dependencies are available with problems that do not stop delivery, ex. consumer lag
+	CheckDegraded CheckStatus = "degraded"
+	// CheckDown dependencies are not available, the worker can not deliver
+	CheckDown CheckStatus = "down"
+)
+
+// Check is the readiness of a dependency, Details are reported as is
+type Check struct {
+	Status  CheckStatus            `json:"status"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Checker is implemented by sources that report their readiness, see the Kafka Worker
+type Checker interface {
+	Check(ctx context.Context) Check
+}
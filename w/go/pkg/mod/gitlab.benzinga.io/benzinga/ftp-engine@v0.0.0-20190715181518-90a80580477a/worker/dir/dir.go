@@ -0,0 +1,227 @@
+package dir
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+)
+
+var _ = worker.Worker(&Worker{}) // check interface
+
+const (
+	// Source is the kafka_topic metric label of the dir source
+	Source = "dir"
+
+	jsonExt   = ".json"
+	jsonlExt  = ".jsonl"
+	doneExt   = ".done"
+	failedExt = ".failed"
+
+	// maxLineSize is the largest envelope read from a .jsonl file
+	maxLineSize = 100 << 20 // 100MB
+)
+
+// Worker reads envelopes from .json files, one envelope per file, and .jsonl files, one envelope per line, in
+// name order. Read files are renamed with a .done suffix. Envelopes that could not be decoded or sent are
+// appended to a .failed file of the same name, which can be renamed to .jsonl to retry them.
+type Worker struct {
+	log      *zap.Logger
+	cfg      *config.Config
+	pipeline *worker.Pipeline
+}
+
+// NewDirWorker reads cfg.Source.Path, which is a directory of envelope files or a single envelope file.
+// Delivery records are not published, deliveries are stored in h if not nil.
+func NewDirWorker(cfg *config.Config, logger *zap.Logger, inst *instr.Collector, s sender.Sender, p process.Processor, h worker.History) (*Worker, error) {
+	if _, err := os.Stat(cfg.Source.Path); err != nil {
+		return nil, err
+	}
+
+	workerLog := logger.Named("worker:dir")
+
+	pipe, err := worker.NewPipeline(cfg, workerLog, inst, s, p, nil, h, Source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Worker{workerLog, cfg, pipe}, nil
+}
+
+// Pipeline ...
+func (w *Worker) Pipeline() *worker.Pipeline {
+	return w.pipeline
+}
+
+// Work reads every file in the source path, then every poll interval until ctx is done. Work returns once the
+// files are read if no poll interval is configured.
+func (w *Worker) Work(ctx context.Context) {
+	for {
+		if err := w.ReadAll(ctx); err != nil {
+			w.log.Error("Read Source Path Error", zap.Error(err), zap.String("path", w.cfg.Source.Path))
+		}
+
+		if w.cfg.Source.PollInterval == 0 {
+			w.log.Info("Source Path Read")
+			return
+		}
+
+		select {
+		case <-time.After(w.cfg.Source.PollInterval):
+		case <-ctx.Done():
+			w.log.Info("Receiver Context Done")
+			return
+		}
+	}
+}
+
+// ReadAll reads the envelope files in the source path. A file interrupted by ctx is not renamed, so it is read
+// again from the start.
+func (w *Worker) ReadAll(ctx context.Context) error {
+	files, err := w.files()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.readFile(ctx, file); err != nil {
+			w.log.Error("Read Envelope File Error", zap.Error(err), zap.String("file", file))
+			continue
+		}
+		if ctx.Err() == nil {
+			if err := os.Rename(file, file+doneExt); err != nil {
+				w.log.Error("Rename Envelope File Error", zap.Error(err), zap.String("file", file))
+			}
+		}
+	}
+
+	return nil
+}
+
+// files returns the envelope files of the source path in name order
+func (w *Worker) files() ([]string, error) {
+	path := w.cfg.Source.Path
+	info, err := os.Stat(path)
+	if err != nil {
+		// A single file source is renamed once read
+		if os.IsNotExist(err) && isEnvelopeFile(path) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, f := range infos {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || !isEnvelopeFile(f.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(path, f.Name()))
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func isEnvelopeFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == jsonExt || ext == jsonlExt
+}
+
+func (w *Worker) readFile(ctx context.Context, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	fileLog := w.log.With(zap.String("file", file))
+	fileLog.Info("Reading Envelope File", zap.Int("size", len(data)))
+
+	var failed [][]byte
+	handle := func(value []byte, line int) {
+		// An envelope not handled because ctx is done while paused is read again, as the file is not renamed
+		if err := w.pipeline.WaitResumed(ctx); err != nil {
+			return
+		}
+		result := w.pipeline.Handle(ctx, "New File Message", &worker.Message{
+			Value:      value,
+			Received:   time.Now(),
+			Log:        fileLog.With(zap.Int("line", line)),
+			SpanFields: []otlog.Field{otlog.String("file", file), otlog.Int("line", line)},
+		})
+		if result.Status == worker.Invalid || result.Status == worker.Failed {
+			// Compacted so a failed .json envelope is a single .failed line
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, value); err == nil {
+				value = compact.Bytes()
+			}
+			failed = append(failed, value)
+		}
+	}
+
+	if filepath.Ext(file) == jsonExt {
+		handle(data, 1)
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+		for line := 1; scanner.Scan(); line++ {
+			if ctx.Err() != nil {
+				break
+			}
+			value := bytes.TrimSpace(scanner.Bytes())
+			if len(value) == 0 {
+				continue
+			}
+			// The scanner reuses its buffer
+			handle(append([]byte(nil), value...), line)
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	if len(failed) > 0 {
+		fileLog.Warn("Envelopes Failed", zap.Int("count", len(failed)), zap.String("failed_file", file+failedExt))
+		return appendLines(file+failedExt, failed)
+	}
+	return nil
+}
+
+func appendLines(file string, lines [][]byte) error {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
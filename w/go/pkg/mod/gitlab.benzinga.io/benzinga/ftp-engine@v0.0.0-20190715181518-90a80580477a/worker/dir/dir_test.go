@@ -0,0 +1,84 @@
+package dir
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+func TestDirWorker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-engine-source")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var events []*models.Event
+	envelope := func(enc bzkaf.Encoding) []byte {
+		event := workertest.NewEvent()
+		events = append(events, event)
+		e, err := worker.NewEventEnvelope(event, enc)
+		require.NoError(t, err)
+		data, err := e.Marshal()
+		require.NoError(t, err)
+		return data
+	}
+
+	var lines bytes.Buffer
+	lines.Write(envelope(bzkaf.JSONEncoding))
+	lines.WriteString("\n\nnot json\n")
+	lines.Write(envelope(bzkaf.LZ4MsgpackEncoding))
+	lines.WriteString("\n")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.jsonl"), lines.Bytes(), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.json"), envelope(bzkaf.MsgpackEncoding), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("not json"), 0640))
+
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		Source:    config.SourceConfig{Type: config.DirSource, Path: dir},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+
+	s := &workertest.Sender{}
+	w, err := NewDirWorker(cfg, zap.NewNop(), inst, s, workertest.Processor{}, nil)
+	require.NoError(t, err)
+
+	// Read once without a poll interval
+	w.Work(context.Background())
+
+	require.Len(t, s.Sent, 3)
+	for i, event := range events {
+		assert.Equal(t, event.Content.Title+".xml", s.Sent[i].Filename, "files are read in name order")
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, f := range infos {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"a.jsonl.done", "a.jsonl.failed", "b.json.done", "ignored.txt"}, names)
+
+	failed, err := ioutil.ReadFile(filepath.Join(dir, "a.jsonl.failed"))
+	require.NoError(t, err)
+	assert.Equal(t, "not json", strings.TrimSpace(string(failed)))
+
+	// Read files are not read again
+	w.Work(context.Background())
+	assert.Len(t, s.Sent, 3)
+}
@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+
+	"github.com/pierrec/lz4"
+	"github.com/tinylib/msgp/msgp"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/content-models/models"
+)
+
+func init() {
+	bzkaf.Register(bzkaf.ContentModelsEventMsgType, 1, eventPayload{})
+	bzkaf.Register(bzkaf.ContentModelsCompressedEventMsgType, 1, eventPayload{})
+}
+
+// eventPayload is a models.Event that supports every envelope encoding. JSON and MessagePack use the
+// models.Event encoding, lz4+msgpack uses the same format as models.Content.Compress.
+type eventPayload struct {
+	models.Event
+}
+
+// Compress returns an Lz4-compressed MessagePack representation of the event
+func (e *eventPayload) Compress() ([]byte, error) {
+	out := bytes.Buffer{}
+	lz := lz4.NewWriter(&out)
+	// Events are small, the default 4MB block size makes decoding allocate far more than the event
+	lz.Header.BlockMaxSize = 64 << 10
+
+	// lz4.Writer is unbuffered, buffer so the event is written as a single frame
+	w := bufio.NewWriterSize(lz, 65536)
+	if err := msgp.Encode(w, &e.Event); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := lz.Close(); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// Decompress decodes an Lz4-compressed MessagePack representation of an event
+func (e *eventPayload) Decompress(data []byte) error {
+	return msgp.Decode(lz4.NewReader(bytes.NewReader(data)), &e.Event)
+}
+
+// NewEventEnvelope encodes the event as a producer would, lz4+msgpack events use the compressed event message type
+func NewEventEnvelope(event *models.Event, enc bzkaf.Encoding) (*bzkaf.Envelope, error) {
+	msgType := bzkaf.ContentModelsEventMsgType
+	if enc == bzkaf.LZ4MsgpackEncoding {
+		msgType = bzkaf.ContentModelsCompressedEventMsgType
+	}
+	return bzkaf.Encode(msgType, 1, enc, &eventPayload{*event})
+}
+
+// IsEventMsgType reports whether the worker accepts envelopes of msgType
+func IsEventMsgType(msgType bzkaf.MessageType) bool {
+	return msgType == bzkaf.ContentModelsEventMsgType || msgType == bzkaf.ContentModelsCompressedEventMsgType
+}
+
+// DecodeEvent decodes the event by envelope message type, schema version and encoding
+func DecodeEvent(envelope *bzkaf.Envelope) (*models.Event, error) {
+	v, err := bzkaf.Decode(envelope)
+	if err != nil {
+		return nil, err
+	}
+	payload, ok := v.(*eventPayload)
+	if !ok {
+		return nil, fmt.Errorf("envelope version %d decoded as %T, not models.Event", envelope.SchemaVersion(), v)
+	}
+	return &payload.Event, nil
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+var testEncodings = []bzkaf.Encoding{bzkaf.JSONEncoding, bzkaf.MsgpackEncoding, bzkaf.LZ4MsgpackEncoding}
+
+func TestDecodeEvent(t *testing.T) {
+	event := workertest.NewEvent()
+
+	for _, enc := range testEncodings {
+		t.Run(enc.String(), func(t *testing.T) {
+			envelope, err := NewEventEnvelope(event, enc)
+			require.NoError(t, err)
+			assert.True(t, IsEventMsgType(envelope.MessageType))
+
+			data, err := envelope.Marshal()
+			require.NoError(t, err)
+			received, err := bzkaf.UnmarshalEnvelope(data)
+			require.NoError(t, err)
+
+			decoded, err := DecodeEvent(received)
+			require.NoError(t, err)
+			assert.Equal(t, event.ID, decoded.ID)
+			assert.Equal(t, event.NodeID, decoded.NodeID)
+			assert.Equal(t, event.Event, decoded.Event)
+			assert.Equal(t, event.Content.Title, decoded.Content.Title)
+			assert.Equal(t, event.Content.Body, decoded.Content.Body)
+			// msgp decodes nil maps as empty, so compare ticker names
+			require.Len(t, decoded.Content.Tickers, len(event.Content.Tickers))
+			for i, ticker := range event.Content.Tickers {
+				assert.Equal(t, ticker.Name, decoded.Content.Tickers[i].Name)
+			}
+		})
+	}
+
+	// Events produced before envelope encodings existed
+	content, err := jsoniter.Marshal(event)
+	require.NoError(t, err)
+	decoded, err := DecodeEvent(bzkaf.NewEnvelope(bzkaf.ContentModelsEventMsgType, content))
+	require.NoError(t, err)
+	assert.Equal(t, event.ID, decoded.ID)
+
+	assert.False(t, IsEventMsgType(bzkaf.FTPDelivery))
+}
+
+func BenchmarkEncodeEvent(b *testing.B) {
+	event := workertest.NewEvent()
+
+	for _, enc := range testEncodings {
+		b.Run(enc.String(), func(b *testing.B) {
+			var size int
+			for i := 0; i < b.N; i++ {
+				envelope, err := NewEventEnvelope(event, enc)
+				if err != nil {
+					b.Fatal(err)
+				}
+				data, err := envelope.Marshal()
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "envelope_bytes")
+		})
+	}
+}
+
+func BenchmarkDecodeEvent(b *testing.B) {
+	event := workertest.NewEvent()
+
+	for _, enc := range testEncodings {
+		envelope, err := NewEventEnvelope(event, enc)
+		if err != nil {
+			b.Fatal(err)
+		}
+		data, err := envelope.Marshal()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(enc.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				received, err := bzkaf.UnmarshalEnvelope(data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := DecodeEvent(received); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "envelope_bytes")
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/lz4"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+)
+
+var _ = worker.Auditor(&AuditWriter{}) // check interface
+
+// AuditWriter publishes audit records as JSON to the audit topic, keyed by node ID so the records of a story are
+// in order. Records are written asynchronously so auditing does not slow the pipeline, write errors are logged by
+// the writer and the record is lost, the "Message Audit" log line is always written.
+type AuditWriter struct {
+	log    *zap.Logger
+	writer Writer
+}
+
+// NewAuditWriter publishes to cfg.Kafka.AuditTopic
+func NewAuditWriter(cfg *config.Config, logger *zap.Logger) (*AuditWriter, error) {
+	auditLog := logger.Named("audit")
+
+	writerConfig := kafka.WriterConfig{
+		Brokers:          cfg.Kafka.Brokers,
+		Topic:            cfg.Kafka.AuditTopic,
+		CompressionCodec: lz4.NewCompressionCodec(),
+		Async:            true,
+		BatchTimeout:     time.Second,
+		ErrorLogger:      kafka.LoggerFunc(auditLog.Sugar().Errorf),
+	}
+
+	dialer, err := loadDialer(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	writerConfig.Dialer = dialer
+
+	if err := writerConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	return newAuditWriter(auditLog, kafka.NewWriter(writerConfig)), nil
+}
+
+func newAuditWriter(logger *zap.Logger, w Writer) *AuditWriter {
+	return &AuditWriter{log: logger, writer: w}
+}
+
+// Audit ...
+func (a *AuditWriter) Audit(ctx context.Context, r *worker.AuditRecord) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return a.writer.WriteMessages(ctx, kafka.Message{Key: []byte(strconv.FormatInt(r.NodeID, 10)), Value: value})
+}
+
+// Close flushes the records being written
+func (a *AuditWriter) Close() error {
+	return a.writer.Close()
+}
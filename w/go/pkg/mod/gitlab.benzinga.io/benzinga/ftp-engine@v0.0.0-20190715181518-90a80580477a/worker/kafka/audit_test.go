@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/kafka/kafkatest"
+)
+
+func TestAuditWriter(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	a := newAuditWriter(zap.NewNop(), broker.NewWriter("audit"))
+
+	record := &worker.AuditRecord{
+		EnvelopeID: "envelope",
+		EventID:    1,
+		NodeID:     2,
+		Status:     worker.Rejected,
+		Reason:     "unwanted_event_type",
+		Stages:     []worker.StageResult{{Stage: worker.FilterStage, Outcome: worker.Reject, Reason: "unwanted_event_type", Duration: time.Millisecond}},
+		Received:   time.Now().UTC(),
+	}
+	require.NoError(t, a.Audit(context.Background(), record))
+	require.NoError(t, a.Close())
+
+	msgs := broker.AllMessages("audit")
+	require.Len(t, msgs, 1)
+	assert.Equal(t, strconv.FormatInt(record.NodeID, 10), string(msgs[0].Key), "records of a story are keyed by node ID")
+
+	var published worker.AuditRecord
+	require.NoError(t, json.Unmarshal(msgs[0].Value, &published))
+	assert.Equal(t, record.EnvelopeID, published.EnvelopeID)
+	assert.Equal(t, record.Status, published.Status)
+	assert.Equal(t, record.Reason, published.Reason)
+	assert.Equal(t, record.Stages, published.Stages)
+	assert.True(t, record.Received.Equal(published.Received))
+}
@@ -0,0 +1,178 @@
+package kafka
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+)
+
+const bufferedRecordExt = ".json"
+
+// deliveryRecorder publishes delivery record envelopes, records that cannot be published are
+// written to the buffer directory and re-published on an interval so they survive a Kafka outage
+type deliveryRecorder struct {
+	sync.Mutex
+	// flush serializes Flush so a record is not re-published by concurrent flushes
+	flush    sync.Mutex
+	log      *zap.Logger
+	writer   Writer
+	dir      string
+	interval time.Duration
+}
+
+// re: sync.Mutex, flushing and buffering share the buffer directory, the lock guards listing and
+// removing records but is not held while publishing, so records are buffered during a Kafka outage
+// while a flush waits on the broker
+
+func newDeliveryRecorder(logger *zap.Logger, w Writer, dir string, interval time.Duration) (*deliveryRecorder, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &deliveryRecorder{
+		log:      logger.Named("delivery"),
+		writer:   w,
+		dir:      dir,
+		interval: interval,
+	}, nil
+}
+
+// Record publishes the envelope, buffering it to disk on failure. An error is only returned if the
+// record could neither be published nor buffered.
+func (d *deliveryRecorder) Record(ctx context.Context, envelope *bzkaf.Envelope) error {
+	span, subCtx := opentracing.StartSpanFromContext(ctx, "Record Delivery")
+	defer span.Finish()
+	span.LogFields(otlog.String("envelope_id", envelope.ID))
+
+	envelopeJSON, err := envelope.Marshal()
+	if err != nil {
+		span.LogFields(otlog.Error(err))
+		d.log.Error("Envelope FTP Delivery Confirmation Marshal Error", zap.Error(err))
+		return err
+	}
+
+	writeErr := d.writer.WriteMessages(subCtx, kafka.Message{Value: envelopeJSON})
+	if writeErr == nil {
+		d.log.Debug("Delivery Confirmation Sent", zap.String("envelope.id", envelope.ID))
+		return nil
+	}
+
+	span.LogFields(otlog.Error(writeErr))
+	d.log.Error("Kafka Write FTP Delivery Confirmation Error, buffering record", zap.Error(writeErr), zap.String("envelope.id", envelope.ID))
+
+	if err := d.buffer(envelope.ID, envelopeJSON); err != nil {
+		span.LogFields(otlog.Error(err))
+		d.log.Error("Buffer FTP Delivery Confirmation Error, record lost", zap.Error(err), zap.String("envelope.id", envelope.ID))
+		return err
+	}
+
+	return nil
+}
+
+// buffer writes the record to a temp file before renaming so a partially written record is never re-published
+func (d *deliveryRecorder) buffer(id string, data []byte) error {
+	d.Lock()
+	defer d.Unlock()
+
+	tmp, err := ioutil.TempFile(d.dir, ".tmp-"+id)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(d.dir, id+bufferedRecordExt))
+}
+
+// Flush re-publishes buffered records in the order they were written, stopping on the first write error
+func (d *deliveryRecorder) Flush(ctx context.Context) error {
+	d.flush.Lock()
+	defer d.flush.Unlock()
+
+	paths, err := d.buffered()
+	if err != nil {
+		return err
+	}
+
+	var published int
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			d.log.Error("Read Buffered Delivery Record Error", zap.Error(err), zap.String("path", path))
+			continue
+		}
+
+		if err := d.writer.WriteMessages(ctx, kafka.Message{Value: data}); err != nil {
+			d.log.Warn("Re-publish Buffered Delivery Record Error", zap.Error(err), zap.Int("published", published))
+			return err
+		}
+
+		d.Lock()
+		err = os.Remove(path)
+		d.Unlock()
+		if err != nil {
+			d.log.Error("Remove Buffered Delivery Record Error", zap.Error(err), zap.String("path", path))
+		}
+		published++
+	}
+
+	if published > 0 {
+		d.log.Info("Buffered Delivery Records Re-published", zap.Int("count", published))
+	}
+
+	return nil
+}
+
+// buffered returns the paths of the buffered records in the order they were written
+func (d *deliveryRecorder) buffered() ([]string, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), bufferedRecordExt) || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		paths = append(paths, filepath.Join(d.dir, f.Name()))
+	}
+	return paths, nil
+}
+
+// Run flushes buffered records on startup and every interval until ctx is done
+func (d *deliveryRecorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Flush(ctx); err != nil {
+			d.log.Debug("Flush Buffered Delivery Records Incomplete", zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
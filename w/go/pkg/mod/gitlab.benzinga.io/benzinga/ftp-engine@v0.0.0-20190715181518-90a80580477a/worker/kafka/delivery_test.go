@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/kafka/kafkatest"
+)
+
+func TestDeliveryRecorderBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-engine-deliveries")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	d, err := newDeliveryRecorder(zap.NewNop(), nil, dir, time.Second)
+	require.NoError(t, err)
+
+	// Empty buffer flushes without publishing
+	require.NoError(t, d.Flush(context.Background()))
+
+	envelope := bzkaf.NewEnvelope(bzkaf.FTPDelivery, []byte(`{"NodeID":1}`))
+	envelopeJSON, err := envelope.Marshal()
+	require.NoError(t, err)
+
+	require.NoError(t, d.buffer(envelope.ID, envelopeJSON))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1, "temp file should be renamed")
+	assert.Equal(t, envelope.ID+bufferedRecordExt, files[0].Name())
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+
+	e, err := bzkaf.UnmarshalEnvelope(data)
+	require.NoError(t, err)
+	assert.Equal(t, envelope.ID, e.ID)
+	assert.Equal(t, bzkaf.FTPDelivery, e.MessageType)
+}
+
+func TestDeliveryRecorderFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-engine-deliveries")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	broker := kafkatest.NewBroker()
+	w := broker.NewWriter("deliveries")
+	d, err := newDeliveryRecorder(zap.NewNop(), w, dir, time.Second)
+	require.NoError(t, err)
+
+	// Records are buffered while Kafka is down
+	w.Err = errors.New("kafka unavailable")
+	envelopes := []*bzkaf.Envelope{
+		bzkaf.NewEnvelope(bzkaf.FTPDelivery, []byte(`{"NodeID":1}`)),
+		bzkaf.NewEnvelope(bzkaf.FTPDelivery, []byte(`{"NodeID":2}`)),
+	}
+	for _, envelope := range envelopes {
+		require.NoError(t, d.Record(context.Background(), envelope), "buffered records are not an error")
+	}
+	assert.Empty(t, broker.AllMessages("deliveries"))
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// Flush keeps the buffer while Kafka is down
+	assert.Error(t, d.Flush(context.Background()))
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// Flush re-publishes and removes buffered records once Kafka is back
+	w.Err = nil
+	require.NoError(t, d.Flush(context.Background()))
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	msgs := broker.AllMessages("deliveries")
+	require.Len(t, msgs, 2)
+	var ids []string
+	for _, msg := range msgs {
+		e, err := bzkaf.UnmarshalEnvelope(msg.Value)
+		require.NoError(t, err)
+		ids = append(ids, e.ID)
+	}
+	assert.ElementsMatch(t, []string{envelopes[0].ID, envelopes[1].ID}, ids)
+
+	// Records are published directly while Kafka is up
+	require.NoError(t, d.Record(context.Background(), bzkaf.NewEnvelope(bzkaf.FTPDelivery, []byte(`{"NodeID":3}`))))
+	assert.Len(t, broker.AllMessages("deliveries"), 3)
+}
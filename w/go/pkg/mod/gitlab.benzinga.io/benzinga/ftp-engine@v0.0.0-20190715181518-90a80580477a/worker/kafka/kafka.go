@@ -4,14 +4,13 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 
-	jsoniter "github.com/json-iterator/go"
 	"github.com/opentracing/opentracing-go"
 	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -22,8 +21,6 @@ import (
 	_ "github.com/segmentio/kafka-go/zstd" // needed for decompression
 	"go.uber.org/zap"
 
-	"gitlab.benzinga.io/benzinga/bzkaf"
-	"gitlab.benzinga.io/benzinga/content-models/models"
 	"gitlab.benzinga.io/benzinga/ftp-engine/config"
 	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
 	"gitlab.benzinga.io/benzinga/ftp-engine/process"
@@ -31,16 +28,51 @@ import (
 	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
 )
 
-var _ = worker.Worker(&Worker{}) // check interface
+var _ = worker.Worker(&Worker{})  // check interface
+var _ = worker.Checker(&Worker{}) // check interface
+
+var _ = Writer(&kafka.Writer{}) // check interface
+
+// Reader is the consumer group API used by the worker, see groupReader for a kafka.Reader and kafkatest for an
+// in-memory Reader
+type Reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	// Stats returns the reader statistics, counters are reset on each call
+	Stats() kafka.ReaderStats
+	// PartitionLag returns the high watermark less the committed offset of each assigned partition
+	PartitionLag(ctx context.Context) (map[int]int64, error)
+	Close() error
+}
+
+// Writer is the kafka.Writer API used by the worker, see kafkatest for an in-memory Writer
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// statsInterval is how often the reader statistics are collected into the metrics
+const statsInterval = 15 * time.Second
 
 type Worker struct {
-	log       *zap.Logger
-	cfg       *config.Config
-	instr     *instr.Collector
-	reader    *kafka.Reader
-	writer    *kafka.Writer
-	processor process.Processor
-	sender    sender.Sender
+	log      *zap.Logger
+	cfg      *config.Config
+	instr    *instr.Collector
+	reader   Reader
+	writer   Writer
+	pipeline *worker.Pipeline
+	delivery *deliveryRecorder
+	stats    readerStats
+}
+
+// readerStats are the reader counters since the last Check, the reader resets its counters on each Stats call
+type readerStats struct {
+	sync.Mutex
+	lag        int64
+	errors     int64
+	rebalances int64
+	// partitions have a lag metric
+	partitions map[int]bool
 }
 
 func loadTLSConfig(keyPath, certPath, caPath string) (*tls.Config, error) {
@@ -74,28 +106,10 @@ func loadTLSConfig(keyPath, certPath, caPath string) (*tls.Config, error) {
 	return &tlsConfig, nil
 }
 
-func NewKafkaWorker(cfg *config.Config, logger *zap.Logger, inst *instr.Collector, s sender.Sender, p process.Processor) (*Worker, error) {
+// loadDialer returns a dialer using scram auth and/or TLS if configured, nil if neither is configured
+func loadDialer(cfg *config.Config, logger *zap.Logger) (*kafka.Dialer, error) {
 
-	readerConfig := kafka.ReaderConfig{
-		Brokers:               cfg.Kafka.Brokers,
-		Topic:                 cfg.Kafka.Topic,
-		GroupID:               cfg.Kafka.GroupID,
-		WatchPartitionChanges: true,
-		// RetentionTime optionally sets the length of time the consumer group will be saved
-		// by the broker
-		// Only used when GroupID is set
-		RetentionTime:     time.Hour * 168, // one week
-		HeartbeatInterval: time.Second * 2,
-		MaxWait:           time.Second * 10,
-		MinBytes:          10e3, // 10KB
-		MaxBytes:          10e8, // 100MB
-	}
-
-	writerConfig := kafka.WriterConfig{
-		Brokers:          cfg.Kafka.Brokers,
-		Topic:            "third-party-deliveries",
-		CompressionCodec: lz4.NewCompressionCodec(),
-	}
+	var dialer *kafka.Dialer
 
 	// If Username and Password set use scram auth
 	if cfg.Kafka.Username != "" && cfg.Kafka.Password != "" {
@@ -104,10 +118,7 @@ func NewKafkaWorker(cfg *config.Config, logger *zap.Logger, inst *instr.Collecto
 		if err != nil {
 			return nil, err
 		}
-		writerConfig.Dialer = &kafka.Dialer{
-			SASLMechanism: mech,
-		}
-		readerConfig.Dialer = &kafka.Dialer{
+		dialer = &kafka.Dialer{
 			SASLMechanism: mech,
 		}
 		logger.Info("Kafka Username & Password set, attempting connection with scram auth", zap.String("algo", algo.Name()))
@@ -124,23 +135,49 @@ func NewKafkaWorker(cfg *config.Config, logger *zap.Logger, inst *instr.Collecto
 			return nil, err
 		}
 
-		if readerConfig.Dialer == nil && writerConfig.Dialer == nil {
-			readerConfig.Dialer = &kafka.Dialer{
-				TLS: tlsConfig,
-			}
-			writerConfig.Dialer = &kafka.Dialer{
-				TLS: tlsConfig,
-			}
-		} else {
-			readerConfig.Dialer.TLS = tlsConfig
-			writerConfig.Dialer.TLS = tlsConfig
+		if dialer == nil {
+			dialer = &kafka.Dialer{}
 		}
+		dialer.TLS = tlsConfig
 
 		logger.Info("Kafka TLS connection configured")
 	} else {
 		logger.Info("Kafka TLS connection not configured")
 	}
 
+	return dialer, nil
+}
+
+func NewKafkaWorker(cfg *config.Config, logger *zap.Logger, inst *instr.Collector, s sender.Sender, p process.Processor, h worker.History) (*Worker, error) {
+
+	readerConfig := kafka.ReaderConfig{
+		Brokers:               cfg.Kafka.Brokers,
+		Topic:                 cfg.Kafka.Topic,
+		GroupID:               cfg.Kafka.GroupID,
+		WatchPartitionChanges: true,
+		// RetentionTime optionally sets the length of time the consumer group will be saved
+		// by the broker
+		// Only used when GroupID is set
+		RetentionTime:     time.Hour * 168, // one week
+		HeartbeatInterval: time.Second * 2,
+		MaxWait:           time.Second * 10,
+		MinBytes:          10e3, // 10KB
+		MaxBytes:          10e8, // 100MB
+	}
+
+	writerConfig := kafka.WriterConfig{
+		Brokers:          cfg.Kafka.Brokers,
+		Topic:            cfg.Delivery.Topic,
+		CompressionCodec: lz4.NewCompressionCodec(),
+	}
+
+	dialer, err := loadDialer(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	readerConfig.Dialer = dialer
+	writerConfig.Dialer = dialer
+
 	if err := readerConfig.Validate(); err != nil {
 		return nil, err
 	}
@@ -149,10 +186,116 @@ func NewKafkaWorker(cfg *config.Config, logger *zap.Logger, inst *instr.Collecto
 		return nil, err
 	}
 
-	r := kafka.NewReader(readerConfig)
-	w := kafka.NewWriter(writerConfig)
+	r := newGroupReader(kafka.NewReader(readerConfig), leaderLastOffset(dialer, cfg.Kafka.Brokers, cfg.Kafka.Topic))
+	return NewWorker(cfg, logger, inst, s, p, h, r, kafka.NewWriter(writerConfig))
+}
+
+// NewWorker consumes events with the reader and publishes delivery records with the writer, deliveries are stored
+// in h if not nil
+func NewWorker(cfg *config.Config, logger *zap.Logger, inst *instr.Collector, s sender.Sender, p process.Processor, h worker.History, r Reader, w Writer) (*Worker, error) {
+
+	workerLog := logger.Named("worker:kafka")
+
+	d, err := newDeliveryRecorder(workerLog, w, cfg.Delivery.BufferPath, cfg.Delivery.RetryInterval)
+	if err != nil {
+		logger.Error("Load Delivery Record Buffer Error", zap.Error(err), zap.String("path", cfg.Delivery.BufferPath))
+		return nil, err
+	}
+
+	pipe, err := worker.NewPipeline(cfg, workerLog, inst, s, p, d, h, cfg.Kafka.Topic)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Worker{logger.Named("worker:kafka"), cfg, inst, r, w, p, s}, nil
+	return &Worker{log: workerLog, cfg: cfg, instr: inst, reader: r, writer: w, pipeline: pipe, delivery: d}, nil
+}
+
+// Pipeline ...
+func (w *Worker) Pipeline() *worker.Pipeline {
+	return w.pipeline
+}
+
+// Check reports the consumer lag and reader errors since the last check, degraded if there were errors or the
+// lag is more than cfg.Ready.MaxLag
+func (w *Worker) Check(ctx context.Context) worker.Check {
+	w.collectStats(ctx)
+
+	w.stats.Lock()
+	lag, errors, rebalances := w.stats.lag, w.stats.errors, w.stats.rebalances
+	w.stats.errors, w.stats.rebalances = 0, 0
+	w.stats.Unlock()
+
+	check := worker.Check{Status: worker.CheckOK, Details: map[string]interface{}{
+		"topic":      w.cfg.Kafka.Topic,
+		"group_id":   w.cfg.Kafka.GroupID,
+		"lag":        lag,
+		"errors":     errors,
+		"rebalances": rebalances,
+	}}
+
+	switch {
+	case errors > 0:
+		check.Status = worker.CheckDegraded
+		check.Error = fmt.Sprintf("%d reader errors since the last check", errors)
+	case w.cfg.Ready.MaxLag > 0 && lag > w.cfg.Ready.MaxLag:
+		check.Status = worker.CheckDegraded
+		check.Error = fmt.Sprintf("consumer lag %d is more than %d", lag, w.cfg.Ready.MaxLag)
+	}
+
+	return check
+}
+
+// collectStats sets the consumer lag metric of each assigned partition, and adds the reader counters to the stats
+// of the next Check. The lag is kept if it cannot be read, which is counted as a reader error.
+func (w *Worker) collectStats(ctx context.Context) {
+	stats := w.reader.Stats()
+	lag, err := w.reader.PartitionLag(ctx)
+	if err != nil {
+		w.log.Warn("Read Consumer Lag Error", zap.Error(err))
+		stats.Errors++
+	}
+
+	w.stats.Lock()
+	defer w.stats.Unlock()
+	w.stats.errors += stats.Errors
+	w.stats.rebalances += stats.Rebalances
+	if err != nil {
+		return
+	}
+
+	w.stats.lag = 0
+	for p := range w.stats.partitions {
+		if _, ok := lag[p]; !ok {
+			w.instr.ConsumerLag.Delete(w.partitionLabels(p))
+		}
+	}
+	w.stats.partitions = make(map[int]bool, len(lag))
+	for p, l := range lag {
+		w.instr.ConsumerLag.With(w.partitionLabels(p)).Set(float64(l))
+		w.stats.partitions[p] = true
+		w.stats.lag += l
+	}
+}
+
+func (w *Worker) partitionLabels(partition int) prometheus.Labels {
+	return prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic, "partition": strconv.Itoa(partition)}
+}
+
+// runStats collects the reader statistics every statsInterval until ctx is done
+func (w *Worker) runStats(ctx context.Context) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			statsCtx, cancel := context.WithTimeout(ctx, statsInterval)
+			w.collectStats(statsCtx)
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
 func (w *Worker) Disconnect() (err error) {
@@ -169,19 +312,27 @@ func (w *Worker) Disconnect() (err error) {
 
 func (w *Worker) Work(ctx context.Context) {
 
-	var workStart time.Time
+	// Re-publish delivery records buffered during Kafka outages
+	go w.delivery.Run(ctx)
+	// Consumer lag metrics
+	go w.runStats(ctx)
 
 work:
 	for {
 		select {
 		default:
+			// Wait while paused, the reader keeps sending consumer group heartbeats
+			if err := w.pipeline.WaitResumed(ctx); err != nil {
+				continue work
+			}
+
 			w.log.Debug("Waiting for new content from Kafka")
 
 			// Fetch Message
 			msg, err := w.reader.FetchMessage(ctx)
-			span, subCtx := opentracing.StartSpanFromContext(ctx, "New Kafka Message")
 			if err != nil {
 
+				span, _ := opentracing.StartSpanFromContext(ctx, "New Kafka Message")
 				span.LogFields(otlog.Error(err))
 
 				if err == io.EOF {
@@ -189,112 +340,28 @@ work:
 				}
 
 				w.log.Error("Fetch Message Error", zap.Error(err))
-				w.instr.ContentReceiveErrors.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic}).Inc()
+				w.instr.ContentReceiveErrors.With(w.pipeline.Labels()).Inc()
 				span.Finish()
 				continue work
 			}
 
-			workStart = time.Now()
-
-			w.instr.ContentAccepted.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic}).Inc()
-			msgLog := w.log.With(zap.Int64("offset", msg.Offset), zap.String("topic", msg.Topic), zap.Int("partition", msg.Partition), zap.Time("msg_time", msg.Time), zap.String("kafka_group_id", w.cfg.Kafka.GroupID))
-			span.LogFields(otlog.Int64("offset", msg.Offset), otlog.String("topic", msg.Topic), otlog.Int("partition", msg.Partition), otlog.String("group_id", w.cfg.Kafka.GroupID))
-			msgLog.Debug("Kafka Message Received")
-
-			//
-			// Process Message
-			//
-
-			// Unmarshal Kafka Envelope
-			var envelope bzkaf.Envelope
-			if err := json.Unmarshal(msg.Value, &envelope); err != nil {
-				span.LogFields(otlog.Error(err))
-				msgLog.Error("Unmarshal Kafka Envelope Error", zap.Error(err))
-				w.instr.ContentReceiveErrors.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic}).Inc()
-				span.Finish()
-				continue work
-			}
-			msgLog = msgLog.With(zap.String("envelope_id", envelope.ID))
-			msgLog.Debug("Kafka Message Envelope Unmarshaled")
-
-			if envelope.MessageType != bzkaf.ContentModelsEventMsgType {
-				// This should never happen unless there is an issue with Kafka configuration
-				w.instr.ContentRejected.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic, "reason": "invalid_evenlope_message_type"}).Inc()
-				msgLog.Error("Invalid Message Type", zap.String("message_type", envelope.MessageType.String()))
-				w.commitMessages(subCtx, msgLog, workStart, msg)
-				span.Finish()
+			// Paused during the fetch, the message is handled on resume. It is not committed before, so it is fetched
+			// again if the worker stops while paused.
+			if err := w.pipeline.WaitResumed(ctx); err != nil {
+				w.log.Info("Message Not Handled While Paused", zap.Int64("offset", msg.Offset), zap.Int("partition", msg.Partition))
 				continue work
 			}
 
-			// ToDo(darwin): Unpack/use tracing data
-
-			// Unmarshal Event
-			var event models.Event
-			if err := json.Unmarshal(envelope.Message, &event); err != nil {
-				span.LogFields(otlog.Error(err))
-				w.instr.ContentReceiveErrors.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic}).Inc()
-				msgLog.Error("Unmarshal Kafka Envelope Error", zap.Error(err))
-				span.Finish()
-				continue work
-			}
-
-			span.LogFields(otlog.Int64("event_id", event.ID), otlog.Int64("node_id", event.NodeID), otlog.String("envelope_id", envelope.ID), otlog.String("event_type", string(event.Event)))
-			msgLog = msgLog.With(zap.Int64("event_id", event.ID), zap.Int64("node_id", event.NodeID))
-			msgLog.Debug("Event Unmarshaled")
-
-			// Filter Event
-			// Check Event Updated Not Before Ignore Value
-			if w.cfg.Processor.IgnoreUpdatedBefore != nil && w.cfg.Processor.IgnoreUpdatedBefore.Before(event.Content.UpdatedAt.Time) {
-				w.instr.ContentRejected.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic, "reason": "updated_before_ignore_value"}).Inc()
-				w.commitMessages(subCtx, msgLog, workStart, msg)
-				span.LogFields(otlog.String("updated_at", event.Content.UpdatedAt.Time.String()), otlog.String("ignore_before", w.cfg.Processor.IgnoreUpdatedBefore.String()))
-				msgLog.Info("Ignoring Event, is updated before ignore value", zap.Time("updated_at", event.Content.UpdatedAt.Time), zap.Time("ignore_before", *w.cfg.Processor.IgnoreUpdatedBefore))
-				span.Finish()
-				continue work
-			}
-			// Check Event Content Type
-			if contentType, ok := process.ContentTypeMappings[strings.ToLower(event.Content.Type)]; !ok {
-				w.instr.ContentRejected.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic, "reason": "unwanted_content_type"}).Inc()
-				w.commitMessages(subCtx, msgLog, workStart, msg)
-				span.LogFields(otlog.String("content_type", event.Content.Type))
-				msgLog.Info("Ignoring Event, is not wanted content type", zap.String("content_type", event.Content.Type))
-				span.Finish()
-				continue work
-			} else {
-				msgLog.Debug("Content Type Valid", zap.String("content_type", contentType.String()))
-			}
-			// Check Event is of Accepted Event Type
-			var match bool
-			for i := 0; i < len(w.cfg.Processor.AcceptedEvents); i++ {
-
-				if event.Event == w.cfg.Processor.AcceptedEvents[i] {
-					// Send Message if Event is of Accepted type
-					match = true
-					if err := w.processAndSend(subCtx, &event); err != nil {
-						span.LogFields(otlog.Error(err))
-						msgLog.Error("Processor/Send Error", zap.Error(err))
-						w.instr.ContentSendErrors.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic}).Inc()
-						span.Finish()
-						continue work
-					}
-					msgLog.Debug("Content Sent")
-
-				}
-			}
-
-			if !match {
-				// Unaccepted event type, acknowledged, but was not sent
-				msgLog.Debug("Unaccepted Event Type", zap.String("event_type", string(event.Event)), zap.Time("event_content_updated_at", event.Content.UpdatedAt.Time))
-				w.instr.ContentRejected.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic, "reason": "unwanted_event_type"}).Inc()
-			} else {
-				w.instr.ContentSent.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic}).Inc()
-			}
-			span.LogFields(otlog.Bool("is_accepted_event_type", match), otlog.String("event_content_updated_at", event.Content.UpdatedAt.String()))
-
-			// Acknowledge/Commit
-			w.commitMessages(subCtx, msgLog, workStart, msg)
-			w.instr.ContentProcessingLatency.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic}).Observe(time.Since(workStart).Seconds())
-			span.Finish()
+			// Decode, Filter, Process, Send & Commit
+			w.pipeline.Handle(ctx, "New Kafka Message", &worker.Message{
+				Value:      msg.Value,
+				Received:   time.Now(),
+				Log:        w.log.With(zap.Int64("offset", msg.Offset), zap.String("topic", msg.Topic), zap.Int("partition", msg.Partition), zap.Time("msg_time", msg.Time)),
+				SpanFields: []otlog.Field{otlog.Int64("offset", msg.Offset), otlog.String("topic", msg.Topic), otlog.Int("partition", msg.Partition)},
+				Ack: func(ctx context.Context) error {
+					return w.reader.CommitMessages(ctx, msg)
+				},
+			})
 
 		case <-ctx.Done():
 			w.log.Info("Receiver Context Done, disconnecting.")
@@ -307,71 +374,3 @@ work:
 	}
 
 }
-
-func (w *Worker) recordFTPDelivery(ctx context.Context, o *process.Output, event *models.Event) error {
-
-	record := worker.FTPDeliveryRecord{
-		NodeID:          event.NodeID,
-		EventID:         event.ID,
-		EventType:       event.Event,
-		ConsumerGroupID: w.cfg.Kafka.GroupID,
-		FTPHost:         w.cfg.FTP.Host,
-		FTPPath:         w.cfg.FTP.Path,
-		Filename:        o.Filename,
-		SHA256Checksum:  o.Checksum,
-		Timestamp:       time.Now().UTC(),
-		SizeBytes:       o.Size,
-	}
-
-	// Marshal Record
-	recordJSON, err := jsoniter.Marshal(&record)
-	if err != nil {
-		w.log.Error("Marshal FTP Delivery Record Error", zap.Error(err))
-		return err
-	}
-
-	// New Envelope
-	envelope := bzkaf.NewEnvelope(bzkaf.FTPDelivery, recordJSON)
-	envelopeJSON, err := envelope.Marshal()
-	if err != nil {
-		w.log.Error("Envelope FTP Delivery Confirmation Marshal Error", zap.Error(err))
-		return err
-	}
-
-	// Create Message
-	msg := kafka.Message{
-		Value: envelopeJSON,
-	}
-
-	// Send FTP Delivery Confirmation
-	if err := w.writer.WriteMessages(ctx, msg); err != nil {
-		w.log.Error("Kafka Write FTP Delivery Confirmation Error")
-		return err
-	}
-
-	w.log.Debug("Delivery Confirmation Sent", zap.String("envelope.id", envelope.ID), zap.String("data.checksum", o.Checksum), zap.Int("data.size", o.Size))
-
-	return nil
-}
-
-func (w *Worker) processAndSend(ctx context.Context, event *models.Event) error {
-	output, err := w.processor.Convert(event)
-	if err != nil {
-		return err
-	}
-	if err := w.sender.Send(ctx, output); err != nil {
-		return err
-	}
-	if err := w.recordFTPDelivery(ctx, output, event); err != nil {
-		w.log.Error("Record FTP Delivery Error", zap.Error(err))
-	}
-	return nil
-}
-
-func (w *Worker) commitMessages(ctx context.Context, msgLog *zap.Logger, start time.Time, msg ...kafka.Message) {
-	if err := w.reader.CommitMessages(ctx, msg...); err != nil {
-		msgLog.Error("Kafka Commit Error", zap.Error(err))
-	}
-	w.instr.ContentAcknowledged.With(prometheus.Labels{"kafka_group_id": w.cfg.Kafka.GroupID, "kafka_topic": w.cfg.Kafka.Topic}).Inc()
-	msgLog.Debug("Message Commit Success", zap.Duration("total_latency", time.Since(start)))
-}
@@ -0,0 +1,382 @@
+// Package kafkatest is an in-memory Kafka for hermetic worker tests. It supports partitioned topics, consumer
+// groups with committed offsets, and rebalancing partitions when group members join or leave.
+package kafkatest
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Broker is an in-memory Kafka cluster, topics are created on first use with DefaultPartitions
+type Broker struct {
+	sync.Mutex
+	// DefaultPartitions of topics not created by CreateTopic
+	DefaultPartitions int
+
+	topics map[string]*topic
+	groups map[string]*group
+	// changed is closed and replaced whenever messages are written or a group rebalances, so waiting readers wake
+	changed chan struct{}
+}
+
+type topic struct {
+	partitions [][]kafka.Message
+	next       int // round robin partition of messages without a key
+}
+
+type group struct {
+	generation int
+	members    []*Reader
+	// offsets are the committed next offset of each partition
+	offsets     map[int]int64
+	assignments map[*Reader][]int
+}
+
+// NewBroker ...
+func NewBroker() *Broker {
+	return &Broker{
+		DefaultPartitions: 3,
+		topics:            map[string]*topic{},
+		groups:            map[string]*group{},
+		changed:           make(chan struct{}),
+	}
+}
+
+// CreateTopic creates the topic with the number of partitions, existing topics are not changed
+func (b *Broker) CreateTopic(name string, partitions int) {
+	b.Lock()
+	defer b.Unlock()
+	b.topic(name, partitions)
+}
+
+func (b *Broker) topic(name string, partitions int) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{partitions: make([][]kafka.Message, partitions)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+func (b *Broker) group(groupID, topicName string) *group {
+	key := groupID + "/" + topicName
+	g, ok := b.groups[key]
+	if !ok {
+		g = &group{offsets: map[int]int64{}, assignments: map[*Reader][]int{}}
+		b.groups[key] = g
+	}
+	return g
+}
+
+// notify wakes waiting readers, the lock must be held
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Messages returns the messages written to the partition
+func (b *Broker) Messages(topicName string, partition int) []kafka.Message {
+	b.Lock()
+	defer b.Unlock()
+	t := b.topic(topicName, b.DefaultPartitions)
+	return append([]kafka.Message(nil), t.partitions[partition]...)
+}
+
+// AllMessages returns the messages written to every partition of the topic, by partition then offset
+func (b *Broker) AllMessages(topicName string) []kafka.Message {
+	b.Lock()
+	defer b.Unlock()
+	var msgs []kafka.Message
+	for _, p := range b.topic(topicName, b.DefaultPartitions).partitions {
+		msgs = append(msgs, p...)
+	}
+	return msgs
+}
+
+// Committed returns the committed next offset of each partition for the consumer group
+func (b *Broker) Committed(groupID, topicName string) map[int]int64 {
+	b.Lock()
+	defer b.Unlock()
+	offsets := map[int]int64{}
+	for p, o := range b.group(groupID, topicName).offsets {
+		offsets[p] = o
+	}
+	return offsets
+}
+
+// Lag returns the number of messages of the topic not committed by the consumer group
+func (b *Broker) Lag(groupID, topicName string) int64 {
+	b.Lock()
+	defer b.Unlock()
+	g := b.group(groupID, topicName)
+	var lag int64
+	for p, msgs := range b.topic(topicName, b.DefaultPartitions).partitions {
+		lag += int64(len(msgs)) - g.offsets[p]
+	}
+	return lag
+}
+
+// Assignments returns the partitions assigned to each member of the consumer group, in join order
+func (b *Broker) Assignments(groupID, topicName string) [][]int {
+	b.Lock()
+	defer b.Unlock()
+	g := b.group(groupID, topicName)
+	assignments := make([][]int, 0, len(g.members))
+	for _, r := range g.members {
+		assignments = append(assignments, append([]int(nil), g.assignments[r]...))
+	}
+	return assignments
+}
+
+// rebalance assigns partitions to the group members in ranges, as the kafka-go range group balancer does.
+// The lock must be held.
+func (b *Broker) rebalance(g *group, topicName string) {
+	g.generation++
+	g.assignments = map[*Reader][]int{}
+
+	n := len(g.members)
+	if n == 0 {
+		b.notify()
+		return
+	}
+
+	partitions := len(b.topic(topicName, b.DefaultPartitions).partitions)
+	for i, r := range g.members {
+		start, end := i*partitions/n, (i+1)*partitions/n
+		for p := start; p < end; p++ {
+			g.assignments[r] = append(g.assignments[r], p)
+		}
+	}
+	b.notify()
+}
+
+// NewWriter returns a writer to the topic. Messages with a key are written to the partition of the key hash,
+// other messages are written to partitions in turn.
+func (b *Broker) NewWriter(topicName string) *Writer {
+	return &Writer{broker: b, topic: topicName}
+}
+
+// NewReader joins the consumer group of the topic, rebalancing the group
+func (b *Broker) NewReader(groupID, topicName string) *Reader {
+	b.Lock()
+	defer b.Unlock()
+
+	r := &Reader{broker: b, groupID: groupID, topic: topicName, positions: map[int]int64{}}
+	g := b.group(groupID, topicName)
+	g.members = append(g.members, r)
+	b.rebalance(g, topicName)
+	return r
+}
+
+// Writer writes messages to an in-memory topic, it has the kafka.Writer methods used by the worker
+type Writer struct {
+	broker *Broker
+	topic  string
+	closed bool
+	// Err is returned by WriteMessages if set, to test publishing failures
+	Err error
+}
+
+// WriteMessages ...
+func (w *Writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	w.broker.Lock()
+	defer w.broker.Unlock()
+
+	if w.closed {
+		return io.ErrClosedPipe
+	}
+	if w.Err != nil {
+		return w.Err
+	}
+
+	t := w.broker.topic(w.topic, w.broker.DefaultPartitions)
+	for _, msg := range msgs {
+		var p int
+		if len(msg.Key) > 0 {
+			h := fnv.New32a()
+			h.Write(msg.Key)
+			p = int(h.Sum32() % uint32(len(t.partitions)))
+		} else {
+			p = t.next % len(t.partitions)
+			t.next++
+		}
+
+		msg.Topic = w.topic
+		msg.Partition = p
+		msg.Offset = int64(len(t.partitions[p]))
+		if msg.Time.IsZero() {
+			msg.Time = time.Now()
+		}
+		t.partitions[p] = append(t.partitions[p], msg)
+	}
+	w.broker.notify()
+
+	return nil
+}
+
+// Close ...
+func (w *Writer) Close() error {
+	w.broker.Lock()
+	defer w.broker.Unlock()
+	w.closed = true
+	return nil
+}
+
+// Reader is a consumer group member, it has the kafka.Reader methods used by the worker. As with Kafka,
+// messages fetched but not committed before a rebalance are fetched again by the new partition owner.
+type Reader struct {
+	broker  *Broker
+	groupID string
+	topic   string
+	closed  bool
+
+	generation int
+	// positions are the next offset fetched from each assigned partition
+	positions map[int]int64
+	next      int // round robin index of assigned partitions
+}
+
+// FetchMessage returns the next message of the assigned partitions, waiting until a message is written or
+// ctx is done. io.EOF is returned once the reader is closed.
+func (r *Reader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		r.broker.Lock()
+		if r.closed {
+			r.broker.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+
+		g := r.broker.group(r.groupID, r.topic)
+		assigned := g.assignments[r]
+
+		// Start from the committed offsets after a rebalance
+		if r.generation != g.generation {
+			r.generation = g.generation
+			r.positions = map[int]int64{}
+			for _, p := range assigned {
+				r.positions[p] = g.offsets[p]
+			}
+		}
+
+		t := r.broker.topic(r.topic, r.broker.DefaultPartitions)
+		for i := range assigned {
+			p := assigned[(r.next+i)%len(assigned)]
+			if r.positions[p] < int64(len(t.partitions[p])) {
+				msg := t.partitions[p][r.positions[p]]
+				r.positions[p]++
+				r.next = (r.next + i + 1) % len(assigned)
+				r.broker.Unlock()
+				return msg, nil
+			}
+		}
+
+		changed := r.broker.changed
+		r.broker.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		}
+	}
+}
+
+// CommitMessages commits the offsets after the messages for the consumer group. Messages of partitions not
+// assigned to the reader, because the group rebalanced, are not committed and kafka.RebalanceInProgress is
+// returned.
+func (r *Reader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.broker.Lock()
+	defer r.broker.Unlock()
+
+	if r.closed {
+		return io.EOF
+	}
+
+	g := r.broker.group(r.groupID, r.topic)
+	assigned := map[int]bool{}
+	for _, p := range g.assignments[r] {
+		assigned[p] = true
+	}
+
+	for _, msg := range msgs {
+		if r.generation != g.generation || !assigned[msg.Partition] {
+			return kafka.RebalanceInProgress
+		}
+		if msg.Offset+1 > g.offsets[msg.Partition] {
+			g.offsets[msg.Partition] = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+// Stats returns the lag of the assigned partitions from the committed offsets, the other statistics are zero
+func (r *Reader) Stats() kafka.ReaderStats {
+	r.broker.Lock()
+	defer r.broker.Unlock()
+
+	stats := kafka.ReaderStats{Topic: r.topic, Partition: "-1"}
+	g := r.broker.group(r.groupID, r.topic)
+	t := r.broker.topic(r.topic, r.broker.DefaultPartitions)
+	for _, p := range g.assignments[r] {
+		stats.Lag += int64(len(t.partitions[p])) - g.offsets[p]
+	}
+	return stats
+}
+
+// PartitionLag returns the number of messages not committed of each assigned partition
+func (r *Reader) PartitionLag(ctx context.Context) (map[int]int64, error) {
+	r.broker.Lock()
+	defer r.broker.Unlock()
+
+	g := r.broker.group(r.groupID, r.topic)
+	t := r.broker.topic(r.topic, r.broker.DefaultPartitions)
+	lag := make(map[int]int64, len(g.assignments[r]))
+	for _, p := range g.assignments[r] {
+		lag[p] = int64(len(t.partitions[p])) - g.offsets[p]
+	}
+	return lag, nil
+}
+
+// Close leaves the consumer group, rebalancing the group
+func (r *Reader) Close() error {
+	r.broker.Lock()
+	defer r.broker.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	g := r.broker.group(r.groupID, r.topic)
+	for i, m := range g.members {
+		if m == r {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			break
+		}
+	}
+	r.broker.rebalance(g, r.topic)
+	return nil
+}
+
+// Partitions returns the partitions assigned to the reader, sorted
+func (r *Reader) Partitions() []int {
+	r.broker.Lock()
+	defer r.broker.Unlock()
+	partitions := append([]int(nil), r.broker.group(r.groupID, r.topic).assignments[r]...)
+	sort.Ints(partitions)
+	return partitions
+}
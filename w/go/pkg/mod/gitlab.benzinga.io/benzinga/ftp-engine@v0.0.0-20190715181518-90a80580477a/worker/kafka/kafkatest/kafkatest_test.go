@@ -0,0 +1,84 @@
+package kafkatest
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker()
+	b.CreateTopic("events", 2)
+
+	w := b.NewWriter("events")
+	require.NoError(t, w.WriteMessages(ctx, kafka.Message{Value: []byte("a")}, kafka.Message{Value: []byte("b")}, kafka.Message{Value: []byte("c")}))
+	assert.Len(t, b.Messages("events", 0), 2, "messages without a key are written round robin")
+	assert.Len(t, b.Messages("events", 1), 1)
+
+	// Keyed messages are written to the same partition
+	require.NoError(t, w.WriteMessages(ctx, kafka.Message{Key: []byte("k"), Value: []byte("d")}, kafka.Message{Key: []byte("k"), Value: []byte("e")}))
+	msgs := b.AllMessages("events")
+	require.Len(t, msgs, 5)
+
+	r1 := b.NewReader("group", "events")
+	assert.Equal(t, []int{0, 1}, r1.Partitions())
+	assert.Equal(t, int64(5), b.Lag("group", "events"))
+
+	// Fetch and commit the first message
+	msg, err := r1.FetchMessage(ctx)
+	require.NoError(t, err)
+	require.NoError(t, r1.CommitMessages(ctx, msg))
+	assert.Equal(t, int64(4), b.Lag("group", "events"))
+
+	// Fetched but uncommitted messages are fetched again by the new owner after a rebalance
+	uncommitted, err := r1.FetchMessage(ctx)
+	require.NoError(t, err)
+
+	r2 := b.NewReader("group", "events")
+	assert.Equal(t, [][]int{{0}, {1}}, b.Assignments("group", "events"))
+	assert.Equal(t, kafka.RebalanceInProgress, r1.CommitMessages(ctx, uncommitted), "commit after rebalance")
+
+	require.NoError(t, r1.Close())
+	assert.Equal(t, []int{0, 1}, r2.Partitions())
+
+	var fetched []kafka.Message
+	for i := 0; i < 4; i++ {
+		msg, err := r2.FetchMessage(ctx)
+		require.NoError(t, err)
+		fetched = append(fetched, msg)
+	}
+	require.NoError(t, r2.CommitMessages(ctx, fetched...))
+	assert.Equal(t, int64(0), b.Lag("group", "events"))
+	assert.Contains(t, fetched, uncommitted)
+
+	// Fetch waits for new messages
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteMessages(ctx, kafka.Message{Value: []byte("f")})
+	}()
+	msg, err = r2.FetchMessage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "f", string(msg.Value))
+
+	// Fetch returns when ctx is done
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = r2.FetchMessage(timeout)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	require.NoError(t, r2.Close())
+	_, err = r2.FetchMessage(ctx)
+	assert.Equal(t, io.EOF, err)
+
+	// Other groups consume from the start
+	r3 := b.NewReader("other", "events")
+	msg, err = r3.FetchMessage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), msg.Offset)
+}
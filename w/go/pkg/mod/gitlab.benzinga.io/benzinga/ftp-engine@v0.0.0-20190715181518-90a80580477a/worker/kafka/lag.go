@@ -0,0 +1,135 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var _ = Reader(&groupReader{})    // check interface
+var _ = consumer(&kafka.Reader{}) // check interface
+
+// consumer is the kafka.Reader consumer group API wrapped by groupReader
+type consumer interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Stats() kafka.ReaderStats
+	Close() error
+}
+
+// lastOffsetFunc returns the high watermark of the partition, the offset of the next message written to it
+type lastOffsetFunc func(ctx context.Context, partition int) (int64, error)
+
+// groupReader reports the lag of each partition of a consumer group reader, which does not expose its assigned
+// partitions or the committed offsets. The committed offset of a partition is the offset of its first fetched
+// message, the offset the reader started from, until the reader commits it. Partitions are forgotten after a
+// rebalance, until a message of theirs is fetched again.
+type groupReader struct {
+	consumer
+	lastOffset lastOffsetFunc
+
+	mu sync.Mutex
+	// committed are the committed next offset of the partitions fetched since the last rebalance
+	committed map[int]int64
+}
+
+func newGroupReader(c consumer, lastOffset lastOffsetFunc) *groupReader {
+	return &groupReader{consumer: c, lastOffset: lastOffset, committed: map[int]int64{}}
+}
+
+// FetchMessage ...
+func (r *groupReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	msg, err := r.consumer.FetchMessage(ctx)
+	if err != nil {
+		return msg, err
+	}
+
+	r.mu.Lock()
+	if _, ok := r.committed[msg.Partition]; !ok {
+		r.committed[msg.Partition] = msg.Offset
+	}
+	r.mu.Unlock()
+	return msg, nil
+}
+
+// CommitMessages ...
+func (r *groupReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := r.consumer.CommitMessages(ctx, msgs...); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	for _, msg := range msgs {
+		if offset, ok := r.committed[msg.Partition]; !ok || msg.Offset+1 > offset {
+			r.committed[msg.Partition] = msg.Offset + 1
+		}
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// Stats returns the reader statistics, the fetched partitions are forgotten if the group rebalanced
+func (r *groupReader) Stats() kafka.ReaderStats {
+	stats := r.consumer.Stats()
+	if stats.Rebalances > 0 {
+		r.mu.Lock()
+		r.committed = map[int]int64{}
+		r.mu.Unlock()
+	}
+	return stats
+}
+
+// PartitionLag returns the high watermark less the committed offset of the partitions fetched since the last
+// rebalance
+func (r *groupReader) PartitionLag(ctx context.Context) (map[int]int64, error) {
+	r.mu.Lock()
+	committed := make(map[int]int64, len(r.committed))
+	for p, offset := range r.committed {
+		committed[p] = offset
+	}
+	r.mu.Unlock()
+
+	lag := make(map[int]int64, len(committed))
+	for p, offset := range committed {
+		last, err := r.lastOffset(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		// A stale partition leader can return an earlier high watermark
+		lag[p] = last - offset
+		if lag[p] < 0 {
+			lag[p] = 0
+		}
+	}
+	return lag, nil
+}
+
+// leaderLastOffset returns a lastOffsetFunc reading the high watermark from the partition leader of the topic, the
+// brokers are tried in order
+func leaderLastOffset(dialer *kafka.Dialer, brokers []string, topic string) lastOffsetFunc {
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+	return func(ctx context.Context, partition int) (int64, error) {
+		var err error
+		for _, broker := range brokers {
+			var conn *kafka.Conn
+			if conn, err = dialer.DialLeader(ctx, "tcp", broker, topic, partition); err != nil {
+				continue
+			}
+			var last int64
+			if deadline, ok := ctx.Deadline(); ok {
+				err = conn.SetDeadline(deadline)
+			}
+			if err == nil {
+				last, err = conn.ReadLastOffset()
+			}
+			conn.Close()
+			if err == nil {
+				return last, nil
+			}
+		}
+		return 0, err
+	}
+}
@@ -0,0 +1,75 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/kafka/kafkatest"
+)
+
+// rebalancedConsumer reports a rebalance in its statistics
+type rebalancedConsumer struct {
+	consumer
+}
+
+func (c rebalancedConsumer) Stats() kafka.ReaderStats {
+	return kafka.ReaderStats{Rebalances: 1}
+}
+
+func TestGroupReaderLag(t *testing.T) {
+	ctx := context.Background()
+	broker := kafkatest.NewBroker()
+	broker.CreateTopic("events", 2)
+	require.NoError(t, broker.NewWriter("events").WriteMessages(ctx, kafka.Message{}, kafka.Message{}, kafka.Message{}, kafka.Message{}))
+
+	var lastOffsetErr error
+	lastOffset := func(ctx context.Context, partition int) (int64, error) {
+		return int64(len(broker.Messages("events", partition))), lastOffsetErr
+	}
+	r := newGroupReader(broker.NewReader("group", "events"), lastOffset)
+	defer r.Close()
+
+	// No partition is known before a fetch
+	lag, err := r.PartitionLag(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, lag)
+
+	// The first fetched message is the committed offset until it is committed
+	msg, err := r.FetchMessage(ctx)
+	require.NoError(t, err)
+	lag, err = r.PartitionLag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{msg.Partition: 2}, lag)
+
+	require.NoError(t, r.CommitMessages(ctx, msg))
+	lag, err = r.PartitionLag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{msg.Partition: 1}, lag)
+
+	// Fetched messages are not committed
+	for i := 0; i < 3; i++ {
+		_, err := r.FetchMessage(ctx)
+		require.NoError(t, err)
+	}
+	lag, err = r.PartitionLag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{msg.Partition: 1, 1 - msg.Partition: 2}, lag)
+	assert.Equal(t, broker.Lag("group", "events"), lag[0]+lag[1])
+
+	lastOffsetErr = errors.New("leader not available")
+	_, err = r.PartitionLag(ctx)
+	assert.Equal(t, lastOffsetErr, err)
+	lastOffsetErr = nil
+
+	// Partitions are forgotten after a rebalance
+	r.consumer = rebalancedConsumer{r.consumer}
+	assert.Equal(t, int64(1), r.Stats().Rebalances)
+	lag, err = r.PartitionLag(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, lag)
+}
@@ -0,0 +1,339 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+)
+
+// replayFetchTimeout is how long a partition replay waits for the next message before ending
+const replayFetchTimeout = 30 * time.Second
+
+// ReplayOptions select the messages replayed, messages must match every option given
+type ReplayOptions struct {
+	// Partitions to replay, all partitions of the topic if empty
+	Partitions []int
+	// From and To limit messages by Kafka message time, zero values are unbounded
+	From time.Time
+	To   time.Time
+	// StartOffset and EndOffset limit messages by offset (inclusive) in each partition, negative values are unbounded
+	StartOffset int64
+	EndOffset   int64
+	// NodeIDs limits replay to events for these nodes, all nodes if empty
+	NodeIDs []int64
+	// Rate is the maximum number of files sent per second, unlimited if 0
+	Rate float64
+}
+
+// ReplayStats counts replayed messages
+type ReplayStats struct {
+	Read     int
+	Sent     int
+	Skipped  int // not in NodeIDs
+	Rejected int // rejected by the envelope checks or destination filters
+	Errors   int
+}
+
+// Replayer re-sends events from the Kafka topic to the destination. It reads partitions directly without a
+// consumer group, so the offsets of the worker consumer group are not changed.
+type Replayer struct {
+	log       *zap.Logger
+	cfg       *config.Config
+	dialer    *kafka.Dialer
+	keyring   *bzkaf.Keyring
+	processor process.Processor
+	sender    sender.Sender
+	opts      ReplayOptions
+	nodeIDs   map[int64]bool
+	limiter   <-chan time.Time
+}
+
+// NewReplayer ...
+func NewReplayer(cfg *config.Config, logger *zap.Logger, s sender.Sender, p process.Processor, opts ReplayOptions) (*Replayer, error) {
+	if !opts.From.IsZero() && !opts.To.IsZero() && opts.To.Before(opts.From) {
+		return nil, errors.New("replay to time is before from time")
+	}
+	if opts.StartOffset >= 0 && opts.EndOffset >= 0 && opts.EndOffset < opts.StartOffset {
+		return nil, errors.New("replay end offset is before start offset")
+	}
+	if opts.Rate < 0 {
+		return nil, errors.New("replay rate must not be negative")
+	}
+
+	replayLog := logger.Named("replay:kafka")
+
+	dialer, err := loadDialer(cfg, replayLog)
+	if err != nil {
+		return nil, err
+	}
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+
+	keyring, err := worker.LoadKeyring(cfg, replayLog)
+	if err != nil {
+		return nil, err
+	}
+
+	r := Replayer{
+		log:       replayLog,
+		cfg:       cfg,
+		dialer:    dialer,
+		keyring:   keyring,
+		processor: p,
+		sender:    s,
+		opts:      opts,
+	}
+
+	if len(opts.NodeIDs) > 0 {
+		r.nodeIDs = make(map[int64]bool, len(opts.NodeIDs))
+		for _, id := range opts.NodeIDs {
+			r.nodeIDs[id] = true
+		}
+	}
+
+	return &r, nil
+}
+
+// Run replays every selected partition in turn
+func (r *Replayer) Run(ctx context.Context) (*ReplayStats, error) {
+	if r.opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / r.opts.Rate))
+		defer ticker.Stop()
+		r.limiter = ticker.C
+	}
+
+	partitions := r.opts.Partitions
+	if len(partitions) == 0 {
+		var err error
+		if partitions, err = r.readPartitions(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var stats ReplayStats
+	for _, partition := range partitions {
+		if err := r.replayPartition(ctx, partition, &stats); err != nil {
+			return &stats, err
+		}
+	}
+
+	return &stats, nil
+}
+
+func (r *Replayer) readPartitions(ctx context.Context) ([]int, error) {
+	conn, err := r.dialer.DialContext(ctx, "tcp", r.cfg.Kafka.Brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ps, err := conn.ReadPartitions(r.cfg.Kafka.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]int, 0, len(ps))
+	for _, p := range ps {
+		partitions = append(partitions, p.ID)
+	}
+	return partitions, nil
+}
+
+// offsets returns the first and last (exclusive) offsets of the partition to replay
+func (r *Replayer) offsets(ctx context.Context, partition int) (int64, int64, error) {
+	conn, err := r.dialer.DialLeader(ctx, "tcp", r.cfg.Kafka.Brokers[0], r.cfg.Kafka.Topic, partition)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+
+	start, err := conn.ReadFirstOffset()
+	if err != nil {
+		return 0, 0, err
+	}
+	// The last offset is the offset of the next message, replay does not wait for new messages
+	end, err := conn.ReadLastOffset()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if r.opts.StartOffset > start {
+		start = r.opts.StartOffset
+	}
+	if !r.opts.From.IsZero() {
+		offset, err := conn.ReadOffset(r.opts.From)
+		if err != nil {
+			return 0, 0, err
+		}
+		if offset > start {
+			start = offset
+		}
+	}
+	if r.opts.EndOffset >= 0 && r.opts.EndOffset+1 < end {
+		end = r.opts.EndOffset + 1
+	}
+
+	return start, end, nil
+}
+
+func (r *Replayer) replayPartition(ctx context.Context, partition int, stats *ReplayStats) error {
+	partitionLog := r.log.With(zap.String("topic", r.cfg.Kafka.Topic), zap.Int("partition", partition))
+
+	start, end, err := r.offsets(ctx, partition)
+	if err != nil {
+		partitionLog.Error("Read Partition Offsets Error", zap.Error(err))
+		return err
+	}
+	if start >= end {
+		partitionLog.Info("No Messages To Replay", zap.Int64("start_offset", start), zap.Int64("end_offset", end))
+		return nil
+	}
+	partitionLog.Info("Replaying Partition", zap.Int64("start_offset", start), zap.Int64("end_offset", end))
+
+	// No GroupID, messages are read without joining or committing to a consumer group
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   r.cfg.Kafka.Brokers,
+		Topic:     r.cfg.Kafka.Topic,
+		Partition: partition,
+		Dialer:    r.dialer,
+		MaxWait:   time.Second,
+		MinBytes:  10e3, // 10KB
+		MaxBytes:  10e8, // 100MB
+	})
+	defer func() {
+		if err := reader.Close(); err != nil {
+			partitionLog.Error("Reader Close Error", zap.Error(err))
+		}
+	}()
+
+	if err := reader.SetOffset(start); err != nil {
+		return err
+	}
+
+	for {
+		if reader.Offset() >= end {
+			return nil
+		}
+
+		// The end offset may never be fetched if it is a transaction marker or was compacted away
+		fetchCtx, cancel := context.WithTimeout(ctx, replayFetchTimeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			partitionLog.Warn("Replay End Offset Not Reached", zap.Int64("offset", reader.Offset()), zap.Int64("end_offset", end), zap.Duration("fetch_timeout", replayFetchTimeout))
+			return nil
+		}
+		if err != nil {
+			partitionLog.Error("Fetch Message Error", zap.Error(err))
+			return err
+		}
+		if msg.Offset >= end {
+			return nil
+		}
+		// Message time is set by the producer, so replay stops at the first message after To
+		if !r.opts.To.IsZero() && msg.Time.After(r.opts.To) {
+			partitionLog.Info("Replay To Time Reached", zap.Int64("offset", msg.Offset), zap.Time("msg_time", msg.Time))
+			return nil
+		}
+
+		if err := r.replay(ctx, msg, stats); err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if msg.Offset+1 >= end {
+			return nil
+		}
+	}
+}
+
+// replay decodes, filters, converts and sends a single message, send errors are counted and returned
+func (r *Replayer) replay(ctx context.Context, msg kafka.Message, stats *ReplayStats) error {
+	stats.Read++
+
+	var envelope bzkaf.Envelope
+	envelopeErr := json.Unmarshal(msg.Value, &envelope)
+	span, subCtx := envelope.StartSpanFromContext(ctx, "Replay Kafka Message")
+	defer span.Finish()
+	span.LogFields(otlog.Int64("offset", msg.Offset), otlog.String("topic", msg.Topic), otlog.Int("partition", msg.Partition))
+
+	msgLog := r.log.With(zap.Int64("offset", msg.Offset), zap.Int("partition", msg.Partition), zap.Time("msg_time", msg.Time))
+
+	if envelopeErr != nil {
+		stats.Errors++
+		span.LogFields(otlog.Error(envelopeErr))
+		msgLog.Error("Unmarshal Kafka Envelope Error", zap.Error(envelopeErr))
+		return envelopeErr
+	}
+	msgLog = msgLog.With(zap.String("envelope_id", envelope.ID))
+
+	if !worker.IsEventMsgType(envelope.MessageType) {
+		stats.Rejected++
+		msgLog.Info("Ignoring Message, invalid message type", zap.String("message_type", envelope.MessageType.String()))
+		return nil
+	}
+
+	if reason, err := worker.VerifyEnvelope(r.keyring, r.cfg.Kafka.RequireSignature, &envelope); err != nil {
+		stats.Rejected++
+		msgLog.Warn("Envelope Signature Rejected", zap.Error(err), zap.String("reason", reason))
+		return nil
+	}
+
+	event, err := worker.DecodeEvent(&envelope)
+	if err != nil {
+		stats.Errors++
+		span.LogFields(otlog.Error(err))
+		msgLog.Error("Decode Kafka Envelope Event Error", zap.Error(err))
+		return err
+	}
+	msgLog = msgLog.With(zap.Int64("event_id", event.ID), zap.Int64("node_id", event.NodeID))
+
+	if r.nodeIDs != nil && !r.nodeIDs[event.NodeID] {
+		stats.Skipped++
+		return nil
+	}
+
+	if reason := process.Filter(&r.cfg.Processor, event); reason != "" {
+		stats.Rejected++
+		msgLog.Info("Ignoring Event", zap.Stringer("reason", reason))
+		return nil
+	}
+
+	output, err := r.processor.Convert(event)
+	if err != nil {
+		stats.Errors++
+		span.LogFields(otlog.Error(err))
+		msgLog.Error("Processor Error", zap.Error(err))
+		return err
+	}
+
+	if r.limiter != nil {
+		select {
+		case <-r.limiter:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := r.sender.Send(subCtx, output); err != nil {
+		stats.Errors++
+		span.LogFields(otlog.Error(err))
+		msgLog.Error("Send Error", zap.Error(err))
+		return fmt.Errorf("send %s: %s", output.Filename, err)
+	}
+
+	stats.Sent++
+	msgLog.Info("Event Replayed", zap.String("filename", output.Filename), zap.Int("size", output.Size))
+	return nil
+}
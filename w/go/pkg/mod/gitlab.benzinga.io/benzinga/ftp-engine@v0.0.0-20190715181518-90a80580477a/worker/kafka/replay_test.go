@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+func newTestReplayMessage(t *testing.T, event *models.Event, offset int64) kafka.Message {
+	envelope, err := worker.NewEventEnvelope(event, bzkaf.LZ4MsgpackEncoding)
+	require.NoError(t, err)
+	data, err := envelope.Marshal()
+	require.NoError(t, err)
+	return kafka.Message{Offset: offset, Value: data}
+}
+
+func TestReplay(t *testing.T) {
+	cfg := &config.Config{
+		Kafka:     config.KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "ftp-engine"},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+
+	wanted := workertest.NewEvent()
+	wanted.Event = models.Created
+	other := workertest.NewEvent()
+	other.Event = models.Created
+	removed := workertest.NewEvent()
+	removed.NodeID = wanted.NodeID
+	removed.Event = models.Removed
+
+	s := &workertest.Sender{}
+	r, err := NewReplayer(cfg, zap.NewNop(), s, workertest.Processor{}, ReplayOptions{StartOffset: -1, EndOffset: -1, NodeIDs: []int64{wanted.NodeID}})
+	require.NoError(t, err)
+
+	var stats ReplayStats
+	ctx := context.Background()
+	require.NoError(t, r.replay(ctx, newTestReplayMessage(t, wanted, 1), &stats))
+	require.NoError(t, r.replay(ctx, newTestReplayMessage(t, other, 2), &stats))
+	require.NoError(t, r.replay(ctx, newTestReplayMessage(t, removed, 3), &stats))
+	assert.Error(t, r.replay(ctx, kafka.Message{Offset: 4, Value: []byte("not json")}, &stats))
+
+	assert.Equal(t, ReplayStats{Read: 4, Sent: 1, Skipped: 1, Rejected: 1, Errors: 1}, stats)
+	require.Len(t, s.Sent, 1)
+	assert.Equal(t, wanted.Content.Title+".xml", s.Sent[0].Filename)
+
+	s.Err = errors.New("connection refused")
+	assert.Error(t, r.replay(ctx, newTestReplayMessage(t, wanted, 5), &stats))
+	assert.Equal(t, 2, stats.Errors)
+}
+
+func TestReplayOptions(t *testing.T) {
+	cfg := &config.Config{Kafka: config.KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "ftp-engine"}}
+
+	_, err := NewReplayer(cfg, zap.NewNop(), &workertest.Sender{}, workertest.Processor{}, ReplayOptions{StartOffset: 10, EndOffset: 5})
+	assert.Error(t, err, "end offset before start")
+
+	_, err = NewReplayer(cfg, zap.NewNop(), &workertest.Sender{}, workertest.Processor{}, ReplayOptions{StartOffset: -1, EndOffset: -1, Rate: -1})
+	assert.Error(t, err, "negative rate")
+}
@@ -0,0 +1,251 @@
+package kafka
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	filedriver "github.com/goftp/file-driver"
+	"github.com/goftp/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process/ravenpack"
+	"gitlab.benzinga.io/benzinga/ftp-engine/rstore"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender/ftp"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/kafka/kafkatest"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+	"gitlab.benzinga.io/benzinga/reference-service/reference"
+)
+
+// newHermeticConfig returns a worker config that needs no external services, FTP files are sent to a goftp
+// server on port
+func newHermeticConfig(t *testing.T, port int) *config.Config {
+	bufferPath, err := ioutil.TempDir("", "ftp-engine-deliveries")
+	require.NoError(t, err)
+
+	return &config.Config{
+		AppName:  config.AppName,
+		AppBuild: "testing",
+		AppEnv:   config.TestingEnv,
+		Processor: config.ProcessorConfig{
+			Type:           config.RavenpackProcessor,
+			AcceptedEvents: []models.EventType{models.Created, models.Updated, models.Removed},
+		},
+		Source: config.SourceConfig{Type: config.KafkaSource},
+		Kafka:  config.KafkaConfig{Topic: "ftp-testing", GroupID: "ftp-engine-hermetic"},
+		FTP: config.FTPConfig{
+			Host:        "localhost:" + strconv.Itoa(port),
+			Path:        "/",
+			Username:    "benzinga",
+			Password:    "testing",
+			ConnTimeout: 5 * time.Second,
+		},
+		Delivery: config.DeliveryConfig{
+			Topic:         config.DefaultDeliveryTopic,
+			BufferPath:    bufferPath,
+			RetryInterval: time.Second,
+		},
+	}
+}
+
+// startTestFTPServer serves root on the port of cfg.FTP.Host and returns a sender connected to it
+func startTestFTPServer(t *testing.T, cfg *config.Config, logger *zap.Logger, root string, port int) (sender.Sender, func()) {
+	factory := &filedriver.FileDriverFactory{
+		RootPath: root,
+		Perm:     server.NewSimplePerm("user", "group"),
+	}
+
+	ftpServer := server.NewServer(&server.ServerOpts{
+		Factory:  factory,
+		Port:     port,
+		Hostname: "127.0.0.1",
+		Auth:     &server.SimpleAuth{Name: cfg.FTP.Username, Password: cfg.FTP.Password},
+	})
+	go ftpServer.ListenAndServe()
+
+	// Wait for the server to accept connections
+	var s sender.Sender
+	var err error
+	for i := 0; i < 50; i++ {
+		if s, err = ftp.NewFTPSender(cfg, logger); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err, "Connect Test FTP Server Error")
+
+	return s, func() {
+		s.Close()
+		ftpServer.Shutdown()
+	}
+}
+
+// waitFor polls cond until it is true or the timeout is reached
+func waitFor(t *testing.T, timeout time.Duration, msg string, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			require.FailNow(t, "timed out waiting for "+msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func writeTestEvents(t *testing.T, w *kafkatest.Writer, n int) []*models.Event {
+	encodings := []bzkaf.Encoding{bzkaf.JSONEncoding, bzkaf.LZ4MsgpackEncoding}
+
+	var events []*models.Event
+	for i := 0; i < n; i++ {
+		event := workertest.NewEvent()
+		envelope, err := worker.NewEventEnvelope(event, encodings[i%len(encodings)])
+		require.NoError(t, err)
+		data, err := envelope.Marshal()
+		require.NoError(t, err)
+
+		require.NoError(t, w.WriteMessages(context.Background(), kafka.Message{Key: []byte(strconv.FormatInt(event.NodeID, 10)), Value: data}))
+		events = append(events, event)
+	}
+	return events
+}
+
+// TestWorkerHermetic runs the worker pipeline end to end with in-memory Kafka and reference store, and a
+// goftp server, including consumer group rebalances as workers join and leave
+func TestWorkerHermetic(t *testing.T) {
+	const port = 12346
+
+	cfg := newHermeticConfig(t, port)
+	defer os.RemoveAll(cfg.Delivery.BufferPath)
+
+	root, err := ioutil.TempDir("", "ftp-engine-hermetic")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	logger := zap.NewNop()
+	s, stop := startTestFTPServer(t, cfg, logger, root, port)
+	defer stop()
+
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+
+	store := rstore.NewMemory(logger)
+	require.NoError(t, store.PutSymbolCurrency(context.Background(), &reference.Instrument{Symbol: "F", CurrencyID: "USD", Exchange: "NYSE", ISIN: "US3453708600"}))
+	processor := ravenpack.NewRavenpackProcessor(cfg, rstore.NewResolver(logger, store, rstore.ResolverOptions{}, nil), logger)
+
+	broker := kafkatest.NewBroker()
+	broker.CreateTopic(cfg.Kafka.Topic, 4)
+	producer := broker.NewWriter(cfg.Kafka.Topic)
+
+	startWorker := func(ctx context.Context) (*kafkatest.Reader, chan struct{}) {
+		r := broker.NewReader(cfg.Kafka.GroupID, cfg.Kafka.Topic)
+		w, err := NewWorker(cfg, logger, inst, s, processor, nil, r, broker.NewWriter(cfg.Delivery.Topic))
+		require.NoError(t, err)
+
+		done := make(chan struct{})
+		go func() {
+			w.Work(ctx)
+			close(done)
+		}()
+		return r, done
+	}
+	consumed := func() bool { return broker.Lag(cfg.Kafka.GroupID, cfg.Kafka.Topic) == 0 }
+
+	// Single worker consumes every partition
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	readerA, doneA := startWorker(ctxA)
+	assert.Equal(t, []int{0, 1, 2, 3}, readerA.Partitions())
+
+	events := writeTestEvents(t, producer, 8)
+	waitFor(t, 10*time.Second, "first events", consumed)
+
+	// Second worker joins, partitions are shared
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	readerB, doneB := startWorker(ctxB)
+	assert.Equal(t, []int{0, 1}, readerA.Partitions())
+	assert.Equal(t, []int{2, 3}, readerB.Partitions())
+
+	events = append(events, writeTestEvents(t, producer, 8)...)
+	waitFor(t, 10*time.Second, "events after join", consumed)
+
+	// First worker leaves, the second takes over its partitions
+	cancelA()
+	<-doneA
+	assert.Equal(t, []int{0, 1, 2, 3}, readerB.Partitions())
+
+	events = append(events, writeTestEvents(t, producer, 8)...)
+	waitFor(t, 10*time.Second, "events after leave", consumed)
+
+	cancelB()
+	<-doneB
+
+	// Every event is delivered once
+	for _, event := range events {
+		data, err := ioutil.ReadFile(filepath.Join(root, "benzinga_"+strconv.Itoa(event.Content.NodeID)+"_"+strconv.FormatInt(event.Content.UpdatedAt.Unix(), 10)+"_rss2.xml"))
+		require.NoError(t, err, "event file delivered")
+		assert.Contains(t, string(data), "US3453708600", "ticker ISIN from reference store")
+	}
+
+	deliveries := broker.AllMessages(cfg.Delivery.Topic)
+	require.Len(t, deliveries, len(events))
+	_, record, err := bzkaf.DecodeFTPDelivery(deliveries[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Kafka.GroupID, record.ConsumerGroupID)
+}
+
+func TestWorkerCheck(t *testing.T) {
+	cfg := newHermeticConfig(t, 0)
+	defer os.RemoveAll(cfg.Delivery.BufferPath)
+	cfg.Ready.MaxLag = 2
+
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+
+	broker := kafkatest.NewBroker()
+	broker.CreateTopic(cfg.Kafka.Topic, 2)
+	r := broker.NewReader(cfg.Kafka.GroupID, cfg.Kafka.Topic)
+	w, err := NewWorker(cfg, zap.NewNop(), inst, &workertest.Sender{}, workertest.Processor{}, nil, r, broker.NewWriter(cfg.Delivery.Topic))
+	require.NoError(t, err)
+	defer w.Disconnect()
+
+	check := w.Check(context.Background())
+	assert.Equal(t, worker.CheckOK, check.Status)
+	assert.Equal(t, int64(0), check.Details["lag"])
+
+	writeTestEvents(t, broker.NewWriter(cfg.Kafka.Topic), 3)
+	check = w.Check(context.Background())
+	assert.Equal(t, worker.CheckDegraded, check.Status, "lag is more than the max lag")
+	assert.Equal(t, int64(3), check.Details["lag"])
+	assert.Equal(t, cfg.Kafka.Topic, check.Details["topic"])
+
+	// The lag metric is by partition
+	lag, err := r.PartitionLag(context.Background())
+	require.NoError(t, err)
+	require.Len(t, lag, 2)
+	for p, l := range lag {
+		assert.Equal(t, float64(l), testutil.ToFloat64(inst.ConsumerLag.WithLabelValues(cfg.Kafka.GroupID, cfg.Kafka.Topic, strconv.Itoa(p))), "partition %d lag", p)
+	}
+
+	// Partitions assigned to another member after a rebalance have no lag metric
+	other := broker.NewReader(cfg.Kafka.GroupID, cfg.Kafka.Topic)
+	defer other.Close()
+	w.Check(context.Background())
+	require.Len(t, r.Partitions(), 1)
+	revoked := other.Partitions()[0]
+	assert.False(t, inst.ConsumerLag.Delete(w.partitionLabels(revoked)), "revoked partition metric is deleted")
+	assert.True(t, inst.ConsumerLag.Delete(w.partitionLabels(r.Partitions()[0])))
+}
@@ -0,0 +1,558 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/history"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender"
+)
+
+// Recorder records FTP delivery record envelopes
+type Recorder interface {
+	Record(ctx context.Context, envelope *bzkaf.Envelope) error
+}
+
+// History stores the sent and failed deliveries of each event, see history.Store
+type History interface {
+	Add(ctx context.Context, d *history.Delivery) error
+}
+
+// Status is the outcome of handling a message
+type Status string
+
+const (
+	// Sent messages were converted, sent and acknowledged
+	Sent Status = "sent"
+	// Rejected messages were acknowledged without sending, see Result Reason
+	Rejected Status = "rejected"
+	// Invalid messages could not be decoded and were not acknowledged
+	Invalid Status = "invalid"
+	// Failed messages could not be converted or sent and were not acknowledged
+	Failed Status = "failed"
+	// Paused messages were not handled because the pipeline is paused, see Pipeline.Pause
+	Paused Status = "paused"
+)
+
+// Message is a message received from a source
+type Message struct {
+	// Value is the JSON bzkaf.Envelope
+	Value []byte
+	// Received is when the source received the message, the start of the processing latency
+	Received time.Time
+	// Log has the source fields of the message, ex. Kafka offset
+	Log *zap.Logger
+	// SpanFields are the source fields logged on the message span
+	SpanFields []otlog.Field
+	// Ack acknowledges the message to the source, it is called for sent and rejected messages
+	Ack func(ctx context.Context) error
+	// Trusted messages were built by the worker, ex. resends, their signature is not verified
+	Trusted bool
+}
+
+// Result of handling a message
+type Result struct {
+	Status Status
+	// Reason is the ContentRejected reason of rejected messages
+	Reason   string
+	Envelope *bzkaf.Envelope
+	Event    *models.Event
+	Output   *process.Output
+	Err      error
+}
+
+// Pipeline decodes, filters, converts, sends and records messages independent of the source they are received
+// from. Metrics are labeled with the Kafka group ID and source name, the topic for the Kafka source.
+type Pipeline struct {
+	log    *zap.Logger
+	cfg    *config.Config
+	instr  *instr.Collector
+	labels prometheus.Labels
+	// sendLabels are labels with the destination, the FTP host
+	sendLabels prometheus.Labels
+	processor  process.Processor
+	sender     sender.Sender
+	// recorder publishes delivery records, nil when deliveries are not recorded
+	recorder Recorder
+	// history stores sent and failed deliveries, nil when they are not stored
+	history History
+	// keyring verifies envelope signatures, nil when signatures are not verified
+	keyring *bzkaf.Keyring
+	// auditor publishes audit records, nil unless EnableAudit was called
+	auditor Auditor
+
+	// started is when the pipeline was created, Check uses it until the first send
+	started time.Time
+	// lastSent is the unix nanoseconds of the last send, accessed atomically
+	lastSent int64
+
+	pauseMu sync.Mutex
+	// resumed is closed on resume, nil when not paused
+	resumed  chan struct{}
+	pausedAt time.Time
+}
+
+// re: pauseMu, the admin API pauses and resumes the pipeline while sources wait on it
+
+// NewPipeline ...
+func NewPipeline(cfg *config.Config, logger *zap.Logger, inst *instr.Collector, s sender.Sender, p process.Processor, r Recorder, h History, source string) (*Pipeline, error) {
+	keyring, err := LoadKeyring(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pipeline{
+		log:        logger.Named("pipeline"),
+		cfg:        cfg,
+		instr:      inst,
+		labels:     prometheus.Labels{"kafka_group_id": cfg.Kafka.GroupID, "kafka_topic": source},
+		sendLabels: prometheus.Labels{"kafka_group_id": cfg.Kafka.GroupID, "kafka_topic": source, "destination": cfg.FTP.Host},
+		processor:  p,
+		sender:     s,
+		recorder:   r,
+		history:    h,
+		keyring:    keyring,
+		started:    time.Now(),
+	}, nil
+}
+
+// EnableAudit publishes the audit record of each message with a, it must be called before messages are handled
+func (p *Pipeline) EnableAudit(a Auditor) {
+	p.auditor = a
+}
+
+// Labels returns the metric labels of the pipeline source, for source metrics such as receive errors
+func (p *Pipeline) Labels() prometheus.Labels {
+	return p.labels
+}
+
+// LastSent returns when a message was last sent, zero if none was sent since the pipeline started
+func (p *Pipeline) LastSent() time.Time {
+	if nanos := atomic.LoadInt64(&p.lastSent); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+// Check reports the time since the last send, degraded if it is more than maxAge and the pipeline is not
+// paused. The start of the pipeline is used until the first send. maxAge 0 is never degraded.
+func (p *Pipeline) Check(maxAge time.Duration) Check {
+	check := Check{Status: CheckOK, Details: map[string]interface{}{}}
+
+	since := p.started
+	if lastSent := p.LastSent(); !lastSent.IsZero() {
+		since = lastSent
+		check.Details["last_sent"] = lastSent.UTC()
+	}
+	age := time.Since(since)
+	check.Details["since_last_sent"] = age.Round(time.Second).String()
+
+	paused, pausedAt := p.Paused()
+	check.Details["paused"] = paused
+	if paused {
+		check.Details["paused_since"] = pausedAt
+	} else if maxAge > 0 && age > maxAge {
+		check.Status = CheckDegraded
+		check.Error = "nothing sent for " + age.Round(time.Second).String()
+	}
+
+	return check
+}
+
+// Pause stops sources from receiving messages until Resume, messages being handled are completed. Sources wait in
+// WaitResumed, the Kafka source keeps its consumer group membership while waiting. Pause returns false if the
+// pipeline was already paused.
+func (p *Pipeline) Pause() bool {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	if p.resumed != nil {
+		return false
+	}
+	p.resumed = make(chan struct{})
+	p.pausedAt = time.Now().UTC()
+	return true
+}
+
+// Resume lets sources receive messages again, it returns false if the pipeline was not paused
+func (p *Pipeline) Resume() bool {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	if p.resumed == nil {
+		return false
+	}
+	close(p.resumed)
+	p.resumed = nil
+	p.pausedAt = time.Time{}
+	return true
+}
+
+// Paused returns whether the pipeline is paused and since when
+func (p *Pipeline) Paused() (bool, time.Time) {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	return p.resumed != nil, p.pausedAt
+}
+
+// WaitResumed blocks while the pipeline is paused, it returns the ctx error if ctx is done first
+func (p *Pipeline) WaitResumed(ctx context.Context) error {
+	p.pauseMu.Lock()
+	resumed := p.resumed
+	p.pauseMu.Unlock()
+	if resumed == nil {
+		return ctx.Err()
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resend re-renders and delivers the event through the pipeline, as a new JSON envelope that is not acknowledged to
+// the source. Resends are filtered like any message but are not signed, so their signature is not verified, and
+// are sent even if the pipeline is paused. requestedBy
+// identifies who asked for the resend in the log.
+func (p *Pipeline) Resend(ctx context.Context, event *models.Event, requestedBy string) *Result {
+	resendLog := p.log.With(zap.Int64("event_id", event.ID), zap.Int64("node_id", event.NodeID), zap.String("requested_by", requestedBy))
+
+	envelope, err := NewEventEnvelope(event, bzkaf.JSONEncoding)
+	var value []byte
+	if err == nil {
+		value, err = envelope.Marshal()
+	}
+	if err != nil {
+		resendLog.Error("Resend Envelope Error", zap.Error(err))
+		return &Result{Status: Invalid, Event: event, Err: err}
+	}
+
+	result := p.Handle(ctx, "Resend Message", &Message{
+		Value:      value,
+		Received:   time.Now(),
+		Log:        resendLog.With(zap.Bool("resend", true)),
+		SpanFields: []otlog.Field{otlog.Bool("resend", true), otlog.String("requested_by", requestedBy)},
+		Trusted:    true,
+	})
+
+	fields := []zap.Field{zap.String("status", string(result.Status)), zap.String("envelope_id", envelope.ID)}
+	if result.Reason != "" {
+		fields = append(fields, zap.String("reason", result.Reason))
+	}
+	if result.Err != nil {
+		fields = append(fields, zap.Error(result.Err))
+	}
+	if result.Output != nil {
+		fields = append(fields, zap.String("filename", result.Output.Filename), zap.String("sha256_checksum", result.Output.Checksum), zap.Int("size_bytes", result.Output.Size))
+	}
+	resendLog.Info("Event Resent", fields...)
+
+	return result
+}
+
+// Handle processes the message in a span named operationName, continuing the trace of the envelope. The outcome
+// of each stage is logged as a single "Message Audit" line, and published if audit is enabled.
+func (p *Pipeline) Handle(ctx context.Context, operationName string, msg *Message) *Result {
+	var result Result
+	audit := &AuditRecord{
+		GroupID:     p.cfg.Kafka.GroupID,
+		Source:      p.labels["kafka_topic"],
+		Destination: p.sendLabels["destination"],
+		Received:    msg.Received,
+	}
+
+	// Unmarshal Envelope, done before starting the message span so it continues the upstream trace
+	start := time.Now()
+	var envelope bzkaf.Envelope
+	envelopeErr := json.Unmarshal(msg.Value, &envelope)
+	span, subCtx := envelope.StartSpanFromContext(ctx, operationName)
+	defer span.Finish()
+
+	p.instr.ContentAccepted.With(p.labels).Inc()
+	msgLog := msg.Log.With(zap.String("kafka_group_id", p.cfg.Kafka.GroupID))
+	span.LogFields(msg.SpanFields...)
+	span.LogFields(otlog.String("group_id", p.cfg.Kafka.GroupID))
+	msgLog.Debug("Message Received")
+	defer func() {
+		p.audit(subCtx, msgLog, audit, &result)
+	}()
+
+	// Check Envelope
+	if envelopeErr != nil {
+		span.LogFields(otlog.Error(envelopeErr))
+		msgLog.Error("Unmarshal Envelope Error", zap.Error(envelopeErr))
+		audit.stage(EnvelopeStage, start, Error, InvalidEnvelopeReason, envelopeErr)
+		return p.invalid(audit, &result, InvalidEnvelopeReason, envelopeErr)
+	}
+	result.Envelope = &envelope
+	audit.EnvelopeID = envelope.ID
+	msgLog = msgLog.With(zap.String("envelope_id", envelope.ID))
+	msgLog.Debug("Message Envelope Unmarshaled")
+
+	if !IsEventMsgType(envelope.MessageType) {
+		// This should never happen unless there is an issue with source configuration
+		msgLog.Error("Invalid Message Type", zap.String("message_type", envelope.MessageType.String()))
+		audit.stage(EnvelopeStage, start, Reject, InvalidMessageTypeReason, nil)
+		return p.reject(subCtx, msgLog, msg, audit, &result, InvalidMessageTypeReason)
+	}
+	audit.stage(EnvelopeStage, start, OK, "", nil)
+
+	// Verify Envelope Signature
+	if !msg.Trusted {
+		start = time.Now()
+		if reason, err := VerifyEnvelope(p.keyring, p.cfg.Kafka.RequireSignature, &envelope); err != nil {
+			span.LogFields(otlog.Error(err))
+			msgLog.Warn("Envelope Signature Rejected", zap.Error(err))
+			audit.stage(SignatureStage, start, Reject, reason, err)
+			return p.reject(subCtx, msgLog, msg, audit, &result, reason)
+		}
+		audit.stage(SignatureStage, start, OK, "", nil)
+	}
+
+	// Decode Event by envelope schema version and encoding
+	start = time.Now()
+	event, err := DecodeEvent(&envelope)
+	if err != nil {
+		span.LogFields(otlog.Error(err))
+		msgLog.Error("Decode Envelope Event Error", zap.Error(err), zap.Int("version", envelope.SchemaVersion()), zap.Stringer("encoding", envelope.Encoding))
+		audit.stage(DecodeStage, start, Error, InvalidEventReason, err)
+		return p.invalid(audit, &result, InvalidEventReason, err)
+	}
+	audit.stage(DecodeStage, start, OK, "", nil)
+	result.Event = event
+	audit.EventID, audit.NodeID, audit.EventType = event.ID, event.NodeID, string(event.Event)
+
+	span.LogFields(otlog.Int64("event_id", event.ID), otlog.Int64("node_id", event.NodeID), otlog.String("envelope_id", envelope.ID), otlog.String("event_type", string(event.Event)))
+	msgLog = msgLog.With(zap.Int64("event_id", event.ID), zap.Int64("node_id", event.NodeID))
+	msgLog.Debug("Event Unmarshaled")
+
+	// Filter Event
+	start = time.Now()
+	if reason := process.Filter(&p.cfg.Processor, event); reason != "" {
+		// Rejected, acknowledged, but was not sent
+		span.LogFields(otlog.String("reject_reason", reason.String()), otlog.String("content_type", event.Content.Type), otlog.String("event_content_updated_at", event.Content.UpdatedAt.String()))
+		msgLog.Info("Ignoring Event", zap.Stringer("reason", reason), zap.String("content_type", event.Content.Type), zap.String("event_type", string(event.Event)), zap.Time("event_content_updated_at", event.Content.UpdatedAt.Time))
+		audit.stage(FilterStage, start, Reject, reason.String(), nil)
+		return p.reject(subCtx, msgLog, msg, audit, &result, reason.String())
+	}
+	audit.stage(FilterStage, start, OK, "", nil)
+
+	// Process & Send
+	output, err := p.processAndSend(subCtx, event, msg.Received, audit)
+	if output != nil {
+		audit.Filename = output.Filename
+	}
+	if err != nil {
+		span.LogFields(otlog.Error(err))
+		msgLog.Error("Processor/Send Error", zap.Error(err))
+		p.instr.ContentSendErrors.With(p.labels).Inc()
+		p.addHistory(subCtx, Failed, &envelope, event, output, err, msg.Received)
+		result.Status, result.Err = Failed, err
+		return &result
+	}
+	p.addHistory(subCtx, Sent, &envelope, event, output, nil, msg.Received)
+	result.Status, result.Output = Sent, output
+	atomic.StoreInt64(&p.lastSent, time.Now().UnixNano())
+	msgLog.Debug("Content Sent")
+	p.instr.ContentSent.With(p.labels).Inc()
+
+	// Acknowledge
+	p.ack(subCtx, msgLog, msg, audit)
+	p.instr.ContentProcessingLatency.With(p.labels).Observe(time.Since(msg.Received).Seconds())
+
+	return &result
+}
+
+// audit logs the audit record of the handled message, and publishes it if audit is enabled
+func (p *Pipeline) audit(ctx context.Context, msgLog *zap.Logger, audit *AuditRecord, result *Result) {
+	audit.Status, audit.Duration = result.Status, time.Since(audit.Received)
+	if result.Status == Rejected {
+		audit.Reason = result.Reason
+	}
+	if result.Err != nil {
+		audit.Error = result.Err.Error()
+	}
+
+	msgLog.Info("Message Audit", zap.Object("audit", audit))
+
+	if p.auditor != nil {
+		if err := p.auditor.Audit(ctx, audit); err != nil {
+			msgLog.Error("Publish Audit Record Error", zap.Error(err))
+		}
+	}
+}
+
+// invalid counts messages that could not be decoded, they are not acknowledged
+func (p *Pipeline) invalid(audit *AuditRecord, result *Result, reason string, err error) *Result {
+	audit.Reason = reason
+	p.instr.ContentInvalid.With(prometheus.Labels{"kafka_group_id": p.labels["kafka_group_id"], "kafka_topic": p.labels["kafka_topic"], "reason": reason}).Inc()
+	result.Status, result.Err = Invalid, err
+	return result
+}
+
+func (p *Pipeline) reject(ctx context.Context, msgLog *zap.Logger, msg *Message, audit *AuditRecord, result *Result, reason string) *Result {
+	p.instr.ContentRejected.With(prometheus.Labels{"kafka_group_id": p.labels["kafka_group_id"], "kafka_topic": p.labels["kafka_topic"], "reason": reason}).Inc()
+	p.ack(ctx, msgLog, msg, audit)
+	result.Status, result.Reason = Rejected, reason
+	return result
+}
+
+func (p *Pipeline) ack(ctx context.Context, msgLog *zap.Logger, msg *Message, audit *AuditRecord) {
+	start := time.Now()
+	if msg.Ack != nil {
+		if err := msg.Ack(ctx); err != nil {
+			msgLog.Error("Acknowledge Error", zap.Error(err))
+			audit.stage(AckStage, start, Error, "", err)
+		} else {
+			audit.stage(AckStage, start, OK, "", nil)
+		}
+	}
+	p.instr.ContentAcknowledged.With(p.labels).Inc()
+	msgLog.Debug("Message Acknowledged", zap.Duration("total_latency", time.Since(msg.Received)))
+}
+
+func (p *Pipeline) processAndSend(ctx context.Context, event *models.Event, start time.Time, audit *AuditRecord) (*process.Output, error) {
+	stageStart := time.Now()
+	output, err := p.processor.Convert(event)
+	if err != nil {
+		audit.stage(ConvertStage, stageStart, Error, "", err)
+		return nil, err
+	}
+	audit.stage(ConvertStage, stageStart, OK, "", nil)
+
+	stageStart = time.Now()
+	if err := p.sender.Send(ctx, output); err != nil {
+		audit.stage(SendStage, stageStart, Error, "", err)
+		// The output is returned for the attempts made
+		return output, err
+	}
+	p.observeSend(event, output, time.Since(stageStart))
+	audit.stage(SendStage, stageStart, OK, "", nil)
+
+	if p.recorder != nil {
+		stageStart = time.Now()
+		if err := p.recordFTPDelivery(ctx, output, event, start); err != nil {
+			p.log.Error("Record FTP Delivery Error", zap.Error(err))
+			audit.stage(RecordStage, stageStart, Error, "", err)
+		} else {
+			audit.stage(RecordStage, stageStart, OK, "", nil)
+		}
+	}
+	return output, nil
+}
+
+// observeSend records the upload metrics of the sent output, and the age of the event at delivery
+func (p *Pipeline) observeSend(event *models.Event, o *process.Output, d time.Duration) {
+	now := time.Now()
+	p.instr.SendDuration.With(p.sendLabels).Observe(d.Seconds())
+	p.instr.SendBytes.With(p.sendLabels).Observe(float64(o.Size))
+	p.instr.SendLastSuccess.With(prometheus.Labels{"kafka_group_id": p.labels["kafka_group_id"], "destination": p.sendLabels["destination"]}).Set(float64(now.Unix()))
+
+	ageLabels := func(since string) prometheus.Labels {
+		return prometheus.Labels{"kafka_group_id": p.labels["kafka_group_id"], "kafka_topic": p.labels["kafka_topic"], "since": since}
+	}
+	if !event.Time.IsZero() {
+		p.instr.ContentEventAge.With(ageLabels("event_time")).Observe(now.Sub(event.Time.Time).Seconds())
+	}
+	if !event.Content.UpdatedAt.IsZero() {
+		p.instr.ContentEventAge.With(ageLabels("content_updated_at")).Observe(now.Sub(event.Content.UpdatedAt.Time).Seconds())
+	}
+}
+
+func (p *Pipeline) recordFTPDelivery(ctx context.Context, o *process.Output, event *models.Event, start time.Time) error {
+	if p.recorder == nil {
+		return nil
+	}
+
+	record := FTPDeliveryRecord{
+		NodeID:          event.NodeID,
+		EventID:         event.ID,
+		EventType:       string(event.Event),
+		ConsumerGroupID: p.cfg.Kafka.GroupID,
+		ProcessorType:   p.cfg.Processor.Type.String(),
+		FTPHost:         p.cfg.FTP.Host,
+		FTPUsername:     p.cfg.FTP.Username,
+		FTPPath:         p.cfg.FTP.Path,
+		RemotePath:      path.Join(p.cfg.FTP.Path, o.Filename),
+		Filename:        o.Filename,
+		SHA256Checksum:  o.Checksum,
+		Timestamp:       time.Now().UTC(),
+		SizeBytes:       o.Size,
+		Attempts:        o.Attempts,
+		Latency:         time.Since(start),
+	}
+
+	envelope, err := newDeliveryEnvelope(ctx, &record)
+	if err != nil {
+		p.log.Error("New FTP Delivery Envelope Error", zap.Error(err))
+		return err
+	}
+
+	// Publish, or buffer until the delivery topic is available
+	if err := p.recorder.Record(ctx, envelope); err != nil {
+		return err
+	}
+
+	p.log.Debug("Delivery Recorded", zap.String("envelope.id", envelope.ID), zap.String("data.checksum", o.Checksum), zap.Int("data.size", o.Size), zap.Int("data.attempts", o.Attempts))
+
+	return nil
+}
+
+// addHistory stores the delivery, output is nil if the event failed to convert
+func (p *Pipeline) addHistory(ctx context.Context, status Status, envelope *bzkaf.Envelope, event *models.Event, o *process.Output, sendErr error, start time.Time) {
+	if p.history == nil {
+		return
+	}
+
+	d := history.Delivery{
+		EventID:    event.ID,
+		NodeID:     event.NodeID,
+		EnvelopeID: envelope.ID,
+		EventType:  string(event.Event),
+		Status:     string(status),
+		Timestamp:  time.Now().UTC(),
+		Latency:    time.Since(start),
+	}
+	if o != nil {
+		d.Filename = o.Filename
+		d.RemotePath = path.Join(p.cfg.FTP.Path, o.Filename)
+		d.Checksum = o.Checksum
+		d.SizeBytes = o.Size
+		d.Attempts = o.Attempts
+	}
+	if sendErr != nil {
+		d.Error = sendErr.Error()
+	}
+
+	if err := p.history.Add(ctx, &d); err != nil {
+		p.log.Error("Add Delivery History Error", zap.Error(err), zap.Int64("event_id", event.ID))
+	}
+}
+
+// newDeliveryEnvelope wraps the record in an envelope carrying the trace context of the span in ctx,
+// so the delivery record is part of the same trace as the source message
+func newDeliveryEnvelope(ctx context.Context, record *FTPDeliveryRecord) (*bzkaf.Envelope, error) {
+	envelope, err := bzkaf.Encode(bzkaf.FTPDelivery, 1, bzkaf.JSONEncoding, record)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := envelope.InjectFromContext(ctx); err != nil {
+		return nil, err
+	}
+
+	return envelope, nil
+}
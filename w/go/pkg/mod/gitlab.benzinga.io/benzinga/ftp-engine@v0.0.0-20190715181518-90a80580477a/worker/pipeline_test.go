@@ -0,0 +1,401 @@
+package worker
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/history"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+type testRecorder struct {
+	records []*bzkaf.Envelope
+}
+
+func (r *testRecorder) Record(ctx context.Context, envelope *bzkaf.Envelope) error {
+	r.records = append(r.records, envelope)
+	return nil
+}
+
+type testHistory struct {
+	deliveries []*history.Delivery
+}
+
+func (h *testHistory) Add(ctx context.Context, d *history.Delivery) error {
+	h.deliveries = append(h.deliveries, d)
+	return nil
+}
+
+func TestPipeline(t *testing.T) {
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		Kafka:     config.KafkaConfig{GroupID: "testing"},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+
+	s := &workertest.Sender{}
+	r := &testRecorder{}
+	h := &testHistory{}
+	p, err := NewPipeline(cfg, zap.NewNop(), inst, s, workertest.Processor{}, r, h, "testing")
+	require.NoError(t, err)
+
+	created := workertest.NewEvent()
+	removed := workertest.NewEvent()
+	removed.Event = models.Removed
+
+	encode := func(event *models.Event) []byte {
+		envelope, err := NewEventEnvelope(event, bzkaf.LZ4MsgpackEncoding)
+		require.NoError(t, err)
+		data, err := envelope.Marshal()
+		require.NoError(t, err)
+		return data
+	}
+	delivery, err := bzkaf.NewEnvelope(bzkaf.FTPDelivery, []byte(`{}`)).Marshal()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		value   []byte
+		sendErr error
+		status  Status
+		reason  string
+		acked   bool
+	}{
+		{"sent", encode(created), nil, Sent, "", true},
+		{"unwanted event type", encode(removed), nil, Rejected, "unwanted_event_type", true},
+		{"invalid message type", delivery, nil, Rejected, "invalid_evenlope_message_type", true},
+		{"invalid envelope", []byte("not json"), nil, Invalid, "", false},
+		{"send error", encode(created), errors.New("connection refused"), Failed, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.Err = tt.sendErr
+			var acked bool
+			result := p.Handle(context.Background(), "Test Message", &Message{
+				Value:    tt.value,
+				Received: time.Now(),
+				Log:      zap.NewNop(),
+				Ack: func(ctx context.Context) error {
+					acked = true
+					return nil
+				},
+			})
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, tt.reason, result.Reason)
+			assert.Equal(t, tt.acked, acked)
+			assert.Equal(t, tt.status == Invalid || tt.status == Failed, result.Err != nil)
+		})
+	}
+
+	require.Len(t, s.Sent, 1)
+	assert.Equal(t, created.Content.Title+".xml", s.Sent[0].Filename)
+
+	require.Len(t, r.records, 1, "only sent messages are recorded")
+	_, record, err := bzkaf.DecodeFTPDelivery(mustMarshal(t, r.records[0]))
+	require.NoError(t, err)
+	assert.Equal(t, created.NodeID, record.NodeID)
+	assert.Equal(t, "testing", record.ConsumerGroupID)
+	assert.Equal(t, s.Sent[0].Checksum, record.SHA256Checksum)
+
+	require.Len(t, h.deliveries, 2, "sent and failed messages are stored")
+	assert.Equal(t, string(Sent), h.deliveries[0].Status)
+	assert.Equal(t, created.ID, h.deliveries[0].EventID)
+	assert.Equal(t, created.NodeID, h.deliveries[0].NodeID)
+	assert.Equal(t, s.Sent[0].Checksum, h.deliveries[0].Checksum)
+	assert.Equal(t, s.Sent[0].Filename, h.deliveries[0].Filename)
+	assert.Empty(t, h.deliveries[0].Error)
+	assert.Equal(t, string(Failed), h.deliveries[1].Status)
+	assert.Equal(t, "connection refused", h.deliveries[1].Error)
+	assert.Equal(t, created.Content.Title+".xml", h.deliveries[1].Filename)
+}
+
+func TestPipelinePause(t *testing.T) {
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		Kafka:     config.KafkaConfig{GroupID: "testing"},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+	p, err := NewPipeline(cfg, zap.NewNop(), inst, &workertest.Sender{}, workertest.Processor{}, nil, nil, "testing")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, p.WaitResumed(ctx))
+	assert.False(t, p.Resume(), "not paused")
+
+	require.True(t, p.Pause())
+	assert.False(t, p.Pause(), "already paused")
+	paused, since := p.Paused()
+	assert.True(t, paused)
+	assert.False(t, since.IsZero())
+
+	// Sources wait until resumed or done
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.WaitResumed(timeout))
+
+	waited := make(chan error)
+	go func() {
+		waited <- p.WaitResumed(ctx)
+	}()
+	require.True(t, p.Resume())
+	select {
+	case err := <-waited:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("WaitResumed did not return on resume")
+	}
+	paused, _ = p.Paused()
+	assert.False(t, paused)
+}
+
+func TestPipelineResend(t *testing.T) {
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		Kafka:     config.KafkaConfig{GroupID: "testing"},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+
+	s := &workertest.Sender{}
+	h := &testHistory{}
+	p, err := NewPipeline(cfg, zap.NewNop(), inst, s, workertest.Processor{}, nil, h, "testing")
+	require.NoError(t, err)
+
+	// Resends are sent while paused
+	require.True(t, p.Pause())
+	event := workertest.NewEvent()
+	result := p.Resend(context.Background(), event, "127.0.0.1")
+	assert.Equal(t, Sent, result.Status)
+	require.Len(t, s.Sent, 1)
+	assert.Equal(t, event.Content.Title+".xml", s.Sent[0].Filename)
+	require.Len(t, h.deliveries, 1)
+	assert.Equal(t, event.ID, h.deliveries[0].EventID)
+
+	event.Event = models.Removed
+	result = p.Resend(context.Background(), event, "127.0.0.1")
+	assert.Equal(t, Rejected, result.Status, "resends are filtered")
+	assert.Len(t, s.Sent, 1)
+}
+
+func TestPipelineResendRequireSignature(t *testing.T) {
+	cfg := &config.Config{
+		AppName: config.AppName,
+		Kafka: config.KafkaConfig{
+			GroupID:          "testing",
+			SignatureKeys:    "2019-07:hmac-sha256:" + base64.StdEncoding.EncodeToString([]byte("ftp-engine-test-signature-secret")),
+			RequireSignature: true,
+		},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+
+	s := &workertest.Sender{}
+	p, err := NewPipeline(cfg, zap.NewNop(), inst, s, workertest.Processor{}, nil, nil, "testing")
+	require.NoError(t, err)
+
+	// Unsigned messages from the source are rejected
+	event := workertest.NewEvent()
+	envelope, err := NewEventEnvelope(event, bzkaf.JSONEncoding)
+	require.NoError(t, err)
+	result := p.Handle(context.Background(), "Test Message", &Message{Value: mustMarshal(t, envelope), Received: time.Now(), Log: zap.NewNop()})
+	require.Equal(t, Rejected, result.Status)
+	assert.Equal(t, "unsigned_envelope", result.Reason)
+
+	// Resends are built by the worker and not signed
+	result = p.Resend(context.Background(), event, "127.0.0.1")
+	assert.Equal(t, Sent, result.Status)
+	assert.Len(t, s.Sent, 1)
+}
+
+func TestPipelineCheck(t *testing.T) {
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		Kafka:     config.KafkaConfig{GroupID: "testing"},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+	p, err := NewPipeline(cfg, zap.NewNop(), inst, &workertest.Sender{}, workertest.Processor{}, nil, nil, "testing")
+	require.NoError(t, err)
+
+	assert.Equal(t, CheckOK, p.Check(0).Status, "never degraded without a max age")
+	assert.Equal(t, CheckOK, p.Check(time.Hour).Status, "age from start until the first send")
+	time.Sleep(5 * time.Millisecond)
+	check := p.Check(time.Millisecond)
+	assert.Equal(t, CheckDegraded, check.Status)
+	assert.NotEmpty(t, check.Error)
+
+	require.Equal(t, Sent, p.Resend(context.Background(), workertest.NewEvent(), "127.0.0.1").Status)
+	assert.False(t, p.LastSent().IsZero())
+	assert.Equal(t, CheckOK, p.Check(time.Hour).Status)
+
+	// Nothing is sent while paused
+	time.Sleep(5 * time.Millisecond)
+	require.True(t, p.Pause())
+	check = p.Check(time.Millisecond)
+	assert.Equal(t, CheckOK, check.Status)
+	assert.Equal(t, true, check.Details["paused"])
+}
+
+func TestPipelineMetrics(t *testing.T) {
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		Kafka:     config.KafkaConfig{GroupID: "testing-metrics"},
+		FTP:       config.FTPConfig{Host: "ftp.example.com:21"},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+	p, err := NewPipeline(cfg, zap.NewNop(), inst, &workertest.Sender{}, workertest.Processor{}, nil, nil, "testing")
+	require.NoError(t, err)
+
+	event := workertest.NewEvent()
+	event.Time = models.Time{Time: time.Now().Add(-time.Minute)}
+	event.Content.UpdatedAt = models.Time{Time: time.Now().Add(-time.Hour)}
+	require.Equal(t, Sent, p.Resend(context.Background(), event, "127.0.0.1").Status)
+
+	assert.InDelta(t, float64(time.Now().Unix()), testutil.ToFloat64(inst.SendLastSuccess.WithLabelValues(cfg.Kafka.GroupID, cfg.FTP.Host)), 1)
+
+	// Histogram sums by label values
+	sums := func(c prometheus.Collector) map[string]float64 {
+		reg := prometheus.NewRegistry()
+		require.NoError(t, reg.Register(c))
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		values := make(map[string]float64)
+		for _, family := range families {
+			for _, m := range family.GetMetric() {
+				var key string
+				for _, label := range m.GetLabel() {
+					key += label.GetValue() + "/"
+				}
+				values[key] = m.GetHistogram().GetSampleSum()
+			}
+		}
+		return values
+	}
+
+	age := sums(inst.ContentEventAge)
+	assert.InDelta(t, time.Minute.Seconds(), age["testing-metrics/testing/event_time/"], 1)
+	assert.InDelta(t, time.Hour.Seconds(), age["testing-metrics/testing/content_updated_at/"], 1)
+	assert.Equal(t, float64(len(event.Content.Body)), sums(inst.SendBytes)["ftp.example.com:21/testing-metrics/testing/"])
+	assert.Contains(t, sums(inst.SendDuration), "ftp.example.com:21/testing-metrics/testing/")
+}
+
+type testAuditor struct {
+	records []*AuditRecord
+}
+
+func (a *testAuditor) Audit(ctx context.Context, r *AuditRecord) error {
+	a.records = append(a.records, r)
+	return nil
+}
+
+func TestPipelineAudit(t *testing.T) {
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		Kafka:     config.KafkaConfig{GroupID: "testing-audit"},
+		FTP:       config.FTPConfig{Host: "ftp.example.com:21"},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+
+	s := &workertest.Sender{}
+	a := &testAuditor{}
+	p, err := NewPipeline(cfg, zap.NewNop(), inst, s, workertest.Processor{}, &testRecorder{}, nil, "testing")
+	require.NoError(t, err)
+	p.EnableAudit(a)
+
+	created := workertest.NewEvent()
+	removed := workertest.NewEvent()
+	removed.Event = models.Removed
+	encode := func(event *models.Event) []byte {
+		envelope, err := NewEventEnvelope(event, bzkaf.LZ4MsgpackEncoding)
+		require.NoError(t, err)
+		return mustMarshal(t, envelope)
+	}
+	undecodable := mustMarshal(t, bzkaf.NewEnvelope(bzkaf.ContentModelsEventMsgType, []byte(`"not an event"`)))
+
+	outcomes := func(r *AuditRecord) map[Stage]Outcome {
+		m := make(map[Stage]Outcome)
+		for _, stage := range r.Stages {
+			m[stage.Stage] = stage.Outcome
+		}
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		value    []byte
+		sendErr  error
+		status   Status
+		reason   string
+		outcomes map[Stage]Outcome
+	}{
+		{"sent", encode(created), nil, Sent, "", map[Stage]Outcome{EnvelopeStage: OK, SignatureStage: OK, DecodeStage: OK, FilterStage: OK, ConvertStage: OK, SendStage: OK, RecordStage: OK, AckStage: OK}},
+		{"unwanted event type", encode(removed), nil, Rejected, "unwanted_event_type", map[Stage]Outcome{EnvelopeStage: OK, SignatureStage: OK, DecodeStage: OK, FilterStage: Reject, AckStage: OK}},
+		{"invalid envelope", []byte("not json"), nil, Invalid, InvalidEnvelopeReason, map[Stage]Outcome{EnvelopeStage: Error}},
+		{"invalid event", undecodable, nil, Invalid, InvalidEventReason, map[Stage]Outcome{EnvelopeStage: OK, SignatureStage: OK, DecodeStage: Error}},
+		{"send error", encode(created), errors.New("connection refused"), Failed, "", map[Stage]Outcome{EnvelopeStage: OK, SignatureStage: OK, DecodeStage: OK, FilterStage: OK, ConvertStage: OK, SendStage: Error}},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.Err = tt.sendErr
+			p.Handle(context.Background(), "Test Message", &Message{
+				Value:    tt.value,
+				Received: time.Now(),
+				Log:      zap.NewNop(),
+				Ack:      func(ctx context.Context) error { return nil },
+			})
+			require.Len(t, a.records, i+1, "one record per message")
+			record := a.records[i]
+			assert.Equal(t, tt.status, record.Status)
+			assert.Equal(t, tt.reason, record.Reason)
+			assert.Equal(t, tt.outcomes, outcomes(record))
+			assert.Equal(t, "testing-audit", record.GroupID)
+			assert.Equal(t, "testing", record.Source)
+			assert.Equal(t, "ftp.example.com:21", record.Destination)
+			assert.Equal(t, tt.sendErr != nil || tt.status == Invalid, record.Error != "")
+			if tt.outcomes[DecodeStage] == OK {
+				assert.NotEmpty(t, record.EnvelopeID)
+				assert.NotZero(t, record.NodeID)
+				assert.NotEmpty(t, record.EventType)
+			}
+		})
+	}
+	assert.Equal(t, created.NodeID, a.records[0].NodeID)
+	assert.Equal(t, created.Content.Title+".xml", a.records[0].Filename)
+
+	// Decode errors are invalid messages, not receive errors
+	assert.Equal(t, float64(1), testutil.ToFloat64(inst.ContentInvalid.WithLabelValues("testing-audit", "testing", InvalidEnvelopeReason)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(inst.ContentInvalid.WithLabelValues("testing-audit", "testing", InvalidEventReason)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(inst.ContentReceiveErrors.WithLabelValues("testing-audit", "testing")))
+}
+
+func mustMarshal(t *testing.T, e *bzkaf.Envelope) []byte {
+	data, err := e.Marshal()
+	require.NoError(t, err)
+	return data
+}
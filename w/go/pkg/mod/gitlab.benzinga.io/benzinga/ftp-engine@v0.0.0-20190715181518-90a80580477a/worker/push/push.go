@@ -0,0 +1,147 @@
+package push
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/process"
+	"gitlab.benzinga.io/benzinga/ftp-engine/sender"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+)
+
+var _ = worker.Worker(&Worker{}) // check interface
+
+const (
+	// Source is the kafka_topic metric label of the HTTP push source
+	Source = "http"
+
+	// maxEnvelopeSize is the largest envelope accepted
+	maxEnvelopeSize = 100 << 20 // 100MB
+)
+
+// Worker accepts bzkaf.Envelope JSON POSTed to the API, the response acknowledges the envelope
+type Worker struct {
+	sync.Mutex
+	log      *zap.Logger
+	cfg      *config.Config
+	instr    *instr.Collector
+	pipeline *worker.Pipeline
+}
+
+// re: sync.Mutex, envelopes are handled one at a time in the order received, as the Kafka source does
+
+// NewPushWorker ... Delivery records are not published, the response includes the delivered file. Deliveries are
+// stored in h if not nil.
+func NewPushWorker(cfg *config.Config, logger *zap.Logger, inst *instr.Collector, s sender.Sender, p process.Processor, h worker.History) (*Worker, error) {
+	workerLog := logger.Named("worker:push")
+
+	pipe, err := worker.NewPipeline(cfg, workerLog, inst, s, p, nil, h, Source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Worker{log: workerLog, cfg: cfg, instr: inst, pipeline: pipe}, nil
+}
+
+// Pipeline ...
+func (w *Worker) Pipeline() *worker.Pipeline {
+	return w.pipeline
+}
+
+// Work waits until ctx is done, envelopes are received by ServeHTTP on the API server
+func (w *Worker) Work(ctx context.Context) {
+	w.log.Info("Accepting Pushed Envelopes")
+	<-ctx.Done()
+	w.log.Info("Receiver Context Done")
+}
+
+// Ack is the response to a pushed envelope. Sent and rejected envelopes are acknowledged with 200 OK and should
+// not be pushed again. Invalid envelopes are 400 Bad Request. Envelopes that failed to convert or send are
+// 503 Service Unavailable and can be pushed again, as can envelopes pushed while the worker is paused.
+type Ack struct {
+	Status     worker.Status `json:"status"`
+	Reason     string        `json:"reason,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	EnvelopeID string        `json:"envelope_id,omitempty"`
+	EventID    int64         `json:"event_id,omitempty"`
+	NodeID     int64         `json:"node_id,omitempty"`
+	Filename   string        `json:"filename,omitempty"`
+	Checksum   string        `json:"sha256_checksum,omitempty"`
+	Size       int           `json:"size_bytes,omitempty"`
+}
+
+// ServeHTTP handles a single envelope POSTed as the request body
+func (w *Worker) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		writeAck(rw, http.StatusMethodNotAllowed, &Ack{Status: worker.Invalid, Error: "method not allowed"})
+		return
+	}
+
+	received := time.Now()
+
+	if paused, _ := w.pipeline.Paused(); paused {
+		writeAck(rw, http.StatusServiceUnavailable, &Ack{Status: worker.Paused, Error: "worker is paused"})
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxEnvelopeSize))
+	if err != nil {
+		w.log.Error("Read Pushed Envelope Error", zap.Error(err))
+		w.instr.ContentReceiveErrors.With(w.pipeline.Labels()).Inc()
+		writeAck(rw, http.StatusBadRequest, &Ack{Status: worker.Invalid, Error: err.Error()})
+		return
+	}
+
+	w.Lock()
+	result := w.pipeline.Handle(r.Context(), "New Pushed Message", &worker.Message{
+		Value:      body,
+		Received:   received,
+		Log:        w.log.With(zap.String("remote_addr", r.RemoteAddr)),
+		SpanFields: []otlog.Field{otlog.String("remote_addr", r.RemoteAddr)},
+	})
+	w.Unlock()
+
+	ack := Ack{Status: result.Status, Reason: result.Reason}
+	if result.Err != nil {
+		ack.Error = result.Err.Error()
+	}
+	if result.Envelope != nil {
+		ack.EnvelopeID = result.Envelope.ID
+	}
+	if result.Event != nil {
+		ack.EventID, ack.NodeID = result.Event.ID, result.Event.NodeID
+	}
+	if result.Output != nil {
+		ack.Filename, ack.Checksum, ack.Size = result.Output.Filename, result.Output.Checksum, result.Output.Size
+	}
+
+	switch result.Status {
+	case worker.Invalid:
+		writeAck(rw, http.StatusBadRequest, &ack)
+	case worker.Failed:
+		writeAck(rw, http.StatusServiceUnavailable, &ack)
+	default:
+		writeAck(rw, http.StatusOK, &ack)
+	}
+}
+
+func writeAck(rw http.ResponseWriter, code int, ack *Ack) {
+	data, err := jsoniter.Marshal(ack)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	rw.Write(data)
+}
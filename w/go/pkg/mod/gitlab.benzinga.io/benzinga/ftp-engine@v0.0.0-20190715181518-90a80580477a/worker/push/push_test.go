@@ -0,0 +1,87 @@
+package push
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+	"gitlab.benzinga.io/benzinga/ftp-engine/instr"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+func TestPushWorker(t *testing.T) {
+	cfg := &config.Config{
+		AppName:   config.AppName,
+		Source:    config.SourceConfig{Type: config.HTTPSource},
+		Processor: config.ProcessorConfig{AcceptedEvents: []models.EventType{models.Created}},
+	}
+	inst, err := instr.NewCollector(cfg.AppName)
+	require.NoError(t, err)
+
+	s := &workertest.Sender{}
+	w, err := NewPushWorker(cfg, zap.NewNop(), inst, s, workertest.Processor{}, nil)
+	require.NoError(t, err)
+
+	event := workertest.NewEvent()
+	envelope, err := worker.NewEventEnvelope(event, bzkaf.JSONEncoding)
+	require.NoError(t, err)
+	data, err := envelope.Marshal()
+	require.NoError(t, err)
+
+	push := func(method string, body []byte) (int, Ack) {
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, httptest.NewRequest(method, "/events", bytes.NewReader(body)))
+		var ack Ack
+		require.NoError(t, jsoniter.Unmarshal(rec.Body.Bytes(), &ack))
+		return rec.Code, ack
+	}
+
+	code, ack := push(http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, worker.Sent, ack.Status)
+	assert.Equal(t, envelope.ID, ack.EnvelopeID)
+	assert.Equal(t, event.NodeID, ack.NodeID)
+	require.Len(t, s.Sent, 1)
+	assert.Equal(t, s.Sent[0].Filename, ack.Filename)
+	assert.Equal(t, s.Sent[0].Checksum, ack.Checksum)
+
+	code, ack = push(http.MethodPost, []byte("not json"))
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, worker.Invalid, ack.Status)
+	assert.NotEmpty(t, ack.Error)
+
+	s.Err = errors.New("connection refused")
+	code, ack = push(http.MethodPost, data)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "send errors can be retried")
+	assert.Equal(t, worker.Failed, ack.Status)
+
+	event.Event = models.Removed
+	removed, err := worker.NewEventEnvelope(event, bzkaf.JSONEncoding)
+	require.NoError(t, err)
+	data, err = removed.Marshal()
+	require.NoError(t, err)
+	code, ack = push(http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, worker.Rejected, ack.Status)
+	assert.Equal(t, "unwanted_event_type", ack.Reason)
+
+	code, _ = push(http.MethodGet, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+	require.True(t, w.Pipeline().Pause())
+	code, ack = push(http.MethodPost, data)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "envelopes pushed while paused can be retried")
+	assert.Equal(t, worker.Paused, ack.Status)
+	assert.Len(t, s.Sent, 1)
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"go.uber.org/zap"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/ftp-engine/config"
+)
+
+// LoadKeyring returns the keyring envelope signatures are verified with, nil if no signature keys are configured
+func LoadKeyring(cfg *config.Config, logger *zap.Logger) (*bzkaf.Keyring, error) {
+	if cfg.Kafka.SignatureKeys == "" {
+		return nil, nil
+	}
+
+	keyring, err := bzkaf.ParseKeyring(cfg.Kafka.SignatureKeys)
+	if err != nil {
+		logger.Error("Load Envelope Signature Keys Error", zap.Error(err))
+		return nil, err
+	}
+	logger.Info("Envelope signature verification enabled", zap.Int("keys", keyring.Len()), zap.Bool("require_signature", cfg.Kafka.RequireSignature))
+
+	return keyring, nil
+}
+
+// VerifyEnvelope checks the envelope signature when a keyring is given, returning the ContentRejected
+// reason and error for envelopes that should be rejected
+func VerifyEnvelope(keyring *bzkaf.Keyring, requireSignature bool, e *bzkaf.Envelope) (string, error) {
+	if keyring == nil {
+		return "", nil
+	}
+
+	err := keyring.Verify(e)
+	switch {
+	case err == nil:
+		return "", nil
+	case err == bzkaf.ErrUnsigned:
+		if !requireSignature {
+			return "", nil
+		}
+		return "unsigned_envelope", err
+	default:
+		return "invalid_envelope_signature", err
+	}
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+)
+
+func TestVerifyEnvelope(t *testing.T) {
+	secret := []byte("ftp-engine-test-signature-secret")
+	keyring := bzkaf.NewKeyring()
+	require.NoError(t, keyring.AddHMACKey("current", secret))
+
+	signed := bzkaf.NewEnvelope(bzkaf.ContentModelsEventMsgType, []byte(`{}`))
+	require.NoError(t, (&bzkaf.HMACSigner{KeyID: "current", Key: secret}).Sign(signed))
+
+	invalid := bzkaf.NewEnvelope(bzkaf.ContentModelsEventMsgType, []byte(`{}`))
+	require.NoError(t, (&bzkaf.HMACSigner{KeyID: "current", Key: []byte("ftp-engine-test-wrong-signature-s")}).Sign(invalid))
+
+	unknownKey := bzkaf.NewEnvelope(bzkaf.ContentModelsEventMsgType, []byte(`{}`))
+	require.NoError(t, (&bzkaf.HMACSigner{KeyID: "retired", Key: secret}).Sign(unknownKey))
+
+	unsigned := bzkaf.NewEnvelope(bzkaf.ContentModelsEventMsgType, []byte(`{}`))
+
+	tests := []struct {
+		name     string
+		keyring  *bzkaf.Keyring
+		require  bool
+		envelope *bzkaf.Envelope
+		reason   string
+	}{
+		{"verification disabled", nil, false, invalid, ""},
+		{"signed", keyring, false, signed, ""},
+		{"signed required", keyring, true, signed, ""},
+		{"invalid", keyring, false, invalid, "invalid_envelope_signature"},
+		{"unknown key", keyring, false, unknownKey, "invalid_envelope_signature"},
+		{"unsigned optional", keyring, false, unsigned, ""},
+		{"unsigned required", keyring, true, unsigned, "unsigned_envelope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := VerifyEnvelope(tt.keyring, tt.require, tt.envelope)
+			assert.Equal(t, tt.reason, reason)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
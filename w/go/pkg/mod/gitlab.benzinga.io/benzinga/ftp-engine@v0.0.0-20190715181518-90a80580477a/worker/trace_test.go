@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+
+	"gitlab.benzinga.io/benzinga/bzkaf"
+	"gitlab.benzinga.io/benzinga/ftp-engine/worker/workertest"
+)
+
+func TestTracePropagation(t *testing.T) {
+	reporter := jaeger.NewInMemoryReporter()
+	tracer, closer := jaeger.NewTracer("ftp-engine", jaeger.NewConstSampler(true), reporter)
+	defer closer.Close()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	// Upstream producer (content-engine)
+	upstream := tracer.StartSpan("content-engine")
+	content, err := jsoniter.Marshal(workertest.NewEvent())
+	require.NoError(t, err)
+	msg := bzkaf.NewEnvelope(bzkaf.ContentModelsEventMsgType, content)
+	require.NoError(t, msg.Inject(tracer, upstream.Context()))
+	upstream.Finish()
+
+	msgJSON, err := msg.Marshal()
+	require.NoError(t, err)
+
+	// Worker
+	received, err := bzkaf.UnmarshalEnvelope(msgJSON)
+	require.NoError(t, err)
+	span, ctx := received.StartSpanFromContext(context.Background(), "New Kafka Message")
+
+	delivery, err := newDeliveryEnvelope(ctx, &FTPDeliveryRecord{NodeID: 1})
+	require.NoError(t, err)
+	span.Finish()
+
+	// Delivery Log Consumer
+	deliveryJSON, err := delivery.Marshal()
+	require.NoError(t, err)
+	_, record, err := bzkaf.DecodeFTPDelivery(deliveryJSON)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), record.NodeID)
+
+	env, err := bzkaf.UnmarshalEnvelope(deliveryJSON)
+	require.NoError(t, err)
+	sc, err := env.Extract(tracer)
+	require.NoError(t, err)
+
+	upstreamCtx := upstream.Context().(jaeger.SpanContext)
+	workerCtx := span.Context().(jaeger.SpanContext)
+	assert.Equal(t, upstreamCtx.TraceID(), workerCtx.TraceID(), "worker continues upstream trace")
+	assert.Equal(t, upstreamCtx.TraceID(), sc.(jaeger.SpanContext).TraceID(), "delivery record carries upstream trace")
+	assert.Equal(t, workerCtx.SpanID(), sc.(jaeger.SpanContext).SpanID(), "delivery record carries worker span")
+	assert.Equal(t, 2, reporter.SpansSubmitted())
+}
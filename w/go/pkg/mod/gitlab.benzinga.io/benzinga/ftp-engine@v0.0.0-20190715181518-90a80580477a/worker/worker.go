@@ -2,25 +2,15 @@ package worker
 
 import (
 	"context"
-	"time"
 
-	"gitlab.benzinga.io/benzinga/content-models/models"
+	"gitlab.benzinga.io/benzinga/bzkaf"
 )
 
-type FTPDeliveryRecord struct {
-	NodeID          int64
-	EventID         int64
-	EventType       models.EventType
-	ConsumerGroupID string
-	FTPHost         string
-	FTPUsername     string
-	FTPPath         string
-	Filename        string
-	SHA256Checksum  string
-	Timestamp       time.Time
-	SizeBytes       int
-}
+// FTPDeliveryRecord is published for each file delivered, see bzkaf.DecodeFTPDelivery for consuming records
+type FTPDeliveryRecord = bzkaf.FTPDeliveryRecord
 
 type Worker interface {
 	Work(ctx context.Context)
+	// Pipeline is the pipeline messages are handled by, to pause and resend from the admin API
+	Pipeline() *Pipeline
 }